@@ -0,0 +1,271 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	envoyAccessLog "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoyFileAccessLog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	envoyGrpcAccessLog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	envoyStreamAccessLog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	"github.com/golang/protobuf/ptypes"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+)
+
+const (
+	// defaultAccessLogFormat is Envoy's default format of the access logs, without the trailing newline
+	defaultAccessLogFormat = "[%START_TIME%] \"%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%\" %RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% " +
+		"%DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% \"%REQ(X-FORWARDED-FOR)%\" \"%REQ(USER-AGENT)%\" \"%REQ(X-REQUEST-ID)%\" \"%REQ(:AUTHORITY)%\" \"%UPSTREAM_HOST%\""
+	// Citrix ADC limits the length of a string literal in an expression
+	maxExprLiteralLen = 255
+)
+
+// accessLogOperatorRegex matches the command operators of the access log format, e.g. %REQ(:PATH):10%
+var accessLogOperatorRegex = regexp.MustCompile(`%([A-Z0-9_]+)(\(([^)]*)\))?(:([0-9]+))?%`)
+
+// accessLogOperatorExprs maps the command operators of the access log format to the Citrix ADC expressions logging the same.
+// BYTES_RECEIVED and BYTES_SENT are not mapped, as the Content-Length of chunked bodies is not their length
+var accessLogOperatorExprs = map[string]string{
+	"START_TIME":                             "SYS.TIME",
+	"PROTOCOL":                               "\"HTTP/\" + HTTP.REQ.VERSION.MAJOR + \".\" + HTTP.REQ.VERSION.MINOR",
+	"RESPONSE_CODE":                          "HTTP.RES.STATUS",
+	"DOWNSTREAM_REMOTE_ADDRESS":              "CLIENT.IP.SRC + \":\" + CLIENT.TCP.SRCPORT",
+	"DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT": "CLIENT.IP.SRC",
+	"DOWNSTREAM_LOCAL_ADDRESS":               "CLIENT.IP.DST + \":\" + CLIENT.TCP.DSTPORT",
+	"DOWNSTREAM_LOCAL_ADDRESS_WITHOUT_PORT":  "CLIENT.IP.DST",
+	"DOWNSTREAM_PEER_SUBJECT":                "CLIENT.SSL.CLIENT_CERT.SUBJECT",
+	"DOWNSTREAM_PEER_URI_SAN":                nsconfigengine.ClientCertURISANExpr,
+	"REQUESTED_SERVER_NAME":                  "CLIENT.SSL.CLIENT_HELLO.SNI",
+	"UPSTREAM_HOST":                          "SERVER.IP.DST + \":\" + SERVER.TCP.DSTPORT",
+	"UPSTREAM_LOCAL_ADDRESS":                 "SERVER.IP.SRC + \":\" + SERVER.TCP.SRCPORT",
+	"UPSTREAM_CLUSTER":                       "HTTP.REQ.LB_VSERVER.NAME",
+}
+
+// requestPseudoHeaderExprs maps the pseudo headers of the request to the Citrix ADC expressions
+var requestPseudoHeaderExprs = map[string]string{
+	":path":      "HTTP.REQ.URL",
+	":method":    "HTTP.REQ.METHOD",
+	":authority": "HTTP.REQ.HOSTNAME",
+}
+
+// getExprLiteral returns the text as string literals of Citrix ADC expression, concatenated if the text is longer than a literal can be
+func getExprLiteral(text string) string {
+	text = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", " ").Replace(text)
+	literals := make([]string, 0, len(text)/maxExprLiteralLen+1)
+	for len(text) > maxExprLiteralLen {
+		// Escape sequence is not split across the literals
+		end := maxExprLiteralLen
+		if text[end-1] == '\\' && !strings.HasSuffix(text[:end-1], "\\") {
+			end--
+		}
+		literals = append(literals, "\""+text[:end]+"\"")
+		text = text[end:]
+	}
+	return strings.Join(append(literals, "\""+text+"\""), " + ")
+}
+
+// getHeaderOperatorExpr returns the expression of the header in the argument of REQ or RESP operator. Of the alternative headers in "X?Y",
+// Y is logged if X is a header added by Envoy, which Citrix ADC does not add
+func getHeaderOperatorExpr(operator, argument string) string {
+	headers := strings.SplitN(argument, "?", 2)
+	header := headers[0]
+	if len(headers) > 1 && strings.HasPrefix(strings.ToLower(header), "x-envoy-") {
+		header = headers[1]
+	}
+	if operator == "RESP" {
+		if strings.HasPrefix(header, ":") {
+			return ""
+		}
+		return "HTTP.RES.HEADER(\"" + header + "\")"
+	}
+	if strings.HasPrefix(header, ":") {
+		return requestPseudoHeaderExprs[strings.ToLower(header)]
+	}
+	return "HTTP.REQ.HEADER(\"" + header + "\")"
+}
+
+// getAccessLogExpr converts the access log format to the Citrix ADC expression logging the same for a request, or for a connection if tcp is set.
+// Command operators which can not be converted, and those of HTTP for a connection, are logged as "-", and returned as unsupported
+func getAccessLogExpr(format string, tcp bool) (string, []string) {
+	var parts, unsupported []string
+	literal := ""
+	for {
+		loc := accessLogOperatorRegex.FindStringSubmatchIndex(format)
+		if loc == nil {
+			break
+		}
+		literal = literal + format[:loc[0]]
+		operator, argument, maxLen := format[loc[2]:loc[3]], "", ""
+		if loc[6] >= 0 {
+			argument = format[loc[6]:loc[7]]
+		}
+		if loc[10] >= 0 {
+			maxLen = format[loc[10]:loc[11]]
+		}
+		expr := accessLogOperatorExprs[operator]
+		if operator == "REQ" || operator == "RESP" {
+			if expr = getHeaderOperatorExpr(operator, argument); expr != "" && maxLen != "" {
+				expr = expr + ".PREFIX(" + maxLen + ")"
+			}
+		}
+		if tcp && strings.Contains(expr, "HTTP.") {
+			expr = ""
+		}
+		if expr == "" {
+			unsupported = append(unsupported, format[loc[0]:loc[1]])
+			literal = literal + "-"
+		} else {
+			if literal != "" {
+				parts = append(parts, getExprLiteral(literal))
+				literal = ""
+			}
+			parts = append(parts, expr)
+		}
+		format = format[loc[1]:]
+	}
+	if literal = strings.TrimSuffix(literal+format, "\n"); literal != "" {
+		parts = append(parts, getExprLiteral(literal))
+	}
+	// Expression starts with a literal so that values of all types are concatenated as text
+	if len(parts) == 0 || !strings.HasPrefix(parts[0], "\"") {
+		parts = append([]string{"\"\""}, parts...)
+	}
+	return strings.Join(parts, " + "), unsupported
+}
+
+// getJSONAccessLogFormat returns the text format logging the JSON object of the JSON format, with its keys sorted
+func getJSONAccessLogFormat(jsonFormat *_struct.Struct) string {
+	keys := make([]string, 0, len(jsonFormat.GetFields()))
+	for key := range jsonFormat.GetFields() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := jsonFormat.GetFields()[key]
+		valueText := strconv.Quote(value.GetStringValue())
+		if _, ok := value.GetKind().(*_struct.Value_StringValue); !ok {
+			valueJSON, _ := json.Marshal(value.AsInterface())
+			valueText = string(valueJSON)
+		}
+		fields = append(fields, strconv.Quote(key)+":"+valueText)
+	}
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+// getSubstitutionFormat returns the text format of the substitution format string, or the default format if not set
+func getSubstitutionFormat(logFormat *core.SubstitutionFormatString) string {
+	if logFormat.GetJsonFormat() != nil {
+		return getJSONAccessLogFormat(logFormat.GetJsonFormat())
+	}
+	if format := logFormat.GetTextFormat(); format != "" {
+		return format
+	}
+	if format := logFormat.GetTextFormatSource().GetInlineString(); format != "" {
+		return format
+	}
+	return defaultAccessLogFormat
+}
+
+// getAccessLogFormat returns the text format of the file access log
+func getAccessLogFormat(fileAccessLog *envoyFileAccessLog.FileAccessLog) string {
+	if format := fileAccessLog.GetFormat(); format != "" {
+		return format
+	}
+	if fileAccessLog.GetJsonFormat() != nil {
+		return getJSONAccessLogFormat(fileAccessLog.GetJsonFormat())
+	}
+	if fileAccessLog.GetTypedJsonFormat() != nil {
+		return getJSONAccessLogFormat(fileAccessLog.GetTypedJsonFormat())
+	}
+	return getSubstitutionFormat(fileAccessLog.GetLogFormat())
+}
+
+// getAccessLogConfig converts the file and standard output access logs to the expressions logged by Citrix ADC for every request, or for every
+// connection if tcp is set, as audit messages. Requests logged by gRPC access log services are exported to the log proxy as AppFlow records
+// instead, and true is returned for them. Access log filters are not supported, and every request is logged
+func getAccessLogConfig(accessLogs []*envoyAccessLog.AccessLog, listenerName string, tcp bool) ([]string, bool) {
+	var logExprs []string
+	grpcAccessLog := false
+	for _, accessLog := range accessLogs {
+		if accessLog.GetFilter() != nil {
+			xDSLogger.Warn("getAccessLogConfig: Access log filter is not supported", "listenerName", listenerName, "accessLog", accessLog.GetName())
+		}
+		var format string
+		typedConfig := accessLog.GetTypedConfig()
+		switch {
+		case typedConfig.MessageIs(&envoyFileAccessLog.FileAccessLog{}):
+			fileAccessLog := &envoyFileAccessLog.FileAccessLog{}
+			if err := ptypes.UnmarshalAny(typedConfig, fileAccessLog); err != nil {
+				xDSLogger.Error("getAccessLogConfig: Error loading file access log", "listenerName", listenerName, "error", err)
+				continue
+			}
+			format = getAccessLogFormat(fileAccessLog)
+		case typedConfig.MessageIs(&envoyStreamAccessLog.StdoutAccessLog{}):
+			stdoutAccessLog := &envoyStreamAccessLog.StdoutAccessLog{}
+			if err := ptypes.UnmarshalAny(typedConfig, stdoutAccessLog); err != nil {
+				xDSLogger.Error("getAccessLogConfig: Error loading standard output access log", "listenerName", listenerName, "error", err)
+				continue
+			}
+			format = getSubstitutionFormat(stdoutAccessLog.GetLogFormat())
+		case typedConfig.MessageIs(&envoyStreamAccessLog.StderrAccessLog{}):
+			stderrAccessLog := &envoyStreamAccessLog.StderrAccessLog{}
+			if err := ptypes.UnmarshalAny(typedConfig, stderrAccessLog); err != nil {
+				xDSLogger.Error("getAccessLogConfig: Error loading standard error access log", "listenerName", listenerName, "error", err)
+				continue
+			}
+			format = getSubstitutionFormat(stderrAccessLog.GetLogFormat())
+		case typedConfig.MessageIs(&envoyGrpcAccessLog.HttpGrpcAccessLogConfig{}), typedConfig.MessageIs(&envoyGrpcAccessLog.TcpGrpcAccessLogConfig{}):
+			grpcAccessLog = true
+			continue
+		default:
+			xDSLogger.Warn("getAccessLogConfig: Access log type is not supported", "listenerName", listenerName, "accessLog", accessLog.GetName())
+			continue
+		}
+		logExpr, unsupported := getAccessLogExpr(format, tcp)
+		if len(unsupported) > 0 {
+			xDSLogger.Warn("getAccessLogConfig: Command operators of access log format are not supported and logged as '-'", "listenerName", listenerName, "operators", unsupported)
+		}
+		logExprs = append(logExprs, logExpr)
+	}
+	return logExprs, grpcAccessLog
+}
+
+// setAccessLogConfig sets the access logs of the CS vserver. Audit messages are logged for the requests of HTTP and SSL vservers,
+// and for the connections of TCP and SSL_TCP vservers. Requests logged by gRPC access log services are exported by the analytics
+// profiles of the log proxy, if configured
+func setAccessLogConfig(nsConfig *configAdaptor, csObj *nsconfigengine.CSApi, accessLogs []*envoyAccessLog.AccessLog, listenerName string) {
+	tcp := csObj.VserverType == "TCP" || csObj.VserverType == "SSL_TCP"
+	logExprs, grpcAccessLog := getAccessLogConfig(accessLogs, listenerName, tcp)
+	if tcp || csObj.VserverType == "HTTP" || csObj.VserverType == "SSL" {
+		csObj.AccessLogExprs = logExprs
+	} else if len(logExprs) > 0 {
+		xDSLogger.Warn("setAccessLogConfig: File access logs are not supported for the vserver type", "listenerName", listenerName, "vserverType", csObj.VserverType)
+	}
+	if grpcAccessLog {
+		if len(nsConfig.analyticsProfiles) == 0 {
+			xDSLogger.Warn("setAccessLogConfig: gRPC access log service requires the log proxy", "listenerName", listenerName)
+			return
+		}
+		csObj.AnalyticsProfileNames = nsConfig.analyticsProfiles
+	}
+}
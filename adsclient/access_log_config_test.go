@@ -0,0 +1,115 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	accesslog "github.com/envoyproxy/go-control-plane/envoy/config/accesslog/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	fileaccesslog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/file/v3"
+	grpcaccesslog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/grpc/v3"
+	streamaccesslog "github.com/envoyproxy/go-control-plane/envoy/extensions/access_loggers/stream/v3"
+	ptypes "github.com/golang/protobuf/ptypes"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+)
+
+func Test_getAccessLogExpr(t *testing.T) {
+	cases := []struct {
+		format              string
+		expectedExpr        string
+		expectedUnsupported []string
+	}{
+		{"%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %RESPONSE_CODE%\n", "\"\" + HTTP.REQ.METHOD + \" \" + HTTP.REQ.URL + \" \" + HTTP.RES.STATUS", nil},
+		{"[%START_TIME%] \"%REQ(USER-AGENT):10%\" %RESP(CONTENT-TYPE)%", "\"[\" + SYS.TIME + \"] \\\"\" + HTTP.REQ.HEADER(\"USER-AGENT\").PREFIX(10) + \"\\\" \" + HTTP.RES.HEADER(\"CONTENT-TYPE\")", nil},
+		{"%PROTOCOL% %DURATION% %UPSTREAM_HOST%", "\"HTTP/\" + HTTP.REQ.VERSION.MAJOR + \".\" + HTTP.REQ.VERSION.MINOR + \" - \" + SERVER.IP.DST + \":\" + SERVER.TCP.DSTPORT", []string{"%DURATION%"}},
+		{"%RESPONSE_FLAGS%", "\"-\"", []string{"%RESPONSE_FLAGS%"}},
+		{"%BYTES_RECEIVED% %DOWNSTREAM_PEER_URI_SAN%", "\"- \" + " + nsconfigengine.ClientCertURISANExpr, []string{"%BYTES_RECEIVED%"}},
+		{"", "\"\"", nil},
+	}
+	for _, c := range cases {
+		expr, unsupported := getAccessLogExpr(c.format, false)
+		if expr != c.expectedExpr || !reflect.DeepEqual(unsupported, c.expectedUnsupported) {
+			t.Errorf("Format %q: expected %s %v, received %s %v", c.format, c.expectedExpr, c.expectedUnsupported, expr, unsupported)
+		}
+	}
+	expr, unsupported := getAccessLogExpr("%DOWNSTREAM_REMOTE_ADDRESS% %REQ(:PATH)% %RESPONSE_CODE%", true)
+	if expr != "\"\" + CLIENT.IP.SRC + \":\" + CLIENT.TCP.SRCPORT + \" - -\"" || !reflect.DeepEqual(unsupported, []string{"%REQ(:PATH)%", "%RESPONSE_CODE%"}) {
+		t.Errorf("Unexpected expression of TCP access log: %s %v", expr, unsupported)
+	}
+}
+
+func Test_getExprLiteral(t *testing.T) {
+	long := make([]byte, maxExprLiteralLen+10)
+	for i := range long {
+		long[i] = 'a'
+	}
+	expected := "\"" + string(long[:maxExprLiteralLen]) + "\" + \"" + string(long[maxExprLiteralLen:]) + "\""
+	if output := getExprLiteral(string(long)); output != expected {
+		t.Errorf("Expected %s, received %s", expected, output)
+	}
+	if output := getExprLiteral("a\"b\\c"); output != "\"a\\\"b\\\\c\"" {
+		t.Errorf("Expected escaped literal, received %s", output)
+	}
+}
+
+func Test_getAccessLogConfig(t *testing.T) {
+	fileLog, _ := ptypes.MarshalAny(&fileaccesslog.FileAccessLog{Path: "/dev/stdout", AccessLogFormat: &fileaccesslog.FileAccessLog_LogFormat{LogFormat: &core.SubstitutionFormatString{
+		Format: &core.SubstitutionFormatString_TextFormatSource{TextFormatSource: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "%REQ(:PATH)%\n"}}}}}})
+	jsonLog, _ := ptypes.MarshalAny(&fileaccesslog.FileAccessLog{Path: "/dev/stdout", AccessLogFormat: &fileaccesslog.FileAccessLog_JsonFormat{JsonFormat: &_struct.Struct{Fields: map[string]*_struct.Value{
+		"status": {Kind: &_struct.Value_StringValue{StringValue: "%RESPONSE_CODE%"}},
+		"method": {Kind: &_struct.Value_StringValue{StringValue: "%REQ(:METHOD)%"}},
+	}}}})
+	stdoutLog, _ := ptypes.MarshalAny(&streamaccesslog.StdoutAccessLog{})
+	grpcLog, _ := ptypes.MarshalAny(&grpcaccesslog.HttpGrpcAccessLogConfig{})
+	cases := []struct {
+		input            []*accesslog.AccessLog
+		expectedLogExprs []string
+		expectedGrpc     bool
+	}{
+		{nil, nil, false},
+		{[]*accesslog.AccessLog{{Name: "envoy.access_loggers.file", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: fileLog}}}, []string{"\"\" + HTTP.REQ.URL"}, false},
+		{[]*accesslog.AccessLog{{Name: "envoy.access_loggers.file", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: jsonLog}},
+			{Name: "envoy.access_loggers.http_grpc", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: grpcLog}}},
+			[]string{"\"{\\\"method\\\":\\\"\" + HTTP.REQ.METHOD + \"\\\",\\\"status\\\":\\\"\" + HTTP.RES.STATUS + \"\\\"}\""}, true},
+		{[]*accesslog.AccessLog{{Name: "envoy.access_loggers.stdout", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: stdoutLog}}}, []string{func() string { expr, _ := getAccessLogExpr(defaultAccessLogFormat, false); return expr }()}, false},
+	}
+	for _, c := range cases {
+		logExprs, grpc := getAccessLogConfig(c.input, "listener1", false)
+		if !reflect.DeepEqual(logExprs, c.expectedLogExprs) || grpc != c.expectedGrpc {
+			t.Errorf("Expected %v %v, received %v %v", c.expectedLogExprs, c.expectedGrpc, logExprs, grpc)
+		}
+	}
+}
+
+func Test_setAccessLogConfig(t *testing.T) {
+	fileLog, _ := ptypes.MarshalAny(&fileaccesslog.FileAccessLog{Path: "/dev/stdout", AccessLogFormat: &fileaccesslog.FileAccessLog_Format{Format: "%RESPONSE_CODE%"}})
+	grpcLog, _ := ptypes.MarshalAny(&grpcaccesslog.TcpGrpcAccessLogConfig{})
+	accessLogs := []*accesslog.AccessLog{{Name: "envoy.access_loggers.file", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: fileLog}},
+		{Name: "envoy.access_loggers.tcp_grpc", ConfigType: &accesslog.AccessLog_TypedConfig{TypedConfig: grpcLog}}}
+	nsConfig := &configAdaptor{analyticsProfiles: []string{"ns_analytics_default_tcp_profile", "ns_analytics_default_http_profile"}}
+	httpObj := nsconfigengine.NewCSApi("cs_http", "HTTP", "1.1.1.1", 80)
+	setAccessLogConfig(nsConfig, httpObj, accessLogs, "listener1")
+	if !reflect.DeepEqual(httpObj.AccessLogExprs, []string{"\"\" + HTTP.RES.STATUS"}) || !reflect.DeepEqual(httpObj.AnalyticsProfileNames, nsConfig.analyticsProfiles) {
+		t.Errorf("Unexpected access logs of HTTP vserver: %v %v", httpObj.AccessLogExprs, httpObj.AnalyticsProfileNames)
+	}
+	tcpObj := nsconfigengine.NewCSApi("cs_tcp", "TCP", "1.1.1.1", 9000)
+	setAccessLogConfig(&configAdaptor{}, tcpObj, accessLogs, "listener1")
+	if !reflect.DeepEqual(tcpObj.AccessLogExprs, []string{"\"-\""}) || tcpObj.AnalyticsProfileNames != nil {
+		t.Errorf("Unexpected access logs of TCP vserver without log proxy: %v %v", tcpObj.AccessLogExprs, tcpObj.AnalyticsProfileNames)
+	}
+}
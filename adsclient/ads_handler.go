@@ -14,10 +14,14 @@ limitations under the License.
 package adsclient
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -31,16 +35,24 @@ import (
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 
+	envoyRateLimit "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
 	envoyFault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
 	envoyJWT "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	envoyLocalRateLimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
+	envoyGlobalRateLimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
 	envoyFilterHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	envoyFilterTcp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/tcp_proxy/v3"
 	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	envoyUpstreamHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	envoyMatcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	envoyType "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	envoyUtil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	proto "github.com/gogo/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	any "github.com/golang/protobuf/ptypes/any"
+	duration "github.com/golang/protobuf/ptypes/duration"
+	_struct "github.com/golang/protobuf/ptypes/struct"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
 )
 
 const (
@@ -64,6 +76,18 @@ const (
 	defaultSDSName    = "default"
 	sdsLeafCertPrefix = "file-cert"
 	sdsRootCertPrefix = "file-root"
+	// localRateLimitFilter is the name of Envoy's local rate limit HTTP filter
+	localRateLimitFilter = "envoy.filters.http.local_ratelimit"
+	// httpProtocolOptionsName is the key of the upstream HTTP protocol options in typed_extension_protocol_options of a cluster
+	httpProtocolOptionsName = "envoy.extensions.upstreams.http.v3.HttpProtocolOptions"
+	// defaultOutlierConsecutiveErrors is Envoy's default of the consecutive errors of the outlier detection checks
+	defaultOutlierConsecutiveErrors = 5
+)
+
+// Range of the HTTP/2 initial window sizes of Citrix ADC HTTP profile
+const (
+	minHTTP2WindowSize = 8192
+	maxHTTP2WindowSize = 20971520
 )
 
 var (
@@ -71,6 +95,9 @@ var (
 	EnableDefaultSSLTCPListener = getBoolEnv("DEFAULT_SSL_LISTENER_ON_443")
 )
 
+// regexSubstitutionGroup matches references to capture groups (\1, \2 ...) in a regex rewrite substitution
+var regexSubstitutionGroup = regexp.MustCompile(`\\[0-9]`)
+
 var valueNameToNum = map[string]int{
 	"HUNDRED":      100,
 	"TEN_THOUSAND": 10000,
@@ -124,15 +151,409 @@ func getLbMethod(lbMethod xdsCluster.Cluster_LbPolicy) string {
 		------------------------------------------------------------------
 		ROUND_ROBIN              | Default. Value 0 ROUNDROBIN
 		LEAST_CONN	         | Value 1 LEASTCONNECTION
+		LEAST_REQUEST	         | Value 1 LEASTREQUEST
 		RANDOM		         | Value 3 LEASTCONNECTION
+		RING_HASH, MAGLEV	 | Hash based LB method of the route's hash policy
 		PASSTHROUGH		 | value 4 not supported in CPX right now
 	*/
-	if lbMethod == xdsCluster.Cluster_LEAST_REQUEST || lbMethod == xdsCluster.Cluster_RANDOM {
+	switch lbMethod {
+	case xdsCluster.Cluster_LEAST_REQUEST:
+		return "LEASTREQUEST"
+	case xdsCluster.Cluster_RANDOM:
 		return "LEASTCONNECTION"
+	case xdsCluster.Cluster_RING_HASH, xdsCluster.Cluster_MAGLEV:
+		return ""
 	}
 	return "ROUNDROBIN"
 }
 
+// getSlowStartWindow returns the slow start window of the cluster in seconds
+func getSlowStartWindow(cluster *xdsCluster.Cluster) int {
+	slowStartConfig := cluster.GetRoundRobinLbConfig().GetSlowStartConfig()
+	if cluster.GetLbPolicy() == xdsCluster.Cluster_LEAST_REQUEST {
+		slowStartConfig = cluster.GetLeastRequestLbConfig().GetSlowStartConfig()
+		if cluster.GetLeastRequestLbConfig().GetChoiceCount() != nil {
+			// LEASTREQUEST LB method chooses from all the services, as Envoy does when choice_count is not less than the number of hosts
+			xDSLogger.Debug("getSlowStartWindow: choice_count of least request LB is not supported", "clusterName", cluster.GetName(), "choiceCount", cluster.GetLeastRequestLbConfig().GetChoiceCount().GetValue())
+		}
+	}
+	window := slowStartConfig.GetSlowStartWindow()
+	if window == nil {
+		return 0
+	}
+	if window.GetNanos() > 0 {
+		return int(window.GetSeconds()) + 1
+	}
+	return int(window.GetSeconds())
+}
+
+// getDurationMsec returns the duration in milliseconds
+func getDurationMsec(value *duration.Duration) int {
+	return int(value.GetSeconds()*1000) + int(value.GetNanos())/valueNameToNum["MILLION"]
+}
+
+// getHealthCheckPayload returns the payload of the TCP health check, whose text is hex encoded
+func getHealthCheckPayload(payload *core.HealthCheck_Payload) (string, error) {
+	if payload.GetBinary() != nil {
+		return string(payload.GetBinary()), nil
+	}
+	decoded, err := hex.DecodeString(payload.GetText())
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// getHealthMonitors converts the active health checks of the cluster into monitor specs
+func getHealthMonitors(cluster *xdsCluster.Cluster) []nsconfigengine.HealthMonitor {
+	var monitors []nsconfigengine.HealthMonitor
+	for _, healthCheck := range cluster.GetHealthChecks() {
+		monitor := nsconfigengine.HealthMonitor{
+			Interval:           getDurationMsec(healthCheck.GetInterval()),
+			Timeout:            getDurationMsec(healthCheck.GetTimeout()),
+			UnhealthyThreshold: int(healthCheck.GetUnhealthyThreshold().GetValue()),
+			HealthyThreshold:   int(healthCheck.GetHealthyThreshold().GetValue()),
+		}
+		switch healthCheck.GetHealthChecker().(type) {
+		case *core.HealthCheck_HttpHealthCheck_:
+			httpHealthCheck := healthCheck.GetHttpHealthCheck()
+			monitor.Type = "HTTP"
+			monitor.HTTPRequest = "GET " + httpHealthCheck.GetPath()
+			monitor.Host = httpHealthCheck.GetHost()
+			for _, status := range httpHealthCheck.GetExpectedStatuses() {
+				if status.GetEnd()-status.GetStart() <= 1 {
+					monitor.RespCodes = append(monitor.RespCodes, fmt.Sprint(status.GetStart()))
+				} else {
+					monitor.RespCodes = append(monitor.RespCodes, fmt.Sprintf("%d-%d", status.GetStart(), status.GetEnd()-1))
+				}
+			}
+			if len(monitor.RespCodes) == 0 {
+				monitor.RespCodes = []string{"200"}
+			}
+		case *core.HealthCheck_TcpHealthCheck_:
+			tcpHealthCheck := healthCheck.GetTcpHealthCheck()
+			monitor.Type = "TCP"
+			if tcpHealthCheck.GetSend() != nil || len(tcpHealthCheck.GetReceive()) > 0 {
+				monitor.Type = "TCP-ECV"
+				payloads := append([]*core.HealthCheck_Payload{tcpHealthCheck.GetSend()}, tcpHealthCheck.GetReceive()...)
+				decoded := make([]string, 0, len(payloads))
+				for _, payload := range payloads {
+					value, err := getHealthCheckPayload(payload)
+					if err != nil {
+						break
+					}
+					decoded = append(decoded, value)
+				}
+				if len(decoded) < len(payloads) {
+					xDSLogger.Error("getHealthMonitors: Text payload of TCP health check is not hex encoded, health check is skipped", "clusterName", cluster.GetName())
+					continue
+				}
+				monitor.Send = decoded[0]
+				// Response is expected to contain any of the receive payloads
+				monitor.Recv = decoded[1:]
+				if len(monitor.Recv) == 0 {
+					monitor.Recv = nil
+				}
+			}
+		case *core.HealthCheck_GrpcHealthCheck_:
+			monitor.Type = "GRPC"
+			monitor.GRPCService = healthCheck.GetGrpcHealthCheck().GetServiceName()
+			monitor.Host = healthCheck.GetGrpcHealthCheck().GetAuthority()
+		default:
+			xDSLogger.Warn("getHealthMonitors: Health checker is not supported", "clusterName", cluster.GetName())
+			continue
+		}
+		monitors = append(monitors, monitor)
+	}
+	return monitors
+}
+
+// getOutlierConsecutiveErrors returns the consecutive errors ejecting a host as per the check of the outlier detection, 0 if the check is not enforced.
+// As in Envoy, consecutive errors default to defaultOutlierConsecutiveErrors, and the enforcing percentage to 100 if the check is enforced by default, 0 otherwise
+func getOutlierConsecutiveErrors(consecutiveErrors, enforcing *wrappers.UInt32Value, enforcedByDefault bool) uint32 {
+	if enforcing == nil && !enforcedByDefault || enforcing != nil && enforcing.GetValue() == 0 {
+		return 0
+	}
+	if consecutiveErrors == nil {
+		return defaultOutlierConsecutiveErrors
+	}
+	return consecutiveErrors.GetValue()
+}
+
+// getHTTP2WindowSize returns the HTTP/2 window size within the range of Citrix ADC, 0 if it is not set
+func getHTTP2WindowSize(size *wrappers.UInt32Value) int {
+	switch {
+	case size == nil:
+		return 0
+	case size.GetValue() < minHTTP2WindowSize:
+		return minHTTP2WindowSize
+	case size.GetValue() > maxHTTP2WindowSize:
+		return maxHTTP2WindowSize
+	}
+	return int(size.GetValue())
+}
+
+// getIgnoredHTTP2Options returns the names of the HTTP/2 protocol options which Citrix ADC cannot express. Only the concurrent streams and
+// the initial window sizes are applied
+func getIgnoredHTTP2Options(http2Options *core.Http2ProtocolOptions) []string {
+	ignored := []string{}
+	if http2Options.GetHpackTableSize() != nil {
+		ignored = append(ignored, "hpack_table_size")
+	}
+	if http2Options.GetAllowConnect() {
+		ignored = append(ignored, "allow_connect")
+	}
+	if http2Options.GetAllowMetadata() {
+		ignored = append(ignored, "allow_metadata")
+	}
+	if http2Options.GetMaxOutboundFrames() != nil || http2Options.GetMaxOutboundControlFrames() != nil || http2Options.GetMaxConsecutiveInboundFramesWithEmptyPayload() != nil ||
+		http2Options.GetMaxInboundPriorityFramesPerStream() != nil || http2Options.GetMaxInboundWindowUpdateFramesPerDataFrameSent() != nil {
+		ignored = append(ignored, "frame flood limits")
+	}
+	if len(http2Options.GetCustomSettingsParameters()) > 0 {
+		ignored = append(ignored, "custom_settings_parameters")
+	}
+	if http2Options.GetConnectionKeepalive() != nil {
+		ignored = append(ignored, "connection_keepalive")
+	}
+	return ignored
+}
+
+// getIgnoredHTTPProtocolOptions returns the names of the upstream HTTP protocol options which Citrix ADC cannot express
+func getIgnoredHTTPProtocolOptions(protocolOptions *envoyUpstreamHttp.HttpProtocolOptions) []string {
+	ignored := []string{}
+	if protocolOptions.GetCommonHttpProtocolOptions() != nil {
+		ignored = append(ignored, "common_http_protocol_options")
+	}
+	if protocolOptions.GetUpstreamHttpProtocolOptions() != nil {
+		ignored = append(ignored, "upstream_http_protocol_options")
+	}
+	if len(protocolOptions.GetHttpFilters()) > 0 {
+		ignored = append(ignored, "http_filters")
+	}
+	var http1Options *core.Http1ProtocolOptions
+	var http2Options *core.Http2ProtocolOptions
+	switch {
+	case protocolOptions.GetExplicitHttpConfig() != nil:
+		http1Options = protocolOptions.GetExplicitHttpConfig().GetHttpProtocolOptions()
+		http2Options = protocolOptions.GetExplicitHttpConfig().GetHttp2ProtocolOptions()
+	case protocolOptions.GetAutoConfig() != nil:
+		http1Options = protocolOptions.GetAutoConfig().GetHttpProtocolOptions()
+		http2Options = protocolOptions.GetAutoConfig().GetHttp2ProtocolOptions()
+		if protocolOptions.GetAutoConfig().GetHttp3ProtocolOptions() != nil || protocolOptions.GetAutoConfig().GetAlternateProtocolsCacheOptions() != nil {
+			ignored = append(ignored, "auto_config HTTP/3")
+		}
+	case protocolOptions.GetUseDownstreamProtocolConfig() != nil:
+		http1Options = protocolOptions.GetUseDownstreamProtocolConfig().GetHttpProtocolOptions()
+		http2Options = protocolOptions.GetUseDownstreamProtocolConfig().GetHttp2ProtocolOptions()
+		if protocolOptions.GetUseDownstreamProtocolConfig().GetHttp3ProtocolOptions() != nil {
+			ignored = append(ignored, "use_downstream_protocol_config HTTP/3")
+		}
+	}
+	if http1Options.GetAllowAbsoluteUrl() != nil || http1Options.GetAcceptHttp_10() || http1Options.GetHeaderKeyFormat() != nil || http1Options.GetEnableTrailers() {
+		ignored = append(ignored, "http_protocol_options")
+	}
+	return append(ignored, getIgnoredHTTP2Options(http2Options)...)
+}
+
+// getHTTPProtocolOptions converts the upstream HTTP protocol options of the cluster into the HTTP protocol options of lbObj, and caps its HTTP/2
+// streams per connection with them. Explicit HTTP/2 is used without negotiation, as h2c for plaintext services, and the auto config and the
+// downstream protocol are approximated by HTTP/2 if negotiated. HTTP/3 is not supported, and HTTP/1.1 is used instead. Citrix ADC has no gRPC
+// servicegroup type, so gRPC upstreams are served by these HTTP/2 servicegroups. Options which cannot be expressed are reported and ignored
+func getHTTPProtocolOptions(cluster *xdsCluster.Cluster, lbObj *nsconfigengine.LBApi) *nsconfigengine.HTTPProtocolOptions {
+	protocolOptions := &envoyUpstreamHttp.HttpProtocolOptions{}
+	if typedOptions, ok := cluster.GetTypedExtensionProtocolOptions()[httpProtocolOptionsName]; ok {
+		if err := ptypes.UnmarshalAny(typedOptions, protocolOptions); err != nil {
+			xDSLogger.Error("getHTTPProtocolOptions: Error unmarshaling HTTP protocol options", "clusterName", cluster.GetName(), "error", err)
+			return nil
+		}
+	} else if cluster.GetHttp2ProtocolOptions() != nil {
+		protocolOptions.UpstreamProtocolOptions = &envoyUpstreamHttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &envoyUpstreamHttp.HttpProtocolOptions_ExplicitHttpConfig{
+			ProtocolConfig: &envoyUpstreamHttp.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{Http2ProtocolOptions: cluster.GetHttp2ProtocolOptions()}}}
+	} else {
+		return nil
+	}
+	if ignored := getIgnoredHTTPProtocolOptions(protocolOptions); len(ignored) > 0 {
+		xDSLogger.Warn("getHTTPProtocolOptions: HTTP protocol options are not supported and ignored", "clusterName", cluster.GetName(), "options", strings.Join(ignored, ", "))
+	}
+	options := &nsconfigengine.HTTPProtocolOptions{}
+	var http2Options *core.Http2ProtocolOptions
+	switch {
+	case protocolOptions.GetExplicitHttpConfig() != nil:
+		if protocolOptions.GetExplicitHttpConfig().GetHttp3ProtocolOptions() != nil {
+			xDSLogger.Warn("getHTTPProtocolOptions: HTTP/3 to upstream is not supported. Using HTTP/1.1", "clusterName", cluster.GetName())
+		}
+		http2Options = protocolOptions.GetExplicitHttpConfig().GetHttp2ProtocolOptions()
+		options.HTTP2Direct = http2Options != nil
+	case protocolOptions.GetAutoConfig() != nil:
+		http2Options = protocolOptions.GetAutoConfig().GetHttp2ProtocolOptions()
+		if http2Options == nil {
+			http2Options = &core.Http2ProtocolOptions{}
+		}
+	case protocolOptions.GetUseDownstreamProtocolConfig() != nil:
+		http2Options = protocolOptions.GetUseDownstreamProtocolConfig().GetHttp2ProtocolOptions()
+	default:
+		return nil
+	}
+	if http2Options != nil {
+		options.HTTP2 = true
+		options.InitialStreamWindowSize = getHTTP2WindowSize(http2Options.GetInitialStreamWindowSize())
+		options.InitialConnWindowSize = getHTTP2WindowSize(http2Options.GetInitialConnectionWindowSize())
+		if http2Options.GetMaxConcurrentStreams() != nil && int(http2Options.GetMaxConcurrentStreams().GetValue()) < lbObj.MaxHTTP2ConcurrentStreams {
+			lbObj.MaxHTTP2ConcurrentStreams = int(http2Options.GetMaxConcurrentStreams().GetValue())
+		}
+	}
+	return options
+}
+
+// getCircuitLimit returns the circuit breaker limit, 0 if it is not set or beyond what Citrix ADC can express
+func getCircuitLimit(limit *wrappers.UInt32Value) int {
+	if limit == nil || limit.GetValue() >= maxConn {
+		return 0
+	}
+	return int(limit.GetValue())
+}
+
+// getThresholdsCircuitBreaker converts the thresholds of a priority of the cluster into a circuit breaker, nil if they limit neither
+// the connections nor the requests. Thresholds which Citrix ADC cannot express are reported and ignored
+func getThresholdsCircuitBreaker(clusterName string, thresholds *xdsCluster.CircuitBreakers_Thresholds) *nsconfigengine.CircuitBreaker {
+	if thresholds.GetMaxRetries() != nil || thresholds.GetRetryBudget() != nil {
+		xDSLogger.Warn("getThresholdsCircuitBreaker: Retry limits of circuit breaker are not supported", "clusterName", clusterName, "priority", thresholds.GetPriority())
+	}
+	if thresholds.GetMaxConnectionPools() != nil {
+		xDSLogger.Warn("getThresholdsCircuitBreaker: max_connection_pools of circuit breaker is not supported", "clusterName", clusterName, "priority", thresholds.GetPriority())
+	}
+	circuitBreaker := &nsconfigengine.CircuitBreaker{
+		MaxConnections:     getCircuitLimit(thresholds.GetMaxConnections()),
+		MaxRequests:        getCircuitLimit(thresholds.GetMaxRequests()),
+		MaxPendingRequests: getCircuitLimit(thresholds.GetMaxPendingRequests()),
+	}
+	if circuitBreaker.MaxConnections == 0 && circuitBreaker.MaxRequests == 0 {
+		if circuitBreaker.MaxPendingRequests > 0 {
+			xDSLogger.Warn("getThresholdsCircuitBreaker: max_pending_requests without connection or request limit is not supported", "clusterName", clusterName, "priority", thresholds.GetPriority())
+		}
+		return nil
+	}
+	return circuitBreaker
+}
+
+// addCircuitLimits returns the sum of the limits of both priorities, 0 if either of them is not limited
+func addCircuitLimits(defaultLimit, highLimit int) int {
+	if defaultLimit == 0 || highLimit == 0 {
+		return 0
+	}
+	return defaultLimit + highLimit
+}
+
+// getCircuitBreakers converts the DEFAULT and HIGH priority thresholds of the cluster into the circuit breakers of the LB vservers of the
+// DEFAULT and HIGH priority routes. Per service connections of lbObj are capped with the limits of both priorities. max_requests only
+// limits the requests of the servicegroup and the spillover of the LB vserver, HTTP/2 streams per connection come from the protocol options
+func getCircuitBreakers(cluster *xdsCluster.Cluster, lbObj *nsconfigengine.LBApi) (*nsconfigengine.CircuitBreaker, *nsconfigengine.CircuitBreaker) {
+	var defaultCircuitBreaker, highCircuitBreaker *nsconfigengine.CircuitBreaker
+	priorities := make(map[core.RoutingPriority]bool)
+	for _, thresholds := range cluster.GetCircuitBreakers().GetThresholds() {
+		if priorities[thresholds.GetPriority()] {
+			xDSLogger.Warn("getCircuitBreakers: Duplicate thresholds of the priority are ignored", "clusterName", cluster.GetName(), "priority", thresholds.GetPriority())
+			continue
+		}
+		priorities[thresholds.GetPriority()] = true
+		if thresholds.GetPriority() == core.RoutingPriority_HIGH {
+			highCircuitBreaker = getThresholdsCircuitBreaker(cluster.GetName(), thresholds)
+		} else {
+			defaultCircuitBreaker = getThresholdsCircuitBreaker(cluster.GetName(), thresholds)
+		}
+	}
+	if defaultCircuitBreaker == nil {
+		// Services are not limited, as the requests of DEFAULT priority are not
+		return nil, highCircuitBreaker
+	}
+	maxConnections := defaultCircuitBreaker.MaxConnections
+	if highCircuitBreaker != nil {
+		maxConnections = addCircuitLimits(maxConnections, highCircuitBreaker.MaxConnections)
+	}
+	if maxConnections > 0 && maxConnections < maxConn {
+		lbObj.MaxConnections = maxConnections
+	}
+	return defaultCircuitBreaker, highCircuitBreaker
+}
+
+// getOutlierMonitor converts the outlier detection of the cluster into the inline monitor of HTTP servicegroup, or the TCP monitor of TCP servicegroup.
+// Service is marked DOWN after the least of the consecutive errors of the enforced checks. Success rate and failure percentage ejections are
+// approximated by marking the service DOWN on consecutive 5xx responses. LB vserver is marked DOWN when more than max ejection percent of the
+// services are DOWN
+func getOutlierMonitor(cluster *xdsCluster.Cluster, serviceGroupType string) *nsconfigengine.LBMonitor {
+	outlierDetection := cluster.GetOutlierDetection()
+	if outlierDetection == nil {
+		return nil
+	}
+	lbMonitor := new(nsconfigengine.LBMonitor)
+	retries := []uint32{}
+	if outlierDetection.GetSplitExternalLocalOriginErrors() {
+		if localOriginFailures := getOutlierConsecutiveErrors(outlierDetection.GetConsecutiveLocalOriginFailure(), outlierDetection.GetEnforcingConsecutiveLocalOriginFailure(), true); localOriginFailures > 0 {
+			retries = append(retries, localOriginFailures)
+		}
+	}
+	consecutive5xx := getOutlierConsecutiveErrors(outlierDetection.GetConsecutive_5Xx(), outlierDetection.GetEnforcingConsecutive_5Xx(), true)
+	// Connection failures of TCP clusters are counted as 5xx errors, unless they are split as local origin errors
+	if consecutive5xx > 0 && (serviceGroupType == "HTTP" || !outlierDetection.GetSplitExternalLocalOriginErrors()) {
+		retries = append(retries, consecutive5xx)
+	}
+	switch serviceGroupType {
+	case "HTTP":
+		lbMonitor.Type = "HTTP-INLINE"
+		gatewayFailures := getOutlierConsecutiveErrors(outlierDetection.GetConsecutiveGatewayFailure(), outlierDetection.GetEnforcingConsecutiveGatewayFailure(), false)
+		if gatewayFailures > 0 {
+			retries = append(retries, gatewayFailures)
+		}
+		rateEjection := outlierDetection.GetEnforcingSuccessRate().GetValue() > 0 || outlierDetection.GetEnforcingFailurePercentage().GetValue() > 0
+		if rateEjection {
+			xDSLogger.Debug("getOutlierMonitor: Success rate and failure percentage ejections are approximated by consecutive 5xx errors", "clusterName", cluster.GetName())
+		}
+		switch {
+		case consecutive5xx > 0 || rateEjection:
+			lbMonitor.RespCodes = []string{"100-499"}
+		case gatewayFailures > 0:
+			// Gateway failures are 502, 503 and 504 responses
+			lbMonitor.RespCodes = []string{"100-501", "505-599"}
+		default:
+			// Only the connection failures and timeouts mark the service DOWN
+			lbMonitor.RespCodes = []string{"100-599"}
+		}
+	case "TCP", "SSL_TCP":
+		lbMonitor.Type = "TCP"
+	default:
+		return nil
+	}
+	for _, value := range retries {
+		if lbMonitor.Retries == 0 || int(value) < lbMonitor.Retries {
+			lbMonitor.Retries = int(value)
+		}
+	}
+	if outlierDetection.GetInterval() != nil {
+		if outlierDetection.GetInterval().GetNanos() != 0 { // If units are in Nano seconds, convert all to milli seconds as Citrix ADC understands that as smallest unit
+			lbMonitor.Interval = getDurationMsec(outlierDetection.GetInterval())
+			lbMonitor.IntervalUnits = "MSEC"
+		} else {
+			lbMonitor.Interval = int(outlierDetection.GetInterval().GetSeconds())
+			lbMonitor.IntervalUnits = "SEC"
+		}
+	}
+	if outlierDetection.GetBaseEjectionTime() != nil {
+		if outlierDetection.GetBaseEjectionTime().GetNanos() != 0 {
+			lbMonitor.DownTime = getDurationMsec(outlierDetection.GetBaseEjectionTime())
+			lbMonitor.DownTimeUnits = "MSEC"
+		} else {
+			lbMonitor.DownTime = int(outlierDetection.GetBaseEjectionTime().GetSeconds())
+			lbMonitor.DownTimeUnits = "SEC"
+		}
+	}
+	// Guard is dropped if all the services can be ejected
+	if maxEjectionPercent := outlierDetection.GetMaxEjectionPercent(); maxEjectionPercent != nil && maxEjectionPercent.GetValue() < 100 {
+		lbMonitor.MaxEjectionPercent = int(maxEjectionPercent.GetValue())
+	}
+	return lbMonitor
+}
+
 func addToWatch(nsConfig *configAdaptor, certPath, keyPath string) (string, string, string, error) {
 	if certPath == "" {
 		return "", "", "", nil
@@ -140,11 +561,76 @@ func addToWatch(nsConfig *configAdaptor, certPath, keyPath string) (string, stri
 	return nsConfig.watch.addDir(certPath, keyPath)
 }
 
-// getTLSDetailsFromTransportSocket will get UpStreamTLSContext which will be bound to SSL ServiceGroup
-func getTLSDetailsFromTransportSocket(nsConfig *configAdaptor, transportSocket *core.TransportSocket, lbObj *nsconfigengine.LBApi) {
+// getValidationContext returns the validation context of the TLS context, or the default validation context if it is combined with an SDS one
+func getValidationContext(commonTLSContext *auth.CommonTlsContext) *auth.CertificateValidationContext {
+	if validationContext := commonTLSContext.GetValidationContext(); validationContext != nil {
+		return validationContext
+	}
+	return commonTLSContext.GetCombinedValidationContext().GetDefaultValidationContext()
+}
+
+// setRevocationCheck sets the CRL of the validation context of the TLS context, and the OCSP responder of the adaptor, on the SSL specs with a CA certificate.
+// CRL file is read here, uploaded to Citrix ADC when the SSL specs are applied, and kept updated by the certificate watcher
+func setRevocationCheck(nsConfig *configAdaptor, commonTLSContext *auth.CommonTlsContext, sslObjs []nsconfigengine.SSLSpec) {
+	var crl string
+	validationContext := getValidationContext(commonTLSContext)
+	if crlFile := validationContext.GetCrl().GetFilename(); crlFile != "" {
+		var err error
+		if crl, err = nsConfig.watch.addCRL(crlFile); err != nil {
+			xDSLogger.Error("setRevocationCheck: Could not read CRL file", "crlFile", crlFile, "error", err)
+		}
+	} else {
+		crl = validationContext.GetCrl().GetInlineString()
+	}
+	for i := range sslObjs {
+		if sslObjs[i].RootCertFilename == "" && sslObjs[i].RootCert == "" {
+			continue
+		}
+		sslObjs[i].CRL = crl
+		sslObjs[i].OCSPResponderURL = ocspResponderURL
+	}
+}
+
+// getUpstreamServerNames returns the SNI, and the DNS subject alternative name expected in the certificate of the upstream server.
+// Citrix ADC verifies the server against a single DNS name. Hence error is returned if any other subject alternative name, or several
+// DNS names, are expected, as the server can not be verified as specified
+func getUpstreamServerNames(tlsContext *auth.UpstreamTlsContext) (string, []string, error) {
+	validationContext := getValidationContext(tlsContext.GetCommonTlsContext())
+	var subjectAltNames, unsupportedNames []string
+	addSubjectAltName := func(subjectAltName string) {
+		if len(subjectAltNames) == 0 || subjectAltNames[0] != subjectAltName {
+			subjectAltNames = append(subjectAltNames, subjectAltName)
+		}
+	}
+	for _, typedMatcher := range validationContext.GetMatchTypedSubjectAltNames() {
+		if typedMatcher.GetSanType() == auth.SubjectAltNameMatcher_DNS && typedMatcher.GetMatcher().GetExact() != "" {
+			addSubjectAltName(typedMatcher.GetMatcher().GetExact())
+		} else {
+			unsupportedNames = append(unsupportedNames, typedMatcher.GetMatcher().String())
+		}
+	}
+	for _, matcher := range validationContext.GetMatchSubjectAltNames() {
+		if matcher.GetExact() != "" && !strings.Contains(matcher.GetExact(), "://") {
+			addSubjectAltName(matcher.GetExact())
+		} else {
+			unsupportedNames = append(unsupportedNames, matcher.String())
+		}
+	}
+	if len(unsupportedNames) > 0 {
+		return "", nil, fmt.Errorf("subject alternative names other than exact DNS names can not be verified: %v", unsupportedNames)
+	}
+	if len(subjectAltNames) > 1 {
+		return "", nil, fmt.Errorf("server can not be verified against any of several subject alternative names: %v", subjectAltNames)
+	}
+	return tlsContext.GetSni(), subjectAltNames, nil
+}
+
+// getTLSDetailsFromTransportSocket will get UpStreamTLSContext which will be bound to SSL ServiceGroup.
+// Error is returned if the upstream server can not be verified as specified
+func getTLSDetailsFromTransportSocket(nsConfig *configAdaptor, transportSocket *core.TransportSocket, lbObj *nsconfigengine.LBApi) error {
 	if transportSocket == nil || nsConfig == nil || lbObj == nil {
 		xDSLogger.Debug("getTLSDetailsFromTransportSocket: Either transportSocket or nsConfig adaptor or lb object is nil")
-		return
+		return nil
 	}
 	tlsContext := &auth.UpstreamTlsContext{}
 	switch c := transportSocket.ConfigType.(type) {
@@ -152,6 +638,11 @@ func getTLSDetailsFromTransportSocket(nsConfig *configAdaptor, transportSocket *
 		if err := ptypes.UnmarshalAny(c.TypedConfig, tlsContext); err != nil {
 			xDSLogger.Error("getTLSDetailsFromTransportSocket: Could not unmarshal while retrieving (upstream) TLS context", "error", err)
 		} else {
+			sni, subjectAltNames, err := getUpstreamServerNames(tlsContext)
+			if err != nil {
+				return err
+			}
+			tlsCount := len(lbObj.BackendTLS)
 			for _, sdsConfig := range tlsContext.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs() {
 				var certFileName, keyFileName, rootCertFileName string
 				var certFile, keyFile, rootFile string
@@ -192,7 +683,9 @@ func getTLSDetailsFromTransportSocket(nsConfig *configAdaptor, transportSocket *
 				lbObj.BackendTLS = append(lbObj.BackendTLS, nsconfigengine.SSLSpec{
 					CertFilename:       certFileName,
 					PrivateKeyFilename: keyFileName,
-					RootCertFilename:   rootCertFileName})
+					RootCertFilename:   rootCertFileName,
+					SNI:                sni,
+					SubjectAltNames:    subjectAltNames})
 			}
 			// If certificates are provided as part of UpstreamTlsContext, then retrieve same
 			for _, tlsCertificate := range tlsContext.GetCommonTlsContext().GetTlsCertificates() {
@@ -204,27 +697,40 @@ func getTLSDetailsFromTransportSocket(nsConfig *configAdaptor, transportSocket *
 					lbObj.BackendTLS = append(lbObj.BackendTLS, nsconfigengine.SSLSpec{
 						CertFilename:       certFileName,
 						PrivateKeyFilename: keyFileName,
-						RootCertFilename:   rootCertFileName})
+						RootCertFilename:   rootCertFileName,
+						SNI:                sni,
+						SubjectAltNames:    subjectAltNames})
 				} else if tlsCertificate.GetCertificateChain().GetInlineString() != "" {
 					lbObj.BackendTLS = append(lbObj.BackendTLS, nsconfigengine.SSLSpec{
-						Cert:       tlsCertificate.GetCertificateChain().GetInlineString(),
-						PrivateKey: tlsCertificate.GetPrivateKey().GetInlineString(),
-						RootCert:   tlsContext.GetCommonTlsContext().GetValidationContext().GetTrustedCa().GetInlineString()})
+						Cert:            tlsCertificate.GetCertificateChain().GetInlineString(),
+						PrivateKey:      tlsCertificate.GetPrivateKey().GetInlineString(),
+						RootCert:        tlsContext.GetCommonTlsContext().GetValidationContext().GetTrustedCa().GetInlineString(),
+						SNI:             sni,
+						SubjectAltNames: subjectAltNames})
 				}
 			}
+			// SNI and server verification apply even if the upstream TLS context has no certificates
+			if len(lbObj.BackendTLS) == tlsCount && (sni != "" || len(subjectAltNames) > 0) {
+				lbObj.BackendTLS = append(lbObj.BackendTLS, nsconfigengine.SSLSpec{SNI: sni, SubjectAltNames: subjectAltNames})
+			}
+			setRevocationCheck(nsConfig, tlsContext.GetCommonTlsContext(), lbObj.BackendTLS[tlsCount:])
 		}
 	}
+	return nil
 }
 
 //getBackendTLS will look for TransportSocket from which TLS details need to be obtained
-func getBackendTLS(nsConfig *configAdaptor, cluster *xdsCluster.Cluster, lbObj *nsconfigengine.LBApi) {
+func getBackendTLS(nsConfig *configAdaptor, cluster *xdsCluster.Cluster, lbObj *nsconfigengine.LBApi) error {
 	if cluster.GetTransportSocket() == nil { // Loop through transportSocketMatch
 		for _, transSocketMatch := range cluster.GetTransportSocketMatches() {
-			getTLSDetailsFromTransportSocket(nsConfig, transSocketMatch.GetTransportSocket(), lbObj)
+			if err := getTLSDetailsFromTransportSocket(nsConfig, transSocketMatch.GetTransportSocket(), lbObj); err != nil {
+				return err
+			}
 		}
-	} else { // TransportSocket is immediately available in cluster resource
-		getTLSDetailsFromTransportSocket(nsConfig, cluster.GetTransportSocket(), lbObj)
+		return nil
 	}
+	// TransportSocket is immediately available in cluster resource
+	return getTLSDetailsFromTransportSocket(nsConfig, cluster.GetTransportSocket(), lbObj)
 }
 
 // isTLSContext func checks if the TLS info is present in cluster or not.
@@ -270,6 +776,255 @@ func getMultiClusterStringMapConfig(clusterName string) *nsconfigengine.StringMa
 	return stringMapBindingObj
 }
 
+// getStringMapBindings returns the stringmap bindings of a cluster's LB vserver.
+// Cluster name is mapped to LB vserver name for cluster_header based routing
+func getStringMapBindings(clusterName string) []*nsconfigengine.StringMapBinding {
+	stringMapBindings := []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: clusterName, Value: nsconfigengine.GetNSCompatibleName(clusterName)}}
+	// Multi Cluster Gateway needs to know point to clusterwide services.
+	if multiClusterIngress {
+		if stringMapBindingObj := getMultiClusterStringMapConfig(clusterName); stringMapBindingObj != nil {
+			stringMapBindings = append(stringMapBindings, stringMapBindingObj)
+		}
+	}
+	return stringMapBindings
+}
+
+// lbSubsetInfo stores the LB subset selectors of a cluster and the subset LB vservers configured from its endpoints
+type lbSubsetInfo struct {
+	lbObj     *nsconfigengine.LBApi
+	selectors [][]string
+	subsets   map[string]bool
+}
+
+// getLbMetadata returns the envoy.lb filter metadata, used for LB subset selection, as key-value pairs
+func getLbMetadata(metadata *core.Metadata) map[string]string {
+	lbMetadata := make(map[string]string)
+	for key, value := range metadata.GetFilterMetadata()["envoy.lb"].GetFields() {
+		switch v := value.GetKind().(type) {
+		case *_struct.Value_StringValue:
+			lbMetadata[key] = v.StringValue
+		case *_struct.Value_NumberValue:
+			lbMetadata[key] = strconv.FormatFloat(v.NumberValue, 'f', -1, 64)
+		case *_struct.Value_BoolValue:
+			lbMetadata[key] = strconv.FormatBool(v.BoolValue)
+		}
+	}
+	return lbMetadata
+}
+
+// getSubsetEntityName returns the name of the LB vserver and servicegroup representing the subset of a cluster
+// whose endpoints match the given metadata
+func getSubsetEntityName(clusterName string, lbMetadata map[string]string) string {
+	keys := make([]string, 0, len(lbMetadata))
+	for key := range lbMetadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	subset := make([]string, 0, len(keys))
+	for _, key := range keys {
+		subset = append(subset, key+"="+lbMetadata[key])
+	}
+	return nsconfigengine.GetNSCompatibleName(clusterName) + "_" + nsconfigengine.GetNSCompatibleNameHash(strings.Join(subset, ","), 10)
+}
+
+// lbSubsetsDelete deletes the subset LB vservers of a cluster
+func lbSubsetsDelete(nsConfig *configAdaptor, clusterName string) {
+	if subsetInfo, ok := nsConfig.lbSubsets[clusterName]; ok {
+		for subsetName := range subsetInfo.subsets {
+			nsConfig.delConfig(&configBlock{configType: cdsDel, resourceName: subsetName, resource: &nsconfigengine.LBApi{Name: subsetName}})
+		}
+		delete(nsConfig.lbSubsets, clusterName)
+	}
+}
+
+// lbSubsetEndpointUpdate creates an LB vserver for every subset of the cluster, as per the cluster's subset selectors
+// and metadata of the endpoints. Subsets which no longer have endpoints are deleted
+func lbSubsetEndpointUpdate(nsConfig *configAdaptor, clusterName string, svcGpObj *nsconfigengine.ServiceGroupAPI, membersMetadata []map[string]string) {
+	subsetInfo, ok := nsConfig.lbSubsets[clusterName]
+	if !ok {
+		return
+	}
+	subsetMembers := make(map[string][]nsconfigengine.ServiceGroupMember)
+	for _, selector := range subsetInfo.selectors {
+		for index, member := range svcGpObj.Members {
+			subsetMetadata := make(map[string]string)
+			for _, key := range selector {
+				if value, ok := membersMetadata[index][key]; ok {
+					subsetMetadata[key] = value
+				}
+			}
+			if len(subsetMetadata) != len(selector) {
+				continue
+			}
+			subsetName := getSubsetEntityName(clusterName, subsetMetadata)
+			subsetMembers[subsetName] = append(subsetMembers[subsetName], member)
+		}
+	}
+	for subsetName, members := range subsetMembers {
+		subsetLbObj := *subsetInfo.lbObj
+		subsetLbObj.Name = subsetName
+		subsetLbObj.StringMapBindings = nil
+		subsetLbObj.BackupVserver = ""
+		subsetLbObj.HighCircuitBreaker = nil
+		subsetLbObj.MinActivePercent = 0
+		nsConfig.addConfig(&configBlock{configType: cdsAdd, resourceName: subsetName, resource: &subsetLbObj})
+		subsetSvcGpObj := nsconfigengine.NewServiceGroupAPI(subsetName)
+		subsetSvcGpObj.Members = members
+		subsetSvcGpObj.IsIPOnlySvcGroup = svcGpObj.IsIPOnlySvcGroup
+		subsetSvcGpObj.GracefulDelay = svcGpObj.GracefulDelay
+		nsConfig.addConfig(&configBlock{configType: edsAdd, resourceName: subsetName, resource: subsetSvcGpObj})
+	}
+	for subsetName := range subsetInfo.subsets {
+		if _, ok := subsetMembers[subsetName]; !ok {
+			nsConfig.delConfig(&configBlock{configType: cdsDel, resourceName: subsetName, resource: &nsconfigengine.LBApi{Name: subsetName}})
+		}
+	}
+	subsetInfo.subsets = make(map[string]bool)
+	for subsetName := range subsetMembers {
+		subsetInfo.subsets[subsetName] = true
+	}
+}
+
+const (
+	maxMemberWeight               = 100 // Weights of servicegroup members range from 1 to 100
+	defaultOverprovisioningFactor = 140 // Default overprovisioning factor of the endpoints' priorities, in percent
+	defaultGracefulDrainDelay     = 30  // Default delay, in seconds, of graceful disable of the draining and removed endpoints
+)
+
+type lbPriorityInfo struct {
+	lbObj            *nsconfigengine.LBApi
+	backupVserver    string          // Backup LB vserver of the cluster's LB vserver
+	minActivePercent int             // Percentage of the services of an LB vserver that need to be UP, below which traffic fails over to its backup
+	backups          map[string]bool // Backup LB vservers of the priorities other than 0
+}
+
+// getPriorityEntityName returns the name of the backup LB vserver and servicegroup of the cluster's endpoints of the given priority
+func getPriorityEntityName(clusterName string, priority uint32) string {
+	return nsconfigengine.GetNSCompatibleName(clusterName) + "_p" + fmt.Sprint(priority)
+}
+
+// getMinActivePercent returns the percentage of the services that need to be UP, below which traffic fails over to the next priority.
+// Envoy fails over when the percentage of healthy endpoints, multiplied by the overprovisioning factor, falls below 100
+func getMinActivePercent(policy *xdsEndpoint.ClusterLoadAssignment_Policy) int {
+	factor := defaultOverprovisioningFactor
+	if policy.GetOverprovisioningFactor() != nil {
+		factor = int(policy.GetOverprovisioningFactor().GetValue())
+	}
+	if factor <= 100 {
+		return 100
+	}
+	return (100*100 + factor - 1) / factor
+}
+
+// getLocalityEndpointWeights returns the member weights of the endpoints of the localities of a priority. When the localities are weighted,
+// the weight of an endpoint is its share of its locality's weight, scaled so that the largest weight is maxMemberWeight. Otherwise nil is returned
+func getLocalityEndpointWeights(localities []*xdsEndpoint.LocalityLbEndpoints) [][]int {
+	totalLocalityWeight := 0
+	for _, locality := range localities {
+		totalLocalityWeight += int(locality.GetLoadBalancingWeight().GetValue())
+	}
+	if totalLocalityWeight == 0 {
+		return nil
+	}
+	shares := make([][]float64, len(localities))
+	maxShare := 0.0
+	for i, locality := range localities {
+		totalWeight := 0
+		for _, lbEndpoint := range locality.GetLbEndpoints() {
+			totalWeight += getEndpointWeight(lbEndpoint)
+		}
+		for _, lbEndpoint := range locality.GetLbEndpoints() {
+			share := float64(locality.GetLoadBalancingWeight().GetValue()) * float64(getEndpointWeight(lbEndpoint)) / float64(totalWeight)
+			shares[i] = append(shares[i], share)
+			if share > maxShare {
+				maxShare = share
+			}
+		}
+	}
+	weights := make([][]int, len(localities))
+	for i := range shares {
+		for _, share := range shares[i] {
+			weight := int(share*maxMemberWeight/maxShare + 0.5)
+			if weight == 0 && share > 0 {
+				weight = 1
+			}
+			weights[i] = append(weights[i], weight)
+		}
+	}
+	return weights
+}
+
+// getEndpointWeight returns the load balancing weight of the endpoint, 1 if not set
+func getEndpointWeight(lbEndpoint *xdsEndpoint.LbEndpoint) int {
+	if lbEndpoint.GetLoadBalancingWeight().GetValue() == 0 {
+		return 1
+	}
+	return int(lbEndpoint.GetLoadBalancingWeight().GetValue())
+}
+
+// lbPrioritiesDelete deletes the backup LB vservers of a cluster
+func lbPrioritiesDelete(nsConfig *configAdaptor, clusterName string) {
+	if priorityInfo, ok := nsConfig.lbPriorities[clusterName]; ok {
+		for backupName := range priorityInfo.backups {
+			nsConfig.delConfig(&configBlock{configType: cdsDel, resourceName: backupName, resource: &nsconfigengine.LBApi{Name: backupName}})
+		}
+		delete(nsConfig.lbPriorities, clusterName)
+	}
+}
+
+// lbPriorityEndpointUpdate creates a backup LB vserver for every priority of the cluster's endpoints other than 0. Backup LB vservers are chained
+// in the order of their priorities, starting from the cluster's LB vserver. Backups of the priorities which no longer have endpoints are deleted
+func lbPriorityEndpointUpdate(nsConfig *configAdaptor, clusterName string, svcGpObj *nsconfigengine.ServiceGroupAPI, backupMembers map[uint32][]nsconfigengine.ServiceGroupMember, minActivePercent int) {
+	priorityInfo, ok := nsConfig.lbPriorities[clusterName]
+	if !ok {
+		return
+	}
+	priorities := make([]uint32, 0, len(backupMembers))
+	for priority := range backupMembers {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+	backups := make(map[string]bool)
+	for index, priority := range priorities {
+		backupName := getPriorityEntityName(clusterName, priority)
+		backupLbObj := *priorityInfo.lbObj
+		backupLbObj.Name = backupName
+		backupLbObj.StringMapBindings = nil
+		backupLbObj.BackupVserver = ""
+		backupLbObj.HighCircuitBreaker = nil
+		backupLbObj.MinActivePercent = 0
+		if index+1 < len(priorities) {
+			backupLbObj.BackupVserver = getPriorityEntityName(clusterName, priorities[index+1])
+			backupLbObj.MinActivePercent = minActivePercent
+		}
+		nsConfig.addConfig(&configBlock{configType: cdsAdd, resourceName: backupName, resource: &backupLbObj})
+		backupSvcGpObj := nsconfigengine.NewServiceGroupAPI(backupName)
+		backupSvcGpObj.Members = backupMembers[priority]
+		backupSvcGpObj.IsIPOnlySvcGroup = svcGpObj.IsIPOnlySvcGroup
+		backupSvcGpObj.GracefulDelay = svcGpObj.GracefulDelay
+		nsConfig.addConfig(&configBlock{configType: edsAdd, resourceName: backupName, resource: backupSvcGpObj})
+		backups[backupName] = true
+	}
+	backupVserver := ""
+	if len(priorities) > 0 {
+		backupVserver = getPriorityEntityName(clusterName, priorities[0])
+	} else {
+		minActivePercent = 0
+	}
+	if backupVserver != priorityInfo.backupVserver || minActivePercent != priorityInfo.minActivePercent {
+		priorityInfo.backupVserver, priorityInfo.minActivePercent = backupVserver, minActivePercent
+		lbObj := *priorityInfo.lbObj
+		lbObj.BackupVserver, lbObj.MinActivePercent = backupVserver, minActivePercent
+		nsConfig.addConfig(&configBlock{configType: cdsAdd, resourceName: clusterName, resource: &lbObj})
+	}
+	for backupName := range priorityInfo.backups {
+		if !backups[backupName] {
+			nsConfig.delConfig(&configBlock{configType: cdsDel, resourceName: backupName, resource: &nsconfigengine.LBApi{Name: backupName}})
+		}
+	}
+	priorityInfo.backups = backups
+}
+
 func clusterAdd(nsConfig *configAdaptor, cluster *xdsCluster.Cluster, data interface{}) string {
 	xDSLogger.Debug("clusterAdd: Cluster resource info", "clusterName", cluster.Name, "serviceType", data.(string))
 	xDSLogger.Trace("clusterAdd: Cluster resource dump", "cluster", nsconfigengine.GetLogString(cluster))
@@ -283,59 +1038,78 @@ func clusterAdd(nsConfig *configAdaptor, cluster *xdsCluster.Cluster, data inter
 		}
 	}
 	lbObj := nsconfigengine.NewLBApi(nsconfigengine.GetNSCompatibleName(cluster.GetName()), serviceType, serviceGroupType, getLbMethod(cluster.GetLbPolicy()))
+	if serviceGroupType == "SSL" || serviceGroupType == "SSL_TCP" {
+		/* TLSContext is removed in go-control-plane:0.9.8	*/
+		if err := getBackendTLS(nsConfig, cluster, lbObj); err != nil {
+			xDSLogger.Error("clusterAdd: Cluster is refused as the upstream server can not be verified", "clusterName", cluster.GetName(), "error", err)
+			return ""
+		}
+	}
+	lbObj.SlowStartWindow = getSlowStartWindow(cluster)
+	hashLb := cluster.GetLbPolicy() == xdsCluster.Cluster_RING_HASH || cluster.GetLbPolicy() == xdsCluster.Cluster_MAGLEV
+	hashLbChanged := nsConfig.hashLbClusters[cluster.GetName()] != hashLb
+	if hashLb {
+		nsConfig.hashLbClusters[cluster.GetName()] = true
+	} else {
+		delete(nsConfig.hashLbClusters, cluster.GetName())
+	}
 	lbObj.MaxConnections = maxConn
 	lbObj.MaxHTTP2ConcurrentStreams = maxHTTP2Conn /* CPX Supports Max 1000 only */
 	lbObj.MaxRequestsPerConnection = maxReqPerConn
-	if cluster.GetCircuitBreakers().GetThresholds() != nil && cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxConnections() != nil {
-		if cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxConnections().GetValue() < maxConn {
-			lbObj.MaxConnections = int(cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxConnections().GetValue())
-		}
+	lbObj.CircuitBreaker, lbObj.HighCircuitBreaker = getCircuitBreakers(cluster, lbObj)
+	highPriorityChanged := nsConfig.highLbClusters[cluster.GetName()] != (lbObj.HighCircuitBreaker != nil)
+	if lbObj.HighCircuitBreaker != nil {
+		nsConfig.highLbClusters[cluster.GetName()] = true
+	} else {
+		delete(nsConfig.highLbClusters, cluster.GetName())
 	}
-	if cluster.GetCircuitBreakers().GetThresholds() != nil && cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxRequests() != nil {
-		if cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxRequests().GetValue() < maxHTTP2Conn {
-			lbObj.MaxHTTP2ConcurrentStreams = int(cluster.GetCircuitBreakers().GetThresholds()[0].GetMaxRequests().GetValue())
-		}
+	if serviceType == "HTTP" {
+		lbObj.HTTPProtocolOptions = getHTTPProtocolOptions(cluster, lbObj)
 	}
 	if cluster.GetMaxRequestsPerConnection().GetValue() < maxReqPerConn {
 		lbObj.MaxRequestsPerConnection = int(cluster.GetMaxRequestsPerConnection().GetValue())
 	}
 	lbObj.NetprofileName = nsConfig.netProfile
-	if serviceGroupType == "SSL" || serviceGroupType == "SSL_TCP" {
-		/* TLSContext is removed in go-control-plane:0.9.8	*/
-		getBackendTLS(nsConfig, cluster, lbObj)
-	}
+	lbObj.HealthMonitors = getHealthMonitors(cluster)
 	/* Outlier Detection. */
-	if serviceGroupType == "HTTP" && cluster.GetOutlierDetection() != nil {
-		lbObj.LbMonitorObj = new(nsconfigengine.LBMonitor)
-		lbObj.LbMonitorObj.Retries = int(cluster.GetOutlierDetection().GetConsecutiveGatewayFailure().GetValue())
-		if cluster.GetOutlierDetection().GetInterval() != nil {
-			if cluster.GetOutlierDetection().GetInterval().GetNanos() != 0 { // If units are in Nano seconds, convert all to milli seconds as Citrix ADC understands that as smallest unit
-				lbObj.LbMonitorObj.Interval = int(cluster.GetOutlierDetection().GetInterval().GetSeconds()*1000) + int(cluster.GetOutlierDetection().GetInterval().GetNanos())/valueNameToNum["MILLION"]
-				lbObj.LbMonitorObj.IntervalUnits = "MSEC"
-			} else {
-				lbObj.LbMonitorObj.Interval = int(cluster.GetOutlierDetection().GetInterval().GetSeconds())
-				lbObj.LbMonitorObj.IntervalUnits = "SEC"
-			}
-		}
-		if cluster.GetOutlierDetection().GetBaseEjectionTime() != nil {
-			if cluster.GetOutlierDetection().GetBaseEjectionTime().GetNanos() != 0 {
-				lbObj.LbMonitorObj.DownTime = int(cluster.GetOutlierDetection().GetBaseEjectionTime().GetSeconds()*1000) + int(cluster.GetOutlierDetection().GetBaseEjectionTime().GetNanos())/valueNameToNum["MILLION"]
-				lbObj.LbMonitorObj.DownTimeUnits = "MSEC"
-			} else {
-				lbObj.LbMonitorObj.DownTime = int(cluster.GetOutlierDetection().GetBaseEjectionTime().GetSeconds())
-				lbObj.LbMonitorObj.DownTimeUnits = "SEC"
-			}
-		}
-	}
+	lbObj.LbMonitorObj = getOutlierMonitor(cluster, serviceGroupType)
 	// Below conditions checks if desired state API can be used for this cluster
 	if cluster.GetType() == xdsCluster.Cluster_EDS || cluster.GetType() == xdsCluster.Cluster_STATIC {
 		lbObj.AutoScale = true
 	}
-	// Multi Cluster Gateway needs to know point to clusterwide services.
-	if multiClusterIngress {
-		lbObj.StringMapBindingObj = getMultiClusterStringMapConfig(cluster.GetName())
+	lbObj.StringMapBindings = getStringMapBindings(cluster.GetName())
+	// Subset LB vservers are created from the endpoints. Hence only the selectors are stored here
+	if len(cluster.GetLbSubsetConfig().GetSubsetSelectors()) > 0 {
+		subsetInfo, ok := nsConfig.lbSubsets[cluster.GetName()]
+		if !ok {
+			subsetInfo = &lbSubsetInfo{subsets: make(map[string]bool)}
+			nsConfig.lbSubsets[cluster.GetName()] = subsetInfo
+		}
+		subsetInfo.lbObj = lbObj
+		subsetInfo.selectors = nil
+		for _, selector := range cluster.GetLbSubsetConfig().GetSubsetSelectors() {
+			subsetInfo.selectors = append(subsetInfo.selectors, selector.GetKeys())
+		}
+	} else {
+		lbSubsetsDelete(nsConfig, cluster.GetName())
+	}
+	// Backup LB vservers of the priorities are created from the endpoints
+	priorityInfo, ok := nsConfig.lbPriorities[cluster.GetName()]
+	if !ok {
+		priorityInfo = &lbPriorityInfo{backups: make(map[string]bool)}
+		nsConfig.lbPriorities[cluster.GetName()] = priorityInfo
 	}
+	priorityInfo.lbObj = lbObj
+	lbObj.BackupVserver, lbObj.MinActivePercent = priorityInfo.backupVserver, priorityInfo.minActivePercent
 	nsConfig.addConfig(&configBlock{configType: cdsAdd, resourceName: cluster.Name, resource: lbObj})
+	extAuthzClusterUpdate(nsConfig, cluster.GetName(), lbObj, nil)
+	if hashLbChanged || highPriorityChanged {
+		// Persistency of the routes to the cluster depends on whether it is balanced by consistent hashing, and the target of
+		// HIGH priority routes on whether the cluster has HIGH priority circuit breaker
+		nsConfig.reapplyRoutes(func(routeInfo *appliedRouteInfo) bool {
+			return routeInfo.referencesCluster(cluster.GetName())
+		})
+	}
 	if (cluster.GetType() == xdsCluster.Cluster_STATIC) || (cluster.GetType() == xdsCluster.Cluster_STRICT_DNS) {
 		if cluster.GetLoadAssignment() != nil {
 			clusterEndpointUpdate(nsConfig, cluster.GetLoadAssignment(), nil)
@@ -356,40 +1130,90 @@ func clusterAdd(nsConfig *configAdaptor, cluster *xdsCluster.Cluster, data inter
 func clusterDel(nsConfig *configAdaptor, clusterName string) {
 	xDSLogger.Trace("clusterDel: Cluster resource to be deleted", "clusterName", clusterName)
 	lbObj := &nsconfigengine.LBApi{Name: nsconfigengine.GetNSCompatibleName(clusterName)}
-	if multiClusterIngress {
-		lbObj.StringMapBindingObj = getMultiClusterStringMapConfig(clusterName)
-	}
+	lbObj.StringMapBindings = getStringMapBindings(clusterName)
+	lbSubsetsDelete(nsConfig, clusterName)
+	delete(nsConfig.hashLbClusters, clusterName)
+	delete(nsConfig.highLbClusters, clusterName)
 	confBl := configBlock{
 		configType:   cdsDel,
 		resourceName: clusterName,
 		resource:     lbObj,
 	}
 	nsConfig.delConfig(&confBl)
+	lbPrioritiesDelete(nsConfig, clusterName)
+	extAuthzClusterDelete(nsConfig, clusterName)
+}
+
+// getForwardClientCertSpec returns the handling of the x-forwarded-client-cert header in the requests of the HTTP connection manager.
+// Certificate and chain of the client, and its DNS subject alternative names, can not be set in the header and are ignored
+func getForwardClientCertSpec(httpCM *envoyFilterHttp.HttpConnectionManager, listenerName string) *nsconfigengine.ForwardClientCertSpec {
+	certDetails := httpCM.GetSetCurrentClientCertDetails()
+	if certDetails.GetCert() || certDetails.GetChain() || certDetails.GetDns() {
+		xDSLogger.Warn("getForwardClientCertSpec: Only subject and URI of the client certificate are set in x-forwarded-client-cert header", "listenerName", listenerName)
+	}
+	return &nsconfigengine.ForwardClientCertSpec{
+		Mode:    httpCM.GetForwardClientCertDetails().String(),
+		Subject: certDetails.GetSubject().GetValue(),
+		URI:     certDetails.GetUri(),
+	}
 }
 
 func getAuthConfig(nsConfig *configAdaptor, listenerName string, httpFilters []*envoyFilterHttp.HttpFilter) *nsconfigengine.AuthSpec {
 	for _, httpFilter := range httpFilters {
-		switch httpFilter.GetName() {
-		case "envoy.filters.http.jwt_authn":
-			jwtAuth := &envoyJWT.JwtAuthentication{}
-			if err := getHTTPFilterConfig(httpFilter, jwtAuth); err == nil {
-				jwtProviders := jwtAuth.GetProviders()
-				for _, jwtProvider := range jwtProviders {
-					authSpec := &nsconfigengine.AuthSpec{Name: nsconfigengine.GetNSCompatibleName(listenerName), Issuer: jwtProvider.GetIssuer(), Jwks: jwtProvider.GetLocalJwks().GetInlineString(), Audiences: jwtProvider.GetAudiences()}
-					for _, header := range jwtProvider.GetFromHeaders() {
-						authSpec.JwtHeaders = append(authSpec.JwtHeaders, nsconfigengine.JwtHeader{Name: header.Name, Prefix: header.ValuePrefix})
-					}
-					authSpec.JwtParams = jwtProvider.GetFromParams()
-					authSpec.Forward = jwtProvider.GetForward()
-					authSpec.ForwardHeader = jwtProvider.GetForwardPayloadHeader()
-					authSpec.FrontendTLS = append(authSpec.FrontendTLS, nsconfigengine.SSLSpec{CertFilename: ClientCertChainFile, PrivateKeyFilename: ClientKeyFile})
-					return authSpec
+		if httpFilter.GetName() != "envoy.filters.http.jwt_authn" {
+			continue
+		}
+		jwtAuth := &envoyJWT.JwtAuthentication{}
+		if err := getHTTPFilterConfig(httpFilter, jwtAuth); err != nil {
+			xDSLogger.Trace("getAuthConfig: getHTTPFilterConfig returned error!", "error", err)
+			continue
+		}
+		if len(jwtAuth.GetProviders()) == 0 {
+			continue
+		}
+		// Providers are sorted by name so that their policies retain priorities across updates
+		providerNames := make([]string, 0, len(jwtAuth.GetProviders()))
+		for providerName := range jwtAuth.GetProviders() {
+			providerNames = append(providerNames, providerName)
+		}
+		sort.Strings(providerNames)
+		authSpec := &nsconfigengine.AuthSpec{Name: nsconfigengine.GetNSCompatibleName(listenerName)}
+		jwtHeaders := make(map[string]bool)
+		jwtParams := make(map[string]bool)
+		for _, providerName := range providerNames {
+			jwtProvider := jwtAuth.GetProviders()[providerName]
+			provider := nsconfigengine.JwtProvider{Issuer: jwtProvider.GetIssuer(), Audiences: jwtProvider.GetAudiences(), ClaimToHeaders: getClaimToHeaders(jwtProvider),
+				Forward: jwtProvider.GetForward(), ForwardHeader: jwtProvider.GetForwardPayloadHeader()}
+			if remoteJwks := jwtProvider.GetRemoteJwks(); remoteJwks != nil {
+				provider.JwksURI = remoteJwks.GetHttpUri().GetUri()
+				provider.Jwks = nsConfig.getRemoteJwks(remoteJwks)
+			} else if jwksFile := jwtProvider.GetLocalJwks().GetFilename(); jwksFile != "" {
+				jwks, err := ioutil.ReadFile(jwksFile)
+				if err != nil {
+					xDSLogger.Error("getAuthConfig: Could not read JWKS file", "provider", providerName, "error", err)
 				}
+				provider.Jwks = string(jwks)
 			} else {
-				xDSLogger.Trace("getAuthConfig: getHTTPFilterConfig returned error!", "error", err)
+				provider.Jwks = jwtProvider.GetLocalJwks().GetInlineString()
+			}
+			authSpec.Providers = append(authSpec.Providers, provider)
+			// Token is looked up in the headers and query parameters of all the providers
+			for _, header := range jwtProvider.GetFromHeaders() {
+				if !jwtHeaders[header.GetName()] {
+					jwtHeaders[header.GetName()] = true
+					authSpec.JwtHeaders = append(authSpec.JwtHeaders, nsconfigengine.JwtHeader{Name: header.GetName(), Prefix: header.GetValuePrefix()})
+				}
+			}
+			for _, param := range jwtProvider.GetFromParams() {
+				if !jwtParams[param] {
+					jwtParams[param] = true
+					authSpec.JwtParams = append(authSpec.JwtParams, param)
+				}
 			}
-			break
 		}
+		setAuthRules(authSpec, providerNames, jwtAuth)
+		authSpec.FrontendTLS = append(authSpec.FrontendTLS, nsconfigengine.SSLSpec{CertFilename: ClientCertChainFile, PrivateKeyFilename: ClientKeyFile})
+		return authSpec
 	}
 	return nil
 }
@@ -417,6 +1241,47 @@ func getListenerFilterChainMatchInfo(nsConfig *configAdaptor, filterChain *xdsLi
 	return filterIP, filterPort, fcName
 }
 
+// tlsVersionNames maps the TLS protocol versions of Envoy to the TLS versions of SSL profile
+var tlsVersionNames = map[auth.TlsParameters_TlsProtocol]string{
+	auth.TlsParameters_TLSv1_0: "TLSv1",
+	auth.TlsParameters_TLSv1_1: "TLSv1.1",
+	auth.TlsParameters_TLSv1_2: "TLSv1.2",
+	auth.TlsParameters_TLSv1_3: "TLSv1.3",
+}
+
+// getSSLProfileSpec converts the TLS parameters, ALPN protocols of SSL_TCP vserver and session resumption settings of the downstream TLS context
+// into the SSL profile of the vserver, nil if none of them is set. TLS versions of TLS_AUTO are the defaults of Envoy, TLSv1.2 to TLSv1.3,
+// and the ciphers of equal preference groups are listed in the order of the group. Error is returned if none of the cipher suites is supported,
+// as the client connections can not be limited to them
+func getSSLProfileSpec(tlsContext *auth.DownstreamTlsContext, vserverType string) (*nsconfigengine.SSLProfileSpec, error) {
+	tlsParams := tlsContext.GetCommonTlsContext().GetTlsParams()
+	alpnProtocols := tlsContext.GetCommonTlsContext().GetAlpnProtocols()
+	if vserverType != "SSL_TCP" {
+		alpnProtocols = nil
+	}
+	if tlsParams == nil && len(alpnProtocols) == 0 && !tlsContext.GetDisableStatelessSessionResumption() && tlsContext.GetSessionTimeout() == nil {
+		return nil, nil
+	}
+	sslProfile := &nsconfigengine.SSLProfileSpec{MinVersion: "TLSv1.2", MaxVersion: "TLSv1.3", ECCCurves: tlsParams.GetEcdhCurves(), ALPNProtocols: alpnProtocols,
+		SessionTickets: !tlsContext.GetDisableStatelessSessionResumption(), SessionTimeout: int(tlsContext.GetSessionTimeout().GetSeconds())}
+	if version, ok := tlsVersionNames[tlsParams.GetTlsMinimumProtocolVersion()]; ok {
+		sslProfile.MinVersion = version
+	}
+	if version, ok := tlsVersionNames[tlsParams.GetTlsMaximumProtocolVersion()]; ok {
+		sslProfile.MaxVersion = version
+	}
+	for _, cipherSuite := range tlsParams.GetCipherSuites() {
+		sslProfile.Ciphers = append(sslProfile.Ciphers, strings.Split(strings.Trim(cipherSuite, "[]"), "|")...)
+	}
+	if unsupportedCiphers := sslProfile.UnsupportedCiphers(); len(unsupportedCiphers) > 0 {
+		if len(unsupportedCiphers) == len(sslProfile.Ciphers) {
+			return nil, fmt.Errorf("none of the cipher suites is supported: %v", unsupportedCiphers)
+		}
+		xDSLogger.Warn("getSSLProfileSpec: Unsupported cipher suites are not allowed", "ciphers", unsupportedCiphers)
+	}
+	return sslProfile, nil
+}
+
 //getTLSfromTransportSocket will get DownstreamTLSContext which will be associcated with SSL CS Vserver
 func getTLSfromTransportSocket(nsConfig *configAdaptor, csObj *nsconfigengine.CSApi, filterChain *xdsListener.FilterChain, sniCertVal bool) *auth.DownstreamTlsContext {
 	tlsContext := &auth.DownstreamTlsContext{}
@@ -427,6 +1292,23 @@ func getTLSfromTransportSocket(nsConfig *configAdaptor, csObj *nsconfigengine.CS
 			return nil
 		}
 	}
+	// TLS parameters are applied to the vserver as a whole, hence those of the first filter chain with TLS parameters are used
+	sslProfile, err := getSSLProfileSpec(tlsContext, csObj.VserverType)
+	if err != nil {
+		xDSLogger.Error("getTLSfromTransportSocket: TLS context of the filter chain is refused", "vserverName", csObj.Name, "filterChainName", filterChain.GetName(), "error", err)
+		return nil
+	}
+	if sslProfile != nil {
+		if csObj.SSLProfile == nil {
+			csObj.SSLProfile = sslProfile
+		} else if !reflect.DeepEqual(csObj.SSLProfile, sslProfile) {
+			xDSLogger.Warn("getTLSfromTransportSocket: Different TLS parameters of filter chains of the same vserver are not supported", "vserverName", csObj.Name)
+		}
+	}
+	// OCSP responses are stapled if enabled for the gateway, or if the TLS context requires stapling
+	if ocspStapling || tlsContext.GetOcspStaplePolicy() != auth.DownstreamTlsContext_LENIENT_STAPLING {
+		csObj.OCSPStapling = true
+	}
 	for _, sdsConfig := range tlsContext.GetCommonTlsContext().GetTlsCertificateSdsSecretConfigs() {
 		var certFile, keyFile, rootFile string
 		sdsName := sdsConfig.GetName()
@@ -459,6 +1341,7 @@ func getTLSfromTransportSocket(nsConfig *configAdaptor, csObj *nsconfigengine.CS
 			_, _, rootCertFileName, _ = addToWatch(nsConfig, rootFile, "")
 		}
 		csObj.FrontendTLS = append(csObj.FrontendTLS, nsconfigengine.SSLSpec{SNICert: sniCertVal, CertFilename: certKeyFileName, PrivateKeyFilename: keyFileName, RootCertFilename: rootCertFileName})
+		setRevocationCheck(nsConfig, tlsContext.GetCommonTlsContext(), csObj.FrontendTLS[len(csObj.FrontendTLS)-1:])
 		return nil
 	}
 	return tlsContext
@@ -469,6 +1352,7 @@ func getFrontEndTLSConfig(nsConfig *configAdaptor, csObj *nsconfigengine.CSApi,
 	if filterChain.GetTransportSocket() != nil {
 		tlsContext = getTLSfromTransportSocket(nsConfig, csObj, filterChain, sniCertVal)
 	}
+	tlsCount := len(csObj.FrontendTLS)
 	for _, tlsCertificate := range tlsContext.GetCommonTlsContext().GetTlsCertificates() {
 		if tlsCertificate.GetCertificateChain().GetFilename() != "" {
 			rootCertFileName := ""
@@ -485,6 +1369,9 @@ func getFrontEndTLSConfig(nsConfig *configAdaptor, csObj *nsconfigengine.CSApi,
 				RootCert:   tlsContext.GetCommonTlsContext().GetValidationContext().GetTrustedCa().GetInlineString()})
 		}
 	}
+	if tlsContext != nil {
+		setRevocationCheck(nsConfig, tlsContext.GetCommonTlsContext(), csObj.FrontendTLS[tlsCount:])
+	}
 	if tlsContext.GetRequireClientCertificate().GetValue() == true {
 		csObj.FrontendTLSClientAuth = true
 	}
@@ -824,12 +1711,41 @@ func listenerAdd(nsConfig *configAdaptor, listener *xdsListener.Listener) []map[
 			}
 
 			switch filterName := filter.GetName(); filterName {
+			case networkRBACFilter:
+				csObj.AuthzSpec = getNetworkAuthzConfig(csObj.AuthzSpec, filter)
 			case envoyUtil.HTTPConnectionManager:
 				httpCM := &envoyFilterHttp.HttpConnectionManager{}
 				if err := getListenerFilterConfig(filter, httpCM); err != nil {
 					xDSLogger.Error("listenerAdd: Error loading http connection manager", "listenerName", listener.GetName(), "error", err)
 				} else {
 					csObj.AuthSpec = getAuthConfig(nsConfig, csObj.Name, httpCM.GetHttpFilters())
+					nsConfig.registerRemoteJwks(csObj)
+					csObj.AuthzSpec = getAuthzConfig(httpCM.GetHttpFilters())
+					csObj.ForwardClientCert = getForwardClientCertSpec(httpCM, listener.GetName())
+					setAccessLogConfig(nsConfig, csObj, httpCM.GetAccessLog(), listener.GetName())
+					if csObj.VserverType != "LOGSTREAM" {
+						// Requests of vservers with tracing are exported by the analytics profiles of the log proxy, sampled at the sampling rate
+						// of the tracing unless all the requests are exported for the access logs or the inbound vserver
+						tracingSpec := getTracingSpec(httpCM.GetTracing(), listener.GetName())
+						nsConfig.registerTracing(csObj.Name, tracingSpec)
+						if tracingSpec != nil && tracingSpec.SamplingRate > 0 && len(nsConfig.analyticsProfiles) > 0 {
+							if len(csObj.AnalyticsProfileNames) == 0 && tracingSpec.SamplingRate < defaultTracingSamplingRate {
+								csObj.AnalyticsSamplingRate = tracingSpec.SamplingRate
+							}
+							csObj.AnalyticsProfileNames = nsConfig.analyticsProfiles
+						}
+					}
+					var extAuthzClusterName string
+					if csObj.ExtAuthzSpec, extAuthzClusterName = getExtAuthzConfig(httpCM.GetHttpFilters()); csObj.ExtAuthzSpec != nil {
+						csObjMap["cdsNames"] = append(csObjMap["cdsNames"].([]string), extAuthzClusterName)
+						csObj.ExtAuthzSpec.Callout.LbVserverName = getExtAuthzTimeoutEntityName(csObj.Name)
+					}
+					if localRateLimit := getLocalRateLimitConfig(httpCM.GetHttpFilters()); localRateLimit != nil {
+						csObjMap["localRateLimit"] = localRateLimit
+					}
+					if globalRateLimit := getGlobalRateLimitFilterConfig(httpCM.GetHttpFilters()); globalRateLimit != nil {
+						csObjMap["globalRateLimit"] = globalRateLimit
+					}
 					// Add configBlock before calling routeUpdate. But don't add for LOGSTREAM type
 					// In case of COE service, vserverType and serviceType are set to LOGSTREAM
 					// But CS vserver should not be created, only LB vserver should be created for LOGSTREAM
@@ -837,8 +1753,16 @@ func listenerAdd(nsConfig *configAdaptor, listener *xdsListener.Listener) []map[
 						confBl.resource = append(confBl.resource.([]*nsconfigengine.CSApi), csObj)
 						nsConfig.addConfig(&confBl)
 					}
+					// Dedicated LB vserver of the authorization service is updated after the callout referring to it
+					nsConfig.registerExtAuthzTimeout(csObj.Name, extAuthzClusterName, csObj.ExtAuthzSpec)
 					if routeConfig := httpCM.GetRouteConfig(); routeConfig != nil {
-						cdsMap := routeUpdate(nsConfig, []*xdsRoute.RouteConfiguration{routeConfig}, map[string]interface{}{"csVsName": csObj.Name, "listenerName": listener.GetName(), "filterChainName": filterChain.GetName(), "serviceType": csObjMap["serviceType"].(string)})
+						routeInput := map[string]interface{}{"csVsName": csObj.Name, "listenerName": listener.GetName(), "filterChainName": filterChain.GetName(), "serviceType": csObjMap["serviceType"].(string)}
+						for _, rateLimitKey := range []string{"localRateLimit", "globalRateLimit"} {
+							if rateLimit, ok := csObjMap[rateLimitKey]; ok {
+								routeInput[rateLimitKey] = rateLimit
+							}
+						}
+						cdsMap := routeUpdate(nsConfig, []*xdsRoute.RouteConfiguration{routeConfig}, routeInput)
 						csObjMap["cdsNames"] = append(csObjMap["cdsNames"].([]string), cdsMap["cdsNames"].([]string)...)
 					}
 					if rds := httpCM.GetRds(); rds != nil {
@@ -850,6 +1774,7 @@ func listenerAdd(nsConfig *configAdaptor, listener *xdsListener.Listener) []map[
 				if err := getListenerFilterConfig(filter, tcpProxy); err != nil {
 					xDSLogger.Error("listenerAdd: Error loading tcp proxy filter", "listenerName", listener.GetName(), "error", err)
 				} else {
+					setAccessLogConfig(nsConfig, csObj, tcpProxy.GetAccessLog(), listener.GetName())
 					if tcpProxy.GetCluster() != "" {
 						if filterChain.GetFilterChainMatch().GetServerNames() == nil {
 							csObj.DefaultLbVserverName = nsconfigengine.GetNSCompatibleName(tcpProxy.GetCluster())
@@ -891,6 +1816,9 @@ func listenerDel(nsConfig *configAdaptor, listenerName string, csVsNames []strin
 	xDSLogger.Trace("listenerDel: Deleting resources", "listenerName", listenerName, "csVsNames", csVsNames)
 	csObjs := make([]*nsconfigengine.CSApi, 0)
 	for _, csVsName := range csVsNames {
+		nsConfig.unregisterRemoteJwks(csVsName)
+		nsConfig.registerTracing(csVsName, nil)
+		delete(nsConfig.appliedRoutes, csVsName)
 		csObjs = append(csObjs, &nsconfigengine.CSApi{Name: csVsName})
 	}
 	confBl := configBlock{
@@ -899,6 +1827,10 @@ func listenerDel(nsConfig *configAdaptor, listenerName string, csVsNames []strin
 		resource:     csObjs,
 	}
 	nsConfig.delConfig(&confBl)
+	// Dedicated LB vservers of the authorization services are deleted after the callouts referring to them
+	for _, csVsName := range csVsNames {
+		nsConfig.registerExtAuthzTimeout(csVsName, "", nil)
+	}
 }
 
 func getValueString(obj map[string]interface{}, name string) (string, error) {
@@ -930,6 +1862,14 @@ func isLogProxyEndpoint(nsConfig *configAdaptor, clusterName string) string {
 	return ""
 }
 
+// getGracefulDrainDelay returns the delay in seconds, for which the draining and removed endpoints are gracefully disabled before they are removed
+func getGracefulDrainDelay() int {
+	if gracefulDrainDelay < 0 {
+		return defaultGracefulDrainDelay
+	}
+	return gracefulDrainDelay
+}
+
 func clusterEndpointUpdate(nsConfig *configAdaptor, clusterLoadAssignment *xdsEndpoint.ClusterLoadAssignment, data interface{}) {
 	var promEP string
 	xDSLogger.Debug("clusterEndpointUpdate: Endpoint info received for cluster", "clusterName", clusterLoadAssignment.ClusterName)
@@ -937,18 +1877,41 @@ func clusterEndpointUpdate(nsConfig *configAdaptor, clusterLoadAssignment *xdsEn
 	entityName := nsconfigengine.GetNSCompatibleName(clusterLoadAssignment.ClusterName)
 	onlyIPs := true // Assume that all endpoints are IP addresses initially
 	svcGpObj := nsconfigengine.NewServiceGroupAPI(entityName)
+	svcGpObj.GracefulDelay = getGracefulDrainDelay()
 	confBl := configBlock{
 		configType:   edsAdd,
 		resourceName: entityName,
 		resource:     svcGpObj,
 	}
-	if clusterLoadAssignment.Endpoints != nil {
-		for _, endpoint := range clusterLoadAssignment.Endpoints {
-			for _, lbEndpoint := range endpoint.LbEndpoints {
+	membersMetadata := make([]map[string]string, 0)
+	// Endpoints of priority 0 are the members of the cluster's servicegroup, and those of the other priorities are the members of backup servicegroups
+	priorityLocalities := make(map[uint32][]*xdsEndpoint.LocalityLbEndpoints)
+	priorities := make([]uint32, 0)
+	for _, endpoint := range clusterLoadAssignment.Endpoints {
+		if _, ok := priorityLocalities[endpoint.GetPriority()]; !ok {
+			priorities = append(priorities, endpoint.GetPriority())
+		}
+		priorityLocalities[endpoint.GetPriority()] = append(priorityLocalities[endpoint.GetPriority()], endpoint)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+	allMembers := make([]nsconfigengine.ServiceGroupMember, 0)
+	backupMembers := make(map[uint32][]nsconfigengine.ServiceGroupMember)
+	for _, priority := range priorities {
+		localityWeights := getLocalityEndpointWeights(priorityLocalities[priority])
+		for i, endpoint := range priorityLocalities[priority] {
+			for j, lbEndpoint := range endpoint.LbEndpoints {
+				// Unhealthy endpoints receive no traffic
+				healthStatus := lbEndpoint.GetHealthStatus()
+				if healthStatus == core.HealthStatus_UNHEALTHY || healthStatus == core.HealthStatus_TIMEOUT {
+					continue
+				}
 				ep := lbEndpoint.GetEndpoint()
 				address := ep.Address.GetSocketAddress().GetAddress()
 				port := int(ep.Address.GetSocketAddress().GetPortValue())
 				weight := int(lbEndpoint.GetLoadBalancingWeight().GetValue())
+				if localityWeights != nil {
+					weight = localityWeights[i][j]
+				}
 				if address == nsConfig.nsip {
 					return
 				}
@@ -956,12 +1919,18 @@ func clusterEndpointUpdate(nsConfig *configAdaptor, clusterLoadAssignment *xdsEn
 					address = nsLoopbackIP
 					weight = defaultWeight
 				}
+				member := nsconfigengine.ServiceGroupMember{IP: address, Port: port, Weight: weight, Draining: healthStatus == core.HealthStatus_DRAINING}
 				if net.ParseIP(address) == nil {
 					onlyIPs = false
-					svcGpObj.Members = append(svcGpObj.Members, nsconfigengine.ServiceGroupMember{Domain: address, Port: port, Weight: weight})
+					member.IP, member.Domain = "", address
+				}
+				if priority == 0 {
+					svcGpObj.Members = append(svcGpObj.Members, member)
 				} else {
-					svcGpObj.Members = append(svcGpObj.Members, nsconfigengine.ServiceGroupMember{IP: address, Port: port, Weight: weight})
+					backupMembers[priority] = append(backupMembers[priority], member)
 				}
+				allMembers = append(allMembers, member)
+				membersMetadata = append(membersMetadata, getLbMetadata(lbEndpoint.GetMetadata()))
 				promEP = address
 			}
 		}
@@ -986,6 +1955,12 @@ func clusterEndpointUpdate(nsConfig *configAdaptor, clusterLoadAssignment *xdsEn
 		svcGpObj.IsIPOnlySvcGroup = false
 	}
 	nsConfig.addConfig(&confBl)
+	lbPriorityEndpointUpdate(nsConfig, clusterLoadAssignment.ClusterName, svcGpObj, backupMembers, getMinActivePercent(clusterLoadAssignment.GetPolicy()))
+	// Subsets are selected from the endpoints of all the priorities
+	allSvcGpObj := *svcGpObj
+	allSvcGpObj.Members = allMembers
+	lbSubsetEndpointUpdate(nsConfig, clusterLoadAssignment.ClusterName, &allSvcGpObj, membersMetadata)
+	extAuthzClusterUpdate(nsConfig, clusterLoadAssignment.ClusterName, nil, svcGpObj)
 }
 
 // staticAndDNSTypeClusterEndpointUpdate() is to populate Citrix ADC config based on Hosts[] field in cluster
@@ -1041,6 +2016,8 @@ func getPersistencyPolicy(hashPolicy []*xdsRoute.RouteAction_HashPolicy) *nsconf
 		} else if hash.GetCookie() != nil {
 			persistency.CookieName = hash.GetCookie().GetName()
 			persistency.Timeout = int(hash.GetCookie().GetTtl().GetSeconds())
+		} else if hash.GetQueryParameter() != nil {
+			persistency.QueryParameter = hash.GetQueryParameter().GetName()
 		} else if hash.GetConnectionProperties() != nil && hash.GetConnectionProperties().GetSourceIp() {
 			persistency.SourceIP = true
 		}
@@ -1083,8 +2060,282 @@ func getFault(typedPerFilterConfig map[string]*any.Any) nsconfigengine.Fault {
 	return fault
 }
 
+// getLocalRateLimitConfig returns the config of the local rate limit filter among the HTTP filters of a listener, if present
+func getLocalRateLimitConfig(httpFilters []*envoyFilterHttp.HttpFilter) *envoyLocalRateLimit.LocalRateLimit {
+	for _, httpFilter := range httpFilters {
+		if httpFilter.GetName() != localRateLimitFilter {
+			continue
+		}
+		localRateLimit := &envoyLocalRateLimit.LocalRateLimit{}
+		if err := getHTTPFilterConfig(httpFilter, localRateLimit); err != nil {
+			xDSLogger.Trace("getLocalRateLimitConfig: getHTTPFilterConfig returned error!", "error", err)
+			return nil
+		}
+		return localRateLimit
+	}
+	return nil
+}
+
+// getFractionalPercent returns a fractional percent as an integral percentage capped at 100%. Nonzero fractions below 1% are rounded up to 1%,
+// as Citrix ADC policies work with integral percentages
+func getFractionalPercent(percent *envoyType.FractionalPercent) (int, error) {
+	den := envoyType.FractionalPercent_DenominatorType_name[int32(percent.GetDenominator())]
+	if _, ok := valueNameToNum[den]; !ok {
+		return 0, fmt.Errorf("incorrect value of denominator in percentage: %s", den)
+	}
+	numerator := uint64(percent.GetNumerator())
+	if numerator >= uint64(valueNameToNum[den]) {
+		return 100, nil
+	}
+	percentage := int((numerator * 100) / uint64(valueNameToNum[den]))
+	if percentage == 0 && numerator != 0 {
+		percentage = 1
+	}
+	return percentage, nil
+}
+
+// getRuntimePercent returns the default value of a runtime fractional percent as a percentage. Absence of the value means 0%
+func getRuntimePercent(runtimePercent *core.RuntimeFractionalPercent) int {
+	runtimePercentage, err := getFractionalPercent(runtimePercent.GetDefaultValue())
+	if err != nil {
+		xDSLogger.Error("getRuntimePercent: Incorrect value of denominator in percentage", "error", err)
+		return 0
+	}
+	return runtimePercentage
+}
+
+func getTokenBucket(tokenBucket *envoyType.TokenBucket) nsconfigengine.TokenBucket {
+	bucket := nsconfigengine.TokenBucket{MaxTokens: int(tokenBucket.GetMaxTokens()), TokensPerFill: 1, FillInterval: int(tokenBucket.GetFillInterval().AsDuration().Milliseconds())}
+	if tokenBucket.GetTokensPerFill() != nil {
+		bucket.TokensPerFill = int(tokenBucket.GetTokensPerFill().GetValue())
+	}
+	return bucket
+}
+
+// getRateLimitMatch returns the request attributes for which the actions of the route's rate limit generate the descriptor entries.
+// Entry without value matches any value of the key, and the ADC expressions for such values are returned as the selector.
+// Returns false if the actions can never generate the entries, or if the actions are not supported
+func getRateLimitMatch(entries []*envoyRateLimit.RateLimitDescriptor_Entry, routeRateLimit *xdsRoute.RateLimit, clusterName string) (nsconfigengine.RateLimitMatch, []string, bool) {
+	match := nsconfigengine.RateLimitMatch{}
+	selector := make([]string, 0)
+	actions := routeRateLimit.GetActions()
+	if len(actions) != len(entries) {
+		return match, selector, false
+	}
+	for i, action := range actions {
+		entry := entries[i]
+		if requestHeaders := action.GetRequestHeaders(); requestHeaders != nil {
+			if requestHeaders.GetDescriptorKey() != entry.GetKey() {
+				return match, selector, false
+			}
+			if entry.GetValue() == "" {
+				// Descriptor is not generated if the header is absent
+				match.Headers = append(match.Headers, nsconfigengine.MatchHeader{Name: requestHeaders.GetHeaderName(), Present: true})
+				selector = append(selector, "HTTP.REQ.HEADER(\""+requestHeaders.GetHeaderName()+"\")")
+			} else {
+				match.Headers = append(match.Headers, nsconfigengine.MatchHeader{Name: requestHeaders.GetHeaderName(), Exact: entry.GetValue()})
+			}
+		} else if action.GetRemoteAddress() != nil {
+			if entry.GetKey() != "remote_address" {
+				return match, selector, false
+			}
+			if entry.GetValue() == "" {
+				selector = append(selector, "CLIENT.IP.SRC")
+			} else {
+				match.ClientIP = entry.GetValue()
+			}
+		} else if genericKey := action.GetGenericKey(); genericKey != nil {
+			descriptorKey := genericKey.GetDescriptorKey()
+			if descriptorKey == "" {
+				descriptorKey = "generic_key"
+			}
+			if descriptorKey != entry.GetKey() || (entry.GetValue() != "" && genericKey.GetDescriptorValue() != entry.GetValue()) {
+				return match, selector, false
+			}
+		} else if action.GetDestinationCluster() != nil {
+			if entry.GetKey() != "destination_cluster" || (entry.GetValue() != "" && entry.GetValue() != clusterName) {
+				return match, selector, false
+			}
+		} else if headerValueMatch := action.GetHeaderValueMatch(); headerValueMatch != nil {
+			descriptorKey := headerValueMatch.GetDescriptorKey()
+			if descriptorKey == "" {
+				descriptorKey = "header_match"
+			}
+			if descriptorKey != entry.GetKey() || (entry.GetValue() != "" && headerValueMatch.GetDescriptorValue() != entry.GetValue()) {
+				return match, selector, false
+			}
+			if headerValueMatch.GetExpectMatch() == nil || headerValueMatch.GetExpectMatch().GetValue() {
+				for _, header := range headerValueMatch.GetHeaders() {
+					match.Headers = append(match.Headers, getMatchHeader(header))
+				}
+			} else if len(headerValueMatch.GetHeaders()) == 1 {
+				header := getMatchHeader(headerValueMatch.GetHeaders()[0])
+				header.Invert = !header.Invert
+				match.Headers = append(match.Headers, header)
+			} else {
+				xDSLogger.Warn("getRateLimitMatch: header_value_match not expecting match of multiple headers is not supported")
+				return match, selector, false
+			}
+		} else {
+			xDSLogger.Warn("getRateLimitMatch: Unsupported rate limit action", "action", action)
+			return match, selector, false
+		}
+	}
+	return match, selector, true
+}
+
+// getRateLimit converts the local rate limit filter config to the rate limit of a route.
+// Descriptors of the config are matched against the descriptor entries generated by the route's rate limit actions
+func getRateLimit(localRateLimit *envoyLocalRateLimit.LocalRateLimit, routeRateLimits []*xdsRoute.RateLimit, clusterName string) *nsconfigengine.RateLimit {
+	if localRateLimit.GetTokenBucket() == nil {
+		return nil
+	}
+	rateLimit := &nsconfigengine.RateLimit{StatusCode: int(localRateLimit.GetStatus().GetCode()), PerConnection: localRateLimit.GetLocalRateLimitPerDownstreamConnection()}
+	rateLimit.EnabledPercent = getRuntimePercent(localRateLimit.GetFilterEnabled())
+	rateLimit.EnforcedPercent = getRuntimePercent(localRateLimit.GetFilterEnforced())
+	if rateLimit.EnabledPercent == 0 || rateLimit.EnforcedPercent == 0 {
+		return nil
+	}
+	tokenBucket := getTokenBucket(localRateLimit.GetTokenBucket())
+	rateLimit.TokenBucket = &tokenBucket
+	for _, descriptor := range localRateLimit.GetDescriptors() {
+		limitDescriptor := nsconfigengine.RateLimitDescriptor{TokenBucket: getTokenBucket(descriptor.GetTokenBucket())}
+		for _, routeRateLimit := range routeRateLimits {
+			if match, _, ok := getRateLimitMatch(descriptor.GetEntries(), routeRateLimit, clusterName); ok {
+				limitDescriptor.Matches = append(limitDescriptor.Matches, match)
+			}
+		}
+		rateLimit.Descriptors = append(rateLimit.Descriptors, limitDescriptor)
+	}
+	return rateLimit
+}
+
+// getRouteRateLimit returns the rate limit of a route when the listener has local rate limit filter.
+// Route's or virtual host's typed_per_filter_config overrides the listener's config. Limits of listener's config are shared by all the routes
+func getRouteRateLimit(listenerRateLimit *envoyLocalRateLimit.LocalRateLimit, virtualHost *xdsRoute.VirtualHost, vroute *xdsRoute.Route) *nsconfigengine.RateLimit {
+	if listenerRateLimit == nil {
+		return nil
+	}
+	for _, typedPerFilterConfig := range []map[string]*any.Any{vroute.GetTypedPerFilterConfig(), virtualHost.GetTypedPerFilterConfig()} {
+		if perFilterConfig, ok := typedPerFilterConfig[localRateLimitFilter]; ok {
+			localRateLimit := &envoyLocalRateLimit.LocalRateLimit{}
+			if err := ptypes.UnmarshalAny(perFilterConfig, localRateLimit); err != nil {
+				xDSLogger.Error("getRouteRateLimit: Could not unmarshal local rate limit config", "error", err)
+				return nil
+			}
+			return getRateLimit(localRateLimit, vroute.GetRoute().GetRateLimits(), vroute.GetRoute().GetCluster())
+		}
+	}
+	rateLimit := getRateLimit(listenerRateLimit, vroute.GetRoute().GetRateLimits(), vroute.GetRoute().GetCluster())
+	if rateLimit != nil {
+		rateLimit.Shared = true
+	}
+	return rateLimit
+}
+
+// setStringMatch fills the match fields of matchHeader from the Envoy string matcher
+func setStringMatch(matchHeader *nsconfigengine.MatchHeader, stringMatch *envoyMatcher.StringMatcher) {
+	matchHeader.Exact = stringMatch.GetExact()
+	matchHeader.Prefix = stringMatch.GetPrefix()
+	matchHeader.Suffix = stringMatch.GetSuffix()
+	matchHeader.Contains = stringMatch.GetContains()
+	matchHeader.Regex = stringMatch.GetSafeRegex().GetRegex()
+	matchHeader.IgnoreCase = stringMatch.GetIgnoreCase()
+}
+
+// getMatchHeader converts Envoy's header matcher to nsconfigengine's MatchHeader.
+// Header matcher without any match specifier matches on the presence of the header
+func getMatchHeader(header *xdsRoute.HeaderMatcher) nsconfigengine.MatchHeader {
+	matchHeader := nsconfigengine.MatchHeader{Name: header.GetName(), Invert: header.GetInvertMatch()}
+	switch header.GetHeaderMatchSpecifier().(type) {
+	case *xdsRoute.HeaderMatcher_ExactMatch:
+		matchHeader.Exact = header.GetExactMatch()
+	case *xdsRoute.HeaderMatcher_SafeRegexMatch:
+		matchHeader.Regex = header.GetSafeRegexMatch().GetRegex()
+	case *xdsRoute.HeaderMatcher_RangeMatch:
+		matchHeader.Range = &nsconfigengine.MatchRange{Start: header.GetRangeMatch().GetStart(), End: header.GetRangeMatch().GetEnd()}
+	case *xdsRoute.HeaderMatcher_PresentMatch:
+		matchHeader.Present = true
+		if !header.GetPresentMatch() {
+			matchHeader.Invert = !matchHeader.Invert
+		}
+	case *xdsRoute.HeaderMatcher_PrefixMatch:
+		matchHeader.Prefix = header.GetPrefixMatch()
+	case *xdsRoute.HeaderMatcher_SuffixMatch:
+		matchHeader.Suffix = header.GetSuffixMatch()
+	case *xdsRoute.HeaderMatcher_ContainsMatch:
+		matchHeader.Contains = header.GetContainsMatch()
+	case *xdsRoute.HeaderMatcher_StringMatch:
+		setStringMatch(&matchHeader, header.GetStringMatch())
+	default:
+		matchHeader.Present = true
+	}
+	return matchHeader
+}
+
+// getMatchQueryParameter converts Envoy's query parameter matcher to nsconfigengine's MatchHeader
+func getMatchQueryParameter(queryParam *xdsRoute.QueryParameterMatcher) nsconfigengine.MatchHeader {
+	matchParam := nsconfigengine.MatchHeader{Name: queryParam.GetName()}
+	if queryParam.GetStringMatch() != nil {
+		setStringMatch(&matchParam, queryParam.GetStringMatch())
+	} else {
+		matchParam.Present = true
+	}
+	return matchParam
+}
+
+// getMirrorWeight returns the percentage of requests to be mirrored as per runtime_fraction of mirror policy.
+// All requests are mirrored if runtime_fraction is not provided
+func getMirrorWeight(rmp *xdsRoute.RouteAction_RequestMirrorPolicy) int {
+	if rmp.GetRuntimeFraction().GetDefaultValue() == nil {
+		return defaultMirrorWeight
+	}
+	weight, err := getFractionalPercent(rmp.GetRuntimeFraction().GetDefaultValue())
+	if err != nil {
+		xDSLogger.Error("getMirrorWeight: Mirroring all requests due to incorrect value of denominator in percentage", "error", err)
+		return defaultMirrorWeight
+	}
+	return weight
+}
+
+// appliedRouteInfo holds the route configs applied on a CS vserver, to reapply them when the config they depend on outside xDS changes
+type appliedRouteInfo struct {
+	routes []*xdsRoute.RouteConfiguration
+	data   map[string]interface{}
+}
+
+// referencesCluster returns true if any of the routes forwards the requests to the cluster
+func (routeInfo *appliedRouteInfo) referencesCluster(clusterName string) bool {
+	for _, routeConfig := range routeInfo.routes {
+		for _, vhost := range routeConfig.GetVirtualHosts() {
+			for _, vroute := range vhost.GetRoutes() {
+				if vroute.GetRoute().GetCluster() == clusterName {
+					return true
+				}
+				for _, cluster := range vroute.GetRoute().GetWeightedClusters().GetClusters() {
+					if cluster.GetName() == clusterName {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// reapplyRoutes reapplies the route configs of the CS vservers for which reapply returns true
+func (confAdaptor *configAdaptor) reapplyRoutes(reapply func(*appliedRouteInfo) bool) {
+	for csVsName, routeInfo := range confAdaptor.appliedRoutes {
+		if reapply(routeInfo) {
+			xDSLogger.Debug("reapplyRoutes: Reapplying routes", "csVsName", csVsName)
+			routeUpdate(confAdaptor, routeInfo.routes, routeInfo.data)
+		}
+	}
+}
+
 func routeUpdate(nsConfig *configAdaptor, routes []*xdsRoute.RouteConfiguration, data interface{}) map[string]interface{} {
 	inputMap := data.(map[string]interface{})
+	nsConfig.appliedRoutes[inputMap["csVsName"].(string)] = &appliedRouteInfo{routes: routes, data: inputMap}
 	xDSLogger.Trace("routeUpdate: Route resources received", "routes", routes)
 	xDSLogger.Trace("routeUpdate: inputMap details", "serviceType", inputMap["serviceType"].(string), "entityName", inputMap["csVsName"].(string))
 	clusterNames := make([]string, 0)
@@ -1096,6 +2347,15 @@ func routeUpdate(nsConfig *configAdaptor, routes []*xdsRoute.RouteConfiguration,
 		resourceName: entityName,
 		resource:     csBindings,
 	}
+	listenerRateLimit, _ := inputMap["localRateLimit"].(*envoyLocalRateLimit.LocalRateLimit)
+	globalRateLimitFilter, _ := inputMap["globalRateLimit"].(*envoyGlobalRateLimit.RateLimit)
+	var rateLimitConfig *globalRateLimitConfig
+	if globalRateLimitFilter != nil {
+		var err error
+		if rateLimitConfig, err = getGlobalRateLimitConfig(globalRateLimitConfigFile, globalRateLimitFilter.GetDomain()); err != nil {
+			xDSLogger.Error("routeUpdate: Global rate limits not applied", "entityName", entityName, "error", err)
+		}
+	}
 	for _, route := range routes {
 		xDSLogger.Debug("routeUpdate: Route and entity", "routeName", route.Name, "entityName", entityName)
 		for _, virtualHost := range route.GetVirtualHosts() {
@@ -1103,45 +2363,70 @@ func routeUpdate(nsConfig *configAdaptor, routes []*xdsRoute.RouteConfiguration,
 				binding := nsconfigengine.CSBinding{}
 				routeMatch := vroute.GetMatch()
 				rule := nsconfigengine.RouteMatch{Domains: virtualHost.GetDomains(), Prefix: routeMatch.GetPrefix(), Path: routeMatch.GetPath(), Regex: routeMatch.GetSafeRegex().GetRegex()}
+				if routeMatch.GetCaseSensitive() != nil && !routeMatch.GetCaseSensitive().GetValue() {
+					rule.CaseInsensitive = true
+				}
 				for _, headers := range routeMatch.GetHeaders() {
-					rule.Headers = append(rule.Headers, nsconfigengine.MatchHeader{Name: headers.GetName(), Exact: headers.GetExactMatch(), Prefix: headers.GetSafeRegexMatch().GetRegex(), Regex: headers.GetPrefixMatch()})
+					rule.Headers = append(rule.Headers, getMatchHeader(headers))
+				}
+				for _, queryParam := range routeMatch.GetQueryParameters() {
+					rule.QueryParameters = append(rule.QueryParameters, getMatchQueryParameter(queryParam))
+				}
+				for _, metadata := range routeMatch.GetDynamicMetadata() {
+					rule.Claims = append(rule.Claims, getRouteClaimMatch(metadata)...)
 				}
 				binding.Rule = rule
 				if vroute.GetTypedPerFilterConfig() != nil {
 					binding.Fault = getFault(vroute.GetTypedPerFilterConfig())
 				}
+				binding.RateLimit = getRouteRateLimit(listenerRateLimit, virtualHost, vroute)
+				binding.GlobalRateLimit = getGlobalRateLimit(globalRateLimitFilter, rateLimitConfig, getRouteRateLimits(virtualHost, vroute, globalRateLimitFilter.GetStage()), vroute.GetRoute().GetCluster())
 				xDSLogger.Trace("routeUpdate: virtual host's route details", "vroute", vroute.GetRoute())
 				binding.RwPolicy.PrefixRewrite = vroute.GetRoute().GetPrefixRewrite()
+				if regexRewrite := vroute.GetRoute().GetRegexRewrite(); regexRewrite != nil {
+					if regexSubstitutionGroup.MatchString(regexRewrite.GetSubstitution()) {
+						// Citrix ADC's replace_all action can not refer to capture groups of the search regex
+						xDSLogger.Error("routeUpdate: Capture groups in regex rewrite substitution are not supported. Path of the route is not rewritten", "routeName", route.Name, "route", vroute.GetName(), "substitution", regexRewrite.GetSubstitution())
+					} else {
+						binding.RwPolicy.RegexRewritePattern = regexRewrite.GetPattern().GetRegex()
+						binding.RwPolicy.RegexRewriteSubstitution = regexRewrite.GetSubstitution()
+					}
+				}
 				binding.RwPolicy.HostRewrite = vroute.GetRoute().GetHostRewriteLiteral() //TODO: confirm GetHostRewriteHeader()
 				for _, reqAddHeader := range vroute.GetRequestHeadersToAdd() {
 					binding.RwPolicy.AddHeaders = append(binding.RwPolicy.AddHeaders, nsconfigengine.RwHeader{Key: reqAddHeader.GetHeader().GetKey(), Value: reqAddHeader.GetHeader().GetValue()})
 				}
 				var persistency *nsconfigengine.PersistencyPolicy
-				if vroute.GetRoute().GetHashPolicy() != nil && serviceType == "HTTP" {
+				hashLb := nsConfig.hashLbClusters[vroute.GetRoute().GetCluster()]
+				if (vroute.GetRoute().GetHashPolicy() != nil || hashLb) && serviceType == "HTTP" {
+					// Hash policy selects the hash based LB method of the cluster balanced by consistent hashing
 					persistency = getPersistencyPolicy(vroute.GetRoute().GetHashPolicy())
+					persistency.ConsistentHash = hashLb
 				}
 				/* HTTP Mirroing */
-				// TODO: Array of Mirror policies. Make MirrorPolicy also as an array.
-				if vroute.GetRoute().GetRequestMirrorPolicies() != nil {
-					rmp := vroute.GetRoute().GetRequestMirrorPolicies()[0] // Choosing first policy
+				for _, rmp := range vroute.GetRoute().GetRequestMirrorPolicies() {
 					mirror := new(nsconfigengine.HTTPMirror)
 					fullReqHdr := "http.req.full_header + http.req.body(10000000)"
 					mirrorClusterName := rmp.GetCluster()
 					mirror.Callout = nsconfigengine.NewHTTPCalloutPolicy(nsconfigengine.GetNSCompatibleName(mirrorClusterName), "Bool", fullReqHdr, "", "", "true")
-					/* TODO: Support mirror Weight */
-					mirror.Weight = defaultMirrorWeight
-					/*mirror.Weight =  vroute.GetRoute().GetRequestMirrorPolicy().GetRuntimeFraction()*/
-					binding.MirrorPolicy = mirror
+					mirror.Weight = getMirrorWeight(rmp)
+					binding.MirrorPolicies = append(binding.MirrorPolicies, mirror)
 					clusterNames = append(clusterNames, mirrorClusterName)
 				}
+				routeMetadata := getLbMetadata(vroute.GetRoute().GetMetadataMatch())
 				if vroute.GetRoute().GetCluster() != "" {
-					binding.CsPolicy.Canary = append(binding.CsPolicy.Canary, nsconfigengine.Canary{LbVserverName: nsconfigengine.GetNSCompatibleName(vroute.GetRoute().GetCluster()), LbVserverType: serviceType, Weight: 100, Persistency: persistency})
+					targetName := nsConfig.getPriorityTargetName(vroute.GetRoute().GetCluster(), getRouteTargetName(vroute.GetRoute().GetCluster(), routeMetadata, nil), vroute.GetRoute().GetPriority())
+					binding.CsPolicy.Canary = append(binding.CsPolicy.Canary, nsconfigengine.Canary{LbVserverName: targetName, LbVserverType: serviceType, Weight: 100, Persistency: persistency})
 					clusterNames = append(clusterNames, vroute.GetRoute().GetCluster())
 				} else if vroute.GetRoute().GetWeightedClusters().GetClusters() != nil {
 					for _, cluster := range vroute.GetRoute().GetWeightedClusters().GetClusters() {
-						binding.CsPolicy.Canary = append(binding.CsPolicy.Canary, nsconfigengine.Canary{LbVserverName: nsconfigengine.GetNSCompatibleName(cluster.GetName()), LbVserverType: serviceType, Weight: int(cluster.GetWeight().GetValue())})
+						targetName := nsConfig.getPriorityTargetName(cluster.GetName(), getRouteTargetName(cluster.GetName(), routeMetadata, getLbMetadata(cluster.GetMetadataMatch())), vroute.GetRoute().GetPriority())
+						binding.CsPolicy.Canary = append(binding.CsPolicy.Canary, nsconfigengine.Canary{LbVserverName: targetName, LbVserverType: serviceType, Weight: int(cluster.GetWeight().GetValue())})
 						clusterNames = append(clusterNames, cluster.GetName())
 					}
+				} else if vroute.GetRoute().GetClusterHeader() != "" {
+					// Clusters selected by the header are expected to be referred by other routes, and hence already configured
+					binding.CsPolicy.Canary = append(binding.CsPolicy.Canary, nsconfigengine.Canary{TargetVserverExpr: "HTTP.REQ.HEADER(\"" + vroute.GetRoute().GetClusterHeader() + "\").MAP_STRING(\"" + clusterHeaderStringMap + "\")", LbVserverType: serviceType, Weight: 100})
 				}
 				binding.ResPolicy.RedirectHost = vroute.GetRedirect().GetHostRedirect()
 				binding.ResPolicy.RedirectPath = vroute.GetRedirect().GetPathRedirect()
@@ -1156,6 +2441,31 @@ func routeUpdate(nsConfig *configAdaptor, routes []*xdsRoute.RouteConfiguration,
 	return map[string]interface{}{"cdsNames": clusterNames, "serviceType": inputMap["serviceType"]}
 }
 
+// getRouteTargetName returns the LB vserver name of the route's target cluster.
+// If the route has metadata_match, subset LB vserver of the cluster is returned. Metadata of weighted cluster overrides route's metadata
+func getRouteTargetName(clusterName string, routeMetadata, clusterMetadata map[string]string) string {
+	subsetMetadata := make(map[string]string)
+	for key, value := range routeMetadata {
+		subsetMetadata[key] = value
+	}
+	for key, value := range clusterMetadata {
+		subsetMetadata[key] = value
+	}
+	if len(subsetMetadata) == 0 {
+		return nsconfigengine.GetNSCompatibleName(clusterName)
+	}
+	return getSubsetEntityName(clusterName, subsetMetadata)
+}
+
+// getPriorityTargetName returns the LB vserver of the HIGH priority routes to the cluster, if the route is of HIGH priority, targets the LB
+// vserver of the cluster and the cluster has HIGH priority circuit breaker. Otherwise the target LB vserver is returned
+func (nsConfig *configAdaptor) getPriorityTargetName(clusterName, targetName string, priority core.RoutingPriority) string {
+	if priority == core.RoutingPriority_HIGH && nsConfig.highLbClusters[clusterName] && targetName == nsconfigengine.GetNSCompatibleName(clusterName) {
+		return nsconfigengine.GetHighPriorityLbName(targetName)
+	}
+	return targetName
+}
+
 // processWeightedTCPClusters processes weighted clusters provided in listener resource's TCP filter.
 // We need to create canary config for these weighted clusters that is categorized as "rdsAdd" configblock.
 func processWeightedTCPClusters(nsConfig *configAdaptor, tcpProxy *envoyFilterTcp.TcpProxy, data interface{}) map[string]interface{} {
@@ -28,18 +28,24 @@ import (
 
 	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
 	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	xdsratelimit "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
 	xdsfault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/common/fault/v3"
 	xdshttpfault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
 	envoy_jwt "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	xdslocalratelimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/local_ratelimit/v3"
 	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
 	auth "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	upstreamhttp "github.com/envoyproxy/go-control-plane/envoy/extensions/upstreams/http/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
 	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
 	xdsutil "github.com/envoyproxy/go-control-plane/pkg/wellknown"
 	ptypes "github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 	duration "github.com/golang/protobuf/ptypes/duration"
+	_struct "github.com/golang/protobuf/ptypes/struct"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
 )
 
@@ -115,9 +121,10 @@ func Test_getLbMethod(t *testing.T) {
 		expectedOutput string
 	}{
 		{cluster.Cluster_ROUND_ROBIN, "ROUNDROBIN"},
-		{cluster.Cluster_LEAST_REQUEST, "LEASTCONNECTION"},
+		{cluster.Cluster_LEAST_REQUEST, "LEASTREQUEST"},
 		{cluster.Cluster_RANDOM, "LEASTCONNECTION"},
-		{cluster.Cluster_RING_HASH, "ROUNDROBIN"},
+		{cluster.Cluster_RING_HASH, ""},
+		{cluster.Cluster_MAGLEV, ""},
 	}
 
 	for _, c := range cases {
@@ -127,6 +134,296 @@ func Test_getLbMethod(t *testing.T) {
 	}
 }
 
+func Test_getSlowStartWindow(t *testing.T) {
+	cases := []struct {
+		input          *cluster.Cluster
+		expectedOutput int
+	}{
+		{&cluster.Cluster{LbPolicy: cluster.Cluster_ROUND_ROBIN}, 0},
+		{&cluster.Cluster{LbPolicy: cluster.Cluster_ROUND_ROBIN, LbConfig: &cluster.Cluster_RoundRobinLbConfig_{RoundRobinLbConfig: &cluster.Cluster_RoundRobinLbConfig{
+			SlowStartConfig: &cluster.Cluster_SlowStartConfig{SlowStartWindow: &duration.Duration{Seconds: 30}}}}}, 30},
+		{&cluster.Cluster{LbPolicy: cluster.Cluster_LEAST_REQUEST, LbConfig: &cluster.Cluster_LeastRequestLbConfig_{LeastRequestLbConfig: &cluster.Cluster_LeastRequestLbConfig{
+			ChoiceCount: &wrappers.UInt32Value{Value: 3}, SlowStartConfig: &cluster.Cluster_SlowStartConfig{SlowStartWindow: &duration.Duration{Seconds: 5, Nanos: 500000000}}}}}, 6},
+	}
+	for _, c := range cases {
+		if output := getSlowStartWindow(c.input); output != c.expectedOutput {
+			t.Errorf("Expected slow start window %d, received %d", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getHealthMonitors(t *testing.T) {
+	input := &cluster.Cluster{Name: "c1", HealthChecks: []*core.HealthCheck{
+		{Interval: &duration.Duration{Seconds: 10}, Timeout: &duration.Duration{Nanos: 500000000}, UnhealthyThreshold: &wrappers.UInt32Value{Value: 3}, HealthyThreshold: &wrappers.UInt32Value{Value: 2},
+			HealthChecker: &core.HealthCheck_HttpHealthCheck_{HttpHealthCheck: &core.HealthCheck_HttpHealthCheck{Host: "svc.local", Path: "/healthz",
+				ExpectedStatuses: []*xdstype.Int64Range{{Start: 200, End: 300}, {Start: 404, End: 405}}}}},
+		{Interval: &duration.Duration{Seconds: 5}, HealthChecker: &core.HealthCheck_TcpHealthCheck_{TcpHealthCheck: &core.HealthCheck_TcpHealthCheck{}}},
+		{Interval: &duration.Duration{Seconds: 5}, HealthChecker: &core.HealthCheck_TcpHealthCheck_{TcpHealthCheck: &core.HealthCheck_TcpHealthCheck{
+			Send:    &core.HealthCheck_Payload{Payload: &core.HealthCheck_Payload_Text{Text: "50494E47"}},
+			Receive: []*core.HealthCheck_Payload{{Payload: &core.HealthCheck_Payload_Binary{Binary: []byte("PONG")}}, {Payload: &core.HealthCheck_Payload_Text{Text: "4f4b"}}}}}},
+		{Interval: &duration.Duration{Seconds: 5}, HealthChecker: &core.HealthCheck_TcpHealthCheck_{TcpHealthCheck: &core.HealthCheck_TcpHealthCheck{
+			Send: &core.HealthCheck_Payload{Payload: &core.HealthCheck_Payload_Text{Text: "PING"}}}}},
+		{Interval: &duration.Duration{Seconds: 5}, HealthChecker: &core.HealthCheck_GrpcHealthCheck_{GrpcHealthCheck: &core.HealthCheck_GrpcHealthCheck{ServiceName: "grpc.health", Authority: "svc.local"}}},
+		{Interval: &duration.Duration{Seconds: 5}, HealthChecker: &core.HealthCheck_CustomHealthCheck_{CustomHealthCheck: &core.HealthCheck_CustomHealthCheck{Name: "custom"}}},
+	}}
+	expectedOutput := []nsconfigengine.HealthMonitor{
+		{Type: "HTTP", HTTPRequest: "GET /healthz", Host: "svc.local", RespCodes: []string{"200-299", "404"}, Interval: 10000, Timeout: 500, UnhealthyThreshold: 3, HealthyThreshold: 2},
+		{Type: "TCP", Interval: 5000},
+		{Type: "TCP-ECV", Send: "PING", Recv: []string{"PONG", "OK"}, Interval: 5000},
+		{Type: "GRPC", GRPCService: "grpc.health", Host: "svc.local", Interval: 5000},
+	}
+	if output := getHealthMonitors(input); !reflect.DeepEqual(output, expectedOutput) {
+		t.Errorf("Expected %v, received %v", expectedOutput, output)
+	}
+}
+
+func Test_getOutlierMonitor(t *testing.T) {
+	cases := []struct {
+		outlierDetection *cluster.OutlierDetection
+		serviceGroupType string
+		expectedOutput   *nsconfigengine.LBMonitor
+	}{
+		{nil, "HTTP", nil},
+		{&cluster.OutlierDetection{Consecutive_5Xx: &wrappers.UInt32Value{Value: 5}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 3}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, MaxEjectionPercent: &wrappers.UInt32Value{Value: 40}}, "HTTP",
+			&nsconfigengine.LBMonitor{Type: "HTTP-INLINE", RespCodes: []string{"100-499"}, Retries: 3, MaxEjectionPercent: 40}},
+		{&cluster.OutlierDetection{Consecutive_5Xx: &wrappers.UInt32Value{Value: 5}, EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 3}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, MaxEjectionPercent: &wrappers.UInt32Value{Value: 100}}, "HTTP",
+			&nsconfigengine.LBMonitor{Type: "HTTP-INLINE", RespCodes: []string{"100-501", "505-599"}, Retries: 3}},
+		// Gateway failures are not enforced by default
+		{&cluster.OutlierDetection{EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 3}}, "HTTP",
+			&nsconfigengine.LBMonitor{Type: "HTTP-INLINE", RespCodes: []string{"100-599"}}},
+		{&cluster.OutlierDetection{SplitExternalLocalOriginErrors: true, ConsecutiveLocalOriginFailure: &wrappers.UInt32Value{Value: 2}, EnforcingFailurePercentage: &wrappers.UInt32Value{Value: 100}}, "HTTP",
+			&nsconfigengine.LBMonitor{Type: "HTTP-INLINE", RespCodes: []string{"100-499"}, Retries: 2}},
+		// Consecutive 5xx errors default to 5
+		{&cluster.OutlierDetection{Interval: &duration.Duration{Seconds: 10}}, "HTTP",
+			&nsconfigengine.LBMonitor{Type: "HTTP-INLINE", RespCodes: []string{"100-499"}, Retries: 5, Interval: 10, IntervalUnits: "SEC"}},
+		{&cluster.OutlierDetection{Consecutive_5Xx: &wrappers.UInt32Value{Value: 4}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 3}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100},
+			BaseEjectionTime: &duration.Duration{Nanos: 500000000}, MaxEjectionPercent: &wrappers.UInt32Value{Value: 30}}, "TCP",
+			&nsconfigengine.LBMonitor{Type: "TCP", Retries: 4, DownTime: 500, DownTimeUnits: "MSEC", MaxEjectionPercent: 30}},
+		// Connection failures split as local origin errors are not counted as 5xx errors
+		{&cluster.OutlierDetection{SplitExternalLocalOriginErrors: true, Consecutive_5Xx: &wrappers.UInt32Value{Value: 4}, ConsecutiveLocalOriginFailure: &wrappers.UInt32Value{Value: 6}}, "SSL_TCP",
+			&nsconfigengine.LBMonitor{Type: "TCP", Retries: 6}},
+		{&cluster.OutlierDetection{Consecutive_5Xx: &wrappers.UInt32Value{Value: 4}}, "SSL", nil},
+	}
+	for _, c := range cases {
+		output := getOutlierMonitor(&cluster.Cluster{Name: "c1", OutlierDetection: c.outlierDetection}, c.serviceGroupType)
+		if !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %v, received %v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getCircuitBreakers(t *testing.T) {
+	cases := []struct {
+		thresholds             []*cluster.CircuitBreakers_Thresholds
+		expectedDefault        *nsconfigengine.CircuitBreaker
+		expectedHigh           *nsconfigengine.CircuitBreaker
+		expectedMaxConnections int
+	}{
+		{nil, nil, nil, maxConn},
+		{[]*cluster.CircuitBreakers_Thresholds{{MaxConnections: &wrappers.UInt32Value{Value: 100}, MaxPendingRequests: &wrappers.UInt32Value{Value: 50}, MaxRequests: &wrappers.UInt32Value{Value: 2000}, MaxRetries: &wrappers.UInt32Value{Value: 3}}},
+			&nsconfigengine.CircuitBreaker{MaxConnections: 100, MaxRequests: 2000, MaxPendingRequests: 50}, nil, 100},
+		{[]*cluster.CircuitBreakers_Thresholds{{Priority: core.RoutingPriority_HIGH, MaxConnections: &wrappers.UInt32Value{Value: 10}}, {MaxRequests: &wrappers.UInt32Value{Value: 200}}},
+			&nsconfigengine.CircuitBreaker{MaxRequests: 200}, &nsconfigengine.CircuitBreaker{MaxConnections: 10}, maxConn},
+		{[]*cluster.CircuitBreakers_Thresholds{{MaxConnections: &wrappers.UInt32Value{Value: 100}, MaxRequests: &wrappers.UInt32Value{Value: 200}}, {Priority: core.RoutingPriority_HIGH, MaxConnections: &wrappers.UInt32Value{Value: 20}, MaxRequests: &wrappers.UInt32Value{Value: 50}, MaxPendingRequests: &wrappers.UInt32Value{Value: 5}}},
+			&nsconfigengine.CircuitBreaker{MaxConnections: 100, MaxRequests: 200}, &nsconfigengine.CircuitBreaker{MaxConnections: 20, MaxRequests: 50, MaxPendingRequests: 5}, 120},
+		{[]*cluster.CircuitBreakers_Thresholds{{Priority: core.RoutingPriority_HIGH, MaxConnections: &wrappers.UInt32Value{Value: 10}}}, nil, &nsconfigengine.CircuitBreaker{MaxConnections: 10}, maxConn},
+		{[]*cluster.CircuitBreakers_Thresholds{{MaxConnections: &wrappers.UInt32Value{Value: maxConn}, MaxPendingRequests: &wrappers.UInt32Value{Value: 50}}}, nil, nil, maxConn},
+	}
+	for _, c := range cases {
+		lbObj := &nsconfigengine.LBApi{MaxConnections: maxConn, MaxHTTP2ConcurrentStreams: maxHTTP2Conn}
+		defaultOutput, highOutput := getCircuitBreakers(&cluster.Cluster{Name: "c1", CircuitBreakers: &cluster.CircuitBreakers{Thresholds: c.thresholds}}, lbObj)
+		if !reflect.DeepEqual(defaultOutput, c.expectedDefault) || !reflect.DeepEqual(highOutput, c.expectedHigh) {
+			t.Errorf("Expected %v/%v, received %v/%v", c.expectedDefault, c.expectedHigh, defaultOutput, highOutput)
+		}
+		// max_requests never limits the HTTP/2 streams per connection
+		if lbObj.MaxConnections != c.expectedMaxConnections || lbObj.MaxHTTP2ConcurrentStreams != maxHTTP2Conn {
+			t.Errorf("Expected limits %d/%d, received %d/%d", c.expectedMaxConnections, maxHTTP2Conn, lbObj.MaxConnections, lbObj.MaxHTTP2ConcurrentStreams)
+		}
+	}
+}
+
+func Test_getHTTPProtocolOptions(t *testing.T) {
+	explicitHTTP2, _ := ptypes.MarshalAny(&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{
+		ProtocolConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{Http2ProtocolOptions: &core.Http2ProtocolOptions{MaxConcurrentStreams: &wrappers.UInt32Value{Value: 200}, InitialStreamWindowSize: &wrappers.UInt32Value{Value: 1048576}, InitialConnectionWindowSize: &wrappers.UInt32Value{Value: 268435456}}}}}})
+	explicitHTTP1, _ := ptypes.MarshalAny(&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{
+		ProtocolConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{HttpProtocolOptions: &core.Http1ProtocolOptions{}}}}})
+	autoConfig, _ := ptypes.MarshalAny(&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_AutoConfig{AutoConfig: &upstreamhttp.HttpProtocolOptions_AutoHttpConfig{}}})
+	cases := []struct {
+		cluster                 *cluster.Cluster
+		expectedOutput          *nsconfigengine.HTTPProtocolOptions
+		expectedMaxHTTP2Streams int
+	}{
+		{&cluster.Cluster{Name: "c1"}, nil, maxHTTP2Conn},
+		{&cluster.Cluster{Name: "c1", TypedExtensionProtocolOptions: map[string]*any.Any{httpProtocolOptionsName: explicitHTTP2}},
+			&nsconfigengine.HTTPProtocolOptions{HTTP2: true, HTTP2Direct: true, InitialStreamWindowSize: 1048576, InitialConnWindowSize: maxHTTP2WindowSize}, 200},
+		{&cluster.Cluster{Name: "c1", TypedExtensionProtocolOptions: map[string]*any.Any{httpProtocolOptionsName: explicitHTTP1}}, &nsconfigengine.HTTPProtocolOptions{}, maxHTTP2Conn},
+		{&cluster.Cluster{Name: "c1", TypedExtensionProtocolOptions: map[string]*any.Any{httpProtocolOptionsName: autoConfig}}, &nsconfigengine.HTTPProtocolOptions{HTTP2: true}, maxHTTP2Conn},
+		{&cluster.Cluster{Name: "c1", Http2ProtocolOptions: &core.Http2ProtocolOptions{InitialStreamWindowSize: &wrappers.UInt32Value{Value: 1024}}},
+			&nsconfigengine.HTTPProtocolOptions{HTTP2: true, HTTP2Direct: true, InitialStreamWindowSize: minHTTP2WindowSize}, maxHTTP2Conn},
+	}
+	for _, c := range cases {
+		lbObj := &nsconfigengine.LBApi{MaxHTTP2ConcurrentStreams: maxHTTP2Conn}
+		output := getHTTPProtocolOptions(c.cluster, lbObj)
+		if !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %v, received %v", c.expectedOutput, output)
+		}
+		if lbObj.MaxHTTP2ConcurrentStreams != c.expectedMaxHTTP2Streams {
+			t.Errorf("Expected %d HTTP/2 streams, received %d", c.expectedMaxHTTP2Streams, lbObj.MaxHTTP2ConcurrentStreams)
+		}
+	}
+}
+
+func Test_getIgnoredHTTPProtocolOptions(t *testing.T) {
+	cases := []struct {
+		protocolOptions *upstreamhttp.HttpProtocolOptions
+		expectedOutput  []string
+	}{
+		{&upstreamhttp.HttpProtocolOptions{}, []string{}},
+		{&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{
+			ProtocolConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{Http2ProtocolOptions: &core.Http2ProtocolOptions{MaxConcurrentStreams: &wrappers.UInt32Value{Value: 200},
+				InitialStreamWindowSize: &wrappers.UInt32Value{Value: 1048576}}}}}}, []string{}},
+		{&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{
+			ProtocolConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_HttpProtocolOptions{HttpProtocolOptions: &core.Http1ProtocolOptions{}}}}}, []string{}},
+		{&upstreamhttp.HttpProtocolOptions{CommonHttpProtocolOptions: &core.HttpProtocolOptions{IdleTimeout: &duration.Duration{Seconds: 60}},
+			UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_{ExplicitHttpConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig{
+				ProtocolConfig: &upstreamhttp.HttpProtocolOptions_ExplicitHttpConfig_Http2ProtocolOptions{Http2ProtocolOptions: &core.Http2ProtocolOptions{HpackTableSize: &wrappers.UInt32Value{Value: 0},
+					MaxOutboundFrames: &wrappers.UInt32Value{Value: 1000}, ConnectionKeepalive: &core.KeepaliveSettings{Interval: &duration.Duration{Seconds: 30}}}}}}},
+			[]string{"common_http_protocol_options", "hpack_table_size", "frame flood limits", "connection_keepalive"}},
+		{&upstreamhttp.HttpProtocolOptions{UpstreamProtocolOptions: &upstreamhttp.HttpProtocolOptions_AutoConfig{AutoConfig: &upstreamhttp.HttpProtocolOptions_AutoHttpConfig{
+			HttpProtocolOptions: &core.Http1ProtocolOptions{EnableTrailers: true}, Http3ProtocolOptions: &core.Http3ProtocolOptions{}}}},
+			[]string{"auto_config HTTP/3", "http_protocol_options"}},
+	}
+	for _, c := range cases {
+		output := getIgnoredHTTPProtocolOptions(c.protocolOptions)
+		if !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %v, received %v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getSSLProfileSpec(t *testing.T) {
+	cases := []struct {
+		tlsContext     *auth.DownstreamTlsContext
+		vserverType    string
+		expectedOutput *nsconfigengine.SSLProfileSpec
+		expectedErr    bool
+	}{
+		{&auth.DownstreamTlsContext{}, "SSL", nil, false},
+		{&auth.DownstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{AlpnProtocols: []string{"h2", "http/1.1"}}}, "SSL", nil, false},
+		{&auth.DownstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{AlpnProtocols: []string{"h2", "http/1.1"}}}, "SSL_TCP",
+			&nsconfigengine.SSLProfileSpec{MinVersion: "TLSv1.2", MaxVersion: "TLSv1.3", ALPNProtocols: []string{"h2", "http/1.1"}, SessionTickets: true}, false},
+		{&auth.DownstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{TlsParams: &auth.TlsParameters{TlsMinimumProtocolVersion: auth.TlsParameters_TLSv1_1, TlsMaximumProtocolVersion: auth.TlsParameters_TLSv1_2,
+			CipherSuites: []string{"[ECDHE-ECDSA-AES128-GCM-SHA256|ECDHE-ECDSA-CHACHA20-POLY1305]", "ECDHE-RSA-AES128-GCM-SHA256"}, EcdhCurves: []string{"X25519", "P-256"}}},
+			SessionTicketKeysType: &auth.DownstreamTlsContext_DisableStatelessSessionResumption{DisableStatelessSessionResumption: true}, SessionTimeout: &duration.Duration{Seconds: 300}}, "SSL",
+			&nsconfigengine.SSLProfileSpec{MinVersion: "TLSv1.1", MaxVersion: "TLSv1.2", Ciphers: []string{"ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-ECDSA-CHACHA20-POLY1305", "ECDHE-RSA-AES128-GCM-SHA256"},
+				ECCCurves: []string{"X25519", "P-256"}, SessionTimeout: 300}, false},
+		{&auth.DownstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{TlsParams: &auth.TlsParameters{CipherSuites: []string{"ECDHE-PSK-CHACHA20-POLY1305", "ECDHE-RSA-AES128-GCM-SHA256"}}}}, "SSL",
+			&nsconfigengine.SSLProfileSpec{MinVersion: "TLSv1.2", MaxVersion: "TLSv1.3", Ciphers: []string{"ECDHE-PSK-CHACHA20-POLY1305", "ECDHE-RSA-AES128-GCM-SHA256"}, SessionTickets: true}, false},
+		// TLS context is refused if none of the cipher suites is supported
+		{&auth.DownstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{TlsParams: &auth.TlsParameters{CipherSuites: []string{"PSK-AES256-CBC-SHA"}}}}, "SSL", nil, true},
+	}
+	for _, c := range cases {
+		output, err := getSSLProfileSpec(c.tlsContext, c.vserverType)
+		if !reflect.DeepEqual(output, c.expectedOutput) || (err != nil) != c.expectedErr {
+			t.Errorf("Expected %+v/%v, received %+v/%v", c.expectedOutput, c.expectedErr, output, err)
+		}
+	}
+}
+
+func Test_getUpstreamServerNames(t *testing.T) {
+	exactMatcher := func(value string) *matcher.StringMatcher {
+		return &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: value}}
+	}
+	validationContext := func(validationContext *auth.CertificateValidationContext) *auth.CommonTlsContext {
+		return &auth.CommonTlsContext{ValidationContextType: &auth.CommonTlsContext_ValidationContext{ValidationContext: validationContext}}
+	}
+	cases := []struct {
+		tlsContext              *auth.UpstreamTlsContext
+		expectedSNI             string
+		expectedSubjectAltNames []string
+		expectedErr             bool
+	}{
+		{&auth.UpstreamTlsContext{}, "", nil, false},
+		{&auth.UpstreamTlsContext{Sni: "svc1.example.com"}, "svc1.example.com", nil, false},
+		{&auth.UpstreamTlsContext{Sni: "svc1.example.com", CommonTlsContext: validationContext(&auth.CertificateValidationContext{
+			MatchSubjectAltNames:      []*matcher.StringMatcher{exactMatcher("svc2.example.com")},
+			MatchTypedSubjectAltNames: []*auth.SubjectAltNameMatcher{{SanType: auth.SubjectAltNameMatcher_DNS, Matcher: exactMatcher("svc2.example.com")}}})},
+			"svc1.example.com", []string{"svc2.example.com"}, false},
+		{&auth.UpstreamTlsContext{Sni: "svc1.example.com", CommonTlsContext: validationContext(&auth.CertificateValidationContext{
+			MatchSubjectAltNames: []*matcher.StringMatcher{exactMatcher("svc1.example.com"), exactMatcher("svc2.example.com")}})}, "", nil, true},
+		{&auth.UpstreamTlsContext{CommonTlsContext: validationContext(&auth.CertificateValidationContext{
+			MatchTypedSubjectAltNames: []*auth.SubjectAltNameMatcher{{SanType: auth.SubjectAltNameMatcher_DNS, Matcher: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "svc"}}}}})}, "", nil, true},
+		{&auth.UpstreamTlsContext{Sni: "outbound_.9080_._.svc1.default.svc.cluster.local", CommonTlsContext: &auth.CommonTlsContext{ValidationContextType: &auth.CommonTlsContext_CombinedValidationContext{
+			CombinedValidationContext: &auth.CommonTlsContext_CombinedCertificateValidationContext{DefaultValidationContext: &auth.CertificateValidationContext{
+				MatchSubjectAltNames: []*matcher.StringMatcher{exactMatcher("spiffe://cluster.local/ns/default/sa/svc1")}}}}}}, "", nil, true},
+	}
+	for _, c := range cases {
+		sni, subjectAltNames, err := getUpstreamServerNames(c.tlsContext)
+		if sni != c.expectedSNI || !reflect.DeepEqual(subjectAltNames, c.expectedSubjectAltNames) || (err != nil) != c.expectedErr {
+			t.Errorf("Expected %s/%v/%v, received %s/%v/%v", c.expectedSNI, c.expectedSubjectAltNames, c.expectedErr, sni, subjectAltNames, err)
+		}
+	}
+}
+
+func Test_clusterAdd_unverifiableServer(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	cds := env.MakeCluster("c1")
+	tlsContext, _ := ptypes.MarshalAny(&auth.UpstreamTlsContext{CommonTlsContext: &auth.CommonTlsContext{ValidationContextType: &auth.CommonTlsContext_ValidationContext{ValidationContext: &auth.CertificateValidationContext{
+		MatchSubjectAltNames: []*matcher.StringMatcher{{MatchPattern: &matcher.StringMatcher_Exact{Exact: "spiffe://cluster.local/ns/default/sa/svc1"}}}}}}})
+	cds.TransportSocket = &core.TransportSocket{Name: EnvoyTLSSocketName, ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: tlsContext}}
+	if edsName := clusterAdd(nsConfAdaptor, cds, "HTTP"); edsName != "" {
+		t.Errorf("Expected no endpoints to be requested for the refused cluster, received %s", edsName)
+	}
+	if _, ok := nsConfAdaptor.cdsHash["c1"]; ok {
+		t.Errorf("Expected cluster with unverifiable subject alternative names to be refused")
+	}
+}
+
+func Test_setRevocationCheck(t *testing.T) {
+	inlineCRL := &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: "crl1"}}
+	cases := []struct {
+		commonTLSContext *auth.CommonTlsContext
+		sslObjs          []nsconfigengine.SSLSpec
+		expectedSSLObjs  []nsconfigengine.SSLSpec
+	}{
+		{nil, []nsconfigengine.SSLSpec{{RootCertFilename: "ca1"}}, []nsconfigengine.SSLSpec{{RootCertFilename: "ca1"}}},
+		{&auth.CommonTlsContext{ValidationContextType: &auth.CommonTlsContext_ValidationContext{ValidationContext: &auth.CertificateValidationContext{Crl: inlineCRL}}},
+			[]nsconfigengine.SSLSpec{{CertFilename: "cert1"}, {RootCert: "ca2"}},
+			[]nsconfigengine.SSLSpec{{CertFilename: "cert1"}, {RootCert: "ca2", CRL: "crl1"}}},
+		{&auth.CommonTlsContext{ValidationContextType: &auth.CommonTlsContext_CombinedValidationContext{CombinedValidationContext: &auth.CommonTlsContext_CombinedCertificateValidationContext{
+			DefaultValidationContext: &auth.CertificateValidationContext{Crl: inlineCRL}}}},
+			[]nsconfigengine.SSLSpec{{RootCertFilename: "ca1"}},
+			[]nsconfigengine.SSLSpec{{RootCertFilename: "ca1", CRL: "crl1"}}},
+	}
+	for _, c := range cases {
+		setRevocationCheck(nil, c.commonTLSContext, c.sslObjs)
+		if !reflect.DeepEqual(c.sslObjs, c.expectedSSLObjs) {
+			t.Errorf("Expected %+v, received %+v", c.expectedSSLObjs, c.sslObjs)
+		}
+	}
+}
+
+func Test_getForwardClientCertSpec(t *testing.T) {
+	cases := []struct {
+		httpCM   *http_conn.HttpConnectionManager
+		expected *nsconfigengine.ForwardClientCertSpec
+	}{
+		{&http_conn.HttpConnectionManager{}, &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}},
+		{&http_conn.HttpConnectionManager{ForwardClientCertDetails: http_conn.HttpConnectionManager_FORWARD_ONLY}, &nsconfigengine.ForwardClientCertSpec{Mode: "FORWARD_ONLY"}},
+		{&http_conn.HttpConnectionManager{ForwardClientCertDetails: http_conn.HttpConnectionManager_APPEND_FORWARD,
+			SetCurrentClientCertDetails: &http_conn.HttpConnectionManager_SetCurrentClientCertDetails{Subject: &wrappers.BoolValue{Value: true}, Uri: true, Dns: true}},
+			&nsconfigengine.ForwardClientCertSpec{Mode: "APPEND_FORWARD", Subject: true, URI: true}},
+		{&http_conn.HttpConnectionManager{ForwardClientCertDetails: http_conn.HttpConnectionManager_SANITIZE_SET,
+			SetCurrentClientCertDetails: &http_conn.HttpConnectionManager_SetCurrentClientCertDetails{Cert: true}},
+			&nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE_SET"}},
+	}
+	for _, c := range cases {
+		if output := getForwardClientCertSpec(c.httpCM, "l1"); !reflect.DeepEqual(output, c.expected) {
+			t.Errorf("Expected %+v, received %+v", c.expected, output)
+		}
+	}
+}
+
 func getNsConfAdaptor() *configAdaptor {
 	configAdaptor := new(configAdaptor)
 	configAdaptor.vserverIP = "1.1.1.1"
@@ -136,6 +433,15 @@ func getNsConfAdaptor() *configAdaptor {
 	configAdaptor.edsHash = make(map[string]*list.Element)
 	configAdaptor.ldsHash = make(map[string]*list.Element)
 	configAdaptor.rdsHash = make(map[string]*list.Element)
+	configAdaptor.lbSubsets = make(map[string]*lbSubsetInfo)
+	configAdaptor.lbPriorities = make(map[string]*lbPriorityInfo)
+	configAdaptor.hashLbClusters = make(map[string]bool)
+	configAdaptor.highLbClusters = make(map[string]bool)
+	configAdaptor.appliedRoutes = make(map[string]*appliedRouteInfo)
+	configAdaptor.extAuthzClusters = make(map[string]*extAuthzClusterInfo)
+	configAdaptor.appliedEds = make(map[string]*configBlock)
+	configAdaptor.remoteJwks = make(map[string]*remoteJwksInfo)
+	configAdaptor.tracingSpecs = make(map[string]*nsconfigengine.TracingSpec)
 	return configAdaptor
 }
 
@@ -189,9 +495,11 @@ func Test_clusterAdd(t *testing.T) {
 	nsConfAdaptor.watch = w
 	w.nsConfig = nsConfAdaptor
 	log.Println("HTTP cluster add")
-	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}}
-	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s"}
+	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}}
+	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s", StringMapBindings: []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: "c1", Value: "c1"}}}
 	lbObj.LbMonitorObj = new(nsconfigengine.LBMonitor)
+	lbObj.LbMonitorObj.Type = "HTTP-INLINE"
+	lbObj.LbMonitorObj.RespCodes = []string{"100-501", "505-599"}
 	lbObj.LbMonitorObj.Retries = 9
 	lbObj.LbMonitorObj.Interval = 5100
 	lbObj.LbMonitorObj.IntervalUnits = "MSEC"
@@ -202,7 +510,7 @@ func Test_clusterAdd(t *testing.T) {
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
 	}
-	lbObj.LbMonitorObj = nil
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Interval: 5100, IntervalUnits: "MSEC", DownTime: 7, DownTimeUnits: "SEC"}
 	log.Println("TCP cluster add")
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "TCP"
@@ -223,7 +531,7 @@ func Test_clusterAdd(t *testing.T) {
 	lbObj.BackendServiceType = "SSL"
 	lbObj.MaxConnections = 500
 	lbObj.MaxRequestsPerConnection = 100
-	lbObj.MaxHTTP2ConcurrentStreams = 750
+	lbObj.CircuitBreaker = &nsconfigengine.CircuitBreaker{MaxConnections: 500, MaxRequests: 750}
 	lbObj.BackendTLS = []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertFileName, PrivateKeyFilename: nsKeyFileName}}
 	lbObj.LbMonitorObj = nil
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "HTTP"))
@@ -232,6 +540,7 @@ func Test_clusterAdd(t *testing.T) {
 	}
 
 	log.Println("SSL_TCP cluster add")
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Retries: 5, Interval: 21000, IntervalUnits: "SEC", DownTime: 7500, DownTimeUnits: "MSEC"}
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "SSL_TCP"
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "TCP"))
@@ -244,7 +553,7 @@ func Test_clusterDel(t *testing.T) {
 	multiClusterIngress = true
 	multiClusterPolExprStr = ".global"
 	multiClusterListenPort = 15443
-	lbObj := &nsconfigengine.LBApi{Name: "c2"}
+	lbObj := &nsconfigengine.LBApi{Name: "c2", StringMapBindings: []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: "c2", Value: "c2"}}}
 	nsConfAdaptor := getNsConfAdaptor()
 	clusterDel(nsConfAdaptor, "c2")
 	err := verifyObject(nsConfAdaptor, cdsDel, "c2", lbObj, nil, nil)
@@ -255,7 +564,7 @@ func Test_clusterDel(t *testing.T) {
 
 func Test_clusterEndpointUpdate(t *testing.T) {
 	eds := env.MakeEndpoint("e1", []env.ServiceEndpoint{{"1.1.1.1", 80, 8}, {"1.1.1.2", 80, 2}, {"www.google.com", 9080, 7}})
-	svcGpObj := &nsconfigengine.ServiceGroupAPI{Name: "e1", Members: []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 8}, {IP: "1.1.1.2", Port: 80, Weight: 2}, {Domain: "www.google.com", Port: 9080, Weight: 7}}}
+	svcGpObj := &nsconfigengine.ServiceGroupAPI{Name: "e1", Members: []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 8}, {IP: "1.1.1.2", Port: 80, Weight: 2}, {Domain: "www.google.com", Port: 9080, Weight: 7}}, GracefulDelay: defaultGracefulDrainDelay}
 	nsConfAdaptor := getNsConfAdaptor()
 	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
 	err := verifyObject(nsConfAdaptor, edsAdd, "e1", svcGpObj, nil, nil)
@@ -266,13 +575,24 @@ func Test_clusterEndpointUpdate(t *testing.T) {
 	coeTracingEnabled = true
 	nsConfAdaptor.logProxyURL = "coe.citrix-system"
 	eds = env.MakeEndpoint("outbound|5557||coe.citrix-system.svc.cluster.local", []env.ServiceEndpoint{{"1.1.1.1", 5557, 8}})
-	svcGpObj = &nsconfigengine.ServiceGroupAPI{Name: "outbound_5557__coe_citrix_system_svc_cluster_local", Members: []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 5557, Weight: 8}}, IsIPOnlySvcGroup: true}
+	svcGpObj = &nsconfigengine.ServiceGroupAPI{Name: "outbound_5557__coe_citrix_system_svc_cluster_local", Members: []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 5557, Weight: 8}}, IsIPOnlySvcGroup: true, GracefulDelay: defaultGracefulDrainDelay}
 	svcGpObj.IsLogProxySvcGrp = true
 	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
 	err = verifyObject(nsConfAdaptor, edsAdd, "outbound|5557||coe.citrix-system.svc.cluster.local", svcGpObj, nil, nil)
 	if err != nil {
 		t.Errorf("Verification failed for logstream endpoint - %v", err)
 	}
+	// Test for endpoint health status
+	eds = env.MakeEndpoint("e2", []env.ServiceEndpoint{{"1.1.1.1", 80, 1}, {"1.1.1.2", 80, 1}, {"1.1.1.3", 80, 1}, {"1.1.1.4", 80, 1}})
+	for index, healthStatus := range []core.HealthStatus{core.HealthStatus_HEALTHY, core.HealthStatus_UNHEALTHY, core.HealthStatus_DRAINING, core.HealthStatus_TIMEOUT} {
+		eds.Endpoints[0].LbEndpoints[index].HealthStatus = healthStatus
+	}
+	svcGpObj = &nsconfigengine.ServiceGroupAPI{Name: "e2", Members: []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 1}, {IP: "1.1.1.3", Port: 80, Weight: 1, Draining: true}}, IsIPOnlySvcGroup: true, GracefulDelay: defaultGracefulDrainDelay}
+	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
+	err = verifyObject(nsConfAdaptor, edsAdd, "e2", svcGpObj, nil, nil)
+	if err != nil {
+		t.Errorf("Verification failed for endpoint health status - %v", err)
+	}
 }
 
 func Test_staticAndDNSTypeClusterEndpointUpdate(t *testing.T) {
@@ -382,7 +702,7 @@ func Test_listenerAdd(t *testing.T) {
 	if err != nil {
 		t.Errorf("MakeHttpListener failed with %v", err)
 	}
-	csObj := []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l1", IP: "10.0.0.0", Port: 80, VserverType: "HTTP", AllowACL: false}}
+	csObj := []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l1", IP: "10.0.0.0", Port: 80, VserverType: "HTTP", AllowACL: false, ForwardClientCert: &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}}}
 	err = verifyObject(nsConfAdaptor, ldsAdd, "l1", csObj, []map[string]interface{}{{"rdsNames": []string{"r1"}, "cdsNames": []string{}, "listenerName": "l1", "csVsName": "l1", "serviceType": "HTTP"}}, listenerAdd(nsConfAdaptor, lds))
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
@@ -403,7 +723,7 @@ func Test_listenerAdd(t *testing.T) {
 	if err != nil {
 		t.Errorf("MakeHttpsListener failed with %v", err)
 	}
-	csObj = []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l3s", IP: "30.2.0.1", Port: 443, VserverType: "SSL", AllowACL: false, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertName, PrivateKeyFilename: nsKeyName, RootCertFilename: nsCertName + "_ic1"}}}}
+	csObj = []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l3s", IP: "30.2.0.1", Port: 443, VserverType: "SSL", AllowACL: false, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertName, PrivateKeyFilename: nsKeyName, RootCertFilename: nsCertName + "_ic1"}}, ForwardClientCert: &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}}}
 	err = verifyObject(nsConfAdaptor, ldsAdd, "l3s", csObj, []map[string]interface{}{{"rdsNames": []string{"r1"}, "cdsNames": []string{}, "listenerName": "l3s", "csVsName": "l3s", "serviceType": "HTTP"}}, listenerAdd(nsConfAdaptor, lds))
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
@@ -414,7 +734,7 @@ func Test_listenerAdd(t *testing.T) {
 	if err != nil {
 		t.Errorf("MakeHttpsListener failed with %v", err)
 	}
-	csObj = []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l2s", IP: "30.0.0.1", Port: 443, VserverType: "SSL", AllowACL: false, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertFileName, PrivateKeyFilename: nsKeyFileName}}}}
+	csObj = []*nsconfigengine.CSApi{&nsconfigengine.CSApi{Name: "l2s", IP: "30.0.0.1", Port: 443, VserverType: "SSL", AllowACL: false, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertFileName, PrivateKeyFilename: nsKeyFileName}}, ForwardClientCert: &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}}}
 	err = verifyObject(nsConfAdaptor, ldsAdd, "l2s", csObj, []map[string]interface{}{{"rdsNames": []string{"r1"}, "cdsNames": []string{}, "listenerName": "l2s", "csVsName": "l2s", "serviceType": "HTTP"}}, listenerAdd(nsConfAdaptor, lds))
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
@@ -438,10 +758,10 @@ func Test_listenerAdd(t *testing.T) {
 	fc3 := env.MakeFilterChain("1.1.1.1", 32, 1010, "", "f3", f3)
 	lds = env.MakeListenerFilterChains("lm1", "0.0.0.0", 15001, outboundDir, []*listener.FilterChain{fc1, fc2, fc3})
 	csObjExpLm1F1 := []*nsconfigengine.CSApi{
-		{Name: "lm1_f1", IP: "1.1.1.1", Port: 9090, VserverType: "HTTP", AllowACL: false},
+		{Name: "lm1_f1", IP: "1.1.1.1", Port: 9090, VserverType: "HTTP", AllowACL: false, ForwardClientCert: &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}},
 	}
 	csObjExpLm1F2 := []*nsconfigengine.CSApi{
-		{Name: "lm1_f2", IP: "2.1.1.1", Port: 9070, VserverType: "HTTP", AllowACL: false},
+		{Name: "lm1_f2", IP: "2.1.1.1", Port: 9070, VserverType: "HTTP", AllowACL: false, ForwardClientCert: &nsconfigengine.ForwardClientCertSpec{Mode: "SANITIZE"}},
 	}
 	csObjExpLm1F3 := []*nsconfigengine.CSApi{
 		{Name: "lm1_f3", IP: "1.1.1.1", Port: 1010, VserverType: "TCP", AllowACL: false, DefaultLbVserverName: "c3"},
@@ -498,6 +818,246 @@ func Test_routeUpdate(t *testing.T) {
 	}
 }
 
+func Test_clusterAdd_hashLbReappliesRoutes(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	rds := env.MakeRoute("rt1", []env.RouteInfo{{Domain: "*", ClusterName: "cl1"}})
+	routeUpdate(nsConfAdaptor, []*route.RouteConfiguration{rds}, map[string]interface{}{"listenerName": "cs1", "csVsName": "cs1", "serviceType": "HTTP"})
+	cds := env.MakeCluster("cl1")
+	cds.LbPolicy = cluster.Cluster_RING_HASH
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	csBindings := nsConfAdaptor.rdsHash["cs1"].Value.(*configBlock).resource.(*nsconfigengine.CSBindingsAPI)
+	if persistency := csBindings.Bindings[0].CsPolicy.Canary[0].Persistency; persistency == nil || !persistency.ConsistentHash {
+		t.Errorf("Expected consistent hash persistency once the cluster is balanced by consistent hashing, received %+v", persistency)
+	}
+	cds.LbPolicy = cluster.Cluster_ROUND_ROBIN
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	csBindings = nsConfAdaptor.rdsHash["cs1"].Value.(*configBlock).resource.(*nsconfigengine.CSBindingsAPI)
+	if persistency := csBindings.Bindings[0].CsPolicy.Canary[0].Persistency; persistency != nil {
+		t.Errorf("Expected no persistency once the cluster is not balanced by consistent hashing, received %+v", persistency)
+	}
+}
+
+func Test_clusterAdd_highPriorityRoutes(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	rds := env.MakeRoute("rt1", []env.RouteInfo{{Domain: "*", ClusterName: "cl1"}})
+	rds.VirtualHosts[0].Routes[0].GetRoute().Priority = core.RoutingPriority_HIGH
+	rds.VirtualHosts[0].Routes = append(rds.VirtualHosts[0].Routes, &route.Route{
+		Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/default"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "cl1"}}},
+	})
+	routeUpdate(nsConfAdaptor, []*route.RouteConfiguration{rds}, map[string]interface{}{"listenerName": "cs1", "csVsName": "cs1", "serviceType": "HTTP"})
+	cds := env.MakeCluster("cl1")
+	cds.CircuitBreakers = &cluster.CircuitBreakers{Thresholds: []*cluster.CircuitBreakers_Thresholds{{Priority: core.RoutingPriority_HIGH, MaxConnections: &wrappers.UInt32Value{Value: 10}}}}
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	if lbObj := nsConfAdaptor.cdsHash["cl1"].Value.(*configBlock).resource.(*nsconfigengine.LBApi); !reflect.DeepEqual(lbObj.HighCircuitBreaker, &nsconfigengine.CircuitBreaker{MaxConnections: 10}) {
+		t.Errorf("Expected HIGH priority circuit breaker, received %+v", lbObj.HighCircuitBreaker)
+	}
+	csBindings := nsConfAdaptor.rdsHash["cs1"].Value.(*configBlock).resource.(*nsconfigengine.CSBindingsAPI)
+	for _, binding := range csBindings.Bindings {
+		expectedTarget := "cl1"
+		if binding.Rule.Prefix == "/" {
+			expectedTarget = nsconfigengine.GetHighPriorityLbName("cl1")
+		}
+		if binding.CsPolicy.Canary[0].LbVserverName != expectedTarget {
+			t.Errorf("Expected route %s to target %s, received %s", binding.Rule.Prefix, expectedTarget, binding.CsPolicy.Canary[0].LbVserverName)
+		}
+	}
+	cds.CircuitBreakers = nil
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	csBindings = nsConfAdaptor.rdsHash["cs1"].Value.(*configBlock).resource.(*nsconfigengine.CSBindingsAPI)
+	for _, binding := range csBindings.Bindings {
+		if binding.CsPolicy.Canary[0].LbVserverName != "cl1" {
+			t.Errorf("Expected route %s to target cl1 without HIGH priority circuit breaker, received %s", binding.Rule.Prefix, binding.CsPolicy.Canary[0].LbVserverName)
+		}
+	}
+}
+
+func Test_routeUpdate_regexRewrite(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	rds := env.MakeRoute("rt2", []env.RouteInfo{{Domain: "*", ClusterName: "cl1"}})
+	rds.VirtualHosts[0].Routes = append(rds.VirtualHosts[0].Routes, &route.Route{
+		Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_SafeRegex{SafeRegex: &matcher.RegexMatcher{Regex: "^/v1/.*"}}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "cl1"}, RegexRewrite: &matcher.RegexMatchAndSubstitute{Pattern: &matcher.RegexMatcher{Regex: "^/v1/"}, Substitution: "/v2/"}}},
+	}, &route.Route{
+		Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Path{Path: "/old"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "cl1"}, PrefixRewrite: "/new", RegexRewrite: &matcher.RegexMatchAndSubstitute{Pattern: &matcher.RegexMatcher{Regex: "^/(.*)$"}, Substitution: "/\\1"}}},
+	})
+	csBindings := nsconfigengine.NewCSBindingsAPI("cs2")
+	canary := nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: "cl1", LbVserverType: "HTTP", Weight: 100}}}
+	csBindings.Bindings = []nsconfigengine.CSBinding{
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/"}, CsPolicy: canary},
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Regex: "^/v1/.*"}, CsPolicy: canary, RwPolicy: nsconfigengine.RewritePolicy{RegexRewritePattern: "^/v1/", RegexRewriteSubstitution: "/v2/"}},
+		// Regex rewrite whose substitution refers to capture groups is skipped, the route is kept
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Path: "/old"}, CsPolicy: canary, RwPolicy: nsconfigengine.RewritePolicy{PrefixRewrite: "/new"}},
+	}
+	err := verifyObject(nsConfAdaptor, rdsAdd, "cs2", csBindings, map[string]interface{}{"cdsNames": []string{"cl1", "cl1", "cl1"}, "serviceType": "HTTP"}, routeUpdate(nsConfAdaptor, []*route.RouteConfiguration{rds}, map[string]interface{}{"listenerName": "cs2", "csVsName": "cs2", "serviceType": "HTTP"}))
+	if err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+}
+
+func Test_routeUpdate_clusterHeaderAndMetadata(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	rds := env.MakeRoute("rt3", []env.RouteInfo{{Domain: "*", ClusterName: "cl1"}})
+	v1Metadata := &core.Metadata{FilterMetadata: map[string]*_struct.Struct{"envoy.lb": {Fields: map[string]*_struct.Value{"version": {Kind: &_struct.Value_StringValue{StringValue: "v1"}}}}}}
+	v2Metadata := &core.Metadata{FilterMetadata: map[string]*_struct.Struct{"envoy.lb": {Fields: map[string]*_struct.Value{"version": {Kind: &_struct.Value_StringValue{StringValue: "v2"}}}}}}
+	rds.VirtualHosts[0].Routes = append(rds.VirtualHosts[0].Routes, &route.Route{
+		Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/header"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_ClusterHeader{ClusterHeader: "x-cluster"}}},
+	}, &route.Route{
+		Match:  &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/v1"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "cl1"}, MetadataMatch: v1Metadata}},
+	}, &route.Route{
+		Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/split"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_WeightedClusters{WeightedClusters: &route.WeightedCluster{Clusters: []*route.WeightedCluster_ClusterWeight{
+			{Name: "cl1", Weight: &wrappers.UInt32Value{Value: 80}},
+			{Name: "cl1", Weight: &wrappers.UInt32Value{Value: 20}, MetadataMatch: v2Metadata}}}}, MetadataMatch: v1Metadata}},
+	})
+	v1Subset := getSubsetEntityName("cl1", map[string]string{"version": "v1"})
+	v2Subset := getSubsetEntityName("cl1", map[string]string{"version": "v2"})
+	csBindings := nsconfigengine.NewCSBindingsAPI("cs3")
+	csBindings.Bindings = []nsconfigengine.CSBinding{
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: "cl1", LbVserverType: "HTTP", Weight: 100}}}},
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/header"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{TargetVserverExpr: "HTTP.REQ.HEADER(\"x-cluster\").MAP_STRING(\"clusterHeaderStringMap\")", LbVserverType: "HTTP", Weight: 100}}}},
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/v1"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: v1Subset, LbVserverType: "HTTP", Weight: 100}}}},
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/split"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: v1Subset, LbVserverType: "HTTP", Weight: 80}, {LbVserverName: v2Subset, LbVserverType: "HTTP", Weight: 20}}}},
+	}
+	err := verifyObject(nsConfAdaptor, rdsAdd, "cs3", csBindings, map[string]interface{}{"cdsNames": []string{"cl1", "cl1", "cl1", "cl1"}, "serviceType": "HTTP"}, routeUpdate(nsConfAdaptor, []*route.RouteConfiguration{rds}, map[string]interface{}{"listenerName": "cs3", "csVsName": "cs3", "serviceType": "HTTP"}))
+	if err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+}
+
+func Test_routeUpdate_localRateLimit(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	rds := env.MakeRoute("rt4", []env.RouteInfo{{Domain: "*", ClusterName: "cl1"}})
+	enabled := &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(100)}
+	listenerRateLimit := &xdslocalratelimit.LocalRateLimit{StatPrefix: "http_local_rate_limiter", FilterEnabled: enabled, FilterEnforced: enabled,
+		TokenBucket: &xdstype.TokenBucket{MaxTokens: 100, TokensPerFill: &wrappers.UInt32Value{Value: 100}, FillInterval: &duration.Duration{Seconds: 60}}}
+	routeRateLimit := &xdslocalratelimit.LocalRateLimit{StatPrefix: "http_local_rate_limiter", FilterEnabled: enabled, FilterEnforced: enabled, Status: &xdstype.HttpStatus{Code: xdstype.StatusCode_ServiceUnavailable},
+		TokenBucket: &xdstype.TokenBucket{MaxTokens: 10, FillInterval: &duration.Duration{Seconds: 1}},
+		Descriptors: []*xdsratelimit.LocalRateLimitDescriptor{{Entries: []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "user", Value: "admin"}},
+			TokenBucket: &xdstype.TokenBucket{MaxTokens: 50, TokensPerFill: &wrappers.UInt32Value{Value: 50}, FillInterval: &duration.Duration{Seconds: 1}}}}}
+	routeRateLimitAny, _ := ptypes.MarshalAny(routeRateLimit)
+	rds.VirtualHosts[0].Routes = append(rds.VirtualHosts[0].Routes, &route.Route{
+		Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/limited"}},
+		Action: &route.Route_Route{Route: &route.RouteAction{ClusterSpecifier: &route.RouteAction_Cluster{Cluster: "cl1"},
+			RateLimits: []*route.RateLimit{{Actions: []*route.RateLimit_Action{{ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{RequestHeaders: &route.RateLimit_Action_RequestHeaders{HeaderName: "x-user", DescriptorKey: "user"}}}}}}}},
+		TypedPerFilterConfig: map[string]*any.Any{localRateLimitFilter: routeRateLimitAny},
+	})
+	csBindings := nsconfigengine.NewCSBindingsAPI("cs4")
+	csBindings.Bindings = []nsconfigengine.CSBinding{
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: "cl1", LbVserverType: "HTTP", Weight: 100}}},
+			RateLimit: &nsconfigengine.RateLimit{TokenBucket: &nsconfigengine.TokenBucket{MaxTokens: 100, TokensPerFill: 100, FillInterval: 60000}, Shared: true, EnabledPercent: 100, EnforcedPercent: 100}},
+		{Rule: nsconfigengine.RouteMatch{Domains: []string{"*"}, Prefix: "/limited"}, CsPolicy: nsconfigengine.CsPolicy{Canary: []nsconfigengine.Canary{{LbVserverName: "cl1", LbVserverType: "HTTP", Weight: 100}}},
+			RateLimit: &nsconfigengine.RateLimit{TokenBucket: &nsconfigengine.TokenBucket{MaxTokens: 10, TokensPerFill: 1, FillInterval: 1000}, StatusCode: 503, EnabledPercent: 100, EnforcedPercent: 100,
+				Descriptors: []nsconfigengine.RateLimitDescriptor{{Matches: []nsconfigengine.RateLimitMatch{{Headers: []nsconfigengine.MatchHeader{{Name: "x-user", Exact: "admin"}}}}, TokenBucket: nsconfigengine.TokenBucket{MaxTokens: 50, TokensPerFill: 50, FillInterval: 1000}}}}},
+	}
+	err := verifyObject(nsConfAdaptor, rdsAdd, "cs4", csBindings, map[string]interface{}{"cdsNames": []string{"cl1", "cl1"}, "serviceType": "HTTP"}, routeUpdate(nsConfAdaptor, []*route.RouteConfiguration{rds}, map[string]interface{}{"listenerName": "cs4", "csVsName": "cs4", "serviceType": "HTTP", "localRateLimit": listenerRateLimit}))
+	if err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+}
+
+func Test_lbSubsetEndpointUpdate(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	cds := env.MakeCluster("c4")
+	cds.LbSubsetConfig = &cluster.Cluster_LbSubsetConfig{SubsetSelectors: []*cluster.Cluster_LbSubsetConfig_LbSubsetSelector{{Keys: []string{"version"}}}}
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	eds := env.MakeEndpoint("c4", []env.ServiceEndpoint{{"1.1.1.1", 80, 1}, {"1.1.1.2", 80, 1}, {"1.1.1.3", 80, 1}})
+	for index, version := range []string{"v1", "v2", "v1"} {
+		eds.Endpoints[0].LbEndpoints[index].Metadata = &core.Metadata{FilterMetadata: map[string]*_struct.Struct{"envoy.lb": {Fields: map[string]*_struct.Value{"version": {Kind: &_struct.Value_StringValue{StringValue: version}}}}}}
+	}
+	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
+	v1Subset := getSubsetEntityName("c4", map[string]string{"version": "v1"})
+	v2Subset := getSubsetEntityName("c4", map[string]string{"version": "v2"})
+	svcGpObj := nsconfigengine.NewServiceGroupAPI(v1Subset)
+	svcGpObj.Members = []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 1}, {IP: "1.1.1.3", Port: 80, Weight: 1}}
+	svcGpObj.GracefulDelay = defaultGracefulDrainDelay
+	if err := verifyObject(nsConfAdaptor, edsAdd, v1Subset, svcGpObj, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+	if _, err := nsConfAdaptor.getConfigByName(v2Subset, cdsAdd); err != nil {
+		t.Errorf("Subset LB vserver %s not added - %v", v2Subset, err)
+	}
+	log.Println("Stale subset delete")
+	eds = env.MakeEndpoint("c4", []env.ServiceEndpoint{{"1.1.1.1", 80, 1}})
+	eds.Endpoints[0].LbEndpoints[0].Metadata = &core.Metadata{FilterMetadata: map[string]*_struct.Struct{"envoy.lb": {Fields: map[string]*_struct.Value{"version": {Kind: &_struct.Value_StringValue{StringValue: "v1"}}}}}}
+	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
+	if err := verifyObject(nsConfAdaptor, cdsDel, v2Subset, &nsconfigengine.LBApi{Name: v2Subset}, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+}
+
+func Test_getMinActivePercent(t *testing.T) {
+	cases := []struct {
+		input          *endpoint.ClusterLoadAssignment_Policy
+		expectedOutput int
+	}{
+		{nil, 72},
+		{&endpoint.ClusterLoadAssignment_Policy{OverprovisioningFactor: &wrappers.UInt32Value{Value: 200}}, 50},
+		{&endpoint.ClusterLoadAssignment_Policy{OverprovisioningFactor: &wrappers.UInt32Value{Value: 100}}, 100},
+	}
+	for _, c := range cases {
+		if output := getMinActivePercent(c.input); output != c.expectedOutput {
+			t.Errorf("Expected %d, received %d", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getLocalityEndpointWeights(t *testing.T) {
+	localities := env.MakeEndpoint("c5", []env.ServiceEndpoint{{"1.1.1.1", 80, 1}, {"1.1.1.2", 80, 3}}).Endpoints
+	if output := getLocalityEndpointWeights(localities); output != nil {
+		t.Errorf("Expected no weights for unweighted localities, received %v", output)
+	}
+	localities[0].LoadBalancingWeight = &wrappers.UInt32Value{Value: 20}
+	localities = append(localities, &endpoint.LocalityLbEndpoints{LoadBalancingWeight: &wrappers.UInt32Value{Value: 80}, LbEndpoints: env.MakeEndpoint("c5", []env.ServiceEndpoint{{"1.1.2.1", 80, 0}}).Endpoints[0].LbEndpoints})
+	expectedOutput := [][]int{{6, 19}, {100}}
+	if output := getLocalityEndpointWeights(localities); !reflect.DeepEqual(output, expectedOutput) {
+		t.Errorf("Expected %v, received %v", expectedOutput, output)
+	}
+}
+
+func Test_lbPriorityEndpointUpdate(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	cds := env.MakeCluster("c5")
+	clusterAdd(nsConfAdaptor, cds, "HTTP")
+	eds := env.MakeEndpoint("c5", []env.ServiceEndpoint{{"1.1.1.1", 80, 1}})
+	for priority, ip := range []string{"1.1.2.1", "1.1.3.1"} {
+		backup := env.MakeEndpoint("c5", []env.ServiceEndpoint{{ip, 80, 1}}).Endpoints[0]
+		backup.Priority = uint32(priority + 1)
+		eds.Endpoints = append(eds.Endpoints, backup)
+	}
+	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
+	svcGpObj := nsconfigengine.NewServiceGroupAPI("c5")
+	svcGpObj.Members = []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 1}}
+	svcGpObj.GracefulDelay = defaultGracefulDrainDelay
+	if err := verifyObject(nsConfAdaptor, edsAdd, "c5", svcGpObj, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+	backupName := getPriorityEntityName("c5", 1)
+	svcGpObj = nsconfigengine.NewServiceGroupAPI(backupName)
+	svcGpObj.Members = []nsconfigengine.ServiceGroupMember{{IP: "1.1.2.1", Port: 80, Weight: 1}}
+	svcGpObj.GracefulDelay = defaultGracefulDrainDelay
+	if err := verifyObject(nsConfAdaptor, edsAdd, backupName, svcGpObj, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+	confBl, err := nsConfAdaptor.getConfigByName("c5", cdsAdd)
+	if err != nil || confBl.resource.(*nsconfigengine.LBApi).BackupVserver != backupName || confBl.resource.(*nsconfigengine.LBApi).MinActivePercent != 72 {
+		t.Errorf("LB vserver c5 not backed up by %s - %v", backupName, err)
+	}
+	confBl, err = nsConfAdaptor.getConfigByName(backupName, cdsAdd)
+	if err != nil || confBl.resource.(*nsconfigengine.LBApi).BackupVserver != getPriorityEntityName("c5", 2) {
+		t.Errorf("LB vserver %s not backed up by %s - %v", backupName, getPriorityEntityName("c5", 2), err)
+	}
+	log.Println("Stale priority delete")
+	eds.Endpoints = eds.Endpoints[:2]
+	clusterEndpointUpdate(nsConfAdaptor, eds, nil)
+	if err := verifyObject(nsConfAdaptor, cdsDel, getPriorityEntityName("c5", 2), &nsconfigengine.LBApi{Name: getPriorityEntityName("c5", 2)}, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+}
+
 func Test_clusterAdd_transportSocket(t *testing.T) {
 	certFileName := "../tests/tls_conn_mgmt_certs/client-cert.pem"
 	keyFileName := "../tests/tls_conn_mgmt_certs/client-key.pem"
@@ -514,9 +1074,11 @@ func Test_clusterAdd_transportSocket(t *testing.T) {
 	nsCertFileName := nsconfigengine.GetNSCompatibleNameHash(string([]byte(certData)), 55)
 	nsKeyFileName := nsconfigengine.GetNSCompatibleNameHash(string([]byte(keyData)), 55)
 	log.Println("HTTP cluster add")
-	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}}
-	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s"}
+	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}}
+	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s", StringMapBindings: []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: "c1", Value: "c1"}}}
 	lbObj.LbMonitorObj = new(nsconfigengine.LBMonitor)
+	lbObj.LbMonitorObj.Type = "HTTP-INLINE"
+	lbObj.LbMonitorObj.RespCodes = []string{"100-501", "505-599"}
 	lbObj.LbMonitorObj.Retries = 9
 	lbObj.LbMonitorObj.Interval = 5100
 	lbObj.LbMonitorObj.IntervalUnits = "MSEC"
@@ -527,7 +1089,7 @@ func Test_clusterAdd_transportSocket(t *testing.T) {
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
 	}
-	lbObj.LbMonitorObj = nil
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Interval: 5100, IntervalUnits: "MSEC", DownTime: 7, DownTimeUnits: "SEC"}
 
 	log.Println("TCP cluster add")
 	lbObj.FrontendServiceType = "TCP"
@@ -559,7 +1121,7 @@ func Test_clusterAdd_transportSocket(t *testing.T) {
 	lbObj.BackendServiceType = "SSL"
 	lbObj.MaxConnections = 500
 	lbObj.MaxRequestsPerConnection = 100
-	lbObj.MaxHTTP2ConcurrentStreams = 750
+	lbObj.CircuitBreaker = &nsconfigengine.CircuitBreaker{MaxConnections: 500, MaxRequests: 750}
 	lbObj.BackendTLS = []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertFileName, PrivateKeyFilename: nsKeyFileName}}
 	lbObj.LbMonitorObj = nil
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "HTTP"))
@@ -568,6 +1130,7 @@ func Test_clusterAdd_transportSocket(t *testing.T) {
 	}
 
 	log.Println("SSL_TCP cluster add")
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Retries: 5, Interval: 21000, IntervalUnits: "SEC", DownTime: 7500, DownTimeUnits: "MSEC"}
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "SSL_TCP"
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "TCP"))
@@ -591,9 +1154,11 @@ func Test_clusterAddInline(t *testing.T) {
 	nsConfAdaptor := getNsConfAdaptor()
 	nsConfAdaptor.client = env.GetNitroClient()
 	log.Println("HTTP cluster add")
-	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}}
-	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s"}
+	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}}
+	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s", StringMapBindings: []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: "c1", Value: "c1"}}}
 	lbObj.LbMonitorObj = new(nsconfigengine.LBMonitor)
+	lbObj.LbMonitorObj.Type = "HTTP-INLINE"
+	lbObj.LbMonitorObj.RespCodes = []string{"100-501", "505-599"}
 	lbObj.LbMonitorObj.Retries = 9
 	lbObj.LbMonitorObj.Interval = 5100
 	lbObj.LbMonitorObj.IntervalUnits = "MSEC"
@@ -604,7 +1169,7 @@ func Test_clusterAddInline(t *testing.T) {
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
 	}
-	lbObj.LbMonitorObj = nil
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Interval: 5100, IntervalUnits: "MSEC", DownTime: 7, DownTimeUnits: "SEC"}
 	log.Println("TCP cluster add")
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "TCP"
@@ -627,7 +1192,7 @@ func Test_clusterAddInline(t *testing.T) {
 	lbObj.BackendServiceType = "SSL"
 	lbObj.MaxConnections = 500
 	lbObj.MaxRequestsPerConnection = 100
-	lbObj.MaxHTTP2ConcurrentStreams = 750
+	lbObj.CircuitBreaker = &nsconfigengine.CircuitBreaker{MaxConnections: 500, MaxRequests: 750}
 	lbObj.BackendTLS = []nsconfigengine.SSLSpec{{SNICert: false, Cert: string(clientCert), PrivateKey: string(clientKey)}}
 	lbObj.LbMonitorObj = nil
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "HTTP"))
@@ -636,6 +1201,7 @@ func Test_clusterAddInline(t *testing.T) {
 	}
 
 	log.Println("SSL_TCP cluster add")
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Retries: 5, Interval: 21000, IntervalUnits: "SEC", DownTime: 7500, DownTimeUnits: "MSEC"}
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "SSL_TCP"
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "TCP"))
@@ -670,9 +1236,11 @@ func Test_clusterAdd_SDS(t *testing.T) {
 	nsCertName := nsconfigengine.GetNSCompatibleNameHash(string([]byte(certData)), 55)
 	nsKeyName := nsconfigengine.GetNSCompatibleNameHash(string([]byte(keyData)), 55)
 
-	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}}
-	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s"}
+	cds.OutlierDetection = &cluster.OutlierDetection{Interval: &duration.Duration{Seconds: int64(5), Nanos: int32(100000000)}, BaseEjectionTime: &duration.Duration{Seconds: int64(7)}, ConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: uint32(9)}, EnforcingConsecutiveGatewayFailure: &wrappers.UInt32Value{Value: 100}, EnforcingConsecutive_5Xx: &wrappers.UInt32Value{Value: 0}}
+	lbObj := &nsconfigengine.LBApi{Name: "c1", FrontendServiceType: "HTTP", LbMethod: "ROUNDROBIN", BackendServiceType: "HTTP", MaxConnections: 0xfffffffe, MaxHTTP2ConcurrentStreams: 1000, NetprofileName: "k8s", StringMapBindings: []*nsconfigengine.StringMapBinding{{StringMapName: clusterHeaderStringMap, Key: "c1", Value: "c1"}}}
 	lbObj.LbMonitorObj = new(nsconfigengine.LBMonitor)
+	lbObj.LbMonitorObj.Type = "HTTP-INLINE"
+	lbObj.LbMonitorObj.RespCodes = []string{"100-501", "505-599"}
 	lbObj.LbMonitorObj.Retries = 9
 	lbObj.LbMonitorObj.Interval = 5100
 	lbObj.LbMonitorObj.IntervalUnits = "MSEC"
@@ -683,7 +1251,7 @@ func Test_clusterAdd_SDS(t *testing.T) {
 	if err != nil {
 		t.Errorf("Verification failed - %v", err)
 	}
-	lbObj.LbMonitorObj = nil
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Interval: 5100, IntervalUnits: "MSEC", DownTime: 7, DownTimeUnits: "SEC"}
 
 	log.Println("TCP cluster add")
 	lbObj.FrontendServiceType = "TCP"
@@ -716,7 +1284,7 @@ func Test_clusterAdd_SDS(t *testing.T) {
 	lbObj.BackendServiceType = "SSL"
 	lbObj.MaxConnections = 500
 	lbObj.MaxRequestsPerConnection = 100
-	lbObj.MaxHTTP2ConcurrentStreams = 750
+	lbObj.CircuitBreaker = &nsconfigengine.CircuitBreaker{MaxConnections: 500, MaxRequests: 750}
 	lbObj.BackendTLS = []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: nsCertName, PrivateKeyFilename: nsKeyName, RootCertFilename: nsCertName + "_ic1"}}
 	lbObj.LbMonitorObj = nil
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "HTTP"))
@@ -725,6 +1293,7 @@ func Test_clusterAdd_SDS(t *testing.T) {
 	}
 
 	log.Println("SSL_TCP cluster add")
+	lbObj.LbMonitorObj = &nsconfigengine.LBMonitor{Type: "TCP", Retries: 5, Interval: 21000, IntervalUnits: "SEC", DownTime: 7500, DownTimeUnits: "MSEC"}
 	lbObj.FrontendServiceType = "TCP"
 	lbObj.BackendServiceType = "SSL_TCP"
 	err = verifyObject(nsConfAdaptor, cdsAdd, "c1", lbObj, "c1", clusterAdd(nsConfAdaptor, cds, "TCP"))
@@ -791,7 +1360,7 @@ func Test_getAuthConfig(t *testing.T) {
 		},
 	}
 	httpFilters = append(httpFilters, &httpFilter)
-	expectedAuthSpec := &nsconfigengine.AuthSpec{Name: "l1", Issuer: "https://secret.foo.com", Jwks: jwtKey, Forward: false, ForwardHeader: "x-header", Audiences: []string{"a1", "a2"}, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: ClientCertChainFile, PrivateKeyFilename: ClientKeyFile}}}
+	expectedAuthSpec := &nsconfigengine.AuthSpec{Name: "l1", IncludePaths: []nsconfigengine.AuthRuleMatch{{Prefix: "/"}}, Providers: []nsconfigengine.JwtProvider{{Issuer: "https://secret.foo.com", Jwks: jwtKey, Audiences: []string{"a1", "a2"}, Forward: false, ForwardHeader: "x-header"}}, FrontendTLS: []nsconfigengine.SSLSpec{{SNICert: false, CertFilename: ClientCertChainFile, PrivateKeyFilename: ClientKeyFile}}}
 	t.Logf("Get AuthSpecConfig")
 	nsConfAdaptor := getNsConfAdaptor()
 	w, _ := newWatcher()
@@ -851,6 +1420,11 @@ func Test_getPersistencyPolicy(t *testing.T) {
 	if compare == false {
 		t.Errorf("Expected PersistencyPolicy:%+v    Received PersistencyPolicy=%+v", expectedPersistency, persistency)
 	}
+	persistency = getPersistencyPolicy([]*route.RouteAction_HashPolicy{{PolicySpecifier: &route.RouteAction_HashPolicy_QueryParameter_{QueryParameter: &route.RouteAction_HashPolicy_QueryParameter{Name: "user"}}}})
+	expectedPersistency = &nsconfigengine.PersistencyPolicy{QueryParameter: "user"}
+	if !reflect.DeepEqual(expectedPersistency, persistency) {
+		t.Errorf("Expected PersistencyPolicy:%+v    Received PersistencyPolicy=%+v", expectedPersistency, persistency)
+	}
 }
 
 func percentToFractPercent(percent float64) *xdstype.FractionalPercent {
@@ -891,6 +1465,134 @@ func Test_getFault(t *testing.T) {
 	}
 }
 
+func Test_getRateLimitMatch(t *testing.T) {
+	headerAction := &route.RateLimit_Action{ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{RequestHeaders: &route.RateLimit_Action_RequestHeaders{HeaderName: "x-user", DescriptorKey: "user"}}}
+	remoteAddressAction := &route.RateLimit_Action{ActionSpecifier: &route.RateLimit_Action_RemoteAddress_{RemoteAddress: &route.RateLimit_Action_RemoteAddress{}}}
+	genericKeyAction := &route.RateLimit_Action{ActionSpecifier: &route.RateLimit_Action_GenericKey_{GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: "gold"}}}
+	clusterAction := &route.RateLimit_Action{ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{DestinationCluster: &route.RateLimit_Action_DestinationCluster{}}}
+	headerValueMatchAction := &route.RateLimit_Action{ActionSpecifier: &route.RateLimit_Action_HeaderValueMatch_{HeaderValueMatch: &route.RateLimit_Action_HeaderValueMatch{DescriptorValue: "no-auth", ExpectMatch: &wrappers.BoolValue{Value: false},
+		Headers: []*route.HeaderMatcher{{Name: "authorization", HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: true}}}}}}
+	cases := []struct {
+		name          string
+		entries       []*xdsratelimit.RateLimitDescriptor_Entry
+		actions       []*route.RateLimit_Action
+		expectedMatch nsconfigengine.RateLimitMatch
+		expectedOk    bool
+	}{
+		{"request headers and remote address", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "user", Value: "foo"}, {Key: "remote_address", Value: "10.1.1.1"}}, []*route.RateLimit_Action{headerAction, remoteAddressAction},
+			nsconfigengine.RateLimitMatch{Headers: []nsconfigengine.MatchHeader{{Name: "x-user", Exact: "foo"}}, ClientIP: "10.1.1.1"}, true},
+		{"generic key and destination cluster", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "generic_key", Value: "gold"}, {Key: "destination_cluster", Value: "cl1"}}, []*route.RateLimit_Action{genericKeyAction, clusterAction}, nsconfigengine.RateLimitMatch{}, true},
+		{"generic key mismatch", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "generic_key", Value: "silver"}}, []*route.RateLimit_Action{genericKeyAction}, nsconfigengine.RateLimitMatch{}, false},
+		{"destination cluster mismatch", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "destination_cluster", Value: "cl2"}}, []*route.RateLimit_Action{clusterAction}, nsconfigengine.RateLimitMatch{}, false},
+		{"header value not matching", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "header_match", Value: "no-auth"}}, []*route.RateLimit_Action{headerValueMatchAction},
+			nsconfigengine.RateLimitMatch{Headers: []nsconfigengine.MatchHeader{{Name: "authorization", Present: true, Invert: true}}}, true},
+		{"entries count mismatch", []*xdsratelimit.RateLimitDescriptor_Entry{{Key: "user", Value: "foo"}}, []*route.RateLimit_Action{headerAction, remoteAddressAction}, nsconfigengine.RateLimitMatch{}, false},
+	}
+	for _, c := range cases {
+		match, _, ok := getRateLimitMatch(c.entries, &route.RateLimit{Actions: c.actions}, "cl1")
+		if ok != c.expectedOk || (ok && !reflect.DeepEqual(match, c.expectedMatch)) {
+			t.Errorf("%s: expected (%+v, %v), received (%+v, %v)", c.name, c.expectedMatch, c.expectedOk, match, ok)
+		}
+	}
+}
+
+func Test_getRateLimit(t *testing.T) {
+	tokenBucket := &xdstype.TokenBucket{MaxTokens: 20, TokensPerFill: &wrappers.UInt32Value{Value: 10}, FillInterval: &duration.Duration{Nanos: 500000000}}
+	cases := []struct {
+		name     string
+		input    *xdslocalratelimit.LocalRateLimit
+		expected *nsconfigengine.RateLimit
+	}{
+		{"no token bucket", &xdslocalratelimit.LocalRateLimit{FilterEnabled: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(100)}}, nil},
+		{"filter not enabled", &xdslocalratelimit.LocalRateLimit{TokenBucket: tokenBucket}, nil},
+		{"filter not enforced", &xdslocalratelimit.LocalRateLimit{TokenBucket: tokenBucket, FilterEnabled: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(100)}}, nil},
+		{"partially enforced per connection", &xdslocalratelimit.LocalRateLimit{TokenBucket: tokenBucket, LocalRateLimitPerDownstreamConnection: true,
+			FilterEnabled: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(100)}, FilterEnforced: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(25)}},
+			&nsconfigengine.RateLimit{TokenBucket: &nsconfigengine.TokenBucket{MaxTokens: 20, TokensPerFill: 10, FillInterval: 500}, PerConnection: true, EnabledPercent: 100, EnforcedPercent: 25}},
+	}
+	for _, c := range cases {
+		if output := getRateLimit(c.input, nil, "cl1"); !reflect.DeepEqual(output, c.expected) {
+			t.Errorf("%s: expected %+v, received %+v", c.name, c.expected, output)
+		}
+	}
+}
+
+func Test_getFractionalPercent(t *testing.T) {
+	cases := []struct {
+		input          *xdstype.FractionalPercent
+		expectedOutput int
+		expectedErr    bool
+	}{
+		{nil, 0, false},
+		{&xdstype.FractionalPercent{Numerator: 25, Denominator: xdstype.FractionalPercent_HUNDRED}, 25, false},
+		{&xdstype.FractionalPercent{Numerator: 150, Denominator: xdstype.FractionalPercent_HUNDRED}, 100, false},
+		{&xdstype.FractionalPercent{Numerator: 5000, Denominator: xdstype.FractionalPercent_MILLION}, 1, false},
+		{&xdstype.FractionalPercent{Numerator: 25, Denominator: 5}, 0, true},
+	}
+	for _, c := range cases {
+		output, err := getFractionalPercent(c.input)
+		if output != c.expectedOutput || (err != nil) != c.expectedErr {
+			t.Errorf("incorrect output for `%v` : expected `%d`/%v but got `%d`/%v", c.input, c.expectedOutput, c.expectedErr, output, err)
+		}
+	}
+}
+
+func Test_getMirrorWeight(t *testing.T) {
+	cases := []struct {
+		input          *route.RouteAction_RequestMirrorPolicy
+		expectedOutput int
+	}{
+		{&route.RouteAction_RequestMirrorPolicy{Cluster: "c1"}, 100},
+		{&route.RouteAction_RequestMirrorPolicy{Cluster: "c1", RuntimeFraction: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(50)}}, 50},
+		{&route.RouteAction_RequestMirrorPolicy{Cluster: "c1", RuntimeFraction: &core.RuntimeFractionalPercent{DefaultValue: percentToFractPercent(0.5)}}, 1},
+		{&route.RouteAction_RequestMirrorPolicy{Cluster: "c1", RuntimeFraction: &core.RuntimeFractionalPercent{DefaultValue: &xdstype.FractionalPercent{Numerator: 25, Denominator: xdstype.FractionalPercent_HUNDRED}}}, 25},
+	}
+	for _, c := range cases {
+		if output := getMirrorWeight(c.input); output != c.expectedOutput {
+			t.Errorf("incorrect output for `%v` : expected `%d` but got `%d`", c.input, c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getMatchHeader(t *testing.T) {
+	cases := []struct {
+		input          *route.HeaderMatcher
+		expectedOutput nsconfigengine.MatchHeader
+	}{
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: "v1"}}, nsconfigengine.MatchHeader{Name: "h1", Exact: "v1"}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_PrefixMatch{PrefixMatch: "v"}}, nsconfigengine.MatchHeader{Name: "h1", Prefix: "v"}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_SafeRegexMatch{SafeRegexMatch: &matcher.RegexMatcher{Regex: "v.*"}}}, nsconfigengine.MatchHeader{Name: "h1", Regex: "v.*"}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_SuffixMatch{SuffixMatch: "1"}, InvertMatch: true}, nsconfigengine.MatchHeader{Name: "h1", Suffix: "1", Invert: true}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_ContainsMatch{ContainsMatch: "v"}}, nsconfigengine.MatchHeader{Name: "h1", Contains: "v"}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_RangeMatch{RangeMatch: &xdstype.Int64Range{Start: 1, End: 5}}}, nsconfigengine.MatchHeader{Name: "h1", Range: &nsconfigengine.MatchRange{Start: 1, End: 5}}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: true}}, nsconfigengine.MatchHeader{Name: "h1", Present: true}},
+		{&route.HeaderMatcher{Name: "h1", HeaderMatchSpecifier: &route.HeaderMatcher_PresentMatch{PresentMatch: false}}, nsconfigengine.MatchHeader{Name: "h1", Present: true, Invert: true}},
+		{&route.HeaderMatcher{Name: "h1"}, nsconfigengine.MatchHeader{Name: "h1", Present: true}},
+		{&route.HeaderMatcher{Name: ":method", HeaderMatchSpecifier: &route.HeaderMatcher_StringMatch{StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: "get"}, IgnoreCase: true}}}, nsconfigengine.MatchHeader{Name: ":method", Exact: "get", IgnoreCase: true}},
+	}
+	for _, c := range cases {
+		if output := getMatchHeader(c.input); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("incorrect output for `%v` : expected `%+v` but got `%+v`", c.input, c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getMatchQueryParameter(t *testing.T) {
+	cases := []struct {
+		input          *route.QueryParameterMatcher
+		expectedOutput nsconfigengine.MatchHeader
+	}{
+		{&route.QueryParameterMatcher{Name: "q1", QueryParameterMatchSpecifier: &route.QueryParameterMatcher_PresentMatch{PresentMatch: true}}, nsconfigengine.MatchHeader{Name: "q1", Present: true}},
+		{&route.QueryParameterMatcher{Name: "q1", QueryParameterMatchSpecifier: &route.QueryParameterMatcher_StringMatch{StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "v"}}}}, nsconfigengine.MatchHeader{Name: "q1", Prefix: "v"}},
+		{&route.QueryParameterMatcher{Name: "q1", QueryParameterMatchSpecifier: &route.QueryParameterMatcher_StringMatch{StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_SafeRegex{SafeRegex: &matcher.RegexMatcher{Regex: "[0-9]+"}}}}}, nsconfigengine.MatchHeader{Name: "q1", Regex: "[0-9]+"}},
+	}
+	for _, c := range cases {
+		if output := getMatchQueryParameter(c.input); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("incorrect output for `%v` : expected `%+v` but got `%+v`", c.input, c.expectedOutput, output)
+		}
+	}
+}
+
 func Test_isEgressGateway(t *testing.T) {
 	testCases := map[string]struct {
 		input          string
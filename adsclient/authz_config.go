@@ -0,0 +1,249 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	xdsListener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	xdsRBAC "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	envoyHTTPRBAC "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	envoyFilterHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoyNetworkRBAC "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/rbac/v3"
+	envoyMatcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+const (
+	// httpRBACFilter is the name of Envoy's HTTP RBAC filter, which Istio generates from AuthorizationPolicy
+	httpRBACFilter = "envoy.filters.http.rbac"
+	// networkRBACFilter is the name of Envoy's network RBAC filter, generated for TCP listeners
+	networkRBACFilter = "envoy.filters.network.rbac"
+	// istioAuthnFilter is the dynamic metadata namespace of the request authentication attributes matched by Istio's RBAC policies
+	istioAuthnFilter = "istio_authn"
+)
+
+var rbacActionToAuthzAction = map[xdsRBAC.RBAC_Action]string{
+	xdsRBAC.RBAC_ALLOW: nsconfigengine.AuthzAllow,
+	xdsRBAC.RBAC_DENY:  nsconfigengine.AuthzDeny,
+	xdsRBAC.RBAC_LOG:   nsconfigengine.AuthzLog,
+}
+
+// noAuthzMatch never matches. It stands for the RBAC matches that can't be evaluated on the ADC
+var noAuthzMatch = nsconfigengine.AuthzMatch{Not: &nsconfigengine.AuthzMatch{Any: true}}
+
+func getStringMatchHeader(name string, stringMatch *envoyMatcher.StringMatcher) *nsconfigengine.MatchHeader {
+	matchHeader := &nsconfigengine.MatchHeader{Name: name}
+	setStringMatch(matchHeader, stringMatch)
+	return matchHeader
+}
+
+// getCidr returns the CIDR range in address/prefix-length form, or the address if the prefix length is not provided
+func getCidr(cidr *core.CidrRange) string {
+	if cidr.GetPrefixLen() == nil {
+		return cidr.GetAddressPrefix()
+	}
+	return cidr.GetAddressPrefix() + "/" + fmt.Sprint(cidr.GetPrefixLen().GetValue())
+}
+
+// getAuthzMetadataMatch converts the match on the request authentication attributes set by Istio.
+// Only the JWT principal and claims can be evaluated on the ADC
+func getAuthzMetadataMatch(metadata *envoyMatcher.MetadataMatcher) nsconfigengine.AuthzMatch {
+	path := make([]string, 0)
+	for _, segment := range metadata.GetPath() {
+		path = append(path, segment.GetKey())
+	}
+	stringMatch := metadata.GetValue().GetStringMatch()
+	if stringMatch == nil {
+		stringMatch = metadata.GetValue().GetListMatch().GetOneOf().GetStringMatch()
+	}
+	if metadata.GetFilter() != istioAuthnFilter || len(path) == 0 || stringMatch == nil {
+		xDSLogger.Warn("getAuthzMetadataMatch: Unsupported metadata match in RBAC policy", "filter", metadata.GetFilter(), "path", path)
+		return noAuthzMatch
+	}
+	match := nsconfigengine.AuthzMatch{}
+	switch {
+	case len(path) == 1 && path[0] == "request.auth.principal":
+		match.RequestPrincipal = getStringMatchHeader("", stringMatch)
+	case len(path) == 1 && path[0] == "request.auth.audiences":
+		match.Claims = append(match.Claims, *getStringMatchHeader("aud", stringMatch))
+	case len(path) == 1 && path[0] == "request.auth.presenter":
+		match.Claims = append(match.Claims, *getStringMatchHeader("azp", stringMatch))
+	case len(path) > 1 && path[0] == "request.auth.claims":
+		match.Claims = append(match.Claims, *getStringMatchHeader(strings.Join(path[1:], "/"), stringMatch))
+	default:
+		xDSLogger.Warn("getAuthzMetadataMatch: Unsupported metadata match in RBAC policy", "filter", metadata.GetFilter(), "path", path)
+		return noAuthzMatch
+	}
+	if metadata.GetInvert() {
+		return nsconfigengine.AuthzMatch{Not: &match}
+	}
+	return match
+}
+
+// getAuthzPermission converts Envoy's RBAC permission
+func getAuthzPermission(permission *xdsRBAC.Permission) nsconfigengine.AuthzMatch {
+	match := nsconfigengine.AuthzMatch{}
+	switch permission.GetRule().(type) {
+	case *xdsRBAC.Permission_Any:
+		match.Any = permission.GetAny()
+	case *xdsRBAC.Permission_AndRules:
+		match.And = make([]nsconfigengine.AuthzMatch, 0)
+		for _, andRule := range permission.GetAndRules().GetRules() {
+			match.And = append(match.And, getAuthzPermission(andRule))
+		}
+	case *xdsRBAC.Permission_OrRules:
+		match.Or = make([]nsconfigengine.AuthzMatch, 0)
+		for _, orRule := range permission.GetOrRules().GetRules() {
+			match.Or = append(match.Or, getAuthzPermission(orRule))
+		}
+	case *xdsRBAC.Permission_NotRule:
+		notRule := getAuthzPermission(permission.GetNotRule())
+		match.Not = &notRule
+	case *xdsRBAC.Permission_Header:
+		match.Headers = append(match.Headers, getMatchHeader(permission.GetHeader()))
+	case *xdsRBAC.Permission_UrlPath:
+		match.Path = getStringMatchHeader("", permission.GetUrlPath().GetPath())
+	case *xdsRBAC.Permission_DestinationIp:
+		match.DestinationIP = getCidr(permission.GetDestinationIp())
+	case *xdsRBAC.Permission_DestinationPort:
+		match.DestinationPort = int(permission.GetDestinationPort())
+	case *xdsRBAC.Permission_RequestedServerName:
+		match.ServerName = getStringMatchHeader("", permission.GetRequestedServerName())
+	case *xdsRBAC.Permission_Metadata:
+		return getAuthzMetadataMatch(permission.GetMetadata())
+	default:
+		xDSLogger.Warn("getAuthzPermission: Unsupported RBAC permission", "permission", permission)
+		return noAuthzMatch
+	}
+	return match
+}
+
+// getAuthzPrincipal converts Envoy's RBAC principal. Remote IP is evaluated as the client IP, as the ADC is the first proxy of the request
+func getAuthzPrincipal(principal *xdsRBAC.Principal) nsconfigengine.AuthzMatch {
+	match := nsconfigengine.AuthzMatch{}
+	switch principal.GetIdentifier().(type) {
+	case *xdsRBAC.Principal_Any:
+		match.Any = principal.GetAny()
+	case *xdsRBAC.Principal_AndIds:
+		match.And = make([]nsconfigengine.AuthzMatch, 0)
+		for _, andID := range principal.GetAndIds().GetIds() {
+			match.And = append(match.And, getAuthzPrincipal(andID))
+		}
+	case *xdsRBAC.Principal_OrIds:
+		match.Or = make([]nsconfigengine.AuthzMatch, 0)
+		for _, orID := range principal.GetOrIds().GetIds() {
+			match.Or = append(match.Or, getAuthzPrincipal(orID))
+		}
+	case *xdsRBAC.Principal_NotId:
+		notID := getAuthzPrincipal(principal.GetNotId())
+		match.Not = &notID
+	case *xdsRBAC.Principal_Authenticated_:
+		match.Authenticated = true
+		if principalName := principal.GetAuthenticated().GetPrincipalName(); principalName != nil {
+			match.Principal = getStringMatchHeader("", principalName)
+		}
+	case *xdsRBAC.Principal_SourceIp:
+		match.SourceIP = getCidr(principal.GetSourceIp())
+	case *xdsRBAC.Principal_DirectRemoteIp:
+		match.SourceIP = getCidr(principal.GetDirectRemoteIp())
+	case *xdsRBAC.Principal_RemoteIp:
+		match.SourceIP = getCidr(principal.GetRemoteIp())
+	case *xdsRBAC.Principal_Header:
+		match.Headers = append(match.Headers, getMatchHeader(principal.GetHeader()))
+	case *xdsRBAC.Principal_UrlPath:
+		match.Path = getStringMatchHeader("", principal.GetUrlPath().GetPath())
+	case *xdsRBAC.Principal_Metadata:
+		return getAuthzMetadataMatch(principal.GetMetadata())
+	default:
+		xDSLogger.Warn("getAuthzPrincipal: Unsupported RBAC principal", "principal", principal)
+		return noAuthzMatch
+	}
+	return match
+}
+
+// getAuthzRule converts the RBAC rules. Policies are ordered by name, to keep the ADC config stable across updates
+func getAuthzRule(rbac *xdsRBAC.RBAC, shadow bool) nsconfigengine.AuthzRule {
+	rule := nsconfigengine.AuthzRule{Action: rbacActionToAuthzAction[rbac.GetAction()], Shadow: shadow}
+	policyNames := make([]string, 0)
+	for policyName := range rbac.GetPolicies() {
+		policyNames = append(policyNames, policyName)
+	}
+	sort.Strings(policyNames)
+	for _, policyName := range policyNames {
+		rbacPolicy := rbac.GetPolicies()[policyName]
+		policy := nsconfigengine.AuthzPolicy{Name: policyName}
+		if rbacPolicy.GetCondition() != nil || rbacPolicy.GetCheckedCondition() != nil {
+			xDSLogger.Warn("getAuthzRule: Conditions of RBAC policy are not supported", "policyName", policyName)
+			policy.Permissions = []nsconfigengine.AuthzMatch{noAuthzMatch}
+		} else {
+			for _, permission := range rbacPolicy.GetPermissions() {
+				policy.Permissions = append(policy.Permissions, getAuthzPermission(permission))
+			}
+		}
+		for _, principal := range rbacPolicy.GetPrincipals() {
+			policy.Principals = append(policy.Principals, getAuthzPrincipal(principal))
+		}
+		rule.Policies = append(rule.Policies, policy)
+	}
+	return rule
+}
+
+// getAuthzConfig returns the authorization of a listener from its RBAC filters, in the order of the filters
+func getAuthzConfig(httpFilters []*envoyFilterHttp.HttpFilter) *nsconfigengine.AuthzSpec {
+	var authzSpec *nsconfigengine.AuthzSpec
+	for _, httpFilter := range httpFilters {
+		if httpFilter.GetName() != httpRBACFilter {
+			continue
+		}
+		rbac := &envoyHTTPRBAC.RBAC{}
+		if err := getHTTPFilterConfig(httpFilter, rbac); err != nil {
+			xDSLogger.Error("getAuthzConfig: Error loading RBAC filter", "error", err)
+			continue
+		}
+		if authzSpec == nil {
+			authzSpec = &nsconfigengine.AuthzSpec{}
+		}
+		appendAuthzRules(authzSpec, rbac.GetRules(), rbac.GetShadowRules())
+	}
+	return authzSpec
+}
+
+// appendAuthzRules appends the enforced and the shadow rules of an RBAC filter to the authorization
+func appendAuthzRules(authzSpec *nsconfigengine.AuthzSpec, rules, shadowRules *xdsRBAC.RBAC) {
+	if rules != nil {
+		authzSpec.Rules = append(authzSpec.Rules, getAuthzRule(rules, false))
+	}
+	if shadowRules != nil {
+		authzSpec.Rules = append(authzSpec.Rules, getAuthzRule(shadowRules, true))
+	}
+}
+
+// getNetworkAuthzConfig adds the rules of a network RBAC filter to the authorization of a TCP listener. Denied connections are reset
+func getNetworkAuthzConfig(authzSpec *nsconfigengine.AuthzSpec, filter *xdsListener.Filter) *nsconfigengine.AuthzSpec {
+	rbac := &envoyNetworkRBAC.RBAC{}
+	if err := getListenerFilterConfig(filter, rbac); err != nil {
+		xDSLogger.Error("getNetworkAuthzConfig: Error loading network RBAC filter", "error", err)
+		return authzSpec
+	}
+	if authzSpec == nil {
+		authzSpec = &nsconfigengine.AuthzSpec{DenyResponse: "RESET"}
+	}
+	appendAuthzRules(authzSpec, rbac.GetRules(), rbac.GetShadowRules())
+	return authzSpec
+}
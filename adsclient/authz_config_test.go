@@ -0,0 +1,105 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	rbac "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	xdsrbac "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/rbac/v3"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	xdsnetworkrbac "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/rbac/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	ptypes "github.com/golang/protobuf/ptypes"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func getRBACFilter(t *testing.T, rbacConfig *xdsrbac.RBAC) *http_conn.HttpFilter {
+	rbacAny, err := ptypes.MarshalAny(rbacConfig)
+	if err != nil {
+		t.Fatalf("Could not marshal RBAC filter config: %v", err)
+	}
+	return &http_conn.HttpFilter{Name: httpRBACFilter, ConfigType: &http_conn.HttpFilter_TypedConfig{TypedConfig: rbacAny}}
+}
+
+func Test_getAuthzConfig(t *testing.T) {
+	if authzSpec := getAuthzConfig(nil); authzSpec != nil {
+		t.Errorf("Expected no authorization without RBAC filter, received %+v", authzSpec)
+	}
+	denyRBAC := &xdsrbac.RBAC{Rules: &rbac.RBAC{Action: rbac.RBAC_DENY, Policies: map[string]*rbac.Policy{
+		"ns[default]-policy[deny-admin]-rule[0]": {
+			Permissions: []*rbac.Permission{{Rule: &rbac.Permission_AndRules{AndRules: &rbac.Permission_Set{Rules: []*rbac.Permission{
+				{Rule: &rbac.Permission_UrlPath{UrlPath: &matcher.PathMatcher{Rule: &matcher.PathMatcher_Path{Path: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "/admin"}}}}}},
+				{Rule: &rbac.Permission_Header{Header: &route.HeaderMatcher{Name: ":method", HeaderMatchSpecifier: &route.HeaderMatcher_ExactMatch{ExactMatch: "POST"}}}}}}}}},
+			Principals: []*rbac.Principal{{Identifier: &rbac.Principal_NotId{NotId: &rbac.Principal{Identifier: &rbac.Principal_SourceIp{SourceIp: &core.CidrRange{AddressPrefix: "10.0.0.0", PrefixLen: &wrappers.UInt32Value{Value: 8}}}}}}},
+		},
+	}}}
+	allowRBAC := &xdsrbac.RBAC{
+		Rules: &rbac.RBAC{Action: rbac.RBAC_ALLOW, Policies: map[string]*rbac.Policy{
+			"ns[default]-policy[b]-rule[0]": {
+				Permissions: []*rbac.Permission{{Rule: &rbac.Permission_Any{Any: true}}},
+				Principals: []*rbac.Principal{{Identifier: &rbac.Principal_Metadata{Metadata: &matcher.MetadataMatcher{Filter: istioAuthnFilter,
+					Path:  []*matcher.MetadataMatcher_PathSegment{{Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: "request.auth.claims"}}, {Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: "groups"}}},
+					Value: &matcher.ValueMatcher{MatchPattern: &matcher.ValueMatcher_ListMatch{ListMatch: &matcher.ListMatcher{MatchPattern: &matcher.ListMatcher_OneOf{OneOf: &matcher.ValueMatcher{MatchPattern: &matcher.ValueMatcher_StringMatch{StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: "admin"}}}}}}}}}}}},
+			},
+			"ns[default]-policy[a]-rule[0]": {
+				Permissions: []*rbac.Permission{{Rule: &rbac.Permission_DestinationPort{DestinationPort: 8080}}},
+				Principals:  []*rbac.Principal{{Identifier: &rbac.Principal_Authenticated_{Authenticated: &rbac.Principal_Authenticated{PrincipalName: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: "spiffe://cluster.local/ns/default/sa/sleep"}}}}}},
+			},
+		}},
+		ShadowRules: &rbac.RBAC{Action: rbac.RBAC_DENY, Policies: map[string]*rbac.Policy{
+			"ns[default]-policy[c]-rule[0]": {
+				Permissions: []*rbac.Permission{{Rule: &rbac.Permission_DestinationPortRange{}}},
+				Principals:  []*rbac.Principal{{Identifier: &rbac.Principal_Any{Any: true}}},
+			},
+		}},
+	}
+	expected := &nsconfigengine.AuthzSpec{Rules: []nsconfigengine.AuthzRule{
+		{Action: nsconfigengine.AuthzDeny, Policies: []nsconfigengine.AuthzPolicy{{Name: "ns[default]-policy[deny-admin]-rule[0]",
+			Permissions: []nsconfigengine.AuthzMatch{{And: []nsconfigengine.AuthzMatch{{Path: &nsconfigengine.MatchHeader{Prefix: "/admin"}}, {Headers: []nsconfigengine.MatchHeader{{Name: ":method", Exact: "POST"}}}}}},
+			Principals:  []nsconfigengine.AuthzMatch{{Not: &nsconfigengine.AuthzMatch{SourceIP: "10.0.0.0/8"}}}}}},
+		{Action: nsconfigengine.AuthzAllow, Policies: []nsconfigengine.AuthzPolicy{
+			{Name: "ns[default]-policy[a]-rule[0]", Permissions: []nsconfigengine.AuthzMatch{{DestinationPort: 8080}},
+				Principals: []nsconfigengine.AuthzMatch{{Authenticated: true, Principal: &nsconfigengine.MatchHeader{Exact: "spiffe://cluster.local/ns/default/sa/sleep"}}}},
+			{Name: "ns[default]-policy[b]-rule[0]", Permissions: []nsconfigengine.AuthzMatch{{Any: true}},
+				Principals: []nsconfigengine.AuthzMatch{{Claims: []nsconfigengine.MatchHeader{{Name: "groups", Exact: "admin"}}}}}}},
+		{Action: nsconfigengine.AuthzDeny, Shadow: true, Policies: []nsconfigengine.AuthzPolicy{{Name: "ns[default]-policy[c]-rule[0]",
+			Permissions: []nsconfigengine.AuthzMatch{noAuthzMatch}, Principals: []nsconfigengine.AuthzMatch{{Any: true}}}}},
+	}}
+	httpFilters := []*http_conn.HttpFilter{getRBACFilter(t, denyRBAC), getRBACFilter(t, allowRBAC)}
+	if authzSpec := getAuthzConfig(httpFilters); !reflect.DeepEqual(authzSpec, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, authzSpec)
+	}
+}
+
+func Test_getNetworkAuthzConfig(t *testing.T) {
+	rbacAny, _ := ptypes.MarshalAny(&xdsnetworkrbac.RBAC{StatPrefix: "tcp.", Rules: &rbac.RBAC{Action: rbac.RBAC_ALLOW, Policies: map[string]*rbac.Policy{
+		"ns[default]-policy[tcp]-rule[0]": {
+			Permissions: []*rbac.Permission{{Rule: &rbac.Permission_DestinationPort{DestinationPort: 9000}}},
+			Principals:  []*rbac.Principal{{Identifier: &rbac.Principal_DirectRemoteIp{DirectRemoteIp: &core.CidrRange{AddressPrefix: "10.1.0.0", PrefixLen: &wrappers.UInt32Value{Value: 16}}}}},
+		},
+	}}})
+	filter := &listener.Filter{Name: networkRBACFilter, ConfigType: &listener.Filter_TypedConfig{TypedConfig: rbacAny}}
+	expected := &nsconfigengine.AuthzSpec{DenyResponse: "RESET", Rules: []nsconfigengine.AuthzRule{{Action: nsconfigengine.AuthzAllow, Policies: []nsconfigengine.AuthzPolicy{{Name: "ns[default]-policy[tcp]-rule[0]",
+		Permissions: []nsconfigengine.AuthzMatch{{DestinationPort: 9000}}, Principals: []nsconfigengine.AuthzMatch{{SourceIP: "10.1.0.0/16"}}}}}}}
+	if authzSpec := getNetworkAuthzConfig(nil, filter); !reflect.DeepEqual(authzSpec, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, authzSpec)
+	}
+}
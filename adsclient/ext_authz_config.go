@@ -0,0 +1,208 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	envoyExtAuthz "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	envoyFilterHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	envoyMatcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+// extAuthzFilter is the name of Envoy's external authorization filter
+const extAuthzFilter = "envoy.filters.http.ext_authz"
+
+// extAuthzHeaderNameRegex returns the regex matching the names of the request headers selected by the string matcher, or "" if not supported
+func extAuthzHeaderNameRegex(stringMatch *envoyMatcher.StringMatcher) string {
+	switch stringMatch.GetMatchPattern().(type) {
+	case *envoyMatcher.StringMatcher_Exact:
+		return regexp.QuoteMeta(stringMatch.GetExact())
+	case *envoyMatcher.StringMatcher_Prefix:
+		return regexp.QuoteMeta(stringMatch.GetPrefix()) + "[^:\\r\\n]*"
+	case *envoyMatcher.StringMatcher_Suffix:
+		return "[^:\\r\\n]*" + regexp.QuoteMeta(stringMatch.GetSuffix())
+	case *envoyMatcher.StringMatcher_Contains:
+		return "[^:\\r\\n]*" + regexp.QuoteMeta(stringMatch.GetContains()) + "[^:\\r\\n]*"
+	case *envoyMatcher.StringMatcher_SafeRegex:
+		return stringMatch.GetSafeRegex().GetRegex()
+	}
+	return ""
+}
+
+// getExtAuthzRequestExpr returns the expression of the authorization request sent to the authorization service.
+// Like Envoy, the request has the method and URL of the client request with the path prefixed, the Host and Authorization headers,
+// along with the first header matching each of the allowed headers and the headers to add. Request body is not sent
+func getExtAuthzRequestExpr(httpService *envoyExtAuthz.HttpService) string {
+	var requestExpr strings.Builder
+	requestExpr.WriteString("HTTP.REQ.METHOD + \" " + httpService.GetPathPrefix() + "\" + HTTP.REQ.URL + \" HTTP/1.1\\r\\nHost: \" + HTTP.REQ.HOSTNAME")
+	headerRegexes := []string{"Authorization"}
+	for _, allowedHeader := range httpService.GetAuthorizationRequest().GetAllowedHeaders().GetPatterns() {
+		headerRegex := extAuthzHeaderNameRegex(allowedHeader)
+		if headerRegex == "" || strings.Contains(headerRegex, "#") {
+			xDSLogger.Warn("getExtAuthzRequestExpr: Allowed header matcher not supported", "matcher", allowedHeader)
+			continue
+		}
+		if !strings.EqualFold(headerRegex, "Authorization") {
+			headerRegexes = append(headerRegexes, headerRegex)
+		}
+	}
+	for _, headerRegex := range headerRegexes {
+		requestExpr.WriteString(" + HTTP.REQ.FULL_HEADER.REGEX_SELECT(re#(?i)\\r\\n" + headerRegex + ":[^\\r\\n]*#)")
+	}
+	requestExpr.WriteString(" + \"")
+	for _, header := range httpService.GetAuthorizationRequest().GetHeadersToAdd() {
+		requestExpr.WriteString("\\r\\n" + header.GetKey() + ": " + header.GetValue())
+	}
+	requestExpr.WriteString("\\r\\nContent-Length: 0\\r\\n\\r\\n\"")
+	return requestExpr.String()
+}
+
+// getExtAuthzConfig converts the HTTP service of the external authorization filter to the ExtAuthzSpec, and returns it along with the
+// authorization service cluster. Only the exact matchers of the allowed upstream headers are supported.
+// Timeout of the authorization service is rounded up to seconds
+func getExtAuthzConfig(httpFilters []*envoyFilterHttp.HttpFilter) (*nsconfigengine.ExtAuthzSpec, string) {
+	for _, httpFilter := range httpFilters {
+		if httpFilter.GetName() != extAuthzFilter {
+			continue
+		}
+		extAuthz := &envoyExtAuthz.ExtAuthz{}
+		if err := getHTTPFilterConfig(httpFilter, extAuthz); err != nil {
+			xDSLogger.Error("getExtAuthzConfig: Error loading external authorization filter", "error", err)
+			continue
+		}
+		httpService := extAuthz.GetHttpService()
+		if httpService == nil {
+			xDSLogger.Warn("getExtAuthzConfig: Only HTTP authorization service is supported", "filter", httpFilter.GetName())
+			continue
+		}
+		clusterName := httpService.GetServerUri().GetCluster()
+		extAuthzSpec := &nsconfigengine.ExtAuthzSpec{
+			Callout:          nsconfigengine.NewHTTPCalloutPolicy(nsconfigengine.GetNSCompatibleName(clusterName), "TEXT", getExtAuthzRequestExpr(httpService), "", "", nsconfigengine.ExtAuthzResultExpr),
+			Timeout:          int(math.Ceil(httpService.GetServerUri().GetTimeout().AsDuration().Seconds())),
+			FailureModeAllow: extAuthz.GetFailureModeAllow(),
+			StatusOnError:    int(extAuthz.GetStatusOnError().GetCode()),
+		}
+		for _, upstreamHeader := range httpService.GetAuthorizationResponse().GetAllowedUpstreamHeaders().GetPatterns() {
+			if upstreamHeader.GetExact() == "" {
+				xDSLogger.Warn("getExtAuthzConfig: Allowed upstream header matcher not supported", "matcher", upstreamHeader)
+				continue
+			}
+			extAuthzSpec.UpstreamHeaders = append(extAuthzSpec.UpstreamHeaders, upstreamHeader.GetExact())
+		}
+		return extAuthzSpec, clusterName
+	}
+	return nil, ""
+}
+
+// extAuthzClusterInfo is the cluster of an authorization service, along with the LB vservers of the authorization service dedicated to the listeners.
+// Server timeout of the servicegroup of a dedicated LB vserver is the timeout of its listener's authorization requests
+type extAuthzClusterInfo struct {
+	lbObj    *nsconfigengine.LBApi
+	svcGpObj *nsconfigengine.ServiceGroupAPI
+	timeouts map[string]int // Server timeouts of the dedicated LB vservers, keyed by LB vserver name
+}
+
+// getExtAuthzTimeoutEntityName returns the name of the LB vserver and servicegroup of the authorization service dedicated to the CS vserver
+func getExtAuthzTimeoutEntityName(csVsName string) string {
+	return nsconfigengine.GetNSCompatibleName(csVsName + "_extauthz")
+}
+
+// extAuthzTimeoutLbAdd adds the dedicated LB vserver, with the endpoints of priority 0 of the authorization service's cluster
+func extAuthzTimeoutLbAdd(nsConfig *configAdaptor, clusterInfo *extAuthzClusterInfo, entityName string) {
+	if clusterInfo.lbObj == nil {
+		return
+	}
+	lbObj := *clusterInfo.lbObj
+	lbObj.Name = entityName
+	lbObj.StringMapBindings = nil
+	lbObj.BackupVserver = ""
+	lbObj.HighCircuitBreaker = nil
+	lbObj.MinActivePercent = 0
+	lbObj.ServerTimeout = clusterInfo.timeouts[entityName]
+	nsConfig.addConfig(&configBlock{configType: cdsAdd, resourceName: entityName, resource: &lbObj})
+	if clusterInfo.svcGpObj != nil {
+		svcGpObj := *clusterInfo.svcGpObj
+		svcGpObj.Name = entityName
+		nsConfig.addConfig(&configBlock{configType: edsAdd, resourceName: entityName, resource: &svcGpObj})
+	}
+}
+
+// extAuthzClusterUpdate stores the LB vserver, or the endpoints if svcGpObj is set, of the cluster, and updates the dedicated LB vservers of its authorization service
+func extAuthzClusterUpdate(nsConfig *configAdaptor, clusterName string, lbObj *nsconfigengine.LBApi, svcGpObj *nsconfigengine.ServiceGroupAPI) {
+	clusterInfo, ok := nsConfig.extAuthzClusters[clusterName]
+	if !ok {
+		clusterInfo = &extAuthzClusterInfo{timeouts: make(map[string]int)}
+		nsConfig.extAuthzClusters[clusterName] = clusterInfo
+	}
+	if svcGpObj != nil {
+		clusterInfo.svcGpObj = svcGpObj
+	} else {
+		clusterInfo.lbObj = lbObj
+	}
+	for entityName := range clusterInfo.timeouts {
+		extAuthzTimeoutLbAdd(nsConfig, clusterInfo, entityName)
+	}
+}
+
+// extAuthzClusterDelete deletes the dedicated LB vservers of the cluster's authorization service. They are added again, if still registered, when the cluster is added
+func extAuthzClusterDelete(nsConfig *configAdaptor, clusterName string) {
+	clusterInfo, ok := nsConfig.extAuthzClusters[clusterName]
+	if !ok {
+		return
+	}
+	for entityName := range clusterInfo.timeouts {
+		nsConfig.delConfig(&configBlock{configType: cdsDel, resourceName: entityName, resource: &nsconfigengine.LBApi{Name: entityName}})
+	}
+	if len(clusterInfo.timeouts) == 0 {
+		delete(nsConfig.extAuthzClusters, clusterName)
+		return
+	}
+	clusterInfo.lbObj, clusterInfo.svcGpObj = nil, nil
+}
+
+// registerExtAuthzTimeout registers the LB vserver of the authorization service dedicated to the CS vserver, or unregisters it if extAuthzSpec is nil.
+// Dedicated LB vserver is added, or updated, as per the cluster of the authorization service, and deleted once unregistered
+func (confAdaptor *configAdaptor) registerExtAuthzTimeout(csVsName, clusterName string, extAuthzSpec *nsconfigengine.ExtAuthzSpec) {
+	entityName := getExtAuthzTimeoutEntityName(csVsName)
+	for name, clusterInfo := range confAdaptor.extAuthzClusters {
+		if _, ok := clusterInfo.timeouts[entityName]; !ok || (name == clusterName && extAuthzSpec != nil) {
+			continue
+		}
+		delete(clusterInfo.timeouts, entityName)
+		if clusterInfo.lbObj == nil && len(clusterInfo.timeouts) == 0 {
+			delete(confAdaptor.extAuthzClusters, name)
+		}
+		if extAuthzSpec == nil {
+			confAdaptor.delConfig(&configBlock{configType: cdsDel, resourceName: entityName, resource: &nsconfigengine.LBApi{Name: entityName}})
+		}
+	}
+	if extAuthzSpec == nil {
+		return
+	}
+	clusterInfo, ok := confAdaptor.extAuthzClusters[clusterName]
+	if !ok {
+		clusterInfo = &extAuthzClusterInfo{timeouts: make(map[string]int)}
+		confAdaptor.extAuthzClusters[clusterName] = clusterInfo
+	}
+	if timeout, ok := clusterInfo.timeouts[entityName]; ok && timeout == extAuthzSpec.Timeout {
+		return
+	}
+	clusterInfo.timeouts[entityName] = extAuthzSpec.Timeout
+	extAuthzTimeoutLbAdd(confAdaptor, clusterInfo, entityName)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	xdsextauthz "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_authz/v3"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	ptypes "github.com/golang/protobuf/ptypes"
+	duration "github.com/golang/protobuf/ptypes/duration"
+)
+
+func Test_getExtAuthzConfig(t *testing.T) {
+	if extAuthzSpec, _ := getExtAuthzConfig(nil); extAuthzSpec != nil {
+		t.Errorf("Expected no external authorization without ext_authz filter, received %+v", extAuthzSpec)
+	}
+	extAuthz := &xdsextauthz.ExtAuthz{
+		FailureModeAllow: true,
+		StatusOnError:    &xdstype.HttpStatus{Code: xdstype.StatusCode_ServiceUnavailable},
+		Services: &xdsextauthz.ExtAuthz_HttpService{HttpService: &xdsextauthz.HttpService{
+			ServerUri:  &core.HttpUri{Uri: "http://opa.authz:8181", HttpUpstreamType: &core.HttpUri_Cluster{Cluster: "outbound|8181||opa.authz.svc.cluster.local"}, Timeout: &duration.Duration{Seconds: 1, Nanos: 500000000}},
+			PathPrefix: "/check",
+			AuthorizationRequest: &xdsextauthz.AuthorizationRequest{
+				AllowedHeaders: &matcher.ListStringMatcher{Patterns: []*matcher.StringMatcher{
+					{MatchPattern: &matcher.StringMatcher_Exact{Exact: "x-user"}},
+					{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "x-b3-"}},
+				}},
+				HeadersToAdd: []*core.HeaderValue{{Key: "x-authz-source", Value: "adc"}},
+			},
+			AuthorizationResponse: &xdsextauthz.AuthorizationResponse{
+				AllowedUpstreamHeaders: &matcher.ListStringMatcher{Patterns: []*matcher.StringMatcher{
+					{MatchPattern: &matcher.StringMatcher_Exact{Exact: "x-auth-user"}},
+					{MatchPattern: &matcher.StringMatcher_Prefix{Prefix: "x-auth-"}},
+				}},
+			},
+		}},
+	}
+	extAuthzAny, err := ptypes.MarshalAny(extAuthz)
+	if err != nil {
+		t.Fatalf("Could not marshal ext_authz filter config: %v", err)
+	}
+	httpFilters := []*http_conn.HttpFilter{{Name: extAuthzFilter, ConfigType: &http_conn.HttpFilter_TypedConfig{TypedConfig: extAuthzAny}}}
+	requestExpr := "HTTP.REQ.METHOD + \" /check\" + HTTP.REQ.URL + \" HTTP/1.1\\r\\nHost: \" + HTTP.REQ.HOSTNAME" +
+		" + HTTP.REQ.FULL_HEADER.REGEX_SELECT(re#(?i)\\r\\nAuthorization:[^\\r\\n]*#)" +
+		" + HTTP.REQ.FULL_HEADER.REGEX_SELECT(re#(?i)\\r\\nx-user:[^\\r\\n]*#)" +
+		" + HTTP.REQ.FULL_HEADER.REGEX_SELECT(re#(?i)\\r\\nx-b3-[^:\\r\\n]*:[^\\r\\n]*#)" +
+		" + \"\\r\\nx-authz-source: adc\\r\\nContent-Length: 0\\r\\n\\r\\n\""
+	expected := &nsconfigengine.ExtAuthzSpec{
+		Callout:          nsconfigengine.NewHTTPCalloutPolicy("outbound_8181__opa_authz_svc_cluster_local", "TEXT", requestExpr, "", "", nsconfigengine.ExtAuthzResultExpr),
+		UpstreamHeaders:  []string{"x-auth-user"},
+		Timeout:          2,
+		FailureModeAllow: true,
+		StatusOnError:    503,
+	}
+	extAuthzSpec, clusterName := getExtAuthzConfig(httpFilters)
+	if !reflect.DeepEqual(extAuthzSpec, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, extAuthzSpec)
+	}
+	if clusterName != "outbound|8181||opa.authz.svc.cluster.local" {
+		t.Errorf("Expected authorization cluster outbound|8181||opa.authz.svc.cluster.local, received %s", clusterName)
+	}
+}
+
+func Test_registerExtAuthzTimeout(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	clusterAdd(nsConfAdaptor, env.MakeCluster("opa"), "HTTP")
+	clusterEndpointUpdate(nsConfAdaptor, env.MakeEndpoint("opa", []env.ServiceEndpoint{{"1.1.1.1", 8181, 1}}), nil)
+	extAuthzSpec := &nsconfigengine.ExtAuthzSpec{Callout: nsconfigengine.NewHTTPCalloutPolicy("opa", "TEXT", "", "", "", nsconfigengine.ExtAuthzResultExpr), Timeout: 2}
+	nsConfAdaptor.registerExtAuthzTimeout("cs1", "opa", extAuthzSpec)
+	entityName := getExtAuthzTimeoutEntityName("cs1")
+	confBl, err := nsConfAdaptor.getConfigByName(entityName, cdsAdd)
+	if err != nil || confBl.resource.(*nsconfigengine.LBApi).ServerTimeout != 2 {
+		t.Errorf("LB vserver %s with server timeout 2 not added - %v", entityName, err)
+	}
+	svcGpObj := nsconfigengine.NewServiceGroupAPI(entityName)
+	svcGpObj.Members = []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.1", Port: 8181, Weight: 1}}
+	svcGpObj.GracefulDelay = defaultGracefulDrainDelay
+	if err := verifyObject(nsConfAdaptor, edsAdd, entityName, svcGpObj, nil, nil); err != nil {
+		t.Errorf("Verification failed - %v", err)
+	}
+	clusterEndpointUpdate(nsConfAdaptor, env.MakeEndpoint("opa", []env.ServiceEndpoint{{"1.1.1.2", 8181, 1}}), nil)
+	svcGpObj.Members = []nsconfigengine.ServiceGroupMember{{IP: "1.1.1.2", Port: 8181, Weight: 1}}
+	if err := verifyObject(nsConfAdaptor, edsAdd, entityName, svcGpObj, nil, nil); err != nil {
+		t.Errorf("Verification failed for endpoint update - %v", err)
+	}
+	nsConfAdaptor.registerExtAuthzTimeout("cs1", "", nil)
+	if err := verifyObject(nsConfAdaptor, cdsDel, entityName, &nsconfigengine.LBApi{Name: entityName}, nil, nil); err != nil {
+		t.Errorf("Verification failed for unregistration - %v", err)
+	}
+	if clusterInfo := nsConfAdaptor.extAuthzClusters["opa"]; clusterInfo == nil || len(clusterInfo.timeouts) != 0 {
+		t.Errorf("Expected opa cluster without dedicated LB vservers, received %+v", clusterInfo)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	envoyJWT "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+)
+
+const (
+	// Envoy's defaults for the cache duration of the remote JWKS and the timeout of fetching it
+	defaultJwksCacheDuration = 10 * time.Minute
+	defaultJwksFetchTimeout  = 1 * time.Second
+	// jwksRetryInterval is the interval after which the JWKS which could not be fetched is fetched again
+	jwksRetryInterval = 30 * time.Second
+	// jwksRefreshInterval is the interval at which the expiry of the cached JWKS is checked
+	jwksRefreshInterval = 5 * time.Second
+)
+
+// remoteJwksInfo is the JWKS fetched from a JWKS URI, along with the CS vservers whose authentication verifies the JWTs with it.
+// CS vservers are copies of those queued for configuration, which are updated with the JWKS before being queued again
+type remoteJwksInfo struct {
+	jwks          string
+	timeout       time.Duration
+	cacheDuration time.Duration
+	expiry        time.Time
+	csObjs        map[string]*nsconfigengine.CSApi // keyed by CS vserver name
+}
+
+func fetchJwks(uri string, timeout time.Duration) (string, error) {
+	httpClient := &http.Client{Timeout: timeout}
+	resp, err := httpClient.Get(uri)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("JWKS URI %s responded with status %d", uri, resp.StatusCode)
+	}
+	jwks, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(jwks), nil
+}
+
+// getRemoteJwks returns the JWKS of the remote JWKS source if already cached. Otherwise empty JWKS is returned,
+// and the JWKS is fetched by the JWKS fetcher, which reconfigures the CS vservers registered for it
+func (confAdaptor *configAdaptor) getRemoteJwks(remoteJwks *envoyJWT.RemoteJwks) string {
+	uri := remoteJwks.GetHttpUri().GetUri()
+	confAdaptor.jwksMux.Lock()
+	defer confAdaptor.jwksMux.Unlock()
+	if jwksInfo, ok := confAdaptor.remoteJwks[uri]; ok {
+		return jwksInfo.jwks
+	}
+	jwksInfo := &remoteJwksInfo{timeout: defaultJwksFetchTimeout, cacheDuration: defaultJwksCacheDuration, csObjs: make(map[string]*nsconfigengine.CSApi)}
+	if remoteJwks.GetHttpUri().GetTimeout() != nil {
+		jwksInfo.timeout = remoteJwks.GetHttpUri().GetTimeout().AsDuration()
+	}
+	if remoteJwks.GetCacheDuration() != nil {
+		jwksInfo.cacheDuration = remoteJwks.GetCacheDuration().AsDuration()
+	}
+	confAdaptor.remoteJwks[uri] = jwksInfo
+	select {
+	case confAdaptor.jwksFetch <- true:
+	default:
+	}
+	return ""
+}
+
+// copyAuthCSApi returns a copy of the CS vserver whose AuthSpec is not shared with it.
+// JWKS of the remote providers are set from the cache
+func (confAdaptor *configAdaptor) copyAuthCSApi(csObj *nsconfigengine.CSApi) *nsconfigengine.CSApi {
+	csObjCopy := *csObj
+	authSpec := *csObj.AuthSpec
+	authSpec.Providers = append([]nsconfigengine.JwtProvider{}, csObj.AuthSpec.Providers...)
+	for i := range authSpec.Providers {
+		if jwksInfo, ok := confAdaptor.remoteJwks[authSpec.Providers[i].JwksURI]; ok {
+			authSpec.Providers[i].Jwks = jwksInfo.jwks
+		}
+	}
+	csObjCopy.AuthSpec = &authSpec
+	return &csObjCopy
+}
+
+// unregisterRemoteJwks stops refreshing the authentication of the CS vserver with the remote JWKS
+func (confAdaptor *configAdaptor) unregisterRemoteJwks(csVsName string) {
+	confAdaptor.jwksMux.Lock()
+	defer confAdaptor.jwksMux.Unlock()
+	for _, jwksInfo := range confAdaptor.remoteJwks {
+		delete(jwksInfo.csObjs, csVsName)
+	}
+}
+
+// registerRemoteJwks registers the CS vserver to be reconfigured when the remote JWKS of any of its JWT providers changes.
+// CS vserver's earlier registrations are replaced. Its remote providers are set with the JWKS fetched since they were converted
+func (confAdaptor *configAdaptor) registerRemoteJwks(csObj *nsconfigengine.CSApi) {
+	confAdaptor.unregisterRemoteJwks(csObj.Name)
+	if csObj.AuthSpec == nil {
+		return
+	}
+	confAdaptor.jwksMux.Lock()
+	defer confAdaptor.jwksMux.Unlock()
+	registeredCSObj := confAdaptor.copyAuthCSApi(csObj)
+	csObj.AuthSpec.Providers = append([]nsconfigengine.JwtProvider{}, registeredCSObj.AuthSpec.Providers...)
+	for _, provider := range csObj.AuthSpec.Providers {
+		if jwksInfo, ok := confAdaptor.remoteJwks[provider.JwksURI]; ok {
+			jwksInfo.csObjs[csObj.Name] = registeredCSObj
+		}
+	}
+}
+
+// refreshRemoteJwks fetches the remote JWKS not fetched yet, or whose cache duration has expired. CS vservers using the JWKS are reconfigured
+// if it has changed. JWKS no longer used by any CS vserver is removed from the cache. JWKS are fetched without holding jwksMux
+func (confAdaptor *configAdaptor) refreshRemoteJwks() {
+	expiredJwks := make(map[string]time.Duration)
+	confAdaptor.jwksMux.Lock()
+	for uri, jwksInfo := range confAdaptor.remoteJwks {
+		if len(jwksInfo.csObjs) == 0 && !jwksInfo.expiry.IsZero() {
+			delete(confAdaptor.remoteJwks, uri)
+		} else if time.Now().After(jwksInfo.expiry) {
+			expiredJwks[uri] = jwksInfo.timeout
+		}
+	}
+	confAdaptor.jwksMux.Unlock()
+	for uri, timeout := range expiredJwks {
+		jwks, err := fetchJwks(uri, timeout)
+		csObjs := make([]*nsconfigengine.CSApi, 0)
+		confAdaptor.jwksMux.Lock()
+		jwksInfo, ok := confAdaptor.remoteJwks[uri]
+		if !ok {
+			confAdaptor.jwksMux.Unlock()
+			continue
+		}
+		if err != nil {
+			xDSLogger.Error("refreshRemoteJwks: Could not fetch JWKS", "uri", uri, "error", err)
+			jwksInfo.expiry = time.Now().Add(jwksRetryInterval)
+		} else {
+			jwksInfo.expiry = time.Now().Add(jwksInfo.cacheDuration)
+			if jwks != jwksInfo.jwks {
+				jwksInfo.jwks = jwks
+				for csVsName, csObj := range jwksInfo.csObjs {
+					registeredCSObj := confAdaptor.copyAuthCSApi(csObj)
+					jwksInfo.csObjs[csVsName] = registeredCSObj
+					csObjs = append(csObjs, confAdaptor.copyAuthCSApi(registeredCSObj))
+				}
+			}
+		}
+		confAdaptor.jwksMux.Unlock()
+		for _, csObj := range csObjs {
+			xDSLogger.Info("refreshRemoteJwks: JWKS changed, updating authentication", "uri", uri, "csVsName", csObj.Name)
+			confAdaptor.addConfig(&configBlock{configType: ldsAdd, resourceName: csObj.Name, resource: []*nsconfigengine.CSApi{csObj}})
+		}
+	}
+}
+
+// startJwksFetcher starts the goroutine fetching the remote JWKS, once requested by getRemoteJwks and periodically thereafter,
+// so that the JWKS are not fetched by the goroutines handling xDS resources or applying the configuration. Fetcher stops once quit is closed
+func (confAdaptor *configAdaptor) startJwksFetcher(quit chan bool) {
+	go func() {
+		ticker := time.NewTicker(jwksRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-confAdaptor.jwksFetch:
+			case <-ticker.C:
+			}
+			confAdaptor.refreshRemoteJwks()
+		}
+	}()
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	envoy_jwt "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	ptypes "github.com/golang/protobuf/ptypes"
+	duration "github.com/golang/protobuf/ptypes/duration"
+)
+
+func Test_remoteJwks(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		fmt.Fprintf(w, `{"keys":[{"kid":"%d"}]}`, fetches)
+	}))
+	defer server.Close()
+	jwtAuthM := &envoy_jwt.JwtAuthentication{Providers: map[string]*envoy_jwt.JwtProvider{
+		"origins-1": {
+			Issuer: "https://remote.example.com",
+			JwksSourceSpecifier: &envoy_jwt.JwtProvider_RemoteJwks{RemoteJwks: &envoy_jwt.RemoteJwks{
+				HttpUri:       &core.HttpUri{Uri: server.URL, HttpUpstreamType: &core.HttpUri_Cluster{Cluster: "outbound|443||remote.example.com"}},
+				CacheDuration: &duration.Duration{Seconds: 300},
+			}},
+			FromHeaders: []*envoy_jwt.JwtHeader{{Name: "Authorization", ValuePrefix: "Bearer "}},
+		},
+		"origins-0": {
+			Issuer:              "https://local.example.com",
+			JwksSourceSpecifier: &envoy_jwt.JwtProvider_LocalJwks{LocalJwks: &core.DataSource{Specifier: &core.DataSource_InlineString{InlineString: `{"keys":[]}`}}},
+			FromHeaders:         []*envoy_jwt.JwtHeader{{Name: "Authorization", ValuePrefix: "Bearer "}},
+			FromParams:          []string{"token"},
+		},
+	}}
+	jwtAuth, _ := ptypes.MarshalAny(jwtAuthM)
+	httpFilters := []*http_conn.HttpFilter{{Name: "envoy.filters.http.jwt_authn", ConfigType: &http_conn.HttpFilter_TypedConfig{TypedConfig: jwtAuth}}}
+	nsConfAdaptor := getNsConfAdaptor()
+	csObj := nsconfigengine.NewCSApi("cs1", "HTTP", "1.1.1.1", 80)
+	csObj.AuthSpec = getAuthConfig(nsConfAdaptor, "cs1", httpFilters)
+	expected := &nsconfigengine.AuthSpec{Name: "cs1",
+		Providers: []nsconfigengine.JwtProvider{
+			{Issuer: "https://local.example.com", Jwks: `{"keys":[]}`},
+			{Issuer: "https://remote.example.com", JwksURI: server.URL},
+		},
+		JwtHeaders:  []nsconfigengine.JwtHeader{{Name: "Authorization", Prefix: "Bearer "}},
+		JwtParams:   []string{"token"},
+		FrontendTLS: []nsconfigengine.SSLSpec{{CertFilename: ClientCertChainFile, PrivateKeyFilename: ClientKeyFile}},
+	}
+	if !reflect.DeepEqual(csObj.AuthSpec, expected) || fetches != 0 {
+		t.Errorf("Expected AuthSpec:%+v without fetching JWKS    Received AuthSpec:%+v, JWKS fetched %d times", expected, csObj.AuthSpec, fetches)
+	}
+	nsConfAdaptor.registerRemoteJwks(csObj)
+	t.Logf("Fetch JWKS")
+	nsConfAdaptor.refreshRemoteJwks()
+	confBl, err := nsConfAdaptor.getConfigByName("cs1", ldsAdd)
+	if err != nil || confBl.resource.([]*nsconfigengine.CSApi)[0].AuthSpec.Providers[1].Jwks != `{"keys":[{"kid":"1"}]}` {
+		t.Errorf("Expected CS vserver cs1 to be reconfigured with fetched JWKS, error %v", err)
+	}
+	if csObj.AuthSpec.Providers[1].Jwks != "" {
+		t.Errorf("Expected AuthSpec of the queued CS vserver not to be modified, received JWKS %s", csObj.AuthSpec.Providers[1].Jwks)
+	}
+	nsConfAdaptor.configs.Init()
+	for key := range nsConfAdaptor.ldsHash {
+		delete(nsConfAdaptor.ldsHash, key)
+	}
+	if authSpec := getAuthConfig(nsConfAdaptor, "cs1", httpFilters); fetches != 1 || authSpec.Providers[1].Jwks != `{"keys":[{"kid":"1"}]}` {
+		t.Errorf("Expected cached JWKS to be used, JWKS fetched %d times", fetches)
+	}
+	t.Logf("Refresh JWKS before its expiry")
+	nsConfAdaptor.refreshRemoteJwks()
+	if fetches != 1 || nsConfAdaptor.configs.Len() != 0 {
+		t.Errorf("Expected JWKS not to be refreshed before expiry, JWKS fetched %d times", fetches)
+	}
+	t.Logf("Refresh expired JWKS")
+	nsConfAdaptor.remoteJwks[server.URL].expiry = time.Now().Add(-time.Second)
+	nsConfAdaptor.refreshRemoteJwks()
+	if confBl, err := nsConfAdaptor.getConfigByName("cs1", ldsAdd); err != nil || confBl.resource.([]*nsconfigengine.CSApi)[0].AuthSpec.Providers[1].Jwks != `{"keys":[{"kid":"2"}]}` {
+		t.Errorf("Expected CS vserver cs1 to be reconfigured with refreshed JWKS, error %v", err)
+	}
+	t.Logf("Unregister CS vserver")
+	nsConfAdaptor.unregisterRemoteJwks("cs1")
+	nsConfAdaptor.refreshRemoteJwks()
+	if _, ok := nsConfAdaptor.remoteJwks[server.URL]; ok {
+		t.Errorf("Expected unused JWKS to be removed from cache")
+	}
+}
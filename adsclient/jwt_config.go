@@ -0,0 +1,153 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	xdsRoute "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoyJWT "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	envoyMatcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+// jwtRequirementInfo is the summary of a JWT requirement: the providers any of which verifies the token, whether a missing or an invalid token is accepted,
+// and whether the requirement cannot be verified
+type jwtRequirementInfo struct {
+	providers    []string
+	allowMissing bool
+	allowFailed  bool
+	unsupported  bool
+}
+
+// getJwtRequirementInfo summarizes the JWT requirement. requires_all is supported only with a single nested requirement
+func getJwtRequirementInfo(requirement *envoyJWT.JwtRequirement, info *jwtRequirementInfo) {
+	switch requirement.GetRequiresType().(type) {
+	case *envoyJWT.JwtRequirement_ProviderName:
+		info.providers = append(info.providers, requirement.GetProviderName())
+	case *envoyJWT.JwtRequirement_ProviderAndAudiences:
+		xDSLogger.Warn("getJwtRequirementInfo: Audiences of JWT requirement are not supported, audiences of the provider are verified", "provider", requirement.GetProviderAndAudiences().GetProviderName())
+		info.providers = append(info.providers, requirement.GetProviderAndAudiences().GetProviderName())
+	case *envoyJWT.JwtRequirement_RequiresAny:
+		for _, nestedRequirement := range requirement.GetRequiresAny().GetRequirements() {
+			getJwtRequirementInfo(nestedRequirement, info)
+		}
+	case *envoyJWT.JwtRequirement_RequiresAll:
+		if nestedRequirements := requirement.GetRequiresAll().GetRequirements(); len(nestedRequirements) == 1 {
+			getJwtRequirementInfo(nestedRequirements[0], info)
+			return
+		}
+		xDSLogger.Error("getJwtRequirementInfo: requires_all JWT requirement is not supported, requests are denied")
+		info.unsupported = true
+	case *envoyJWT.JwtRequirement_AllowMissing:
+		info.allowMissing = true
+	case *envoyJWT.JwtRequirement_AllowMissingOrFailed:
+		info.allowFailed = true
+	}
+}
+
+// getAuthRuleMatch converts the path match of the route match. Header and query parameter matches are not supported
+func getAuthRuleMatch(routeMatch *xdsRoute.RouteMatch) nsconfigengine.AuthRuleMatch {
+	if len(routeMatch.GetHeaders()) > 0 || len(routeMatch.GetQueryParameters()) > 0 {
+		xDSLogger.Warn("getAuthRuleMatch: Header and query parameter matches of JWT requirement rule are not supported, path is matched", "routeMatch", routeMatch)
+	}
+	return nsconfigengine.AuthRuleMatch{Exact: routeMatch.GetPath(), Prefix: routeMatch.GetPrefix(), Regex: routeMatch.GetSafeRegex().GetRegex()}
+}
+
+// setAuthRules translates the JWT requirement rules into the paths of the authentication spec and of its providers.
+// Requests are matched against the paths of all the rules, whereas Envoy applies the first matching rule. Hence the rules after
+// the rule matching all the paths are skipped. Providers not required by any rule are removed.
+// Requests on the paths of the rules whose requirement is not supported are denied
+func setAuthRules(authSpec *nsconfigengine.AuthSpec, providerNames []string, jwtAuth *envoyJWT.JwtAuthentication) {
+	if len(jwtAuth.GetRules()) == 0 {
+		return
+	}
+	providerPaths := make(map[string][]nsconfigengine.AuthRuleMatch)
+	verifyingRules := 0
+	for _, rule := range jwtAuth.GetRules() {
+		match := getAuthRuleMatch(rule.GetMatch())
+		requirement := rule.GetRequires()
+		if rule.GetRequirementName() != "" {
+			requirement = jwtAuth.GetRequirementMap()[rule.GetRequirementName()]
+		}
+		info := jwtRequirementInfo{}
+		if requirement != nil {
+			getJwtRequirementInfo(requirement, &info)
+		}
+		switch {
+		case info.unsupported:
+			// Requests are denied as their tokens cannot be verified as required
+			authSpec.DenyPaths = append(authSpec.DenyPaths, match)
+		case len(info.providers) == 0:
+			// Tokens of the requests are not verified
+			authSpec.ExcludePaths = append(authSpec.ExcludePaths, match)
+		case info.allowFailed:
+			// Tokens are verified, and the requests whose token is missing or invalid are let through
+			authSpec.IncludePaths = append(authSpec.IncludePaths, match)
+			authSpec.ExcludePaths = append(authSpec.ExcludePaths, match)
+		case info.allowMissing:
+			authSpec.AllowMissingPaths = append(authSpec.AllowMissingPaths, match)
+		default:
+			authSpec.IncludePaths = append(authSpec.IncludePaths, match)
+		}
+		if len(info.providers) > 0 && !info.unsupported {
+			verifyingRules++
+			for _, providerName := range info.providers {
+				providerPaths[providerName] = append(providerPaths[providerName], match)
+			}
+		}
+		if match.Prefix == "/" && len(rule.GetMatch().GetHeaders()) == 0 && len(rule.GetMatch().GetQueryParameters()) == 0 {
+			break
+		}
+	}
+	providers := make([]nsconfigengine.JwtProvider, 0, len(authSpec.Providers))
+	for i, providerName := range providerNames {
+		paths, ok := providerPaths[providerName]
+		if !ok {
+			continue
+		}
+		// Provider required by all the rules verifying the tokens need not be restricted to their paths
+		if len(paths) < verifyingRules {
+			authSpec.Providers[i].IncludePaths = paths
+		}
+		providers = append(providers, authSpec.Providers[i])
+	}
+	authSpec.Providers = providers
+}
+
+// getClaimToHeaders returns the claim_to_headers of the JWT provider
+func getClaimToHeaders(jwtProvider *envoyJWT.JwtProvider) []nsconfigengine.JwtClaimHeader {
+	var claimHeaders []nsconfigengine.JwtClaimHeader
+	for _, claimToHeader := range jwtProvider.GetClaimToHeaders() {
+		claimHeaders = append(claimHeaders, nsconfigengine.JwtClaimHeader{Header: claimToHeader.GetHeaderName(), Claim: claimToHeader.GetClaimName()})
+	}
+	return claimHeaders
+}
+
+// getRouteClaimMatch converts the dynamic metadata match of a route on the JWT claims, i.e. Istio's request.auth.claims header match
+func getRouteClaimMatch(metadata *envoyMatcher.MetadataMatcher) []nsconfigengine.MatchHeader {
+	match := getAuthzMetadataMatch(metadata)
+	invert := false
+	if match.Not != nil {
+		invert = true
+		match = *match.Not
+	}
+	if len(match.Claims) == 0 {
+		xDSLogger.Warn("getRouteClaimMatch: Unsupported dynamic metadata match of route", "filter", metadata.GetFilter(), "path", metadata.GetPath())
+		return nil
+	}
+	for i := range match.Claims {
+		match.Claims[i].Invert = invert
+	}
+	return match.Claims
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoy_jwt "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/jwt_authn/v3"
+	matcher "github.com/envoyproxy/go-control-plane/envoy/type/matcher/v3"
+)
+
+func providerRequirement(providerName string) *envoy_jwt.JwtRequirement {
+	return &envoy_jwt.JwtRequirement{RequiresType: &envoy_jwt.JwtRequirement_ProviderName{ProviderName: providerName}}
+}
+
+func Test_setAuthRules(t *testing.T) {
+	jwtAuth := &envoy_jwt.JwtAuthentication{
+		Rules: []*envoy_jwt.RequirementRule{
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Path{Path: "/healthz"}}},
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/admin"}}, RequirementType: &envoy_jwt.RequirementRule_RequirementName{RequirementName: "admin"}},
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/public"}}, RequirementType: &envoy_jwt.RequirementRule_Requires{Requires: &envoy_jwt.JwtRequirement{
+				RequiresType: &envoy_jwt.JwtRequirement_AllowMissingOrFailed{}}}},
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/both"}}, RequirementType: &envoy_jwt.RequirementRule_Requires{Requires: &envoy_jwt.JwtRequirement{
+				RequiresType: &envoy_jwt.JwtRequirement_RequiresAll{RequiresAll: &envoy_jwt.JwtRequirementAndList{Requirements: []*envoy_jwt.JwtRequirement{
+					providerRequirement("origins-0"), providerRequirement("origins-2"),
+				}}}}}},
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"}}, RequirementType: &envoy_jwt.RequirementRule_Requires{Requires: &envoy_jwt.JwtRequirement{
+				RequiresType: &envoy_jwt.JwtRequirement_RequiresAny{RequiresAny: &envoy_jwt.JwtRequirementOrList{Requirements: []*envoy_jwt.JwtRequirement{
+					providerRequirement("origins-0"), providerRequirement("origins-1"), {RequiresType: &envoy_jwt.JwtRequirement_AllowMissing{}},
+				}}}}}},
+			{Match: &route.RouteMatch{PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/unreachable"}}},
+		},
+		RequirementMap: map[string]*envoy_jwt.JwtRequirement{"admin": providerRequirement("origins-1")},
+	}
+	authSpec := &nsconfigengine.AuthSpec{Providers: []nsconfigengine.JwtProvider{{Issuer: "issuer0"}, {Issuer: "issuer1"}, {Issuer: "issuer2"}}}
+	setAuthRules(authSpec, []string{"origins-0", "origins-1", "origins-2"}, jwtAuth)
+	expected := &nsconfigengine.AuthSpec{
+		IncludePaths:      []nsconfigengine.AuthRuleMatch{{Prefix: "/admin"}},
+		ExcludePaths:      []nsconfigengine.AuthRuleMatch{{Exact: "/healthz"}, {Prefix: "/public"}},
+		AllowMissingPaths: []nsconfigengine.AuthRuleMatch{{Prefix: "/"}},
+		DenyPaths:         []nsconfigengine.AuthRuleMatch{{Prefix: "/both"}},
+		Providers: []nsconfigengine.JwtProvider{
+			{Issuer: "issuer0", IncludePaths: []nsconfigengine.AuthRuleMatch{{Prefix: "/"}}},
+			{Issuer: "issuer1"},
+		},
+	}
+	if !reflect.DeepEqual(authSpec, expected) {
+		t.Errorf("Expected AuthSpec:%+v    Received AuthSpec:%+v", expected, authSpec)
+	}
+}
+
+func Test_getClaimToHeaders(t *testing.T) {
+	jwtProvider := &envoy_jwt.JwtProvider{Issuer: "issuer0"}
+	if claimHeaders := getClaimToHeaders(jwtProvider); claimHeaders != nil {
+		t.Errorf("Expected no claim headers, received %+v", claimHeaders)
+	}
+	jwtProvider.ClaimToHeaders = []*envoy_jwt.JwtClaimToHeader{{HeaderName: "x-jwt-group", ClaimName: "groups.primary"}}
+	expected := []nsconfigengine.JwtClaimHeader{{Header: "x-jwt-group", Claim: "groups.primary"}}
+	if claimHeaders := getClaimToHeaders(jwtProvider); !reflect.DeepEqual(claimHeaders, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, claimHeaders)
+	}
+}
+
+func Test_getRouteClaimMatch(t *testing.T) {
+	metadata := &matcher.MetadataMatcher{
+		Filter: istioAuthnFilter,
+		Path:   []*matcher.MetadataMatcher_PathSegment{{Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: "request.auth.claims"}}, {Segment: &matcher.MetadataMatcher_PathSegment_Key{Key: "group"}}},
+		Value:  &matcher.ValueMatcher{MatchPattern: &matcher.ValueMatcher_StringMatch{StringMatch: &matcher.StringMatcher{MatchPattern: &matcher.StringMatcher_Exact{Exact: "admin"}}}},
+		Invert: true,
+	}
+	expected := []nsconfigengine.MatchHeader{{Name: "group", Exact: "admin", Invert: true}}
+	if claims := getRouteClaimMatch(metadata); !reflect.DeepEqual(claims, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, claims)
+	}
+	metadata.Filter = "envoy.filters.http.jwt_authn"
+	if claims := getRouteClaimMatch(metadata); claims != nil {
+		t.Errorf("Expected no claim match for unsupported metadata, received %+v", claims)
+	}
+}
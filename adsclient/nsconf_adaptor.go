@@ -50,6 +50,7 @@ const (
 	ldsDel
 	edsAdd
 	rdsAdd
+	tracingUpdate
 	//MSS for setting various tcp profiles
 	MSS = 1410
 )
@@ -80,6 +81,19 @@ type configAdaptor struct {
 	analyticsProfiles []string // Two analyticspofile needed. One for TCP Insight, one for Web Insight
 	localHostVIP      string
 	caServerPort      string
+	lbSubsets         map[string]*lbSubsetInfo        // LB subset config of clusters, keyed by cluster name
+	lbPriorities      map[string]*lbPriorityInfo      // Backup LB vservers of the endpoint priorities of clusters, keyed by cluster name
+	hashLbClusters    map[string]bool                 // Clusters balanced by consistent hashing, keyed by cluster name
+	highLbClusters    map[string]bool                 // Clusters with HIGH priority circuit breaker, keyed by cluster name
+	appliedRoutes     map[string]*appliedRouteInfo    // Route configs applied on the CS vservers, keyed by CS vserver name
+	extAuthzClusters  map[string]*extAuthzClusterInfo // Dedicated LB vservers of the authorization services, keyed by cluster name
+	appliedEds        map[string]*configBlock         // Servicegroup configs applied last, keyed by resource name
+	jwksMux           sync.Mutex
+	jwksFetch         chan bool                  // Requests the JWKS fetcher to fetch the JWKS not fetched yet
+	remoteJwks        map[string]*remoteJwksInfo // JWKS of the JWT providers fetched by the adaptor, keyed by JWKS URI
+	tracingMux        sync.Mutex
+	tracingSpecs      map[string]*nsconfigengine.TracingSpec // Tracing of the HTTP connection managers, keyed by CS vserver name
+	tracingSpec       *nsconfigengine.TracingSpec            // Tracing applied on the Citrix ADC
 }
 
 var (
@@ -88,9 +102,13 @@ var (
 	multiClusterExpression = "multiClusterExpression"
 	multiClusterPolExprStr = os.Getenv("MULTICLUSTER_SVC_DOMAIN") //".global"
 	multiClusterListenPort = getIntEnv("MULTICLUSTER_LISTENER_PORT")
+	clusterHeaderStringMap = "clusterHeaderStringMap" // Stringmap to select LB vserver from cluster name for cluster_header routing
 	coeTracingEnabled      = getBoolEnv("COE_TRACING") // Either COE or ADM can be endpoint for collecting tracing data
 	labelsFile             = "/etc/podinfo/labels"
 	labelsFuncEnabled      = getBoolEnv("ENABLE_LABELS_FEATURE")
+	gracefulDrainDelay     = getIntEnv("GRACEFUL_DRAIN_DELAY") // Graceful disable delay of the draining and removed endpoints, 0 removes them immediately
+	ocspStapling           = getBoolEnv("OCSP_STAPLING")       // Staple OCSP responses of the certificates of SSL csvservers of the gateway
+	ocspResponderURL       = os.Getenv("OCSP_RESPONDER_URL")   // OCSP responder checking revocation of the peer certificates issued by the CA certificates
 )
 
 func getBoolEnv(key string) bool {
@@ -218,6 +236,16 @@ func newConfigAdaptor(nsinfo *NSDetails) (*configAdaptor, error) {
 	configAdaptor.edsHash = make(map[string]*list.Element)
 	configAdaptor.ldsHash = make(map[string]*list.Element)
 	configAdaptor.rdsHash = make(map[string]*list.Element)
+	configAdaptor.lbSubsets = make(map[string]*lbSubsetInfo)
+	configAdaptor.lbPriorities = make(map[string]*lbPriorityInfo)
+	configAdaptor.hashLbClusters = make(map[string]bool)
+	configAdaptor.highLbClusters = make(map[string]bool)
+	configAdaptor.appliedRoutes = make(map[string]*appliedRouteInfo)
+	configAdaptor.extAuthzClusters = make(map[string]*extAuthzClusterInfo)
+	configAdaptor.appliedEds = make(map[string]*configBlock)
+	configAdaptor.remoteJwks = make(map[string]*remoteJwksInfo)
+	configAdaptor.jwksFetch = make(chan bool, 1)
+	configAdaptor.tracingSpecs = make(map[string]*nsconfigengine.TracingSpec)
 	configAdaptor.quit = make(chan bool)
 	configAdaptor.analyticsServerIP = nsinfo.AnalyticsServerIP
 	configAdaptor.logProxyURL = nsinfo.LogProxyURL
@@ -429,6 +457,7 @@ func (confAdaptor *configAdaptor) bootstrapConfig() error {
 		{ResourceType: netscaler.Sslcert.Type(), ResourceName: "dummy_xds_cert", Resource: ssl.Sslcert{Certfile: "dummy_xds_cert", Reqfile: "dummy_xds_cert_req", Certtype: "ROOT_CERT", Keyfile: "dummy_xds_key"}, Operation: "create", IgnoreErrors: []string{"File already exists"}},
 	}
 	configs = append(configs, dummySslCertConfigs...)
+	configs = append(configs, nsconfigengine.NsConfigEntity{ResourceType: netscaler.Policystringmap.Type(), ResourceName: clusterHeaderStringMap, Resource: policy.Policystringmap{Name: clusterHeaderStringMap, Comment: "Stringmap to select LB vserver from cluster name"}, Operation: "add"})
 	// Config related to multiCluster Ingress gateway
 	if multiClusterIngress == true {
 		// Policy stringmap name and policy expression name should not be same.
@@ -457,7 +486,7 @@ func (confAdaptor *configAdaptor) dologProxyConfig() error {
 			xDSLogger.Warn("dologProxyConfig: ULFD mode could not be enabled")
 		}
 		// Below config is for Transaction data (used for tracing, logstream) on default port 5557
-		appflowResource := map[string]interface{}{"templaterefresh": 60, "securityinsightrecordinterval": 60, "httpurl": "ENABLED", "httpcookie": "ENABLED", "httpreferer": "ENABLED", "httpmethod": "ENABLED", "httphost": "ENABLED", "httpuseragent": "ENABLED", "httpcontenttype": "ENABLED", "securityinsighttraffic": "ENABLED", "httpquerywithurl": "ENABLED", "urlcategory": "ENABLED", "distributedtracing": "ENABLED", "disttracingsamplingrate": 100}
+		appflowResource := map[string]interface{}{"templaterefresh": 60, "securityinsightrecordinterval": 60, "httpurl": "ENABLED", "httpcookie": "ENABLED", "httpreferer": "ENABLED", "httpmethod": "ENABLED", "httphost": "ENABLED", "httpuseragent": "ENABLED", "httpcontenttype": "ENABLED", "securityinsighttraffic": "ENABLED", "httpquerywithurl": "ENABLED", "urlcategory": "ENABLED"}
 		configs := []nsconfigengine.NsConfigEntity{
 			{ResourceType: netscaler.Appflowparam.Type(), ResourceName: "", Resource: appflowResource, Operation: "set"},
 			{ResourceType: "analyticsprofile", ResourceName: "ns_analytics_default_http_profile", Resource: analytics.Analyticsprofile{Name: "ns_analytics_default_http_profile", Type: "webinsight", Httpurl: "ENABLED", Httphost: "ENABLED", Httpmethod: "ENABLED", Httpuseragent: "ENABLED", Urlcategory: "ENABLED", Httpcontenttype: "ENABLED", Httpvia: "ENABLED", Httpdomainname: "ENABLED", Httpurlquery: "ENABLED"}},
@@ -465,6 +494,13 @@ func (confAdaptor *configAdaptor) dologProxyConfig() error {
 			{ResourceType: "analyticsprofile", ResourceName: "ns_analytics_time_series_profile", Resource: analytics.Analyticsprofile{Name: "ns_analytics_time_series_profile", Type: "timeseries", Outputmode: "prometheus", Metrics: "ENABLED"}},
 		}
 		err = nsconfigengine.NsConfigCommit(confAdaptor.client, configs)
+		if err == nil {
+			// Sampling rate and logged headers of tracing are updated from the tracing of HTTP connection managers
+			confAdaptor.tracingMux.Lock()
+			confAdaptor.tracingSpec = confAdaptor.getAppliedTracingSpec()
+			err = confAdaptor.tracingSpec.Update(confAdaptor.client)
+			confAdaptor.tracingMux.Unlock()
+		}
 		if err != nil {
 			xDSLogger.Warn("dologProxyConfig: Tracing config (transaction data) failed")
 		} else {
@@ -551,7 +587,10 @@ func (confAdaptor *configAdaptor) delConfig(config *configBlock) {
 }
 
 func (confAdaptor *configAdaptor) startConfigAdaptor(adsClient *AdsClient) {
+	jwksQuit := make(chan bool)
+	confAdaptor.startJwksFetcher(jwksQuit)
 	go func() {
+		defer close(jwksQuit)
 		xDSLogger.Trace("startConfigAdaptor: Starting Config adaptor")
 		previousUptime := -1
 		lastQueryTime := int64(0)
@@ -580,6 +619,9 @@ func (confAdaptor *configAdaptor) startConfigAdaptor(adsClient *AdsClient) {
 						err = config.resource.(*nsconfigengine.LBApi).Add(confAdaptor.client)
 					case cdsDel:
 						err = config.resource.(*nsconfigengine.LBApi).Delete(confAdaptor.client)
+						confAdaptor.mux.Lock()
+						delete(confAdaptor.appliedEds, config.resourceName)
+						confAdaptor.mux.Unlock()
 					case ldsAdd:
 						fallthrough
 					case ldsDel:
@@ -596,9 +638,13 @@ func (confAdaptor *configAdaptor) startConfigAdaptor(adsClient *AdsClient) {
 							}
 						}
 					case edsAdd:
-						err = config.resource.(*nsconfigengine.ServiceGroupAPI).Add(confAdaptor.client)
+						svcGpObj := config.resource.(*nsconfigengine.ServiceGroupAPI)
+						err = svcGpObj.Add(confAdaptor.client)
+						confAdaptor.edsApplied(config, svcGpObj.HasLingeringMembers())
 					case rdsAdd:
 						err = config.resource.(*nsconfigengine.CSBindingsAPI).Add(confAdaptor.client)
+					case tracingUpdate:
+						err = config.resource.(*nsconfigengine.TracingSpec).Update(confAdaptor.client)
 					}
 					if err != nil {
 						xDSLogger.Error("startConfigAdaptor: xDS application failed", "error", err)
@@ -626,6 +672,27 @@ func (confAdaptor *configAdaptor) startConfigAdaptor(adsClient *AdsClient) {
 	}()
 }
 
+// edsApplied records the servicegroup config applied. If removed members are kept bound until they are out of service, the config is queued
+// again after the graceful delay to unbind them, unless another config of the servicegroup is queued or applied meanwhile
+func (confAdaptor *configAdaptor) edsApplied(config *configBlock, lingeringMembers bool) {
+	confAdaptor.mux.Lock()
+	confAdaptor.appliedEds[config.resourceName] = config
+	confAdaptor.mux.Unlock()
+	if !lingeringMembers {
+		return
+	}
+	delay := time.Duration(config.resource.(*nsconfigengine.ServiceGroupAPI).GracefulDelay+1) * time.Second
+	time.AfterFunc(delay, func() {
+		confAdaptor.mux.Lock()
+		defer confAdaptor.mux.Unlock()
+		if _, queued := confAdaptor.edsHash[config.resourceName]; queued || confAdaptor.appliedEds[config.resourceName] != config {
+			return
+		}
+		xDSLogger.Debug("edsApplied: Reapplying servicegroup to unbind the removed members", "resourceName", config.resourceName)
+		confAdaptor.edsHash[config.resourceName] = confAdaptor.configs.PushBack(config)
+	})
+}
+
 func (confAdaptor *configAdaptor) stopConfigAdaptor() {
 	xDSLogger.Trace("stopConfigAdaptor: Config adaptor is stopped")
 	confAdaptor.quit <- true
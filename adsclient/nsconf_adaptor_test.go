@@ -18,6 +18,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
 	"github.com/citrix/citrix-xds-adaptor/tests/env"
@@ -313,3 +314,22 @@ func Test_getIntEnv(t *testing.T) {
 		}
 	}
 }
+
+func Test_edsApplied(t *testing.T) {
+	nsConfAdaptor := getNsConfAdaptor()
+	lingering := &configBlock{configType: edsAdd, resourceName: "sg1", resource: &nsconfigengine.ServiceGroupAPI{Name: "sg1"}}
+	nsConfAdaptor.edsApplied(lingering, true)
+	stale := &configBlock{configType: edsAdd, resourceName: "sg2", resource: &nsconfigengine.ServiceGroupAPI{Name: "sg2"}}
+	nsConfAdaptor.edsApplied(stale, true)
+	nsConfAdaptor.edsApplied(&configBlock{configType: edsAdd, resourceName: "sg2", resource: &nsconfigengine.ServiceGroupAPI{Name: "sg2"}}, false)
+	nsConfAdaptor.edsApplied(&configBlock{configType: edsAdd, resourceName: "sg3", resource: &nsconfigengine.ServiceGroupAPI{Name: "sg3"}}, false)
+	time.Sleep(1500 * time.Millisecond)
+	nsConfAdaptor.mux.Lock()
+	defer nsConfAdaptor.mux.Unlock()
+	if nsConfAdaptor.configs.Len() != 1 {
+		t.Fatalf("Expected 1 config queued, got %d", nsConfAdaptor.configs.Len())
+	}
+	if e, ok := nsConfAdaptor.edsHash["sg1"]; !ok || e.Value.(*configBlock) != lingering {
+		t.Errorf("Expected servicegroup sg1 to be queued again")
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	xdsRoute "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	envoyRateLimit "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	envoyGlobalRateLimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	envoyFilterHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// globalRateLimitFilter is the name of Envoy's HTTP filter calling the external rate limit service
+	globalRateLimitFilter = "envoy.filters.http.ratelimit"
+)
+
+var (
+	// globalRateLimitConfigFile holds the config of the external rate limit service, as the limits are not part of xDS
+	globalRateLimitConfigFile = os.Getenv("RATELIMIT_CONFIG_FILE")
+)
+
+// Units of the rate limit service config, in milliseconds
+var rateLimitUnitToMs = map[string]int{
+	"second": 1000,
+	"minute": 60 * 1000,
+	"hour":   60 * 60 * 1000,
+	"day":    24 * 60 * 60 * 1000,
+}
+
+// globalRateLimitPolicy is the limit of a descriptor in the rate limit service config
+type globalRateLimitPolicy struct {
+	Unit            string `yaml:"unit"`
+	RequestsPerUnit int    `yaml:"requests_per_unit"`
+	Unlimited       bool   `yaml:"unlimited"`
+}
+
+// globalRateLimitDescriptor is a descriptor in the rate limit service config. Descriptor without value matches any value of the key,
+// and every distinct value is limited separately
+type globalRateLimitDescriptor struct {
+	Key         string                      `yaml:"key"`
+	Value       string                      `yaml:"value"`
+	RateLimit   *globalRateLimitPolicy      `yaml:"rate_limit"`
+	Descriptors []globalRateLimitDescriptor `yaml:"descriptors"`
+}
+
+// globalRateLimitConfig is the rate limit service config of a domain
+type globalRateLimitConfig struct {
+	Domain      string                      `yaml:"domain"`
+	Descriptors []globalRateLimitDescriptor `yaml:"descriptors"`
+}
+
+// reloadGlobalRateLimits reapplies the routes of the listeners with the global rate limit filter, as the limits of the rate limit service config changed
+func (client *AdsClient) reloadGlobalRateLimits() {
+	client.nsConfigAdaptorMux.Lock()
+	defer client.nsConfigAdaptorMux.Unlock()
+	if client.nsConfigAdaptor == nil {
+		return
+	}
+	client.nsConfigAdaptor.reapplyRoutes(func(routeInfo *appliedRouteInfo) bool {
+		_, ok := routeInfo.data["globalRateLimit"]
+		return ok
+	})
+}
+
+// getGlobalRateLimitFilterConfig returns the config of the global rate limit filter among the HTTP filters of a listener, if present
+func getGlobalRateLimitFilterConfig(httpFilters []*envoyFilterHttp.HttpFilter) *envoyGlobalRateLimit.RateLimit {
+	for _, httpFilter := range httpFilters {
+		if httpFilter.GetName() != globalRateLimitFilter {
+			continue
+		}
+		globalRateLimit := &envoyGlobalRateLimit.RateLimit{}
+		if err := getHTTPFilterConfig(httpFilter, globalRateLimit); err != nil {
+			xDSLogger.Trace("getGlobalRateLimitFilterConfig: getHTTPFilterConfig returned error!", "error", err)
+			return nil
+		}
+		return globalRateLimit
+	}
+	return nil
+}
+
+// getGlobalRateLimitConfig reads the rate limit service config of the domain from the config file.
+// Config file may have the configs of multiple domains as separate YAML documents
+func getGlobalRateLimitConfig(fileName, domain string) (*globalRateLimitConfig, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("rate limit config file not provided")
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	decoder := yaml.NewDecoder(file)
+	for {
+		config := &globalRateLimitConfig{}
+		if err = decoder.Decode(config); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("rate limit config of domain %s not found in %s", domain, fileName)
+			}
+			return nil, err
+		}
+		if config.Domain == domain {
+			return config, nil
+		}
+	}
+}
+
+// getGlobalRateLimitPaths returns the descriptor paths, from the top level descriptor, leading to a descriptor with a limit
+func getGlobalRateLimitPaths(descriptors []globalRateLimitDescriptor, parent []globalRateLimitDescriptor) [][]globalRateLimitDescriptor {
+	paths := make([][]globalRateLimitDescriptor, 0)
+	for _, descriptor := range descriptors {
+		path := append(append([]globalRateLimitDescriptor{}, parent...), descriptor)
+		if descriptor.RateLimit != nil && !descriptor.RateLimit.Unlimited {
+			paths = append(paths, path)
+		}
+		paths = append(paths, getGlobalRateLimitPaths(descriptor.Descriptors, path)...)
+	}
+	return paths
+}
+
+// getRouteRateLimits returns the rate limits of the route in the given stage. Virtual host's rate limits apply if the route has none, or if the route includes them
+func getRouteRateLimits(virtualHost *xdsRoute.VirtualHost, vroute *xdsRoute.Route, stage uint32) []*xdsRoute.RateLimit {
+	rateLimits := vroute.GetRoute().GetRateLimits()
+	if len(rateLimits) == 0 || vroute.GetRoute().GetIncludeVhRateLimits().GetValue() {
+		rateLimits = append(append([]*xdsRoute.RateLimit{}, rateLimits...), virtualHost.GetRateLimits()...)
+	}
+	stageRateLimits := make([]*xdsRoute.RateLimit, 0)
+	for _, rateLimit := range rateLimits {
+		if rateLimit.GetStage().GetValue() == stage {
+			stageRateLimits = append(stageRateLimits, rateLimit)
+		}
+	}
+	return stageRateLimits
+}
+
+// getGlobalRateLimit converts the limits of the rate limit service config to the rate limit of a route.
+// Descriptors of the route's rate limit actions are matched against every descriptor path with a limit. The limits are shared by all the routes of a listener.
+// Unlike the rate limit service, a value specific limit does not take precedence over the limit for any value of the same key, both are applied
+func getGlobalRateLimit(filter *envoyGlobalRateLimit.RateLimit, config *globalRateLimitConfig, routeRateLimits []*xdsRoute.RateLimit, clusterName string) *nsconfigengine.RateLimit {
+	if filter == nil || config == nil || len(routeRateLimits) == 0 {
+		return nil
+	}
+	rateLimit := &nsconfigengine.RateLimit{StatusCode: int(filter.GetRateLimitedStatus().GetCode()), EnabledPercent: 100, EnforcedPercent: 100, Shared: true, AllDescriptors: true}
+	matched := false
+	for _, path := range getGlobalRateLimitPaths(config.Descriptors, nil) {
+		policy := path[len(path)-1].RateLimit
+		unitMs, ok := rateLimitUnitToMs[strings.ToLower(policy.Unit)]
+		if !ok {
+			xDSLogger.Error("getGlobalRateLimit: Unsupported unit of rate limit", "domain", config.Domain, "unit", policy.Unit)
+			continue
+		}
+		// Descriptor is retained even if the route can't match it, to keep the limit identifier names stable across routes
+		limitDescriptor := nsconfigengine.RateLimitDescriptor{TokenBucket: nsconfigengine.TokenBucket{MaxTokens: policy.RequestsPerUnit, TokensPerFill: policy.RequestsPerUnit, FillInterval: unitMs}}
+		entries := make([]*envoyRateLimit.RateLimitDescriptor_Entry, 0)
+		for _, descriptor := range path {
+			entries = append(entries, &envoyRateLimit.RateLimitDescriptor_Entry{Key: descriptor.Key, Value: descriptor.Value})
+		}
+		for _, routeRateLimit := range routeRateLimits {
+			match, selector, ok := getRateLimitMatch(entries, routeRateLimit, clusterName)
+			if !ok {
+				continue
+			}
+			if len(limitDescriptor.Matches) > 0 && strings.Join(limitDescriptor.Selector, ",") != strings.Join(selector, ",") {
+				xDSLogger.Warn("getGlobalRateLimit: Skipping rate limit actions selecting different request attributes for the same descriptor", "domain", config.Domain, "selector", selector)
+				continue
+			}
+			limitDescriptor.Matches = append(limitDescriptor.Matches, match)
+			if len(selector) > 0 {
+				limitDescriptor.Selector = selector
+			}
+			matched = true
+		}
+		rateLimit.Descriptors = append(rateLimit.Descriptors, limitDescriptor)
+	}
+	if !matched {
+		return nil
+	}
+	return rateLimit
+}
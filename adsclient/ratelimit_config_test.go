@@ -0,0 +1,144 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	xdsratelimit "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ratelimit/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+)
+
+const rateLimitConfigYAML = `domain: other
+descriptors:
+  - key: generic_key
+    value: default
+    rate_limit:
+      unit: second
+      requests_per_unit: 1
+---
+domain: edge
+descriptors:
+  - key: remote_address
+    rate_limit:
+      unit: minute
+      requests_per_unit: 60
+  - key: user
+    value: admin
+    rate_limit:
+      unlimited: true
+    descriptors:
+      - key: generic_key
+        value: write
+        rate_limit:
+          unit: second
+          requests_per_unit: 5
+`
+
+func writeRateLimitConfig(t *testing.T) string {
+	file, err := ioutil.TempFile("", "ratelimit")
+	if err != nil {
+		t.Fatalf("Could not create rate limit config file: %v", err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(rateLimitConfigYAML); err != nil {
+		t.Fatalf("Could not write rate limit config file: %v", err)
+	}
+	return file.Name()
+}
+
+func Test_getGlobalRateLimitConfig(t *testing.T) {
+	fileName := writeRateLimitConfig(t)
+	defer os.Remove(fileName)
+	config, err := getGlobalRateLimitConfig(fileName, "edge")
+	if err != nil {
+		t.Fatalf("getGlobalRateLimitConfig failed: %v", err)
+	}
+	expected := &globalRateLimitConfig{Domain: "edge", Descriptors: []globalRateLimitDescriptor{
+		{Key: "remote_address", RateLimit: &globalRateLimitPolicy{Unit: "minute", RequestsPerUnit: 60}},
+		{Key: "user", Value: "admin", RateLimit: &globalRateLimitPolicy{Unlimited: true}, Descriptors: []globalRateLimitDescriptor{
+			{Key: "generic_key", Value: "write", RateLimit: &globalRateLimitPolicy{Unit: "second", RequestsPerUnit: 5}}}},
+	}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v, received %+v", expected, config)
+	}
+	if _, err = getGlobalRateLimitConfig(fileName, "unknown"); err == nil {
+		t.Errorf("Expected error for unknown domain")
+	}
+	if _, err = getGlobalRateLimitConfig("", "edge"); err == nil {
+		t.Errorf("Expected error for missing config file")
+	}
+	paths := getGlobalRateLimitPaths(config.Descriptors, nil)
+	if len(paths) != 2 || len(paths[0]) != 1 || len(paths[1]) != 2 || paths[1][1].Value != "write" {
+		t.Errorf("Unexpected descriptor paths %+v", paths)
+	}
+}
+
+func Test_getRouteRateLimits(t *testing.T) {
+	vhRateLimit := &route.RateLimit{Actions: []*route.RateLimit_Action{{ActionSpecifier: &route.RateLimit_Action_RemoteAddress_{RemoteAddress: &route.RateLimit_Action_RemoteAddress{}}}}}
+	routeRateLimit := &route.RateLimit{Actions: []*route.RateLimit_Action{{ActionSpecifier: &route.RateLimit_Action_GenericKey_{GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: "write"}}}}}
+	stage1RateLimit := &route.RateLimit{Stage: &wrappers.UInt32Value{Value: 1}, Actions: routeRateLimit.Actions}
+	virtualHost := &route.VirtualHost{RateLimits: []*route.RateLimit{vhRateLimit}}
+	cases := []struct {
+		name     string
+		action   *route.RouteAction
+		expected []*route.RateLimit
+	}{
+		{"virtual host rate limits", &route.RouteAction{}, []*route.RateLimit{vhRateLimit}},
+		{"route rate limits", &route.RouteAction{RateLimits: []*route.RateLimit{routeRateLimit, stage1RateLimit}}, []*route.RateLimit{routeRateLimit}},
+		{"route including virtual host rate limits", &route.RouteAction{RateLimits: []*route.RateLimit{routeRateLimit}, IncludeVhRateLimits: &wrappers.BoolValue{Value: true}}, []*route.RateLimit{routeRateLimit, vhRateLimit}},
+	}
+	for _, c := range cases {
+		vroute := &route.Route{Action: &route.Route_Route{Route: c.action}}
+		if output := getRouteRateLimits(virtualHost, vroute, 0); !reflect.DeepEqual(output, c.expected) {
+			t.Errorf("%s: expected %v, received %v", c.name, c.expected, output)
+		}
+	}
+}
+
+func Test_getGlobalRateLimit(t *testing.T) {
+	fileName := writeRateLimitConfig(t)
+	defer os.Remove(fileName)
+	config, _ := getGlobalRateLimitConfig(fileName, "edge")
+	filter := &xdsratelimit.RateLimit{Domain: "edge", RateLimitedStatus: &xdstype.HttpStatus{Code: xdstype.StatusCode_ServiceUnavailable}}
+	remoteAddressRateLimit := &route.RateLimit{Actions: []*route.RateLimit_Action{{ActionSpecifier: &route.RateLimit_Action_RemoteAddress_{RemoteAddress: &route.RateLimit_Action_RemoteAddress{}}}}}
+	userWriteRateLimit := &route.RateLimit{Actions: []*route.RateLimit_Action{
+		{ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{RequestHeaders: &route.RateLimit_Action_RequestHeaders{HeaderName: "x-user", DescriptorKey: "user"}}},
+		{ActionSpecifier: &route.RateLimit_Action_GenericKey_{GenericKey: &route.RateLimit_Action_GenericKey{DescriptorValue: "write"}}}}}
+	remoteAddressLimit := nsconfigengine.RateLimitDescriptor{TokenBucket: nsconfigengine.TokenBucket{MaxTokens: 60, TokensPerFill: 60, FillInterval: 60000}}
+	userWriteLimit := nsconfigengine.RateLimitDescriptor{TokenBucket: nsconfigengine.TokenBucket{MaxTokens: 5, TokensPerFill: 5, FillInterval: 1000}}
+	cases := []struct {
+		name       string
+		rateLimits []*route.RateLimit
+		expected   *nsconfigengine.RateLimit
+	}{
+		{"no rate limits", nil, nil},
+		{"per client limit", []*route.RateLimit{remoteAddressRateLimit}, &nsconfigengine.RateLimit{StatusCode: 503, EnabledPercent: 100, EnforcedPercent: 100, Shared: true, AllDescriptors: true, Descriptors: []nsconfigengine.RateLimitDescriptor{
+			{Matches: []nsconfigengine.RateLimitMatch{{}}, TokenBucket: remoteAddressLimit.TokenBucket, Selector: []string{"CLIENT.IP.SRC"}}, userWriteLimit}}},
+		{"nested limit", []*route.RateLimit{userWriteRateLimit}, &nsconfigengine.RateLimit{StatusCode: 503, EnabledPercent: 100, EnforcedPercent: 100, Shared: true, AllDescriptors: true, Descriptors: []nsconfigengine.RateLimitDescriptor{
+			remoteAddressLimit, {Matches: []nsconfigengine.RateLimitMatch{{Headers: []nsconfigengine.MatchHeader{{Name: "x-user", Exact: "admin"}}}}, TokenBucket: userWriteLimit.TokenBucket}}}},
+	}
+	for _, c := range cases {
+		if output := getGlobalRateLimit(filter, config, c.rateLimits, "cl1"); !reflect.DeepEqual(output, c.expected) {
+			t.Errorf("%s: expected %+v, received %+v", c.name, c.expected, output)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	envoyFilterHttp "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// Envoy's default sampling rate of the requests, which is also used when none of the HTTP connection managers specifies tracing
+const defaultTracingSamplingRate = 100
+
+// getSamplingPercent returns the sampling percentage, rounded to the nearest integer, or 100 if not set.
+// Percentage above 0 is rounded to at least 1, so that the requests are sampled
+func getSamplingPercent(sampling *xdstype.Percent) int {
+	if sampling == nil {
+		return defaultTracingSamplingRate
+	}
+	if percent := int(math.Round(sampling.GetValue())); percent > 0 || sampling.GetValue() <= 0 {
+		return percent
+	}
+	return 1
+}
+
+// getTracingSpec converts the tracing of the HTTP connection manager. Requests are sampled at random_sampling rate, limited by overall_sampling.
+// Citrix ADC does not force the tracing of requests with x-client-trace-id header, and logs only the request headers of the custom tags which
+// it can log in the AppFlow records. Spans are exported to the log proxy irrespective of the tracing provider
+func getTracingSpec(tracing *envoyFilterHttp.HttpConnectionManager_Tracing, listenerName string) *nsconfigengine.TracingSpec {
+	if tracing == nil {
+		return nil
+	}
+	tracingSpec := &nsconfigengine.TracingSpec{SamplingRate: getSamplingPercent(tracing.GetRandomSampling())}
+	if overallSampling := getSamplingPercent(tracing.GetOverallSampling()); overallSampling < tracingSpec.SamplingRate {
+		tracingSpec.SamplingRate = overallSampling
+	}
+	if tracing.GetClientSampling() != nil && getSamplingPercent(tracing.GetClientSampling()) != defaultTracingSamplingRate {
+		xDSLogger.Warn("getTracingSpec: Client sampling of tracing is not supported", "listenerName", listenerName)
+	}
+	for _, customTag := range tracing.GetCustomTags() {
+		if header := customTag.GetRequestHeader().GetName(); header != "" && nsconfigengine.IsTracingHeader(header) {
+			tracingSpec.RequestHeaders = append(tracingSpec.RequestHeaders, strings.ToLower(header))
+		} else {
+			xDSLogger.Warn("getTracingSpec: Custom tag of tracing is not supported", "listenerName", listenerName, "tag", customTag.GetTag())
+		}
+	}
+	return tracingSpec
+}
+
+// getAppliedTracingSpec returns the tracing applied on Citrix ADC for the tracing of all the CS vservers. Tracing is enabled if any of the
+// vservers samples the requests, which it does by its AppFlow policy, and the request headers of all the custom tags are logged
+func (confAdaptor *configAdaptor) getAppliedTracingSpec() *nsconfigengine.TracingSpec {
+	if len(confAdaptor.tracingSpecs) == 0 {
+		return &nsconfigengine.TracingSpec{SamplingRate: defaultTracingSamplingRate}
+	}
+	appliedSpec := &nsconfigengine.TracingSpec{}
+	headers := make(map[string]bool)
+	for _, tracingSpec := range confAdaptor.tracingSpecs {
+		if tracingSpec.SamplingRate > 0 {
+			appliedSpec.SamplingRate = defaultTracingSamplingRate
+		}
+		for _, header := range tracingSpec.RequestHeaders {
+			headers[header] = true
+		}
+	}
+	for header := range headers {
+		appliedSpec.RequestHeaders = append(appliedSpec.RequestHeaders, header)
+	}
+	sort.Strings(appliedSpec.RequestHeaders)
+	return appliedSpec
+}
+
+// registerTracing registers the tracing of the CS vserver, or unregisters it if tracingSpec is nil.
+// Tracing of Citrix ADC is updated if the registration changes it
+func (confAdaptor *configAdaptor) registerTracing(csVsName string, tracingSpec *nsconfigengine.TracingSpec) {
+	if len(confAdaptor.analyticsProfiles) == 0 {
+		return
+	}
+	confAdaptor.tracingMux.Lock()
+	defer confAdaptor.tracingMux.Unlock()
+	if tracingSpec == nil {
+		delete(confAdaptor.tracingSpecs, csVsName)
+	} else {
+		confAdaptor.tracingSpecs[csVsName] = tracingSpec
+	}
+	appliedSpec := confAdaptor.getAppliedTracingSpec()
+	if reflect.DeepEqual(appliedSpec, confAdaptor.tracingSpec) {
+		return
+	}
+	xDSLogger.Info("registerTracing: Updating tracing", "samplingRate", appliedSpec.SamplingRate, "requestHeaders", appliedSpec.RequestHeaders)
+	confAdaptor.tracingSpec = appliedSpec
+	confAdaptor.addConfig(&configBlock{configType: tracingUpdate, resourceName: "", resource: appliedSpec})
+}
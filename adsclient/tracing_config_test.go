@@ -0,0 +1,81 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adsclient
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/nsconfigengine"
+
+	http_conn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	xdstracing "github.com/envoyproxy/go-control-plane/envoy/type/tracing/v3"
+	xdstype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+func Test_getTracingSpec(t *testing.T) {
+	cases := []struct {
+		input          *http_conn.HttpConnectionManager_Tracing
+		expectedOutput *nsconfigengine.TracingSpec
+	}{
+		{nil, nil},
+		{&http_conn.HttpConnectionManager_Tracing{}, &nsconfigengine.TracingSpec{SamplingRate: 100}},
+		{&http_conn.HttpConnectionManager_Tracing{RandomSampling: &xdstype.Percent{Value: 1.4}}, &nsconfigengine.TracingSpec{SamplingRate: 1}},
+		{&http_conn.HttpConnectionManager_Tracing{RandomSampling: &xdstype.Percent{Value: 0.1}}, &nsconfigengine.TracingSpec{SamplingRate: 1}},
+		{&http_conn.HttpConnectionManager_Tracing{RandomSampling: &xdstype.Percent{Value: 0}}, &nsconfigengine.TracingSpec{SamplingRate: 0}},
+		{&http_conn.HttpConnectionManager_Tracing{RandomSampling: &xdstype.Percent{Value: 50}, OverallSampling: &xdstype.Percent{Value: 20}, ClientSampling: &xdstype.Percent{Value: 0},
+			CustomTags: []*xdstracing.CustomTag{
+				{Tag: "referer", Type: &xdstracing.CustomTag_RequestHeader{RequestHeader: &xdstracing.CustomTag_Header{Name: "Referer"}}},
+				{Tag: "request-id", Type: &xdstracing.CustomTag_RequestHeader{RequestHeader: &xdstracing.CustomTag_Header{Name: "x-request-id"}}},
+				{Tag: "mesh", Type: &xdstracing.CustomTag_Literal_{Literal: &xdstracing.CustomTag_Literal{Value: "istio"}}},
+			}}, &nsconfigengine.TracingSpec{SamplingRate: 20, RequestHeaders: []string{"referer"}}},
+	}
+	for _, c := range cases {
+		if output := getTracingSpec(c.input, "listener1"); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %+v, received %+v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_registerTracing(t *testing.T) {
+	nsConfig := &configAdaptor{configs: list.New(), tracingSpecs: make(map[string]*nsconfigengine.TracingSpec)}
+	nsConfig.registerTracing("cs1", &nsconfigengine.TracingSpec{SamplingRate: 10})
+	if nsConfig.configs.Len() != 0 {
+		t.Errorf("Tracing updated without the log proxy")
+	}
+	nsConfig.analyticsProfiles = []string{"ns_analytics_default_tcp_profile", "ns_analytics_default_http_profile"}
+	nsConfig.tracingSpec = &nsconfigengine.TracingSpec{SamplingRate: 100}
+	cases := []struct {
+		csVsName        string
+		input           *nsconfigengine.TracingSpec
+		expectedApplied *nsconfigengine.TracingSpec
+		expectedUpdates int
+	}{
+		{"cs1", &nsconfigengine.TracingSpec{SamplingRate: 10}, &nsconfigengine.TracingSpec{SamplingRate: 100}, 0},
+		{"cs2", &nsconfigengine.TracingSpec{SamplingRate: 5, RequestHeaders: []string{"via"}}, &nsconfigengine.TracingSpec{SamplingRate: 100, RequestHeaders: []string{"via"}}, 1},
+		{"cs1", &nsconfigengine.TracingSpec{SamplingRate: 0}, &nsconfigengine.TracingSpec{SamplingRate: 100, RequestHeaders: []string{"via"}}, 1},
+		{"cs2", nil, &nsconfigengine.TracingSpec{}, 2},
+		{"cs1", nil, &nsconfigengine.TracingSpec{SamplingRate: 100}, 3},
+	}
+	for _, c := range cases {
+		nsConfig.registerTracing(c.csVsName, c.input)
+		if !reflect.DeepEqual(nsConfig.tracingSpec, c.expectedApplied) || nsConfig.configs.Len() != c.expectedUpdates {
+			t.Errorf("Expected %+v with %d updates, received %+v with %d updates", c.expectedApplied, c.expectedUpdates, nsConfig.tracingSpec, nsConfig.configs.Len())
+		}
+	}
+	if config := nsConfig.configs.Back().Value.(*configBlock); config.configType != tracingUpdate || !reflect.DeepEqual(config.resource, nsConfig.tracingSpec) {
+		t.Errorf("Unexpected config block %+v", config)
+	}
+}
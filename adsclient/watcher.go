@@ -34,6 +34,8 @@ type Watcher struct {
 	watcher    *fsnotify.Watcher
 	watcherMux sync.Mutex
 	stopCh     chan bool
+	// reloadRateLimits reapplies the global rate limits when the rate limit service config file changes
+	reloadRateLimits func()
 }
 
 // StartCertWatcher will start the Certificate Watcher
@@ -46,6 +48,11 @@ func (client *AdsClient) StartCertWatcher(errCh chan<- error) error {
 	client.certWatcherMux.Lock()
 	client.certWatcher = w
 	client.certWatcherMux.Unlock()
+	if globalRateLimitConfigFile != "" {
+		if err = w.addRateLimitConfig(globalRateLimitConfigFile, client.reloadGlobalRateLimits); err != nil {
+			return err
+		}
+	}
 	go client.certWatcher.Run(errCh)
 	return nil
 }
@@ -191,6 +198,49 @@ func (w *Watcher) addDir(certPath, keyPath string) (string, string, string, erro
 	return w.dirNames[dirName]["nsCertFileName"], w.dirNames[dirName]["nsKeyFileName"], w.dirNames[dirName]["nsRootCertFile"], nil
 }
 
+//addCRL will add the Directory which contains crlPath for monitoring, if not already added, and return the content of the CRL file
+//CRL file is uploaded to Citrix ADC when the CRL is applied, and again by the watcher when its content changes
+func (w *Watcher) addCRL(crlPath string) (string, error) {
+	dirName, crlFile := getDirFileName(crlPath)
+	if _, ok := w.dirNames[dirName]; !ok {
+		err := w.watcher.Add(dirName)
+		if err != nil {
+			xDSLogger.Error("addCRL: Failed to add directory to watcher", "dirName", dirName, "err", err)
+			return "", err
+		}
+		xDSLogger.Debug("addCRL: Directory added for monitoring", "dirName", dirName)
+		w.dirNames[dirName] = make(map[string]string)
+	}
+	crlData, err := getFileContent(crlPath)
+	if err != nil {
+		return "", err
+	}
+	w.dirNames[dirName]["crlFile"] = crlFile
+	w.dirNames[dirName]["nsCRLFile"] = nsconfigengine.GetCRLFileName(string(crlData))
+	return string(crlData), nil
+}
+
+// addRateLimitConfig will add the Directory which contains the rate limit service config file for monitoring.
+// reload is called when the content of the file changes
+func (w *Watcher) addRateLimitConfig(configPath string, reload func()) error {
+	dirName, configFile := getDirFileName(configPath)
+	if _, ok := w.dirNames[dirName]; !ok {
+		err := w.watcher.Add(dirName)
+		if err != nil {
+			xDSLogger.Error("addRateLimitConfig: Failed to add directory to watcher", "dirName", dirName, "err", err)
+			return err
+		}
+		xDSLogger.Debug("addRateLimitConfig: Directory added for monitoring", "dirName", dirName)
+		w.dirNames[dirName] = make(map[string]string)
+	}
+	w.dirNames[dirName]["rateLimitFile"] = configFile
+	if configData, err := getFileContent(configPath); err == nil {
+		w.dirNames[dirName]["rateLimitHash"] = nsconfigengine.GetNSCompatibleNameHash(string(configData), 55)
+	}
+	w.reloadRateLimits = reload
+	return nil
+}
+
 // Run is a thread which will alert whenever files in the directory added for watch gets updated.
 func (w *Watcher) Run(errCh chan<- error) {
 	for {
@@ -206,12 +256,16 @@ func (w *Watcher) Run(errCh chan<- error) {
 				return
 			}
 			w.watcherMux.Lock()
+			reloadRateLimits := false
 			xDSLogger.Trace("Watcher captured event", "event", event)
 			if (event.Op&fsnotify.Remove == fsnotify.Remove) || (event.Op&fsnotify.Write == fsnotify.Write) {
 				xDSLogger.Debug("Watcher folder got updated", "eventName", event.Name)
+				eventDirName, eventFileName := getDirFileName(event.Name)
+				rateLimitEvent := eventFileName != "" && eventFileName == w.dirNames[eventDirName]["rateLimitFile"]
 				// strings.Contains(event.Name, "..") this is for mounted certificates
 				//strings.Contains(event.Name, ClientCertChainFile)  for CSR generated
-				if !strings.Contains(event.Name, "..") && !strings.Contains(event.Name, ClientCertChainFile) {
+				//rateLimitEvent for the rate limit service config file written in place
+				if !strings.Contains(event.Name, "..") && !strings.Contains(event.Name, ClientCertChainFile) && !rateLimitEvent {
 					xDSLogger.Debug("File not considered for update", "fileName", event.Name)
 				} else {
 					uploadFilePath, _ := getDirFileName(event.Name)
@@ -256,9 +310,45 @@ func (w *Watcher) Run(errCh chan<- error) {
 							}
 						}
 					}
+					if w.dirNames[uploadFilePath]["crlFile"] != "" {
+						crlFile := uploadFilePath + "/" + w.dirNames[uploadFilePath]["crlFile"]
+						if fileExists(crlFile) {
+							crlData, err := getFileContent(crlFile)
+							if err == nil {
+								nsCRLFileName := nsconfigengine.GetCRLFileName(string(crlData))
+								/* if CRL did not change then do not update */
+								if nsCRLFileName != w.dirNames[uploadFilePath]["nsCRLFile"] {
+									xDSLogger.Debug("Uploading and updating CRLs on ADC", "crlFile", crlFile, "nsCRLFile", nsCRLFileName)
+									if nsconfigengine.UploadCertData(w.nsConfig.client, crlData, nsCRLFileName, nil, "") == nil {
+										nsconfigengine.UpdateCRL(w.nsConfig.client, w.dirNames[uploadFilePath]["nsCRLFile"], nsCRLFileName)
+										w.dirNames[uploadFilePath]["nsCRLFile"] = nsCRLFileName
+									}
+								}
+							}
+						}
+					}
+					if w.dirNames[uploadFilePath]["rateLimitFile"] != "" {
+						configFile := uploadFilePath + "/" + w.dirNames[uploadFilePath]["rateLimitFile"]
+						if fileExists(configFile) {
+							configData, err := getFileContent(configFile)
+							if err == nil {
+								configHash := nsconfigengine.GetNSCompatibleNameHash(string(configData), 55)
+								/* if rate limit service config did not change then do not reload */
+								if configHash != w.dirNames[uploadFilePath]["rateLimitHash"] {
+									xDSLogger.Debug("Reloading global rate limits", "configFile", configFile)
+									w.dirNames[uploadFilePath]["rateLimitHash"] = configHash
+									reloadRateLimits = true
+								}
+							}
+						}
+					}
 				}
 			}
 			w.watcherMux.Unlock()
+			// Routes are reapplied without holding watcherMux, as the ADS handlers holding the config adaptor add directories to the watcher
+			if reloadRateLimits && w.reloadRateLimits != nil {
+				w.reloadRateLimits()
+			}
 		case err, ok := <-w.watcher.Errors:
 			if !ok {
 				errCh <- fmt.Errorf("Certificate watcher encountered issue in monitoring events ")
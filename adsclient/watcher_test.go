@@ -174,3 +174,41 @@ func Test_getCertKeyData(t *testing.T) {
 		t.Errorf("FAILED Expected ERROR")
 	}
 }
+
+func Test_addRateLimitConfig(t *testing.T) {
+	if err := os.MkdirAll("/tmp/adsclientratelimit", 0777); err != nil {
+		t.Fatalf("Could not create temp folder")
+	}
+	defer os.RemoveAll("/tmp/adsclientratelimit")
+	configPath := "/tmp/adsclientratelimit/config.yaml"
+	if err := os.WriteFile(configPath, []byte("domain: d1\n"), 0644); err != nil {
+		t.Fatalf("Could not write file. Error: %s", err.Error())
+	}
+	w, err := newWatcher()
+	if err != nil {
+		t.Fatalf("newWatcher failed with error %v", err)
+	}
+	reloadCh := make(chan bool, 2)
+	if err = w.addRateLimitConfig(configPath, func() { reloadCh <- true }); err != nil {
+		t.Fatalf("addRateLimitConfig failed with error %v", err)
+	}
+	cwErrCh := make(chan error, 1)
+	go w.Run(cwErrCh)
+	defer w.Stop()
+	if err := os.WriteFile(configPath, []byte("domain: d1\n"), 0644); err != nil {
+		t.Fatalf("Could not write file. Error: %s", err.Error())
+	}
+	select {
+	case <-reloadCh:
+		t.Errorf("Rate limits reloaded though the config did not change")
+	case <-time.After(time.Second):
+	}
+	if err := os.WriteFile(configPath, []byte("domain: d2\n"), 0644); err != nil {
+		t.Fatalf("Could not write file. Error: %s", err.Error())
+	}
+	select {
+	case <-reloadCh:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Rate limits not reloaded on config change")
+	}
+}
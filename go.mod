@@ -4,7 +4,7 @@ go 1.16
 
 require (
 	github.com/citrix/adc-nitro-go v0.0.0-20210701174421-a3bd5f0e580a
-	github.com/envoyproxy/go-control-plane v0.10.3
+	github.com/envoyproxy/go-control-plane v0.11.0
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/protobuf v1.5.2
@@ -13,9 +13,8 @@ require (
 	github.com/sirupsen/logrus v1.7.0
 	github.com/spiffe/go-spiffe v1.0.0
 	github.com/txn2/txeh v1.3.0
-	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/grpc v1.45.0
+	google.golang.org/grpc v1.52.0
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 	istio.io/istio v0.0.0-20200625184358-58f551e08f08
 )
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/citrix/adc-nitro-go/resource/config/audit"
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	"github.com/citrix/adc-nitro-go/resource/config/rewrite"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+// Rewrite policy label logging the requests is invoked when the response is sent to the client
+const accessLogInvokePriority = 1
+
+func getAccessLogLabelName(csVserverName string) string {
+	return csVserverName + "_accesslog"
+}
+
+// enableUserDefinedAuditlog enables the syslog and nslog servers to log the audit messages of the access logs
+func enableUserDefinedAuditlog(client *netscaler.NitroClient, confErr *nitroError) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditsyslogparams.Type(), "", audit.Auditsyslogparams{Userdefinedauditlog: "YES"}, "set", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditnslogparams.Type(), "", audit.Auditnslogparams{Userdefinedauditlog: "YES"}, "set", "", "", ""}, nil, nil))
+}
+
+// updateVserverAccessLogs adds the rewrite policy label logging every request of the CS vserver with an audit message per expression of logExprs,
+// when the response is sent to the client. Label is deleted if logExprs is empty
+func updateVserverAccessLogs(client *netscaler.NitroClient, csVserverName string, logExprs []string, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverAccessLogs", "logExprs", logExprs, "csVserver", csVserverName)
+	labelName := getAccessLogLabelName(csVserverName)
+	curPriority := authzPolicyStartPriority
+	if len(logExprs) > 0 {
+		enableUserDefinedAuditlog(client, confErr)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel.Type(), labelName, rewrite.Rewritepolicylabel{Labelname: labelName, Transform: "http_res"}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	}
+	for _, logExpr := range logExprs {
+		entityName := labelName + "_" + fmt.Sprint(curPriority)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), entityName, audit.Auditmessageaction{Name: entityName, Loglevel: "INFORMATIONAL", Stringbuilderexpr: logExpr}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), entityName, rewrite.Rewritepolicy{Name: entityName, Rule: "true", Action: "NOOP", Logaction: entityName}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel_rewritepolicy_binding.Type(), labelName, rewrite.Rewritepolicylabelrewritepolicybinding{Labelname: labelName, Policyname: entityName, Priority: curPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+		curPriority = curPriority + 10
+	}
+	if len(logExprs) > 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), labelName, rewrite.Rewritepolicy{Name: labelName, Rule: "true", Action: "NOOP"}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_rewritepolicy_binding.Type(), csVserverName, cs.Csvserverrewritepolicybinding{Name: csVserverName, Policyname: labelName, Priority: accessLogInvokePriority, Gotopriorityexpression: "NEXT", Bindpoint: "RESPONSE", Invoke: true, Labeltype: "policylabel", Labelname: labelName}, "add", "", "", ""}, nil, nil))
+	}
+	headersLabelDelete(client, confErr, csVserverName, labelName, curPriority)
+}
+
+// updateVserverTCPAccessLogs adds the CS policies logging every connection of the TCP CS vserver with an audit message per expression of logExprs,
+// when the connection is switched to the default LB vserver. Policies are bound before those of the CS bindings, and the evaluation continues
+// after them. Stale policies are deleted
+func updateVserverTCPAccessLogs(client *netscaler.NitroClient, csVserverName, defaultLbVserverName string, logExprs []string, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverTCPAccessLogs", "logExprs", logExprs, "csVserver", csVserverName)
+	if len(logExprs) > 0 && defaultLbVserverName == "" {
+		nsconfLogger.Warn("updateVserverTCPAccessLogs: Access logs of TCP vserver require a single cluster", "csVserver", csVserverName)
+		logExprs = nil
+	}
+	if len(logExprs) >= csPolicyStartPriority {
+		nsconfLogger.Warn("updateVserverTCPAccessLogs: Access logs of TCP vserver are limited", "csVserver", csVserverName, "limit", csPolicyStartPriority-1)
+		logExprs = logExprs[:csPolicyStartPriority-1]
+	}
+	if len(logExprs) > 0 {
+		enableUserDefinedAuditlog(client, confErr)
+	}
+	labelName := getAccessLogLabelName(csVserverName)
+	for i, logExpr := range logExprs {
+		entityName := labelName + "_" + fmt.Sprint(i+1)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), entityName, audit.Auditmessageaction{Name: entityName, Loglevel: "INFORMATIONAL", Stringbuilderexpr: logExpr}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), entityName, cs.Cspolicy{Policyname: entityName, Rule: "true", Logaction: entityName}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_cspolicy_binding.Type(), csVserverName, cs.Csvservercspolicybinding{Name: csVserverName, Policyname: entityName, Targetlbvserver: defaultLbVserverName, Priority: i + 1, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+	}
+	bindings, err := client.FindResourceArray(netscaler.Csvserver_cspolicy_binding.Type(), csVserverName)
+	if err != nil {
+		return
+	}
+	for _, binding := range bindings {
+		policyName, err := getValueString(binding, "policyname")
+		if err != nil || !strings.HasPrefix(policyName, labelName+"_") {
+			continue
+		}
+		if priority, err := getValueInt(binding, "priority"); err != nil || priority <= len(logExprs) || priority >= csPolicyStartPriority {
+			continue
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_cspolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": policyName}, "delete", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), policyName, nil, "delete", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+}
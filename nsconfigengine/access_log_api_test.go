@@ -0,0 +1,112 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_CSApi_accessLog(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("csaccesslog", "HTTP", "2.2.1.6", 80)
+	csObj.AccessLogExprs = []string{"\"\" + HTTP.REQ.METHOD + \" \" + HTTP.REQ.URL", "\"\" + HTTP.RES.STATUS"}
+	t.Logf("Test CSApi Add with access logs")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"rewritepolicylabel", "csaccesslog_accesslog", map[string]interface{}{"labelname": "csaccesslog_accesslog"}},
+		{"auditmessageaction", "csaccesslog_accesslog_10", map[string]interface{}{"name": "csaccesslog_accesslog_10"}},
+		{"auditmessageaction", "csaccesslog_accesslog_20", map[string]interface{}{"name": "csaccesslog_accesslog_20"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csaccesslog, error %v", err)
+	}
+	t.Logf("Test CSApi Update with fewer access logs")
+	csObj.AccessLogExprs = csObj.AccessLogExprs[:1]
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"auditmessageaction", "csaccesslog_accesslog_20", map[string]interface{}{"name": "csaccesslog_accesslog_20"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale access logs of csaccesslog, error %v", err)
+	}
+	t.Logf("Test CSApi Delete with access logs")
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"rewritepolicylabel", "csaccesslog_accesslog", map[string]interface{}{"labelname": "csaccesslog_accesslog"}},
+		{"auditmessageaction", "csaccesslog_accesslog_10", map[string]interface{}{"name": "csaccesslog_accesslog_10"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete csaccesslog, error %v", err)
+	}
+}
+
+func Test_CSApi_tcpAccessLog(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("cstcpaccesslog", "TCP", "2.2.1.7", 9000)
+	csObj.DefaultLbVserverName = "lbtcpaccesslog"
+	csObj.AccessLogExprs = []string{"\"\" + CLIENT.IP.SRC", "\"\" + SERVER.IP.DST"}
+	t.Logf("Test CSApi Add with access logs of TCP vserver")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"cspolicy", "cstcpaccesslog_accesslog_1", map[string]interface{}{"policyname": "cstcpaccesslog_accesslog_1", "logaction": "cstcpaccesslog_accesslog_1"}},
+		{"auditmessageaction", "cstcpaccesslog_accesslog_2", map[string]interface{}{"name": "cstcpaccesslog_accesslog_2"}},
+		{"auditsyslogparams", "", map[string]interface{}{"userdefinedauditlog": "YES"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add cstcpaccesslog, error %v", err)
+	}
+	t.Logf("Test CSApi Update with fewer access logs of TCP vserver")
+	csObj.AccessLogExprs = csObj.AccessLogExprs[:1]
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"cspolicy", "cstcpaccesslog_accesslog_2", map[string]interface{}{"policyname": "cstcpaccesslog_accesslog_2"}},
+		{"auditmessageaction", "cstcpaccesslog_accesslog_2", map[string]interface{}{"name": "cstcpaccesslog_accesslog_2"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale access logs of cstcpaccesslog, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"cspolicy", "cstcpaccesslog_accesslog_1", map[string]interface{}{"policyname": "cstcpaccesslog_accesslog_1"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete cstcpaccesslog, error %v", err)
+	}
+}
@@ -27,6 +27,8 @@ import (
 const (
 	dummyEndPoint = "https://dummy.com"
 	maxLen        = 127
+	// Rewrite policy label inserting the JWT claims is invoked after the one copying the external authorization response headers
+	jwtClaimHeadersInvokePriority = 2
 )
 
 // JwtHeader specifies Header info for JWT
@@ -43,21 +45,44 @@ type AuthRuleMatch struct {
 	Regex  string
 }
 
-// AuthSpec specifies the attributes associated with an authentication vserver
+// JwtClaimHeader specifies the request header the value of a JWT claim is copied to.
+// Nested claims are separated by '.'
+type JwtClaimHeader struct {
+	Header string
+	Claim  string
+}
+
+// JwtProvider specifies an issuer of JWTs, the JWKS verifying its tokens and the audiences accepted.
+// JwksURI is the URI the JWKS is fetched from, if it is not provided inline.
+// If IncludePaths are specified, the provider verifies the tokens of the requests on these paths only.
+// Token verified by the provider is removed from the request unless Forward is set, and its payload is copied to ForwardHeader if specified
+type JwtProvider struct {
+	Issuer         string
+	Jwks           string
+	JwksURI        string
+	Audiences      []string
+	IncludePaths   []AuthRuleMatch
+	ClaimToHeaders []JwtClaimHeader
+	Forward        bool
+	ForwardHeader  string
+}
+
+// AuthSpec specifies the attributes associated with an authentication vserver.
+// A request is authenticated if its JWT is verified by any of the Providers.
+// Requests on AllowMissingPaths are authenticated only if they carry a JWT.
+// Requests on DenyPaths are never authenticated, as their JWT requirement cannot be verified
 type AuthSpec struct {
 	Name                   string
 	IncludePaths           []AuthRuleMatch
 	ExcludePaths           []AuthRuleMatch
-	Issuer                 string
-	Jwks                   string
-	Audiences              []string
+	AllowMissingPaths      []AuthRuleMatch
+	DenyPaths              []AuthRuleMatch
+	Providers              []JwtProvider
 	JwtHeaders             []JwtHeader
 	JwtParams              []string
 	curPolicyPriority      int
 	curLoginSchemaPriority int
 	FrontendTLS            []SSLSpec
-	Forward                bool
-	ForwardHeader          string
 }
 
 func getAuthnRule(rules []AuthRuleMatch) string {
@@ -79,6 +104,29 @@ func getAuthnRule(rules []AuthRuleMatch) string {
 	return "(" + strings.Join(authRules, " || ") + ")"
 }
 
+// getJwtPresenceRule returns the rule matching the requests carrying a JWT in any of the JWT headers or query parameters
+func (authSpec *AuthSpec) getJwtPresenceRule() string {
+	presenceRules := make([]string, 0)
+	for _, header := range authSpec.JwtHeaders {
+		presenceRules = append(presenceRules, "HTTP.REQ.HEADER(\""+header.Name+"\").EXISTS")
+	}
+	for _, param := range authSpec.JwtParams {
+		presenceRules = append(presenceRules, "HTTP.REQ.URL.QUERY.VALUE(\""+param+"\").LENGTH.GT(0)")
+	}
+	if len(presenceRules) == 0 {
+		// Envoy looks up the token in the Authorization header by default
+		presenceRules = append(presenceRules, "HTTP.REQ.HEADER(\"Authorization\").EXISTS")
+	}
+	return "(" + strings.Join(presenceRules, " || ") + ")"
+}
+
+// getJwtVerifiedRule returns the expression which is true when the JWT of the request is verified by the authentication vserver of the CS vserver.
+// OAuth actions of the providers add the users of the verified JWTs to the group named after the authentication vserver, while requests
+// not authenticated, such as those on the excluded paths or without JWT on the paths allowing it, are not members of the group
+func getJwtVerifiedRule(csVserverName string) string {
+	return "AAA.USER.IS_MEMBER_OF(\"" + csVserverName + "authn\")"
+}
+
 func addPatSet(client *netscaler.NitroClient, confErr *nitroError, authResourceName string, jwtAudiences []string) string {
 	if len(jwtAudiences) > 0 {
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset.Type(), authResourceName, policy.Policypatset{Name: authResourceName}, "add", "", "", ""}, nil, nil))
@@ -128,22 +176,51 @@ func isJwksFilePresent(client *netscaler.NitroClient, jwksFileName string) bool
 	return false
 }
 
-func (authSpec *AuthSpec) authAdd(client *netscaler.NitroClient, confErr *nitroError) {
-	nsconfLogger.Trace("authAdd: AuthSpec addition", "authSpec", authSpec)
-	nsReleaseNo, nsBuildNo := GetNsReleaseBuild()
+// getJwksFile returns the name of the JWKS file of the OAuth action, or "" if the action does not exist
+func getJwksFile(client *netscaler.NitroClient, authAction string) string {
+	auth, err := client.FindResource(netscaler.Authenticationoauthaction.Type(), authAction)
+	if err != nil {
+		return ""
+	}
+	jwksFile, err := getValueString(auth, "certfilepath")
+	if err != nil {
+		return ""
+	}
+	return jwksFile[strings.LastIndex(jwksFile, "/")+1:]
+}
+
+// providerAdd adds the OAuth action verifying the JWTs of the provider, and binds its policy to the authentication vserver.
+// JWKS file is uploaded only if not already present, and the JWKS file replaced by the provider's current JWKS is deleted if no longer referred
+func (authSpec *AuthSpec) providerAdd(client *netscaler.NitroClient, confErr *nitroError, provider *JwtProvider, policyRule string, nsReleaseNo, nsBuildNo float64) {
 	var audiences string
-	/* Check if CertFile is already uploaded, if not Upload the CertFile again */
-	jwksFileName := GetNSCompatibleNameHash(authSpec.Jwks, 127)
+	authResourceName := authSpec.Name + "_" + fmt.Sprint(authSpec.curPolicyPriority)
+	jwksFileName := GetNSCompatibleNameHash(provider.Jwks, 127)
 	if isJwksFilePresent(client, jwksFileName) == false {
 		/* as JWKS File is not added in ADC uploading the jwksFile */
-		sslFileTransfer(client, jwksFileName, base64.StdEncoding.EncodeToString([]byte(authSpec.Jwks)))
+		sslFileTransfer(client, jwksFileName, base64.StdEncoding.EncodeToString([]byte(provider.Jwks)))
 	}
 	jwksFileLocation := sslCertPath + jwksFileName
 	if nsReleaseNo == 13.0 && nsBuildNo >= 41.10 {
-		audiences = addPatSet(client, confErr, authSpec.Name, authSpec.Audiences)
+		deletePatSet(client, confErr, authResourceName)
+		audiences = addPatSet(client, confErr, authResourceName, provider.Audiences)
 	} else {
-		audiences = getAuthAudience(authSpec.Audiences, nsReleaseNo, nsBuildNo)
+		audiences = getAuthAudience(provider.Audiences, nsReleaseNo, nsBuildNo)
 	}
+	if audiences == "" {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationoauthaction.Type(), authResourceName, map[string]interface{}{"name": authResourceName, "audience": true}, "unset", "", "", ""}, nil, nil))
+	}
+	staleJwksFileName := getJwksFile(client, authResourceName)
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationoauthaction.Type(), authResourceName, authentication.Authenticationoauthaction{Name: authResourceName, Authorizationendpoint: dummyEndPoint, Tokenendpoint: dummyEndPoint, Clientid: "testcitrix", Clientsecret: "testcitrix", Issuer: provider.Issuer, Certfilepath: jwksFileLocation, Audience: audiences, Defaultauthenticationgroup: authSpec.Name}, "add", "", "", ""}, nil, nil))
+	if staleJwksFileName != "" && staleJwksFileName != jwksFileName && isJwksFilePresent(client, staleJwksFileName) == false {
+		DeleteCert(client, staleJwksFileName)
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationpolicy.Type(), authResourceName, authentication.Authenticationpolicy{Name: authResourceName, Rule: policyRule, Action: authResourceName}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver_authenticationpolicy_binding.Type(), authSpec.Name, authentication.Authenticationvserverauthenticationpolicybinding{Name: authSpec.Name, Policy: authResourceName, Priority: authSpec.curPolicyPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, []string{"A policy is already bound to the specified priority"}, nil))
+}
+
+func (authSpec *AuthSpec) authAdd(client *netscaler.NitroClient, confErr *nitroError) {
+	nsconfLogger.Trace("authAdd: AuthSpec addition", "authSpec", authSpec)
+	nsReleaseNo, nsBuildNo := GetNsReleaseBuild()
 	/*	------------------------------------------------------------------------------------------------
 		|	IncludePath	|	ExcludePath 	|	PolicyRule	|	ExcludeRule	|
 		------------------------------------------------------------------------------------------------
@@ -156,34 +233,65 @@ func (authSpec *AuthSpec) authAdd(client *netscaler.NitroClient, confErr *nitroE
 		|	/abc		|	/xyz		|	/abc		|	/xyz		|
 		------------------------------------------------------------------------------------------------
 	*/
+	// Requests on AllowMissingPaths are authenticated like those on IncludePaths, unless they carry no JWT
+	includePaths := append(append([]AuthRuleMatch{}, authSpec.IncludePaths...), authSpec.AllowMissingPaths...)
+	excludeRules := make([]string, 0)
+	if len(authSpec.ExcludePaths) > 0 {
+		excludeRules = append(excludeRules, getAuthnRule(authSpec.ExcludePaths))
+	}
+	if len(authSpec.AllowMissingPaths) > 0 {
+		excludeRules = append(excludeRules, "("+getAuthnRule(authSpec.AllowMissingPaths)+" && !"+authSpec.getJwtPresenceRule()+")")
+	}
 	policyRule := ""
 	excludeRule := ""
 	loginSchemaRule := ""
-	if len(authSpec.IncludePaths) == 0 && len(authSpec.ExcludePaths) == 0 {
+	if len(includePaths) == 0 && len(excludeRules) == 0 {
 		policyRule = "true"
-	} else if len(authSpec.IncludePaths) > 0 && len(authSpec.ExcludePaths) == 0 {
-		policyRule = getAuthnRule(authSpec.IncludePaths)
+	} else if len(includePaths) > 0 && len(excludeRules) == 0 {
+		policyRule = getAuthnRule(includePaths)
 		excludeRule = "true"
-	} else if len(authSpec.IncludePaths) == 0 && len(authSpec.ExcludePaths) > 0 {
-		excludeRule = getAuthnRule(authSpec.ExcludePaths)
+	} else if len(includePaths) == 0 && len(excludeRules) > 0 {
+		excludeRule = "(" + strings.Join(excludeRules, " || ") + ")"
 		policyRule = "(!" + excludeRule + ")"
 	} else { // both IncludePaths and ExcludePaths are present
-		policyRule = getAuthnRule(authSpec.IncludePaths)
-		excludeRule = getAuthnRule(authSpec.ExcludePaths)
+		policyRule = getAuthnRule(includePaths)
+		excludeRule = "(" + strings.Join(excludeRules, " || ") + ")"
+	}
+	// Requests on DenyPaths match none of the policies, hence are rejected
+	if len(authSpec.DenyPaths) > 0 {
+		denyRule := getAuthnRule(authSpec.DenyPaths)
+		if policyRule == "true" {
+			policyRule = "(!" + denyRule + ")"
+		} else {
+			policyRule = "(" + policyRule + " && !" + denyRule + ")"
+		}
+		if excludeRule != "" {
+			excludeRule = "(" + excludeRule + " && !" + denyRule + ")"
+		}
 	}
-	authSpec.curPolicyPriority = 10
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver.Type(), authSpec.Name, authentication.Authenticationvserver{Name: authSpec.Name, Servicetype: "SSL", Ipv46: "0.0.0.0"}, "add", "", "", ""}, nil, nil))
-	authResourceName := authSpec.Name + "_" + fmt.Sprint(authSpec.curPolicyPriority)
-	if audiences == "" {
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationoauthaction.Type(), authResourceName, map[string]interface{}{"name": authResourceName, "audience": true}, "unset", "", "", ""}, nil, nil))
+	// Policies of the providers are evaluated in order, the token not verified by a provider is evaluated by the next one
+	authSpec.curPolicyPriority = 0
+	for i := range authSpec.Providers {
+		if authSpec.Providers[i].Jwks == "" {
+			// JWKS of the remote provider is added once fetched
+			nsconfLogger.Warn("authAdd: JWT provider without JWKS is skipped", "authSpec", authSpec.Name, "issuer", authSpec.Providers[i].Issuer)
+			continue
+		}
+		providerRule := policyRule
+		if len(authSpec.Providers[i].IncludePaths) > 0 {
+			providerRule = "(" + policyRule + " && " + getAuthnRule(authSpec.Providers[i].IncludePaths) + ")"
+		}
+		authSpec.curPolicyPriority = authSpec.curPolicyPriority + 10
+		authSpec.providerAdd(client, confErr, &authSpec.Providers[i], providerRule, nsReleaseNo, nsBuildNo)
 	}
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationoauthaction.Type(), authResourceName, authentication.Authenticationoauthaction{Name: authResourceName, Authorizationendpoint: dummyEndPoint, Tokenendpoint: dummyEndPoint, Clientid: "testcitrix", Clientsecret: "testcitrix", Issuer: authSpec.Issuer, Certfilepath: jwksFileLocation, Audience: audiences}, "add", "", "", ""}, nil, nil))
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationpolicy.Type(), authResourceName, authentication.Authenticationpolicy{Name: authResourceName, Rule: policyRule, Action: authResourceName}, "add", "", "", ""}, nil, nil))
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver_authenticationpolicy_binding.Type(), authSpec.Name, authentication.Authenticationvserverauthenticationpolicybinding{Name: authSpec.Name, Policy: authResourceName, Priority: authSpec.curPolicyPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, []string{"A policy is already bound to the specified priority"}, nil))
 	if excludeRule != "" {
-		authSpec.curPolicyPriority = 20
+		authSpec.curPolicyPriority = authSpec.curPolicyPriority + 10
 		authResourceName := authSpec.Name + "_" + fmt.Sprint(authSpec.curPolicyPriority)
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationpolicy.Type(), authResourceName, authentication.Authenticationpolicy{Name: authResourceName, Rule: excludeRule, Action: "NO_AUTHN"}, "add", "", "", ""}, nil, nil))
+		// Policy may have verified the JWTs of a removed provider earlier
+		deleteStaleJwksFile(client, confErr, authResourceName)
+		deletePatSet(client, confErr, authResourceName)
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver_authenticationpolicy_binding.Type(), authSpec.Name, authentication.Authenticationvserverauthenticationpolicybinding{Name: authSpec.Name, Policy: authResourceName, Priority: authSpec.curPolicyPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, []string{"A policy is already bound to the specified priority"}, nil))
 	}
 	for _, header := range authSpec.JwtHeaders {
@@ -208,14 +316,14 @@ func (authSpec *AuthSpec) authAdd(client *netscaler.NitroClient, confErr *nitroE
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationloginschemapolicy.Type(), authResourceName, authentication.Authenticationloginschemapolicy{Name: authResourceName, Rule: loginSchemaRule, Action: authResourceName}, "add", "", "", ""}, nil, nil))
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver_authenticationpolicy_binding.Type(), authSpec.Name, authentication.Authenticationvserverauthenticationpolicybinding{Name: authSpec.Name, Policy: authResourceName, Priority: authSpec.curLoginSchemaPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, []string{"A policy is already bound to the specified priority"}, nil))
 	}
-	addSSLVserver(client, authSpec.Name, authSpec.FrontendTLS, false, confErr)
+	addSSLVserver(client, authSpec.Name, authSpec.FrontendTLS, false, false, nil, confErr)
 	authSpec.deleteStale(client, confErr)
 }
 
-func (authSpec *AuthSpec) deletePatSet(client *netscaler.NitroClient, confErr *nitroError) {
-	_, err := client.FindResource(netscaler.Policypatset.Type(), authSpec.Name)
+func deletePatSet(client *netscaler.NitroClient, confErr *nitroError, patSetName string) {
+	_, err := client.FindResource(netscaler.Policypatset.Type(), patSetName)
 	if err == nil {
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset.Type(), authSpec.Name, nil, "delete", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset.Type(), patSetName, nil, "delete", "", "", ""}, nil, nil))
 	}
 }
 
@@ -241,6 +349,7 @@ func (authSpec *AuthSpec) deleteStale(client *netscaler.NitroClient, confErr *ni
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver_authenticationpolicy_binding.Type(), authSpec.Name, map[string]string{"name": bvserverName, "policy": bPolicyName}, "delete", "", "", ""}, nil, nil))
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationpolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
 			deleteStaleJwksFile(client, confErr, bPolicyName)
+			deletePatSet(client, confErr, bPolicyName)
 		}
 	}
 	authPolicyBindings, err = client.FindResourceArray(netscaler.Authenticationvserver_authenticationloginschemapolicy_binding.Type(), authSpec.Name)
@@ -266,15 +375,14 @@ func (authSpec *AuthSpec) deleteStale(client *netscaler.NitroClient, confErr *ni
 }
 
 func deleteStaleJwksFile(client *netscaler.NitroClient, confErr *nitroError, authAction string) {
-	auth, err := client.FindResource(netscaler.Authenticationoauthaction.Type(), authAction)
+	jwks := getJwksFile(client, authAction)
+	if jwks == "" {
+		// Policy excluding the paths from authentication has no OAuth action
+		return
+	}
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationoauthaction.Type(), authAction, nil, "delete", "", "", ""}, nil, nil))
-	if err == nil {
-		if jwksFile, err := getValueString(auth, "certfilepath"); err == nil {
-			jwks := jwksFile[strings.LastIndex(jwksFile, "/")+1:]
-			if isJwksFilePresent(client, jwks) == false {
-				DeleteCert(client, jwks)
-			}
-		}
+	if isJwksFilePresent(client, jwks) == false {
+		DeleteCert(client, jwks)
 	}
 }
 func (authSpec *AuthSpec) authDelete(client *netscaler.NitroClient, confErr *nitroError) {
@@ -283,18 +391,53 @@ func (authSpec *AuthSpec) authDelete(client *netscaler.NitroClient, confErr *nit
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Authenticationvserver.Type(), authSpec.Name, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 }
 
+// claimHeadersAdd adds the rewrite policy label copying the claims, and the encoded payloads, of the JWTs to the request headers.
+// Claim is copied only if the token is verified and issued by the provider mapping it to the header. Token verified by a provider which does not forward it
+// is removed from the JWT headers of the request
+func (authSpec *AuthSpec) claimHeadersAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	headers := make([]requestHeader, 0)
+	removeRules := make([]string, 0)
+	for _, provider := range authSpec.Providers {
+		issuerRule := getJwtClaimExpr("iss") + ".EQ(\"" + provider.Issuer + "\")"
+		providerRule := "(" + getJwtVerifiedRule(csVserverName) + " && " + issuerRule + ")"
+		for _, claimHeader := range provider.ClaimToHeaders {
+			claimExpr := getJwtClaimExpr(strings.ReplaceAll(claimHeader.Claim, ".", "/"))
+			headers = append(headers, requestHeader{name: claimHeader.Header, presenceRule: providerRule + " && " + claimExpr + ".LENGTH.GT(0)", valueExpr: claimExpr})
+		}
+		if provider.ForwardHeader != "" {
+			headers = append(headers, requestHeader{name: provider.ForwardHeader, presenceRule: providerRule, valueExpr: jwtEncodedPayloadExpr})
+		}
+		if !provider.Forward {
+			removeRules = append(removeRules, providerRule)
+		}
+	}
+	if len(removeRules) > 0 {
+		jwtHeaders := authSpec.JwtHeaders
+		if len(jwtHeaders) == 0 {
+			jwtHeaders = []JwtHeader{{Name: "Authorization"}}
+		}
+		for _, jwtHeader := range jwtHeaders {
+			headers = append(headers, requestHeader{name: jwtHeader.Name, removeRule: "(" + strings.Join(removeRules, " || ") + ")"})
+		}
+	}
+	headersLabelAdd(client, confErr, csVserverName, csVserverName+"_jwtclaims", jwtClaimHeadersInvokePriority, headers)
+}
+
 func updateVserverAuthSpec(client *netscaler.NitroClient, csVserverName string, authSpec *AuthSpec, confErr *nitroError) {
 	nsconfLogger.Trace("updateVserverAuthSpec", "authSpec", authSpec, "csVserver", csVserverName)
 	authVserverName := csVserverName + "authn"
 	if authSpec == nil {
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver.Type(), csVserverName, map[string]interface{}{"name": csVserverName, "authn401": true, "authnvsname": true}, "unset", "", "", ""}, nil, nil))
 		authSpecD := &AuthSpec{Name: authVserverName}
-		authSpecD.deletePatSet(client, confErr)
+		deletePatSet(client, confErr, authVserverName)
 		authSpecD.authDelete(client, confErr)
+		headersLabelDelete(client, confErr, csVserverName, csVserverName+"_jwtclaims", authzPolicyStartPriority)
 	} else {
 		authSpec.Name = authVserverName
-		authSpec.deletePatSet(client, confErr)
+		// Audiences patset named after the authentication vserver is replaced by the patsets of the providers
+		deletePatSet(client, confErr, authVserverName)
 		authSpec.authAdd(client, confErr)
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver.Type(), csVserverName, cs.Csvserver{Name: csVserverName, Authn401: "ON", Authnvsname: authSpec.Name}, "set", "", "", ""}, nil, nil))
+		authSpec.claimHeadersAdd(client, confErr, csVserverName)
 	}
 }
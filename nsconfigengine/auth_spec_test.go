@@ -37,6 +37,21 @@ func Test_getAuthnRule(t *testing.T) {
 	}
 }
 
+func Test_getJwtPresenceRule(t *testing.T) {
+	cases := []struct {
+		input          AuthSpec
+		expectedOutput string
+	}{
+		{AuthSpec{}, "(HTTP.REQ.HEADER(\"Authorization\").EXISTS)"},
+		{AuthSpec{JwtHeaders: []JwtHeader{{Name: "x-jwt"}}, JwtParams: []string{"token"}}, "(HTTP.REQ.HEADER(\"x-jwt\").EXISTS || HTTP.REQ.URL.QUERY.VALUE(\"token\").LENGTH.GT(0))"},
+	}
+	for _, c := range cases {
+		if output := c.input.getJwtPresenceRule(); output != c.expectedOutput {
+			t.Errorf("Expected %s, received %s", c.expectedOutput, output)
+		}
+	}
+}
+
 func Test_getAuthAudience(t *testing.T) {
 	cases := []struct {
 		inputAudiences []string
@@ -83,9 +98,8 @@ func Test_patset(t *testing.T) {
 		t.Errorf("Config verification failed for policy Patset bindings, error  %v", err)
 	}
 	t.Logf("Test patset Delete")
-	authSpec := &AuthSpec{Name: "csvsvrauthn"}
 	confErr = newNitroError()
-	authSpec.deletePatSet(client, confErr)
+	deletePatSet(client, confErr, "csvsvrauthn")
 	if confErr.getError() != nil {
 		t.Errorf("deletePatSet for patset csvsvrauthn failed with %v", confErr.getError())
 	}
@@ -114,7 +128,7 @@ func Test_auth(t *testing.T) {
 	jwks2 := fmt.Sprintf("%v", string(jwksInterface2))
 	file1 := "/nsconfig/ssl/ns_897f7f67ed30b9c4f01e540c39e2aab8"
 	file2 := "/nsconfig/ssl/ns_8f7c0711838ebd8a70c57e9199519b1d"
-	authSpec := &AuthSpec{Name: "csvsvrauthn", IncludePaths: []AuthRuleMatch{{Prefix: "/login"}}, ExcludePaths: []AuthRuleMatch{{Suffix: ".net"}}, Issuer: "google", Jwks: jwks, Audiences: []string{"string1"}, JwtHeaders: []JwtHeader{{Name: "header1", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}}, JwtParams: []string{"param1", "param2", "param3"}}
+	authSpec := &AuthSpec{Name: "csvsvrauthn", IncludePaths: []AuthRuleMatch{{Prefix: "/login"}}, ExcludePaths: []AuthRuleMatch{{Suffix: ".net"}}, Providers: []JwtProvider{{Issuer: "google", Jwks: jwks, Audiences: []string{"string1"}}}, JwtHeaders: []JwtHeader{{Name: "header1", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}}, JwtParams: []string{"param1", "param2", "param3"}}
 	confErr := newNitroError()
 	authSpec.authAdd(client, confErr)
 	if confErr.getError() != nil {
@@ -158,7 +172,7 @@ func Test_auth(t *testing.T) {
 		t.Errorf("Config verification failed for authAdd authenticationloginschemapolicy binding csvsvrauthn, error  %v", err)
 	}
 	t.Logf("Test authAdd update")
-	authSpec = &AuthSpec{Name: "csvsvrauthn", IncludePaths: []AuthRuleMatch{{Prefix: "/logout"}}, Issuer: "google", Jwks: jwks2, Audiences: []string{"string2"}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
+	authSpec = &AuthSpec{Name: "csvsvrauthn", IncludePaths: []AuthRuleMatch{{Prefix: "/logout"}}, Providers: []JwtProvider{{Issuer: "google", Jwks: jwks2, Audiences: []string{"string2"}}}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
 	confErr = newNitroError()
 	authSpec.authAdd(client, confErr)
 	if confErr.getError() != nil {
@@ -207,7 +221,7 @@ func Test_auth(t *testing.T) {
 		t.Errorf("Config verification failed for auth deleteStale csvsvrauthn, error %v", err)
 	}
 	t.Logf("Test authAdd update")
-	authSpec = &AuthSpec{Name: "csvsvrauthn", Issuer: "google", Jwks: jwks2, Audiences: []string{}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
+	authSpec = &AuthSpec{Name: "csvsvrauthn", Providers: []JwtProvider{{Issuer: "google", Jwks: jwks2, Audiences: []string{}}}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
 	confErr = newNitroError()
 	authSpec.authAdd(client, confErr)
 	if confErr.getError() != nil {
@@ -254,7 +268,7 @@ func Test_auth(t *testing.T) {
 		t.Errorf("Config verification failed for auth deleteStale csvsvrauthn, error %v", err)
 	}
 	t.Logf("Test authAdd update")
-	authSpec = &AuthSpec{Name: "csvsvrauthn", ExcludePaths: []AuthRuleMatch{{Suffix: ".net"}}, Issuer: "google", Jwks: jwks, Audiences: []string{"string2"}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
+	authSpec = &AuthSpec{Name: "csvsvrauthn", ExcludePaths: []AuthRuleMatch{{Suffix: ".net"}}, Providers: []JwtProvider{{Issuer: "google", Jwks: jwks, Audiences: []string{"string2"}}}, JwtHeaders: []JwtHeader{{Name: "header11", Prefix: "Bearer"}, {Name: "header2", Prefix: "Bearer"}, {Name: "header3", Prefix: "Bearer"}}, JwtParams: []string{"param2"}}
 	confErr = newNitroError()
 	authSpec.authAdd(client, confErr)
 	if confErr.getError() != nil {
@@ -330,3 +344,84 @@ func Test_auth(t *testing.T) {
 		t.Errorf("Config verification failed for authDelete csvsvrauthn, error %v", err)
 	}
 }
+
+func Test_authMultipleProviders(t *testing.T) {
+	client := env.GetNitroClient()
+	jwks := `{"keys": [{"e":"AQAB","kty":"RSA","n":"xAE7eB6qugXyCAG3yhh7pkDkT65pHymX-P7KfIupjf59vsdo91bSP9C8H07pSAGQO1MV_xFj9VswgsCg4R6otmg5PV2He95lZdHtOcU5DXIg_pbhLdKXbi66GlVeK6ABZOUW3WYtnNHD-91gVuoeJT_DwtGGcp4ignkgXfkiEm4sw-4sfb4qdt5oLbyVpmW6x9cfa7vs2WTfURiCrBoUqgBo_-4WTiULmmHSGZHOjzwa8WtrtOQGsAFjIbno85jp6MnGGGZPYZbDAa_b3y5u-YpW7ypZrvD8BgtKVjgtQgZhLAGezMt0ua3DRrWnKqTZ0BJ_EyxOGuHJrLsn00fnMQ"}]}`
+	jwks2 := `{"keys": [{"e":"AQAB","kty":"RSA","n":"3LlzeRY6gbIVwGO7AxO1bN3-CgWwIpWOT8m485AzkOdhxgCWc2F-3OqAigDyyDMqXtH1ovCaZnEIf3ZkJin7Y_zC48TNQwlKnuM29CrTjnYR1c_w30ZT4PNIisEwLKuEX5uRHuIrKYBxwwVf4eqoFmtpZbrmwDPCA1ZMFox0v40q1m_SecCB286alE42Ohb6j0ZuntjO5rg2ZyQt3EmxEDPE2Iuh737gYhXLuFhTiYH5S_kFokX1Yv0RdUyiGcmaxXgGaF3iglnsOHv9209uwlzrcDAouOD7PYbLjCoqpWydVLyxcJGqjF5i7CK36q_SVmpGHbIsdOlZQLWNA97AgQ"}]}`
+	t.Logf("Test authAdd with multiple providers")
+	authSpec := &AuthSpec{Name: "csvsvrmultiauthn", ExcludePaths: []AuthRuleMatch{{Prefix: "/health"}}, Providers: []JwtProvider{
+		{Issuer: "google", Jwks: jwks},
+		{Issuer: "https://issuer.example.com", Jwks: jwks2, JwksURI: "https://issuer.example.com/jwks"},
+	}}
+	confErr := newNitroError()
+	authSpec.authAdd(client, confErr)
+	if confErr.getError() != nil {
+		t.Errorf("authAdd for csvsvrmultiauthn failed with %v", confErr.getError())
+	}
+	configs := []env.VerifyNitroConfig{
+		{"authenticationoauthaction", "csvsvrmultiauthn_10", map[string]interface{}{"issuer": "google", "name": "csvsvrmultiauthn_10"}},
+		{"authenticationoauthaction", "csvsvrmultiauthn_20", map[string]interface{}{"issuer": "https://issuer.example.com", "name": "csvsvrmultiauthn_20"}},
+		{"authenticationpolicy", "csvsvrmultiauthn_30", map[string]interface{}{"action": "NO_AUTHN", "name": "csvsvrmultiauthn_30"}},
+	}
+	err := env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for authAdd csvsvrmultiauthn, error %v", err)
+	}
+	t.Logf("Test authAdd with a provider removed")
+	authSpec.Providers = authSpec.Providers[:1]
+	confErr = newNitroError()
+	authSpec.authAdd(client, confErr)
+	if confErr.getError() != nil {
+		t.Errorf("authAdd update for csvsvrmultiauthn failed with %v", confErr.getError())
+	}
+	err = env.VerifyConfigBlockPresence(client, []env.VerifyNitroConfig{{"authenticationpolicy", "csvsvrmultiauthn_20", map[string]interface{}{"action": "NO_AUTHN", "name": "csvsvrmultiauthn_20"}}})
+	if err != nil {
+		t.Errorf("Config verification failed for authAdd update csvsvrmultiauthn, error %v", err)
+	}
+	err = env.VerifyConfigBlockAbsence(client, []env.VerifyNitroConfig{{"authenticationoauthaction", "csvsvrmultiauthn_20", nil}, {"authenticationpolicy", "csvsvrmultiauthn_30", nil}})
+	if err != nil {
+		t.Errorf("Config verification failed for stale provider of csvsvrmultiauthn, error %v", err)
+	}
+	confErr = newNitroError()
+	authSpec.authDelete(client, confErr)
+}
+
+func Test_authRulesAndClaimHeaders(t *testing.T) {
+	client := env.GetNitroClient()
+	jwks := `{"keys": [{"e":"AQAB","kty":"RSA","n":"xAE7eB6qugXyCAG3yhh7pkDkT65pHymX-P7KfIupjf59vsdo91bSP9C8H07pSAGQO1MV_xFj9VswgsCg4R6otmg5PV2He95lZdHtOcU5DXIg_pbhLdKXbi66GlVeK6ABZOUW3WYtnNHD-91gVuoeJT_DwtGGcp4ignkgXfkiEm4sw-4sfb4qdt5oLbyVpmW6x9cfa7vs2WTfURiCrBoUqgBo_-4WTiULmmHSGZHOjzwa8WtrtOQGsAFjIbno85jp6MnGGGZPYZbDAa_b3y5u-YpW7ypZrvD8BgtKVjgtQgZhLAGezMt0ua3DRrWnKqTZ0BJ_EyxOGuHJrLsn00fnMQ"}]}`
+	csObj := NewCSApi("csjwtclaims", "HTTP", "2.2.1.5", 80)
+	csObj.AuthSpec = &AuthSpec{AllowMissingPaths: []AuthRuleMatch{{Prefix: "/"}}, JwtHeaders: []JwtHeader{{Name: "Authorization", Prefix: "Bearer "}}, Providers: []JwtProvider{
+		{Issuer: "google", Jwks: jwks, IncludePaths: []AuthRuleMatch{{Prefix: "/api"}}, ClaimToHeaders: []JwtClaimHeader{{Header: "x-jwt-group", Claim: "group"}}, ForwardHeader: "x-jwt-payload"},
+	}}
+	t.Logf("Test CSApi Add with JWT requirement rules, claim and payload headers")
+	if err := csObj.Add(client); err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"authenticationpolicy", "csjwtclaimsauthn_10", map[string]interface{}{"name": "csjwtclaimsauthn_10", "action": "csjwtclaimsauthn_10"}},
+		{"authenticationpolicy", "csjwtclaimsauthn_20", map[string]interface{}{"name": "csjwtclaimsauthn_20", "action": "NO_AUTHN"}},
+		{"rewritepolicylabel", "csjwtclaims_jwtclaims", map[string]interface{}{"labelname": "csjwtclaims_jwtclaims"}},
+		{"rewriteaction", "csjwtclaims_jwtclaims_10", map[string]interface{}{"name": "csjwtclaims_jwtclaims_10", "type": "replace"}},
+		{"rewriteaction", "csjwtclaims_jwtclaims_20", map[string]interface{}{"name": "csjwtclaims_jwtclaims_20", "type": "insert_http_header"}},
+		{"rewriteaction", "csjwtclaims_jwtclaims_40", map[string]interface{}{"name": "csjwtclaims_jwtclaims_40", "type": "insert_http_header", "target": "x-jwt-payload"}},
+		{"rewriteaction", "csjwtclaims_jwtclaims_50", map[string]interface{}{"name": "csjwtclaims_jwtclaims_50", "type": "delete_http_header", "target": "Authorization"}},
+	}
+	if err := env.VerifyConfigBlockPresence(client, configs); err != nil {
+		t.Errorf("Config verification failed for Add csjwtclaims, error %v", err)
+	}
+	t.Logf("Test CSApi Update without claim headers, forwarding the token")
+	csObj.AuthSpec.Providers[0].ClaimToHeaders = nil
+	csObj.AuthSpec.Providers[0].ForwardHeader = ""
+	csObj.AuthSpec.Providers[0].Forward = true
+	if err := csObj.Add(client); err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	if err := env.VerifyConfigBlockAbsence(client, []env.VerifyNitroConfig{{"rewritepolicylabel", "csjwtclaims_jwtclaims", nil}}); err != nil {
+		t.Errorf("Config verification failed for stale claim headers of csjwtclaims, error %v", err)
+	}
+	csObj.AuthSpec = nil
+	if err := csObj.Delete(client); err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+}
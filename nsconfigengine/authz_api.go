@@ -0,0 +1,498 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/citrix/adc-nitro-go/resource/config/audit"
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	"github.com/citrix/adc-nitro-go/resource/config/responder"
+	"github.com/citrix/adc-nitro-go/resource/config/ssl"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+// Authorization actions of an AuthzRule
+const (
+	AuthzAllow = "ALLOW"
+	AuthzDeny  = "DENY"
+	AuthzLog   = "LOG"
+)
+
+const (
+	// Authorization policy labels are invoked ahead of the route level responder policies, which start at resPolicyStartPriority
+	authzLogInvokePriority   = 1
+	authzDenyInvokePriority  = 2
+	authzPolicyStartPriority = 10
+	// SSL policy of the connection authorization is bound after the SSL forwarding policies
+	authzSSLPolicyPriority = 1000
+	authzDeniedResponse    = "\"HTTP/1.1 403 Forbidden\r\nContent-Length: 19\r\n\r\nRBAC: access denied\""
+	// jwtEncodedPayloadExpr is the base64url encoded payload of the bearer token, and jwtPayloadExpr decodes it.
+	// Payload is trusted only if getJwtVerifiedRule is true
+	jwtEncodedPayloadExpr = "HTTP.REQ.HEADER(\"Authorization\").AFTER_STR(\".\").BEFORE_STR(\".\")"
+	jwtPayloadExpr        = jwtEncodedPayloadExpr + ".REGEX_REPLACE(re/-/, \"+\", ALL).REGEX_REPLACE(re/_/, \"/\", ALL).B64DECODE"
+)
+
+// ClientCertURISANExpr selects the URI of the subject alternative names of the client certificate, which holds the SPIFFE ID of the peer
+var ClientCertURISANExpr = "CLIENT.SSL.CLIENT_CERT.SUBJECT_ALT_NAME.REGEX_SELECT(" + getNSRegex("URI:[^,]+") + ").AFTER_STR(\"URI:\")"
+
+// getJwtClaimExpr returns the expression of the claim of the bearer token, where nested claims of claimPath are separated by '/'
+func getJwtClaimExpr(claimPath string) string {
+	return jwtPayloadExpr + ".XPATH_JSON(xp%/" + claimPath + "%)"
+}
+
+// getJwtMatchRule returns the expression matching the JWT of the request as per jwtRule only if the JWT is verified, as per jwtVerifiedRule.
+// Request with unverified JWT matches if unverifiedMatch is true, so that it is not allowed by an ALLOW rule nor escapes a DENY rule
+func getJwtMatchRule(jwtRule, jwtVerifiedRule string, unverifiedMatch bool) string {
+	if jwtVerifiedRule == "" {
+		return fmt.Sprint(unverifiedMatch)
+	}
+	if unverifiedMatch {
+		return "(!" + jwtVerifiedRule + " || " + jwtRule + ")"
+	}
+	return "(" + jwtVerifiedRule + " && " + jwtRule + ")"
+}
+
+// AuthzMatch specifies a request match of an authorization policy, equivalent to a permission or a principal of Envoy's RBAC.
+// All the specified attributes need to match. And, Or and Not combine nested matches.
+// SourceIP and DestinationIP are IP addresses or CIDR ranges. Principal is matched against the URI subject alternative name of the client certificate,
+// RequestPrincipal against the "<iss>/<sub>" of the JWT, and the Name of a Claims entry is the claim path with nested claims separated by '/'.
+// RequestPrincipal and Claims are evaluated only if the JWT is verified by the authentication vserver of the CS vserver
+type AuthzMatch struct {
+	Any              bool
+	And              []AuthzMatch
+	Or               []AuthzMatch
+	Not              *AuthzMatch
+	Headers          []MatchHeader
+	Path             *MatchHeader
+	SourceIP         string
+	DestinationIP    string
+	DestinationPort  int
+	ServerName       *MatchHeader
+	Authenticated    bool
+	Principal        *MatchHeader
+	RequestPrincipal *MatchHeader
+	Claims           []MatchHeader
+}
+
+// AuthzPolicy specifies a named authorization policy. A request matches the policy if it matches any of Permissions and any of Principals
+type AuthzPolicy struct {
+	Name        string
+	Permissions []AuthzMatch
+	Principals  []AuthzMatch
+}
+
+// AuthzRule specifies the policies of an RBAC filter with its action. ALLOW denies the requests matching none of the policies,
+// DENY denies the requests matching any of the policies and LOG only logs the matching requests.
+// Shadow rule is never enforced, the requests it would deny are logged instead
+type AuthzRule struct {
+	Action   string
+	Policies []AuthzPolicy
+	Shadow   bool
+}
+
+// AuthzSpec specifies the authorization of the requests of a CS vserver. Rules are evaluated in order, and a request denied by any rule is
+// responded with 403, or dropped or reset as per DenyResponse ("DROP" or "RESET")
+type AuthzSpec struct {
+	Name            string
+	Rules           []AuthzRule
+	DenyResponse    string
+	curDenyPriority int
+	curLogPriority  int
+	labelType       string
+}
+
+func getAuthzIPMatchRule(address, ipv4Expr, ipv6Expr string) string {
+	_, subnet, err := net.ParseCIDR(address)
+	if err != nil {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return "false"
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		subnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+	ones, _ := subnet.Mask.Size()
+	if subnet.IP.To4() != nil {
+		return ipv4Expr + ".IN_SUBNET(" + subnet.IP.String() + "/" + fmt.Sprint(ones) + ")"
+	}
+	return ipv6Expr + ".IN_SUBNET(" + subnet.IP.String() + "/" + fmt.Sprint(ones) + ")"
+}
+
+func joinAuthzRules(rules []string, operator, emptyRule string) string {
+	if len(rules) == 0 {
+		return emptyRule
+	}
+	if len(rules) == 1 {
+		return rules[0]
+	}
+	return "(" + strings.Join(rules, " "+operator+" ") + ")"
+}
+
+// getMatchRule returns the expression which is true when the request matches. Predicates on the JWT are true for the requests whose JWT is not verified
+// as per jwtVerifiedRule, if unverifiedMatch is true. Since Not negates it, unverifiedMatch is inverted for the nested match of Not
+func (match *AuthzMatch) getMatchRule(jwtVerifiedRule string, unverifiedMatch bool) string {
+	if match.Any {
+		return "true"
+	}
+	rules := make([]string, 0)
+	if match.And != nil {
+		andRules := make([]string, 0)
+		for _, andMatch := range match.And {
+			andRules = append(andRules, andMatch.getMatchRule(jwtVerifiedRule, unverifiedMatch))
+		}
+		rules = append(rules, joinAuthzRules(andRules, "&&", "true"))
+	}
+	if match.Or != nil {
+		orRules := make([]string, 0)
+		for _, orMatch := range match.Or {
+			orRules = append(orRules, orMatch.getMatchRule(jwtVerifiedRule, unverifiedMatch))
+		}
+		rules = append(rules, joinAuthzRules(orRules, "||", "false"))
+	}
+	if match.Not != nil {
+		rules = append(rules, "!("+match.Not.getMatchRule(jwtVerifiedRule, !unverifiedMatch)+")")
+	}
+	for _, header := range match.Headers {
+		if headerRule := header.getHeaderMatchRule(); headerRule != "" {
+			rules = append(rules, headerRule)
+		}
+	}
+	if match.Path != nil {
+		if pathRule := match.Path.getMatchRule("HTTP.REQ.URL.PATH", "true"); pathRule != "" {
+			rules = append(rules, pathRule)
+		}
+	}
+	if match.SourceIP != "" {
+		rules = append(rules, getAuthzIPMatchRule(match.SourceIP, "CLIENT.IP.SRC", "CLIENT.IPV6.SRC"))
+	}
+	if match.DestinationIP != "" {
+		rules = append(rules, getAuthzIPMatchRule(match.DestinationIP, "CLIENT.IP.DST", "CLIENT.IPV6.DST"))
+	}
+	if match.DestinationPort != 0 {
+		rules = append(rules, "CLIENT.TCP.DSTPORT.EQ("+fmt.Sprint(match.DestinationPort)+")")
+	}
+	if match.ServerName != nil {
+		if serverNameRule := match.ServerName.getMatchRule("CLIENT.SSL.CLIENT_HELLO.SNI", "true"); serverNameRule != "" {
+			rules = append(rules, serverNameRule)
+		}
+	}
+	if match.Authenticated || match.Principal != nil {
+		rules = append(rules, "CLIENT.SSL.CLIENT_CERT.EXISTS")
+	}
+	if match.Principal != nil {
+		if principalRule := match.Principal.getMatchRule(ClientCertURISANExpr, "true"); principalRule != "" {
+			rules = append(rules, principalRule)
+		}
+	}
+	if match.RequestPrincipal != nil {
+		requestPrincipalExpr := "(" + jwtPayloadExpr + ".XPATH_JSON(xp%/iss%) + \"/\" + " + jwtPayloadExpr + ".XPATH_JSON(xp%/sub%))"
+		if requestPrincipalRule := match.RequestPrincipal.getMatchRule(requestPrincipalExpr, "true"); requestPrincipalRule != "" {
+			rules = append(rules, getJwtMatchRule(requestPrincipalRule, jwtVerifiedRule, unverifiedMatch))
+		}
+	}
+	for _, claim := range match.Claims {
+		claimExpr := getJwtClaimExpr(claim.Name)
+		if claimRule := claim.getMatchRule(claimExpr, claimExpr+".LENGTH.GT(0)"); claimRule != "" {
+			rules = append(rules, getJwtMatchRule(claimRule, jwtVerifiedRule, unverifiedMatch))
+		}
+	}
+	return joinAuthzRules(rules, "&&", "true")
+}
+
+func (policy *AuthzPolicy) getMatchRule(jwtVerifiedRule string, unverifiedMatch bool) string {
+	permissionRules := make([]string, 0)
+	for _, permission := range policy.Permissions {
+		permissionRules = append(permissionRules, permission.getMatchRule(jwtVerifiedRule, unverifiedMatch))
+	}
+	principalRules := make([]string, 0)
+	for _, principal := range policy.Principals {
+		principalRules = append(principalRules, principal.getMatchRule(jwtVerifiedRule, unverifiedMatch))
+	}
+	return joinAuthzRules(permissionRules, "||", "false") + " && " + joinAuthzRules(principalRules, "||", "false")
+}
+
+// getMatchRule returns the expression which is true when the request matches any of the policies of the rule
+func (rule *AuthzRule) getMatchRule(jwtVerifiedRule string, unverifiedMatch bool) string {
+	policyRules := make([]string, 0)
+	for _, policy := range rule.Policies {
+		policyRules = append(policyRules, "("+policy.getMatchRule(jwtVerifiedRule, unverifiedMatch)+")")
+	}
+	return joinAuthzRules(policyRules, "||", "false")
+}
+
+// getDenyRule returns the expression which is true when the rule denies the request, empty if the rule never denies.
+// Predicates on the JWT do not match the requests whose JWT is not verified for ALLOW, and match them for DENY
+func (rule *AuthzRule) getDenyRule(jwtVerifiedRule string) string {
+	switch rule.Action {
+	case AuthzAllow:
+		return "!(" + rule.getMatchRule(jwtVerifiedRule, false) + ")"
+	case AuthzDeny:
+		return rule.getMatchRule(jwtVerifiedRule, true)
+	}
+	return ""
+}
+
+// authzLogAdd adds the responder policy logging the requests matching policyRule, and binds it to the log policy label
+func (authzSpec *AuthzSpec) authzLogAdd(client *netscaler.NitroClient, confErr *nitroError, policyRule string, message string) {
+	labelName := authzSpec.Name + "log"
+	entityName := labelName + "_" + fmt.Sprint(authzSpec.curLogPriority)
+	if authzSpec.curLogPriority == authzPolicyStartPriority {
+		authzLabelAdd(client, confErr, labelName, authzSpec.labelType)
+	}
+	logExpr := "\"rbac " + message + ": \" + CLIENT.IP.SRC + \" \" + HTTP.REQ.HOSTNAME + HTTP.REQ.URL.PATH"
+	if authzSpec.labelType != "HTTP" {
+		logExpr = "\"rbac " + message + ": \" + CLIENT.IP.SRC + \" \" + CLIENT.IP.DST + \":\" + CLIENT.TCP.DSTPORT"
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), entityName, audit.Auditmessageaction{Name: entityName, Loglevel: "INFORMATIONAL", Stringbuilderexpr: logExpr}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), entityName, responder.Responderpolicy{Name: entityName, Rule: policyRule, Action: "NOOP", Logaction: entityName}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicylabel_responderpolicy_binding.Type(), labelName, responder.Responderpolicylabelresponderpolicybinding{Labelname: labelName, Policyname: entityName, Priority: authzSpec.curLogPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+	authzSpec.curLogPriority = authzSpec.curLogPriority + 10
+}
+
+// authzDenyAdd adds the responder policy denying the requests matching policyRule, and binds it to the deny policy label
+func (authzSpec *AuthzSpec) authzDenyAdd(client *netscaler.NitroClient, confErr *nitroError, policyRule string) {
+	entityName := authzSpec.Name + "_" + fmt.Sprint(authzSpec.curDenyPriority)
+	if authzSpec.curDenyPriority == authzPolicyStartPriority {
+		authzLabelAdd(client, confErr, authzSpec.Name, authzSpec.labelType)
+	}
+	action := authzSpec.DenyResponse
+	if action != "DROP" && action != "RESET" {
+		action = authzSpec.Name
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), entityName, responder.Responderpolicy{Name: entityName, Rule: policyRule, Action: action}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicylabel_responderpolicy_binding.Type(), authzSpec.Name, responder.Responderpolicylabelresponderpolicybinding{Labelname: authzSpec.Name, Policyname: entityName, Priority: authzSpec.curDenyPriority, Gotopriorityexpression: "END"}, "add", "", "", ""}, nil, nil))
+	authzSpec.curDenyPriority = authzSpec.curDenyPriority + 10
+}
+
+// authzLogRuleAdd adds the policies logging the requests as per the LOG or shadow rule
+func (authzSpec *AuthzSpec) authzLogRuleAdd(client *netscaler.NitroClient, confErr *nitroError, rule *AuthzRule, jwtVerifiedRule string) {
+	prefix := strings.ToLower(rule.Action)
+	if rule.Shadow {
+		prefix = "shadow " + prefix
+	}
+	if rule.Action == AuthzAllow {
+		// Shadow ALLOW rule logs the requests which it would deny
+		authzSpec.authzLogAdd(client, confErr, rule.getDenyRule(jwtVerifiedRule), prefix+" denied")
+		return
+	}
+	for _, policy := range rule.Policies {
+		// Shadow DENY rule logs the requests which it would deny, LOG rule only the requests matching its policies
+		authzSpec.authzLogAdd(client, confErr, policy.getMatchRule(jwtVerifiedRule, rule.Shadow), prefix+" "+policy.Name)
+	}
+}
+
+func authzLabelAdd(client *netscaler.NitroClient, confErr *nitroError, labelName, labelType string) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicylabel.Type(), labelName, responder.Responderpolicylabel{Labelname: labelName, Policylabeltype: labelType}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+}
+
+// authzLabelInvoke adds the responder policy invoking the policy label from the CS vserver for the requests matching policyRule
+func authzLabelInvoke(client *netscaler.NitroClient, confErr *nitroError, csVserverName, labelName, policyRule string, priority int, gotoPriorityExpression string) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), labelName, responder.Responderpolicy{Name: labelName, Rule: policyRule, Action: "NOOP"}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, cs.Csvserverresponderpolicybinding{Name: csVserverName, Policyname: labelName, Priority: priority, Gotopriorityexpression: gotoPriorityExpression, Invoke: true, Labeltype: "policylabel", Labelname: labelName}, "add", "", "", ""}, nil, nil))
+}
+
+// authzLabelDelete deletes the policies bound to the policy label at or after startPriority.
+// If startPriority is authzPolicyStartPriority, the label is deleted along with the responder policy invoking it from the CS vserver
+func authzLabelDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName, labelName string, startPriority int) {
+	var bPolicyName string
+	var priority int
+	labelBindings, err := client.FindResourceArray(netscaler.Responderpolicylabel_responderpolicy_binding.Type(), labelName)
+	if err == nil {
+		for _, labelBinding := range labelBindings {
+			if bPolicyName, err = getValueString(labelBinding, "policyname"); err != nil {
+				continue
+			}
+			if priority, err = getValueInt(labelBinding, "priority"); err != nil {
+				continue
+			}
+			if priority < startPriority {
+				continue
+			}
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicylabel_responderpolicy_binding.Type(), labelName, map[string]string{"labelname": labelName, "policyname": bPolicyName}, "delete", "", "", ""}, nil, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), bPolicyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		}
+	}
+	if startPriority != authzPolicyStartPriority {
+		return
+	}
+	if _, err = client.FindResource(netscaler.Responderpolicylabel.Type(), labelName); err != nil {
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": labelName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), labelName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicylabel.Type(), labelName, nil, "delete", "", "", ""}, nil, nil))
+}
+
+func authzDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	authzName := csVserverName + "_authz"
+	authzLabelDelete(client, confErr, csVserverName, authzName, authzPolicyStartPriority)
+	authzLabelDelete(client, confErr, csVserverName, authzName+"log", authzPolicyStartPriority)
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), authzName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
+
+// authzAdd adds the policy label logging the requests as per the LOG and shadow rules, and the policy label denying the requests as per the enforced rules.
+// Log label is invoked for every request, while deny label is invoked only for the requests denied by any rule
+func (authzSpec *AuthzSpec) authzAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	nsconfLogger.Trace("authzAdd: AuthzSpec addition", "authzSpec", authzSpec)
+	authzSpec.Name = csVserverName + "_authz"
+	authzSpec.curDenyPriority = authzPolicyStartPriority
+	authzSpec.curLogPriority = authzPolicyStartPriority
+	authzSpec.labelType = "HTTP"
+	jwtVerifiedRule := getJwtVerifiedRule(csVserverName)
+	denyRules := make([]string, 0)
+	for _, rule := range authzSpec.Rules {
+		if rule.Action == AuthzLog || rule.Shadow {
+			authzSpec.authzLogRuleAdd(client, confErr, &rule, jwtVerifiedRule)
+			continue
+		}
+		if denyRule := rule.getDenyRule(jwtVerifiedRule); denyRule != "" {
+			denyRules = append(denyRules, denyRule)
+		}
+	}
+	if len(denyRules) > 0 {
+		if authzSpec.DenyResponse != "DROP" && authzSpec.DenyResponse != "RESET" {
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), authzSpec.Name, responder.Responderaction{Name: authzSpec.Name, Type: "respondwith", Target: authzDeniedResponse}, "add", "", "", ""}, nil, nil))
+		}
+		for _, denyRule := range denyRules {
+			authzSpec.authzDenyAdd(client, confErr, denyRule)
+		}
+		// Label is invoked only after its policies are bound
+		authzLabelInvoke(client, confErr, csVserverName, authzSpec.Name, joinAuthzRules(denyRules, "||", "false"), authzDenyInvokePriority, "END")
+	}
+	if authzSpec.curLogPriority > authzPolicyStartPriority {
+		authzLabelInvoke(client, confErr, csVserverName, authzSpec.Name+"log", "true", authzLogInvokePriority, "NEXT")
+	}
+	authzLabelDelete(client, confErr, csVserverName, authzSpec.Name, authzSpec.curDenyPriority)
+	authzLabelDelete(client, confErr, csVserverName, authzSpec.Name+"log", authzSpec.curLogPriority)
+	if len(denyRules) == 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), authzSpec.Name, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+}
+
+func updateVserverAuthzSpec(client *netscaler.NitroClient, csVserverName string, authzSpec *AuthzSpec, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverAuthzSpec", "authzSpec", authzSpec, "csVserver", csVserverName)
+	if authzSpec == nil {
+		authzDelete(client, confErr, csVserverName)
+		return
+	}
+	authzSpec.authzAdd(client, confErr, csVserverName)
+}
+
+// requiresTLS returns true if the match evaluates the client certificate or the server name of the TLS handshake
+func (match *AuthzMatch) requiresTLS() bool {
+	if match.Authenticated || match.Principal != nil || match.ServerName != nil {
+		return true
+	}
+	for _, nestedMatches := range [][]AuthzMatch{match.And, match.Or} {
+		for _, nestedMatch := range nestedMatches {
+			if nestedMatch.requiresTLS() {
+				return true
+			}
+		}
+	}
+	return match.Not != nil && match.Not.requiresTLS()
+}
+
+func (rule *AuthzRule) requiresTLS() bool {
+	for _, policy := range rule.Policies {
+		for _, matches := range [][]AuthzMatch{policy.Permissions, policy.Principals} {
+			for _, match := range matches {
+				if match.requiresTLS() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func authzSSLPolicyDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	sslPolicyName := csVserverName + "_authz"
+	if _, err := client.FindResource(netscaler.Sslpolicy.Type(), sslPolicyName); err != nil {
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver_sslpolicy_binding.Type(), csVserverName, map[string]string{"vservername": csVserverName, "policyname": sslPolicyName, "type": "REQUEST"}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslpolicy.Type(), sslPolicyName, nil, "delete", "", "", ""}, nil, nil))
+}
+
+// listenPolicyUpdate sets the listen policy of the CS vserver, unless it is already set
+func listenPolicyUpdate(client *netscaler.NitroClient, confErr *nitroError, csVserverName, listenPolicy string) {
+	if csVserver, err := client.FindResource(netscaler.Csvserver.Type(), csVserverName); err == nil {
+		if curListenPolicy, err := getValueString(csVserver, "listenpolicy"); err == nil && curListenPolicy == listenPolicy {
+			return
+		}
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver.Type(), csVserverName, cs.Csvserver{Name: csVserverName, Listenpolicy: listenPolicy}, "set", "", "", ""}, nil, nil))
+}
+
+// updateVserverNetworkAuthzSpec enforces the authorization of the connections of a TCP or SSL_TCP CS vserver.
+// Connections denied by the rules evaluating only the addresses and ports are not accepted by the listen policy of the CS vserver.
+// Rules evaluating the client certificate or the server name reset the connection after the SSL handshake, hence are supported only on SSL_TCP CS vservers.
+// Connections are logged as per the LOG and shadow rules by the responder policies of the CS vserver
+func updateVserverNetworkAuthzSpec(client *netscaler.NitroClient, csVserverName, vserverType string, authzSpec *AuthzSpec, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverNetworkAuthzSpec", "authzSpec", authzSpec, "csVserver", csVserverName)
+	authzName := csVserverName + "_authz"
+	listenRules := make([]string, 0)
+	tlsRules := make([]string, 0)
+	logPriority := authzPolicyStartPriority
+	if authzSpec != nil {
+		authzSpec.Name = authzName
+		authzSpec.curLogPriority = authzPolicyStartPriority
+		authzSpec.labelType = "OTHERTCP"
+		for _, rule := range authzSpec.Rules {
+			if rule.requiresTLS() && vserverType != "SSL_TCP" {
+				nsconfLogger.Warn("updateVserverNetworkAuthzSpec: Client certificate and server name can not be evaluated on non-SSL vserver", "csVserver", csVserverName, "rule", rule)
+				continue
+			}
+			// Connections carry no JWT
+			if rule.Action == AuthzLog || rule.Shadow {
+				authzSpec.authzLogRuleAdd(client, confErr, &rule, "")
+				continue
+			}
+			denyRule := rule.getDenyRule("")
+			if denyRule == "" {
+				continue
+			}
+			if !rule.requiresTLS() {
+				listenRules = append(listenRules, denyRule)
+			} else {
+				tlsRules = append(tlsRules, denyRule)
+			}
+		}
+		if authzSpec.curLogPriority > authzPolicyStartPriority {
+			authzLabelInvoke(client, confErr, csVserverName, authzName+"log", "true", authzLogInvokePriority, "NEXT")
+		}
+		logPriority = authzSpec.curLogPriority
+	}
+	authzLabelDelete(client, confErr, csVserverName, authzName+"log", logPriority)
+	listenPolicy := "NONE"
+	if len(listenRules) > 0 {
+		listenPolicy = "!(" + strings.Join(listenRules, " || ") + ")"
+	}
+	listenPolicyUpdate(client, confErr, csVserverName, listenPolicy)
+	if len(tlsRules) == 0 {
+		authzSSLPolicyDelete(client, confErr, csVserverName)
+		return
+	}
+	sslPolicyName := authzName
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslpolicy.Type(), sslPolicyName, ssl.Sslpolicy{Name: sslPolicyName, Rule: joinAuthzRules(tlsRules, "||", "false"), Action: "RESET"}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver_sslpolicy_binding.Type(), csVserverName, ssl.Sslvserversslpolicybinding{Vservername: csVserverName, Policyname: sslPolicyName, Priority: authzSSLPolicyPriority, Type: "REQUEST"}, "add", "", "", ""}, nil, nil))
+}
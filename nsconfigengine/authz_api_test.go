@@ -0,0 +1,185 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_AuthzMatch_getMatchRule(t *testing.T) {
+	cases := []struct {
+		name  string
+		match AuthzMatch
+		rule  string
+	}{
+		{"any", AuthzMatch{Any: true}, "true"},
+		{"path and method", AuthzMatch{And: []AuthzMatch{{Path: &MatchHeader{Prefix: "/api"}}, {Headers: []MatchHeader{{Name: ":method", Exact: "GET"}}}}},
+			"(HTTP.REQ.URL.PATH.STARTSWITH(\"/api\") && HTTP.REQ.METHOD.EQ(\"GET\"))"},
+		{"source IPs", AuthzMatch{Or: []AuthzMatch{{SourceIP: "10.0.0.0/8"}, {SourceIP: "2001:db8::1"}}},
+			"(CLIENT.IP.SRC.IN_SUBNET(10.0.0.0/8) || CLIENT.IPV6.SRC.IN_SUBNET(2001:db8::1/128))"},
+		{"not destination port", AuthzMatch{Not: &AuthzMatch{DestinationPort: 8080}}, "!(CLIENT.TCP.DSTPORT.EQ(8080))"},
+		{"principal", AuthzMatch{Authenticated: true, Principal: &MatchHeader{Exact: "spiffe://cluster.local/ns/default/sa/sleep"}},
+			"(CLIENT.SSL.CLIENT_CERT.EXISTS && CLIENT.SSL.CLIENT_CERT.SUBJECT_ALT_NAME.REGEX_SELECT(re/URI:[^,]+/).AFTER_STR(\"URI:\").EQ(\"spiffe://cluster.local/ns/default/sa/sleep\"))"},
+		{"JWT claim", AuthzMatch{Claims: []MatchHeader{{Name: "groups", Exact: "admin"}}},
+			"(AAA.USER.IS_MEMBER_OF(\"cs1authn\") && " + jwtPayloadExpr + ".XPATH_JSON(xp%/groups%).EQ(\"admin\"))"},
+		{"not JWT claim", AuthzMatch{Not: &AuthzMatch{Claims: []MatchHeader{{Name: "groups", Exact: "admin"}}}},
+			"!((!AAA.USER.IS_MEMBER_OF(\"cs1authn\") || " + jwtPayloadExpr + ".XPATH_JSON(xp%/groups%).EQ(\"admin\")))"},
+		{"no match", AuthzMatch{Or: []AuthzMatch{}}, "false"},
+	}
+	for _, c := range cases {
+		if rule := c.match.getMatchRule(getJwtVerifiedRule("cs1"), false); rule != c.rule {
+			t.Errorf("%s: expected %s, received %s", c.name, c.rule, rule)
+		}
+	}
+}
+
+func Test_AuthzRule_getDenyRule(t *testing.T) {
+	policies := []AuthzPolicy{
+		{Name: "p1", Permissions: []AuthzMatch{{Path: &MatchHeader{Exact: "/admin"}}}, Principals: []AuthzMatch{{Any: true}}},
+		{Name: "p2", Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{SourceIP: "10.1.1.1"}}},
+	}
+	cases := []struct {
+		name string
+		rule AuthzRule
+		deny string
+	}{
+		{"allow", AuthzRule{Action: AuthzAllow, Policies: policies}, "!(((HTTP.REQ.URL.PATH.EQ(\"/admin\") && true) || (true && CLIENT.IP.SRC.IN_SUBNET(10.1.1.1/32))))"},
+		{"allow nothing", AuthzRule{Action: AuthzAllow}, "!(false)"},
+		{"deny", AuthzRule{Action: AuthzDeny, Policies: policies[:1]}, "(HTTP.REQ.URL.PATH.EQ(\"/admin\") && true)"},
+		{"log", AuthzRule{Action: AuthzLog, Policies: policies}, ""},
+		{"deny request principal", AuthzRule{Action: AuthzDeny, Policies: []AuthzPolicy{{Name: "p3", Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{RequestPrincipal: &MatchHeader{Exact: "iss1/sub1"}}}}}},
+			"(true && (!AAA.USER.IS_MEMBER_OF(\"cs1authn\") || (" + jwtPayloadExpr + ".XPATH_JSON(xp%/iss%) + \"/\" + " + jwtPayloadExpr + ".XPATH_JSON(xp%/sub%)).EQ(\"iss1/sub1\")))"},
+	}
+	for _, c := range cases {
+		if deny := c.rule.getDenyRule(getJwtVerifiedRule("cs1")); deny != c.deny {
+			t.Errorf("%s: expected %s, received %s", c.name, c.deny, deny)
+		}
+	}
+}
+
+func Test_CSApi_authz(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("csauthz", "HTTP", "2.2.1.2", 80)
+	csObj.AuthzSpec = &AuthzSpec{Rules: []AuthzRule{
+		{Action: AuthzDeny, Policies: []AuthzPolicy{{Name: "deny-admin", Permissions: []AuthzMatch{{Path: &MatchHeader{Prefix: "/admin"}}}, Principals: []AuthzMatch{{Any: true}}}}},
+		{Action: AuthzAllow, Policies: []AuthzPolicy{{Name: "allow-internal", Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{SourceIP: "10.0.0.0/8"}}}}},
+		{Action: AuthzDeny, Shadow: true, Policies: []AuthzPolicy{{Name: "deny-get", Permissions: []AuthzMatch{{Headers: []MatchHeader{{Name: ":method", Exact: "GET"}}}}, Principals: []AuthzMatch{{Any: true}}}}},
+	}}
+	t.Logf("Test CSApi Add with authorization")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"responderaction", "csauthz_authz", map[string]interface{}{"name": "csauthz_authz", "type": "respondwith"}},
+		{"responderpolicylabel", "csauthz_authz", map[string]interface{}{"labelname": "csauthz_authz"}},
+		{"responderpolicy", "csauthz_authz_10", map[string]interface{}{"name": "csauthz_authz_10", "action": "csauthz_authz", "rule": "(HTTP.REQ.URL.PATH.STARTSWITH(\"/admin\") && true)"}},
+		{"responderpolicy", "csauthz_authz_20", map[string]interface{}{"name": "csauthz_authz_20", "action": "csauthz_authz", "rule": "!((true && CLIENT.IP.SRC.IN_SUBNET(10.0.0.0/8)))"}},
+		{"responderpolicylabel", "csauthz_authzlog", map[string]interface{}{"labelname": "csauthz_authzlog"}},
+		{"auditmessageaction", "csauthz_authzlog_10", map[string]interface{}{"name": "csauthz_authzlog_10"}},
+		{"responderpolicy", "csauthz_authzlog_10", map[string]interface{}{"name": "csauthz_authzlog_10", "action": "NOOP", "logaction": "csauthz_authzlog_10"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csauthz, error %v", err)
+	}
+	t.Logf("Test CSApi Update with shadow rule removed")
+	csObj.AuthzSpec.Rules = csObj.AuthzSpec.Rules[:1]
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"responderpolicy", "csauthz_authz_20", map[string]interface{}{"name": "csauthz_authz_20"}},
+		{"responderpolicylabel", "csauthz_authzlog", map[string]interface{}{"labelname": "csauthz_authzlog"}},
+		{"auditmessageaction", "csauthz_authzlog_10", map[string]interface{}{"name": "csauthz_authzlog_10"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale authorization of csauthz, error %v", err)
+	}
+	t.Logf("Test CSApi Delete with authorization")
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"responderaction", "csauthz_authz", map[string]interface{}{"name": "csauthz_authz"}},
+		{"responderpolicylabel", "csauthz_authz", map[string]interface{}{"labelname": "csauthz_authz"}},
+		{"responderpolicy", "csauthz_authz_10", map[string]interface{}{"name": "csauthz_authz_10"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete csauthz, error %v", err)
+	}
+}
+
+func Test_AuthzRule_requiresTLS(t *testing.T) {
+	cases := []struct {
+		name        string
+		rule        AuthzRule
+		requiresTLS bool
+	}{
+		{"source IP", AuthzRule{Action: AuthzAllow, Policies: []AuthzPolicy{{Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{SourceIP: "10.1.1.1"}}}}}, false},
+		{"principal", AuthzRule{Action: AuthzAllow, Policies: []AuthzPolicy{{Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{Or: []AuthzMatch{{SourceIP: "10.1.1.1"}, {Not: &AuthzMatch{Authenticated: true}}}}}}}}, true},
+		{"server name", AuthzRule{Action: AuthzDeny, Policies: []AuthzPolicy{{Permissions: []AuthzMatch{{ServerName: &MatchHeader{Suffix: ".internal"}}}, Principals: []AuthzMatch{{Any: true}}}}}, true},
+	}
+	for _, c := range cases {
+		if requiresTLS := c.rule.requiresTLS(); requiresTLS != c.requiresTLS {
+			t.Errorf("%s: expected %v, received %v", c.name, c.requiresTLS, requiresTLS)
+		}
+	}
+}
+
+func Test_CSApi_networkAuthz(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("csnetauthz", "SSL_TCP", "2.2.1.3", 9443)
+	csObj.AuthzSpec = &AuthzSpec{DenyResponse: "RESET", Rules: []AuthzRule{
+		{Action: AuthzAllow, Policies: []AuthzPolicy{{Name: "allow-internal", Permissions: []AuthzMatch{{DestinationPort: 9443}}, Principals: []AuthzMatch{{SourceIP: "10.0.0.0/8"}}}}},
+		{Action: AuthzDeny, Policies: []AuthzPolicy{{Name: "deny-sleep", Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{Authenticated: true, Principal: &MatchHeader{Exact: "spiffe://cluster.local/ns/default/sa/sleep"}}}}}},
+		{Action: AuthzLog, Policies: []AuthzPolicy{{Name: "log-external", Permissions: []AuthzMatch{{Any: true}}, Principals: []AuthzMatch{{Not: &AuthzMatch{SourceIP: "10.0.0.0/8"}}}}}},
+	}}
+	t.Logf("Test CSApi Add with connection authorization")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"csvserver", "csnetauthz", map[string]interface{}{"name": "csnetauthz", "listenpolicy": "!(!((CLIENT.TCP.DSTPORT.EQ(9443) && CLIENT.IP.SRC.IN_SUBNET(10.0.0.0/8))))"}},
+		{"sslpolicy", "csnetauthz_authz", map[string]interface{}{"name": "csnetauthz_authz", "action": "RESET"}},
+		{"responderpolicylabel", "csnetauthz_authzlog", map[string]interface{}{"labelname": "csnetauthz_authzlog", "policylabeltype": "OTHERTCP"}},
+		{"responderpolicy", "csnetauthz_authzlog_10", map[string]interface{}{"name": "csnetauthz_authzlog_10", "action": "NOOP", "rule": "true && !(CLIENT.IP.SRC.IN_SUBNET(10.0.0.0/8))"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csnetauthz, error %v", err)
+	}
+	t.Logf("Test CSApi Update without connection authorization")
+	csObj.AuthzSpec = nil
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	err = env.VerifyConfigBlockAbsence(client, []env.VerifyNitroConfig{{"sslpolicy", "csnetauthz_authz", map[string]interface{}{"name": "csnetauthz_authz"}},
+		{"responderpolicylabel", "csnetauthz_authzlog", map[string]interface{}{"labelname": "csnetauthz_authzlog"}}})
+	if err != nil {
+		t.Errorf("Config verification failed for stale connection authorization of csnetauthz, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+}
@@ -15,7 +15,10 @@ package nsconfigengine
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/citrix/adc-nitro-go/resource/config/cs"
@@ -44,10 +47,17 @@ type CSApi struct {
 	AllowACL              bool
 	FrontendTLS           []SSLSpec
 	FrontendTLSClientAuth bool
+	SSLProfile            *SSLProfileSpec
+	OCSPStapling          bool
 	DefaultLbVserverName  string
 	SSLForwarding         []SSLForwardSpec
 	AuthSpec              *AuthSpec
+	AuthzSpec             *AuthzSpec
+	ExtAuthzSpec          *ExtAuthzSpec
+	ForwardClientCert     *ForwardClientCertSpec
 	AnalyticsProfileNames []string //AnalyticsProfileNames specifies analytics profiles (webinsight and tcpinsight) required for opentracing purpose
+	AnalyticsSamplingRate int      //AnalyticsSamplingRate specifies the percentage of the requests exported by the analytics profiles, all if 0
+	AccessLogExprs        []string //AccessLogExprs specifies the expressions logged in audit messages for every request of HTTP and SSL vservers, and every connection of TCP and SSL_TCP vservers
 }
 
 //RewriteAction will define members which will be used to rewrite policy
@@ -57,6 +67,7 @@ type RewriteAction struct {
 	ActionStringBldrExp string
 	Bindpoint           string
 	Search              string
+	RegexSearch         string
 }
 
 //CsPolicyBinding will define members which will be used to configure cs policy
@@ -86,13 +97,20 @@ func (csObj *CSApi) Add(client *netscaler.NitroClient) error {
 	if csObj.AllowACL == true {
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsacl.Type(), csObj.Name, ns.Nsacl{Aclname: csObj.Name, Aclaction: "ALLOW", Priority: csObj.Port, Protocol: "tcp", Destip: true, Destipval: csObj.IP, Destport: true, Destportval: fmt.Sprint(csObj.Port)}, "add", "", "", ""}, nil, nil))
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsacls.Type(), "", ns.Nsacls{}, "apply", "", "", ""}, nil, nil))
-		// AllowACL flag also indicates if this is an inbound cs vserver or not. Bind analyticsprofiles this cs vserver
-		for _, profname := range csObj.AnalyticsProfileNames {
-			confErr.updateError(doNitro(client, nitroConfig{"csvserver_analyticsprofile_binding", csObj.Name, map[string]string{"name": csObj.Name, "analyticsprofile": profname}, "add", "", "", ""}, nil, nil))
-		}
 	}
+	// Analytics profiles are set for inbound cs vservers, and for those whose requests are logged by the log proxy.
+	// Profiles exporting a sample of the requests are set by the AppFlow policy of the vserver instead
+	analyticsProfileNames := csObj.AnalyticsProfileNames
+	if csObj.AnalyticsSamplingRate > 0 {
+		analyticsProfileNames = nil
+	}
+	for _, profname := range analyticsProfileNames {
+		confErr.updateError(doNitro(client, nitroConfig{"csvserver_analyticsprofile_binding", csObj.Name, map[string]string{"name": csObj.Name, "analyticsprofile": profname}, "add", "", "", ""}, nil, nil))
+	}
+	unbindStaleAnalyticsProfiles(client, csObj.Name, analyticsProfileNames, confErr)
+	updateVserverAnalyticsSampling(client, csObj.Name, csObj.AnalyticsProfileNames, csObj.AnalyticsSamplingRate, confErr)
 	if csObj.VserverType == "SSL" || csObj.VserverType == "SSL_TCP" {
-		addSSLVserver(client, csObj.Name, csObj.FrontendTLS, csObj.FrontendTLSClientAuth, confErr)
+		addSSLVserver(client, csObj.Name, csObj.FrontendTLS, csObj.FrontendTLSClientAuth, csObj.OCSPStapling, csObj.SSLProfile, confErr)
 	}
 	if csObj.DefaultLbVserverName != "" {
 		serviceType := "HTTP"
@@ -105,38 +123,100 @@ func (csObj *CSApi) Add(client *netscaler.NitroClient) error {
 
 	addSSLForwardSpec(client, csObj.Name, csObj.SSLForwarding, confErr)
 	updateVserverAuthSpec(client, csObj.Name, csObj.AuthSpec, confErr)
+	if csObj.VserverType == "HTTP" || csObj.VserverType == "SSL" {
+		updateVserverAuthzSpec(client, csObj.Name, csObj.AuthzSpec, confErr)
+		updateVserverExtAuthzSpec(client, csObj.Name, csObj.ExtAuthzSpec, confErr)
+		updateVserverForwardClientCertSpec(client, csObj.Name, csObj.ForwardClientCert, confErr)
+		updateVserverAccessLogs(client, csObj.Name, csObj.AccessLogExprs, confErr)
+	} else if csObj.VserverType == "TCP" || csObj.VserverType == "SSL_TCP" {
+		updateVserverNetworkAuthzSpec(client, csObj.Name, csObj.VserverType, csObj.AuthzSpec, confErr)
+		updateVserverTCPAccessLogs(client, csObj.Name, csObj.DefaultLbVserverName, csObj.AccessLogExprs, confErr)
+	}
 	return confErr.getError()
 }
 
+// unbindStaleAnalyticsProfiles unbinds the analytics profiles of the CS vserver other than analyticsProfileNames
+func unbindStaleAnalyticsProfiles(client *netscaler.NitroClient, csVserverName string, analyticsProfileNames []string, confErr *nitroError) {
+	bindings, err := client.FindResourceArray("csvserver_analyticsprofile_binding", csVserverName)
+	if err != nil {
+		return
+	}
+	profiles := make(map[string]bool, len(analyticsProfileNames))
+	for _, profileName := range analyticsProfileNames {
+		profiles[profileName] = true
+	}
+	for _, binding := range bindings {
+		profileName, err := getValueString(binding, "analyticsprofile")
+		if err != nil || profiles[profileName] {
+			continue
+		}
+		confErr.updateError(doNitro(client, nitroConfig{"csvserver_analyticsprofile_binding", csVserverName, map[string]string{"name": csVserverName, "analyticsprofile": profileName}, "delete", "", "", ""}, nil, nil))
+	}
+}
+
 // Delete method deletes a CS vserver
 func (csObj *CSApi) Delete(client *netscaler.NitroClient) error {
 	nsconfLogger.Trace("CSApi delete", "csObj", csObj)
 	confErr := newNitroError()
 	addSSLForwardSpec(client, csObj.Name, []SSLForwardSpec{}, confErr)
 	updateVserverAuthSpec(client, csObj.Name, csObj.AuthSpec, confErr)
+	updateVserverAuthzSpec(client, csObj.Name, nil, confErr)
+	authzSSLPolicyDelete(client, confErr, csObj.Name)
+	updateVserverExtAuthzSpec(client, csObj.Name, nil, confErr)
+	updateVserverForwardClientCertSpec(client, csObj.Name, nil, confErr)
+	updateVserverAccessLogs(client, csObj.Name, nil, confErr)
+	updateVserverTCPAccessLogs(client, csObj.Name, "", nil, confErr)
+	updateVserverAnalyticsSampling(client, csObj.Name, nil, 0, confErr)
 	csBindings := NewCSBindingsAPI(csObj.Name)
 	csBindings.deleteState(client, confErr)
+	deletePatSet(client, confErr, getDomainsPatsetName(csObj.Name))
+	limitIdentifiersDelete(client, confErr, csObj.Name, 0)
+	limitIdentifiersDelete(client, confErr, getGlobalLimitPrefix(csObj.Name), 0)
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsacl.Type(), csObj.Name, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsacls.Type(), "", ns.Nsacls{}, "apply", "", "", ""}, nil, nil))
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver.Type(), csObj.Name, nil, "delete", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslprofile.Type(), getSSLProfileName(csObj.Name), nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 	return confErr.getError()
 }
 
-// MatchHeader specifies a policy header match rule
+// MatchRange specifies an integer range [Start, End) for a header match rule
+type MatchRange struct {
+	Start int64
+	End   int64
+}
+
+// MatchHeader specifies a policy header match rule.
+// Same structure is used for query parameter match rules, where Name is the query parameter name and Range is not applicable.
+// Present matches if the header/query parameter exists. Invert negates the complete match rule of the header.
 type MatchHeader struct {
-	Name   string
-	Exact  string
-	Prefix string
-	Regex  string
+	Name       string
+	Exact      string
+	Prefix     string
+	Suffix     string
+	Contains   string
+	Regex      string
+	Range      *MatchRange
+	Present    bool
+	IgnoreCase bool
+	Invert     bool
 }
 
 // RouteMatch specifies a policy match rule
+// CaseInsensitive applies to Prefix and Path match only.
+// Claims match the claims of the JWT, where the Name of a claim is its path with nested claims separated by '/'.
+// Request whose JWT is not verified by the authentication vserver of the CS vserver matches only the inverted claims
 type RouteMatch struct {
-	Domains []string
-	Prefix  string
-	Path    string
-	Regex   string
-	Headers []MatchHeader
+	Domains         []string
+	Prefix          string
+	Path            string
+	Regex           string
+	CaseInsensitive bool
+	Headers         []MatchHeader
+	QueryParameters []MatchHeader
+	Claims          []MatchHeader
+	excludedDomains []string // Wildcard domains of the virtual hosts selected before the one of the route
+	excludedPatset  string   // Patset of the exact domains of the virtual hosts, selected before any wildcard domain
+	jwtVerifiedRule string   // Claims are matched only if the JWT is verified as per this rule
 }
 
 func (match *RouteMatch) getMatchRule() string {
@@ -144,24 +224,36 @@ func (match *RouteMatch) getMatchRule() string {
 	if match.getPolicyRuleForDomain() != "" {
 		matchRule = append(matchRule, match.getPolicyRuleForDomain())
 	}
+	urlExpr := "HTTP.REQ.URL"
+	if match.CaseInsensitive {
+		urlExpr = urlExpr + ".SET_TEXT_MODE(IGNORECASE)"
+	}
 	if match.Prefix != "" {
-		matchRule = append(matchRule, "HTTP.REQ.URL.Startswith(\""+match.Prefix+"\")")
+		matchRule = append(matchRule, urlExpr+".Startswith(\""+match.Prefix+"\")")
 	}
 	if match.Path != "" {
-		matchRule = append(matchRule, "HTTP.REQ.URL.EQ(\""+match.Path+"\")")
+		matchRule = append(matchRule, urlExpr+".EQ(\""+match.Path+"\")")
 	}
 	if match.Regex != "" {
-		matchRule = append(matchRule, "HTTP.REQ.URL.REGEX_MATCH(re/"+match.Regex+"/)")
+		matchRule = append(matchRule, "HTTP.REQ.URL.REGEX_MATCH("+getNSRegex(match.Regex)+")")
 	}
 	for _, header := range match.Headers {
-		if header.Exact != "" {
-			matchRule = append(matchRule, "HTTP.REQ.HEADER(\""+header.Name+"\").EQ(\""+header.Exact+"\")")
+		if headerRule := header.getHeaderMatchRule(); headerRule != "" {
+			matchRule = append(matchRule, headerRule)
 		}
-		if header.Prefix != "" {
-			matchRule = append(matchRule, "HTTP.REQ.HEADER(\""+header.Name+"\").STARTSWITH(\""+header.Prefix+"\")")
+	}
+	for _, param := range match.QueryParameters {
+		paramExpr := "HTTP.REQ.URL.QUERY.VALUE(\"" + param.Name + "\")"
+		// Query parameter is present even if it has no value, as in "?debug"
+		presenceExpr := "HTTP.REQ.URL.QUERY.REGEX_MATCH(" + getNSRegex("(^|&)"+regexp.QuoteMeta(param.Name)+"(=|&|$)") + ")"
+		if paramRule := param.getMatchRule(paramExpr, presenceExpr); paramRule != "" {
+			matchRule = append(matchRule, paramRule)
 		}
-		if header.Regex != "" {
-			matchRule = append(matchRule, "HTTP.REQ.HEADER(\""+header.Name+"\").REGEX_MATCH(re/"+header.Regex+"/)")
+	}
+	for _, claim := range match.Claims {
+		claimExpr := getJwtClaimExpr(claim.Name)
+		if claimRule := claim.getMatchRule(claimExpr, claimExpr+".LENGTH.GT(0)"); claimRule != "" {
+			matchRule = append(matchRule, getJwtMatchRule(claimRule, match.jwtVerifiedRule, claim.Invert))
 		}
 	}
 	if len(matchRule) == 0 {
@@ -170,14 +262,189 @@ func (match *RouteMatch) getMatchRule() string {
 	return "(" + strings.Join(matchRule, " && ") + ")"
 }
 
-func (match *RouteMatch) getPolicyRuleForDomain() string {
+// getHeaderMatchRule returns the match rule for a header.
+// Envoy's pseudo-headers are mapped to the equivalent ADC expressions
+func (header *MatchHeader) getHeaderMatchRule() string {
+	switch header.Name {
+	case ":scheme":
+		return header.invertRule(header.getSchemeMatchRule())
+	case ":method":
+		return header.getMatchRule("HTTP.REQ.METHOD", "true")
+	case ":authority":
+		return header.getMatchRule("HTTP.REQ.HOSTNAME", "true")
+	case ":path":
+		return header.getMatchRule("HTTP.REQ.URL", "true")
+	}
+	headerExpr := "HTTP.REQ.HEADER(\"" + header.Name + "\")"
+	return header.getMatchRule(headerExpr, headerExpr+".EXISTS")
+}
+
+// getMatchRule returns the match rule for the text returned by textExpr. presenceExpr is used for the Present match
+func (header *MatchHeader) getMatchRule(textExpr, presenceExpr string) string {
+	rules := make([]string, 0)
+	if header.Present {
+		rules = append(rules, presenceExpr)
+	}
+	matchExpr := textExpr
+	if header.IgnoreCase {
+		matchExpr = matchExpr + ".SET_TEXT_MODE(IGNORECASE)"
+	}
+	if header.Exact != "" {
+		rules = append(rules, matchExpr+".EQ(\""+header.Exact+"\")")
+	}
+	if header.Prefix != "" {
+		rules = append(rules, matchExpr+".STARTSWITH(\""+header.Prefix+"\")")
+	}
+	if header.Suffix != "" {
+		rules = append(rules, matchExpr+".ENDSWITH(\""+header.Suffix+"\")")
+	}
+	if header.Contains != "" {
+		rules = append(rules, matchExpr+".CONTAINS(\""+header.Contains+"\")")
+	}
+	if header.Regex != "" {
+		rules = append(rules, textExpr+".REGEX_MATCH("+getNSRegex(header.Regex)+")")
+	}
+	if header.Range != nil {
+		rules = append(rules, textExpr+".TYPECAST_NUM_T(DECIMAL).GE("+fmt.Sprint(header.Range.Start)+")")
+		rules = append(rules, textExpr+".TYPECAST_NUM_T(DECIMAL).LT("+fmt.Sprint(header.Range.End)+")")
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return header.invertRule(strings.Join(rules, " && "))
+}
+
+func (header *MatchHeader) invertRule(rule string) string {
+	if header.Invert && rule != "" {
+		return "!(" + rule + ")"
+	}
+	return rule
+}
+
+// getSchemeMatchRule evaluates the scheme match against http and https,
+// as ADC does not provide the scheme as text. Scheme is https only for SSL connections
+func (header *MatchHeader) getSchemeMatchRule() string {
+	httpMatch := header.matchesValue("http")
+	httpsMatch := header.matchesValue("https")
+	switch {
+	case httpMatch && httpsMatch:
+		return "true"
+	case httpsMatch:
+		return "CLIENT.SSL.IS_SSL"
+	case httpMatch:
+		return "CLIENT.SSL.IS_SSL.NOT"
+	}
+	return "false"
+}
+
+func (header *MatchHeader) matchesValue(value string) bool {
+	exact, prefix, suffix, contains := header.Exact, header.Prefix, header.Suffix, header.Contains
+	if header.IgnoreCase {
+		value, exact, prefix, suffix, contains = strings.ToLower(value), strings.ToLower(exact), strings.ToLower(prefix), strings.ToLower(suffix), strings.ToLower(contains)
+	}
+	if header.Range != nil {
+		return false
+	}
+	if exact != "" && value != exact {
+		return false
+	}
+	if !strings.HasPrefix(value, prefix) || !strings.HasSuffix(value, suffix) || !strings.Contains(value, contains) {
+		return false
+	}
+	if header.Regex != "" {
+		matched, err := regexp.MatchString("^(?:"+header.Regex+")$", value)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// getNSRegex returns the regex in Citrix ADC's re<delimiter>regex<delimiter> format.
+// Delimiter is chosen such that it is not part of the regex, as paths mostly contain '/'.
+// If the regex contains all the delimiters, its unescaped '/' are escaped, which matches the same
+func getNSRegex(regex string) string {
+	for _, delimiter := range []string{"/", "#", "~", "|", "@", "%", "!", ";", ":", "^", "&", "="} {
+		if !strings.Contains(regex, delimiter) {
+			return "re" + delimiter + regex + delimiter
+		}
+	}
+	var escapedRegex strings.Builder
+	escaped := false
+	for _, char := range regex {
+		if char == '/' && !escaped {
+			escapedRegex.WriteRune('\\')
+		}
+		escaped = char == '\\' && !escaped
+		escapedRegex.WriteRune(char)
+	}
+	return "re/" + escapedRegex.String() + "/"
+}
+
+// getExprString returns the text as a string literal of Citrix ADC expression
+func getExprString(text string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(text) + "\""
+}
+
+// Virtual host domain match types in the order of Envoy's domain search precedence
+const (
+	domainExactMatch = iota
+	domainSuffixMatch
+	domainPrefixMatch
+	domainAnyMatch
+)
+
+// normalizeDomain returns the lower-cased domain without the port, as the Host header port is not considered for matching
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(domain)
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		return host
+	}
+	return domain
+}
+
+func getDomainMatchType(domain string) int {
+	if domain == "*" {
+		return domainAnyMatch
+	} else if strings.HasPrefix(domain, "*") {
+		return domainSuffixMatch
+	} else if strings.HasSuffix(domain, "*") {
+		return domainPrefixMatch
+	}
+	return domainExactMatch
+}
+
+// getDomainMatchRule returns the match rule for a normalized domain.
+// Wildcard must match at least one character as per Envoy
+func getDomainMatchRule(domain string) string {
+	hostExpr := "HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE)"
+	switch getDomainMatchType(domain) {
+	case domainAnyMatch:
+		return "true"
+	case domainSuffixMatch:
+		suffix := strings.TrimPrefix(domain, "*")
+		return "(" + hostExpr + ".ENDSWITH(\"" + suffix + "\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(" + fmt.Sprint(len(suffix)) + "))"
+	case domainPrefixMatch:
+		prefix := strings.TrimSuffix(domain, "*")
+		return "(" + hostExpr + ".STARTSWITH(\"" + prefix + "\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(" + fmt.Sprint(len(prefix)) + "))"
+	}
+	return hostExpr + ".EQ(\"" + domain + "\")"
+}
+
+// getDomainsMatchRule returns the match rule for any of the domains, or empty rule if the domains match any host
+func getDomainsMatchRule(domains []string) string {
 	policyDomains := make([]string, 0)
-	for _, domain := range match.Domains {
-		if strings.Contains(domain, "*") {
-			policyDomains = append(policyDomains, "HTTP.REQ.HOSTNAME.REGEX_MATCH(re/"+strings.Replace(domain, "*", ".*", -1)+"/)")
-		} else {
-			policyDomains = append(policyDomains, "HTTP.REQ.HOSTNAME.CONTAINS(\""+domain+"\")")
+	seenDomains := make(map[string]bool)
+	for _, domain := range domains {
+		domain = normalizeDomain(domain)
+		if domain == "*" {
+			return ""
 		}
+		if seenDomains[domain] {
+			continue
+		}
+		seenDomains[domain] = true
+		policyDomains = append(policyDomains, getDomainMatchRule(domain))
 	}
 	if len(policyDomains) > 0 {
 		return "(" + strings.Join(policyDomains, " || ") + ")"
@@ -185,6 +452,29 @@ func (match *RouteMatch) getPolicyRuleForDomain() string {
 	return ""
 }
 
+// getPolicyRuleForDomain returns the match rule for the domains of the virtual host.
+// Hosts matching the domains of the virtual hosts which Envoy selects before it are not matched. Exact domains are looked up
+// in a patset, so that the rule does not grow with the number of virtual hosts
+func (match *RouteMatch) getPolicyRuleForDomain() string {
+	domainRule := getDomainsMatchRule(match.Domains)
+	excludedRule := getDomainsMatchRule(match.excludedDomains)
+	if match.excludedPatset != "" {
+		patsetRule := "HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQUALS_ANY(\"" + match.excludedPatset + "\")"
+		if excludedRule == "" {
+			excludedRule = patsetRule
+		} else {
+			excludedRule = "(" + patsetRule + " || " + excludedRule + ")"
+		}
+	}
+	if excludedRule == "" {
+		return domainRule
+	}
+	if domainRule == "" {
+		return "!" + excludedRule
+	}
+	return "(" + domainRule + " && !" + excludedRule + ")"
+}
+
 // Fault specifies the fault testing to be introduced to the outbound traffic
 type Fault struct {
 	AbortPercent    int
@@ -193,12 +483,62 @@ type Fault struct {
 	DelaySeconds    int
 }
 
-// PersistencyPolicy speficies the persistency rules to be applied by an LB vserver entity while forwarding packets to backend services
+// PersistencyPolicy speficies the persistency rules to be applied by an LB vserver entity while forwarding packets to backend services.
+// If ConsistentHash is set, the LB vserver instead balances the requests by the hash of the header, cookie, query parameter or source IP
 type PersistencyPolicy struct {
-	HeaderName string
-	CookieName string
-	Timeout    int
-	SourceIP   bool
+	HeaderName     string
+	CookieName     string
+	QueryParameter string
+	Timeout        int
+	SourceIP       bool
+	ConsistentHash bool
+}
+
+// setLbvserver sets the persistence, or the hash based LB method, of the LB vserver
+func (persistency *PersistencyPolicy) setLbvserver(lbObj *lb.Lbvserver) {
+	if persistency.ConsistentHash {
+		switch {
+		case strings.EqualFold(persistency.HeaderName, ":path"):
+			lbObj.Lbmethod = "URLHASH"
+			return
+		case strings.EqualFold(persistency.HeaderName, ":authority") || strings.EqualFold(persistency.HeaderName, "host"):
+			lbObj.Lbmethod = "DOMAINHASH"
+			return
+		case persistency.HeaderName != "":
+			lbObj.Lbmethod = "TOKEN"
+			lbObj.Rule = "HTTP.REQ.HEADER(\"" + persistency.HeaderName + "\")"
+			return
+		case persistency.CookieName != "":
+			if persistency.Timeout == 0 {
+				lbObj.Lbmethod = "TOKEN"
+				lbObj.Rule = "HTTP.REQ.COOKIE.VALUE(\"" + persistency.CookieName + "\")"
+				return
+			}
+			// Cookie generated by Envoy if absent is equivalent to the cookie inserted by the persistence
+			lbObj.Lbmethod = "ROUNDROBIN"
+		case persistency.QueryParameter != "":
+			lbObj.Lbmethod = "TOKEN"
+			lbObj.Rule = "HTTP.REQ.URL.QUERY.VALUE(\"" + persistency.QueryParameter + "\")"
+			return
+		case persistency.SourceIP:
+			lbObj.Lbmethod = "SOURCEIPHASH"
+			return
+		default:
+			// Envoy hashes the requests randomly if no hash policy applies
+			lbObj.Lbmethod = "ROUNDROBIN"
+			return
+		}
+	}
+	if persistency.HeaderName != "" {
+		lbObj.Persistencetype = "RULE"
+		lbObj.Rule = "HTTP.REQ.HEADER(\"" + persistency.HeaderName + "\")"
+	} else if persistency.CookieName != "" {
+		lbObj.Persistencetype = "COOKIEINSERT"
+		lbObj.Cookiename = persistency.CookieName
+		lbObj.Timeout = persistency.Timeout
+	} else if persistency.SourceIP == true {
+		lbObj.Persistencetype = "SOURCEIP"
+	}
 }
 
 // Canary specifies a means of splitting traffic between one or more versions of a service
@@ -222,10 +562,13 @@ type RwHeader struct {
 }
 
 // RewritePolicy specifies a rewrite operation to be made on an HTTP packet
+// RegexRewritePattern and RegexRewriteSubstitution replace every match of the pattern in the request path
 type RewritePolicy struct {
-	PrefixRewrite string
-	HostRewrite   string
-	AddHeaders    []RwHeader
+	PrefixRewrite            string
+	RegexRewritePattern      string
+	RegexRewriteSubstitution string
+	HostRewrite              string
+	AddHeaders               []RwHeader
 }
 
 // ResponderPolicy specifies how to respond to an HTTP request
@@ -245,6 +588,7 @@ type HTTPCalloutPolicy struct {
 }
 
 //HTTPMirror will mirror the traffic
+//Weight is the percentage of requests to be mirrored
 type HTTPMirror struct {
 	Callout *HTTPCalloutPolicy
 	Weight  int
@@ -252,12 +596,14 @@ type HTTPMirror struct {
 
 // CSBinding specifies the CS, RW or Responder action to be taken for a route match and the fault that needs to be introduced before taking the action
 type CSBinding struct {
-	Rule         RouteMatch
-	Fault        Fault
-	CsPolicy     CsPolicy
-	RwPolicy     RewritePolicy
-	ResPolicy    ResponderPolicy
-	MirrorPolicy *HTTPMirror
+	Rule            RouteMatch
+	Fault           Fault
+	CsPolicy        CsPolicy
+	RwPolicy        RewritePolicy
+	ResPolicy       ResponderPolicy
+	MirrorPolicies  []*HTTPMirror
+	RateLimit       *RateLimit
+	GlobalRateLimit *RateLimit
 }
 
 //NewHTTPCalloutPolicy returns a NewHTTPCallout object
@@ -281,6 +627,15 @@ func (csBindings *CSBindingsAPI) mirrorPolicyAdd(client *netscaler.NitroClient,
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver_rewritepolicy_binding.Type(), callout.LbVserverName, lb.Lbvserverrewritepolicybinding{Name: callout.LbVserverName, Policyname: callout.LbVserverName, Priority: rwPolicyStartPriority, Bindpoint: "REQUEST", Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
 }
 
+// getMirrorCalloutName returns the name of HTTP callout for the index'th mirror policy of a cs policy
+// First mirror policy retains the name used when only a single mirror policy was supported
+func getMirrorCalloutName(policyName string, index int) string {
+	if index == 0 {
+		return GetNSCompatibleNameByLen(policyName+"_call_Mirror", 31)
+	}
+	return GetNSCompatibleNameByLen(policyName+"_call_Mirror"+fmt.Sprint(index), 31)
+}
+
 func mirrorPolicyDeleteWithLBvserver(client *netscaler.NitroClient, confErr *nitroError, policyName, vserver string) {
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Policyhttpcallout.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver_rewritepolicy_binding.Type(), vserver, map[string]string{"name": vserver, "policyname": vserver}, "delete", "", "", ""}, []string{"No such resource"}, nil))
@@ -290,17 +645,27 @@ func mirrorPolicyDeleteWithLBvserver(client *netscaler.NitroClient, confErr *nit
 	lbObj.Delete(client)
 }
 
-func (csBindings *CSBindingsAPI) mirrorPolicyDelete(client *netscaler.NitroClient, confErr *nitroError, policyName string) {
-	mirrorPolicy := GetNSCompatibleNameByLen(policyName+"_call_Mirror", 31)
-	calloutPolicy, err := client.FindResourceArray(netscaler.Policyhttpcallout.Type(), mirrorPolicy)
-	if err == nil {
-		for _, callout := range calloutPolicy {
-			vserver := callout["vserver"].(string)
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_cspolicy_binding.Type(), csBindings.Name, map[string]string{"name": csBindings.Name, "policyname": policyName}, "delete", "", "", ""}, nil, nil))
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), policyName, nil, "delete", "", "", ""}, nil, nil))
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Csaction.Type(), policyName, nil, "delete", "", "", ""}, nil, nil))
-			mirrorPolicyDeleteWithLBvserver(client, confErr, mirrorPolicy, vserver)
+// mirrorCalloutsDelete deletes the HTTP callouts (and associated mirror config) of a cs policy starting from startIndex
+func mirrorCalloutsDelete(client *netscaler.NitroClient, confErr *nitroError, policyName string, startIndex int) {
+	for index := startIndex; ; index++ {
+		mirrorPolicy := getMirrorCalloutName(policyName, index)
+		calloutPolicy, err := client.FindResource(netscaler.Policyhttpcallout.Type(), mirrorPolicy)
+		if err != nil {
+			return
 		}
+		mirrorPolicyDeleteWithLBvserver(client, confErr, mirrorPolicy, calloutPolicy["vserver"].(string))
+	}
+}
+
+// mirrorPolicyDelete deletes the stale mirror callouts of a cs policy, i.e. the ones from index staleIndex onwards.
+// CS policy referring to the callouts is deleted first, and is expected to be added again by the caller
+func (csBindings *CSBindingsAPI) mirrorPolicyDelete(client *netscaler.NitroClient, confErr *nitroError, policyName string, staleIndex int) {
+	_, err := client.FindResource(netscaler.Policyhttpcallout.Type(), getMirrorCalloutName(policyName, staleIndex))
+	if err == nil {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_cspolicy_binding.Type(), csBindings.Name, map[string]string{"name": csBindings.Name, "policyname": policyName}, "delete", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), policyName, nil, "delete", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csaction.Type(), policyName, nil, "delete", "", "", ""}, nil, nil))
+		mirrorCalloutsDelete(client, confErr, policyName, staleIndex)
 	}
 }
 
@@ -353,6 +718,8 @@ func (csBindings *CSBindingsAPI) rewritePolicyAdd(client *netscaler.NitroClient,
 		}
 		rewritepolinfo.ActionStringBldrExp = "\"" + rewritepolinfo.ActionStringBldrExp + "\""
 		rewritepolinfo.Search = "text(\"" + rewritepolinfo.Search + "\")"
+	} else if rewritepolinfo.RegexSearch != "" {
+		rewritepolinfo.Search = "regex(" + getNSRegex(rewritepolinfo.RegexSearch) + ")"
 	}
 	// Action update can fail if it is of different type. In this case unbind policy, delete policy, delete action and add action again
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewriteaction.Type(), rwEntityName,
@@ -367,21 +734,12 @@ func (csBindings *CSBindingsAPI) rewritePolicyAdd(client *netscaler.NitroClient,
 	csBindings.curRwPriority = csBindings.curRwPriority + 10
 }
 
-func (csBindings *CSBindingsAPI) csPolicyAdd(client *netscaler.NitroClient, confErr *nitroError, csactpolinfo *CsPolicyBinding, persistency *PersistencyPolicy, mirror *HTTPMirror) {
+func (csBindings *CSBindingsAPI) csPolicyAdd(client *netscaler.NitroClient, confErr *nitroError, csactpolinfo *CsPolicyBinding, persistency *PersistencyPolicy, mirrors []*HTTPMirror) {
 	/* LBVserver ns_dummy_http is bound to CS Vserver for Redirect case where ResponderPolicy will be hit post selection of Vserver*/
 	if (len(csactpolinfo.TargetLB) > 0) && csactpolinfo.TargetLB != "ns_dummy_http" {
 		lbObj := lb.Lbvserver{Name: csactpolinfo.TargetLB, Servicetype: csactpolinfo.ServiceType, Persistencetype: "NONE", Timeout: 2}
 		if persistency != nil {
-			if persistency.HeaderName != "" {
-				lbObj.Persistencetype = "RULE"
-				lbObj.Rule = "HTTP.REQ.HEADER(\"" + persistency.HeaderName + "\")"
-			} else if persistency.CookieName != "" {
-				lbObj.Persistencetype = "COOKIEINSERT"
-				lbObj.Cookiename = persistency.CookieName
-				lbObj.Timeout = persistency.Timeout
-			} else if persistency.SourceIP == true {
-				lbObj.Persistencetype = "SOURCEIP"
-			}
+			persistency.setLbvserver(&lbObj)
 		}
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), csactpolinfo.TargetLB, lbObj, "add", "", "", ""}, nil, nil))
 	}
@@ -393,16 +751,20 @@ func (csBindings *CSBindingsAPI) csPolicyAdd(client *netscaler.NitroClient, conf
 		if csactpolinfo.WeightPercent != defaultMirrorWeight {
 			policyRule = "(" + policyRule + " && sys.random.mul(100).lt(" + fmt.Sprint(csactpolinfo.WeightPercent) + "))"
 		}
-		mirrorCallout := GetNSCompatibleNameByLen(csBoundEntityName+"_call_Mirror", 31)
-		if mirror != nil {
+		csBindings.mirrorPolicyDelete(client, confErr, csBoundEntityName, len(mirrors))
+		mirrorRules := make([]string, 0)
+		for index, mirror := range mirrors {
+			mirrorCallout := getMirrorCalloutName(csBoundEntityName, index)
 			csBindings.mirrorPolicyAdd(client, confErr, mirror.Callout, mirrorCallout)
-			if mirror.Weight != 100 {
-				/* TODO: Mirror Weight Support*/
+			if mirror.Weight != defaultMirrorWeight {
+				// Callout is skipped for (100 - Weight) percent of requests. Rule evaluates to true in either case
+				mirrorRules = append(mirrorRules, "(sys.random.mul(100).ge("+fmt.Sprint(mirror.Weight)+") || sys.non_blocking_http_callout("+mirrorCallout+"))")
 			} else {
-				policyRule = "(" + policyRule + " && (sys.non_blocking_http_callout(" + mirrorCallout + ")))"
+				mirrorRules = append(mirrorRules, "(sys.non_blocking_http_callout("+mirrorCallout+"))")
 			}
-		} else {
-			csBindings.mirrorPolicyDelete(client, confErr, csBoundEntityName)
+		}
+		if len(mirrorRules) > 0 {
+			policyRule = "(" + policyRule + " && " + strings.Join(mirrorRules, " && ") + ")"
 		}
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csaction.Type(), csBoundEntityName, cs.Csaction{Name: csBoundEntityName, Targetlbvserver: csactpolinfo.TargetLB, Targetvserverexpr: csactpolinfo.TargetVserverExpr}, "add", "", "", ""}, nil, nil))
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), csBoundEntityName, cs.Cspolicy{Policyname: csBoundEntityName, Rule: policyRule, Action: csBoundEntityName}, "add", "", "", ""}, nil, nil))
@@ -412,17 +774,141 @@ func (csBindings *CSBindingsAPI) csPolicyAdd(client *netscaler.NitroClient, conf
 	}
 }
 
+// getDomainsPatsetName returns the name of the patset of the exact domains of the virtual hosts of the CS vserver
+func getDomainsPatsetName(csVserverName string) string {
+	return GetNSCompatibleNameByLen(csVserverName+"_domains", 127)
+}
+
+// domainsPatsetUpdate binds the exact domains to the patset of the CS vserver, and unbinds the stale ones.
+// Patset is added only if there are domains to be bound, and is kept empty otherwise as the existing policies may refer to it
+func (csBindings *CSBindingsAPI) domainsPatsetUpdate(client *netscaler.NitroClient, confErr *nitroError, domains []string) {
+	patsetName := getDomainsPatsetName(csBindings.Name)
+	boundDomains := make(map[string]bool)
+	if bindings, err := client.FindResourceArray(netscaler.Policypatset_pattern_binding.Type(), patsetName); err == nil {
+		for _, binding := range bindings {
+			if domain, err := getValueString(binding, "String"); err == nil {
+				boundDomains[domain] = true
+			}
+		}
+	} else if len(domains) > 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset.Type(), patsetName, policy.Policypatset{Name: patsetName}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	}
+	for _, domain := range domains {
+		if boundDomains[domain] {
+			delete(boundDomains, domain)
+			continue
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset_pattern_binding.Type(), patsetName, policy.Policypatsetpatternbinding{Name: patsetName, String: domain}, "add", "", "", ""}, nil, nil))
+	}
+	for domain := range boundDomains {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policypatset.Type(), patsetName, nil, "unbind", "pattern", domain, "String"}, nil, nil))
+	}
+}
+
+// getOrderedBindings returns the bindings in the order of Envoy's virtual host selection: exact domains first,
+// followed by suffix wildcards, prefix wildcards (longest wildcard first) and the '*' domain.
+// A binding whose domains fall in different groups is split into one binding per group.
+// Order of the bindings within a group is retained, and the bindings exclude the domains of the earlier groups.
+// Exact domains, excluded with the patset of the CS vserver, are returned along with the bindings
+func (csBindings *CSBindingsAPI) getOrderedBindings() ([]CSBinding, []string) {
+	type domainGroup struct {
+		matchType int
+		length    int
+	}
+	groupBindings := make(map[domainGroup][]CSBinding)
+	groups := make([]domainGroup, 0)
+	for _, csBinding := range csBindings.Bindings {
+		groupDomains := make(map[domainGroup][]string)
+		bindingGroups := make([]domainGroup, 0)
+		for _, domain := range csBinding.Rule.Domains {
+			group := domainGroup{matchType: getDomainMatchType(normalizeDomain(domain))}
+			if group.matchType == domainSuffixMatch || group.matchType == domainPrefixMatch {
+				group.length = len(normalizeDomain(domain))
+			}
+			if _, ok := groupDomains[group]; !ok {
+				bindingGroups = append(bindingGroups, group)
+			}
+			groupDomains[group] = append(groupDomains[group], domain)
+		}
+		if len(bindingGroups) == 0 {
+			bindingGroups = append(bindingGroups, domainGroup{matchType: domainAnyMatch})
+		}
+		for _, group := range bindingGroups {
+			groupBinding := csBinding
+			if len(csBinding.Rule.Domains) > 0 {
+				groupBinding.Rule.Domains = groupDomains[group]
+			}
+			if _, ok := groupBindings[group]; !ok {
+				groups = append(groups, group)
+			}
+			groupBindings[group] = append(groupBindings[group], groupBinding)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].matchType != groups[j].matchType {
+			return groups[i].matchType < groups[j].matchType
+		}
+		return groups[i].length > groups[j].length
+	})
+	// Envoy selects exactly one virtual host for a host, so a host matching the domains of a group never falls through to the routes of later groups
+	orderedBindings := make([]CSBinding, 0, len(csBindings.Bindings))
+	exactDomains := make([]string, 0)
+	excludedDomains := make([]string, 0)
+	seenDomains := make(map[string]bool)
+	for _, group := range groups {
+		groupExcludedDomains := excludedDomains[:len(excludedDomains):len(excludedDomains)]
+		excludedPatset := ""
+		if len(exactDomains) > 0 {
+			excludedPatset = getDomainsPatsetName(csBindings.Name)
+		}
+		for _, groupBinding := range groupBindings[group] {
+			groupBinding.Rule.excludedDomains = groupExcludedDomains
+			groupBinding.Rule.excludedPatset = excludedPatset
+			groupBinding.Rule.jwtVerifiedRule = getJwtVerifiedRule(csBindings.Name)
+			orderedBindings = append(orderedBindings, groupBinding)
+			for _, domain := range groupBinding.Rule.Domains {
+				domain = normalizeDomain(domain)
+				if seenDomains[domain] {
+					continue
+				}
+				seenDomains[domain] = true
+				if group.matchType == domainExactMatch {
+					exactDomains = append(exactDomains, domain)
+				} else {
+					excludedDomains = append(excludedDomains, domain)
+				}
+			}
+		}
+	}
+	return orderedBindings, exactDomains
+}
+
 // Add method binds/updates policies to a CS vserver
 func (csBindings *CSBindingsAPI) Add(client *netscaler.NitroClient) error {
 	nsconfLogger.Trace("CSBindingsAPI add", "csBindings", csBindings)
 	confErr := newNitroError()
 	rewritepolinfo := new(RewriteAction)
-	for _, csBinding := range csBindings.Bindings {
+	sharedLimitCount := 0
+	globalLimitCount := 0
+	orderedBindings, exactDomains := csBindings.getOrderedBindings()
+	// Patset is updated before the policies referring to it
+	csBindings.domainsPatsetUpdate(client, confErr, exactDomains)
+	for _, csBinding := range orderedBindings {
 		curPolicyRule := csBinding.Rule.getMatchRule()
 		curDelayRule := ""
 		if csBinding.Fault.AbortPercent != 0 {
 			csBindings.responderPolicyAdd(client, confErr, "(("+curPolicyRule+")"+" && sys.random.mul(100).lt("+fmt.Sprint(csBinding.Fault.AbortPercent)+"))", "respondwith", "\"HTTP/1.1 "+fmt.Sprint(csBinding.Fault.AbortHTTPStatus)+" "+http.StatusText(csBinding.Fault.AbortHTTPStatus)+"\r\n\r\n\"", 0)
 		}
+		if csBinding.RateLimit != nil {
+			if limitCount := csBindings.rateLimitPolicyAdd(client, confErr, curPolicyRule, csBinding.RateLimit, csBindings.Name); limitCount > sharedLimitCount {
+				sharedLimitCount = limitCount
+			}
+		}
+		if csBinding.GlobalRateLimit != nil {
+			if limitCount := csBindings.rateLimitPolicyAdd(client, confErr, curPolicyRule, csBinding.GlobalRateLimit, getGlobalLimitPrefix(csBindings.Name)); limitCount > globalLimitCount {
+				globalLimitCount = limitCount
+			}
+		}
 		bindingName := csBindings.Name + "_" + fmt.Sprint(csBindings.curCsPriority)
 		httpCalloutName := GetNSCompatibleNameByLen(bindingName+"_call_Delay", 31)
 		if csBinding.Fault.DelayPercent != 0 {
@@ -438,13 +924,41 @@ func (csBindings *CSBindingsAPI) Add(client *netscaler.NitroClient) error {
 			}
 		}
 		rewritepolinfo.Bindpoint = "REQUEST"
-		if csBinding.RwPolicy.PrefixRewrite != "" && csBinding.Rule.Prefix != "" {
+		if csBinding.RwPolicy.PrefixRewrite != "" {
+			rewritepolinfo.RegexSearch = ""
+			if csBinding.Rule.Prefix != "" {
+				rewritepolinfo.ActionType = "replace_all"
+				rewritepolinfo.ActionTarget = "http.REQ.URL"
+				rewritepolinfo.ActionStringBldrExp = csBinding.RwPolicy.PrefixRewrite
+				rewritepolinfo.Search = csBinding.Rule.Prefix
+				csBindings.rewritePolicyAdd(client, confErr, curPolicyRule, rewritepolinfo)
+			} else if csBinding.Rule.Path != "" {
+				// Complete path is the matched prefix in case of exact path match
+				rewritepolinfo.ActionType = "replace"
+				rewritepolinfo.ActionTarget = "HTTP.REQ.URL.PATH"
+				rewritepolinfo.ActionStringBldrExp = "\"" + csBinding.RwPolicy.PrefixRewrite + "\""
+				rewritepolinfo.Search = ""
+				csBindings.rewritePolicyAdd(client, confErr, curPolicyRule, rewritepolinfo)
+			} else if csBinding.Rule.Regex != "" {
+				// Portion of the path matched by the regex from its start is considered as the matched prefix.
+				// Regex is anchored, so that the matches in the middle of the path are not rewritten
+				rewritepolinfo.ActionType = "replace_all"
+				rewritepolinfo.ActionTarget = "HTTP.REQ.URL.PATH"
+				rewritepolinfo.ActionStringBldrExp = "\"" + csBinding.RwPolicy.PrefixRewrite + "\""
+				rewritepolinfo.Search = ""
+				rewritepolinfo.RegexSearch = "^(?:" + csBinding.Rule.Regex + ")"
+				csBindings.rewritePolicyAdd(client, confErr, curPolicyRule, rewritepolinfo)
+			}
+		}
+		if csBinding.RwPolicy.RegexRewritePattern != "" {
 			rewritepolinfo.ActionType = "replace_all"
-			rewritepolinfo.ActionTarget = "http.REQ.URL"
-			rewritepolinfo.ActionStringBldrExp = csBinding.RwPolicy.PrefixRewrite
-			rewritepolinfo.Search = csBinding.Rule.Prefix
+			rewritepolinfo.ActionTarget = "HTTP.REQ.URL.PATH"
+			rewritepolinfo.ActionStringBldrExp = getExprString(csBinding.RwPolicy.RegexRewriteSubstitution)
+			rewritepolinfo.Search = ""
+			rewritepolinfo.RegexSearch = csBinding.RwPolicy.RegexRewritePattern
 			csBindings.rewritePolicyAdd(client, confErr, curPolicyRule, rewritepolinfo)
 		}
+		rewritepolinfo.RegexSearch = ""
 		if csBinding.RwPolicy.HostRewrite != "" {
 			rewritepolinfo.ActionType = "replace"
 			rewritepolinfo.ActionTarget = "HTTP.REQ.HOSTNAME"
@@ -476,7 +990,7 @@ func (csBindings *CSBindingsAPI) Add(client *netscaler.NitroClient) error {
 			csactpolinfo.ServiceType = canary.LbVserverType
 			csactpolinfo.WeightPercent = weightPercentage
 			csactpolinfo.TargetVserverExpr = canary.TargetVserverExpr
-			csBindings.csPolicyAdd(client, confErr, csactpolinfo, canary.Persistency, csBinding.MirrorPolicy)
+			csBindings.csPolicyAdd(client, confErr, csactpolinfo, canary.Persistency, csBinding.MirrorPolicies)
 			totalWeight = totalWeight - canary.Weight
 		}
 		if csBinding.ResPolicy.RedirectHost != "" && csBinding.ResPolicy.RedirectPath != "" {
@@ -488,6 +1002,8 @@ func (csBindings *CSBindingsAPI) Add(client *netscaler.NitroClient) error {
 		}
 	}
 	csBindings.deleteState(client, confErr)
+	limitIdentifiersDelete(client, confErr, csBindings.Name, sharedLimitCount)
+	limitIdentifiersDelete(client, confErr, getGlobalLimitPrefix(csBindings.Name), globalLimitCount)
 	return confErr.getError()
 }
 
@@ -530,16 +1046,13 @@ func (csBindings *CSBindingsAPI) deleteState(client *netscaler.NitroClient, conf
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Cspolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Csaction.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Policyhttpcallout.Type(), GetNSCompatibleNameByLen(bPolicyName+"_call_Delay", 31), nil, "delete", "", "", ""}, nil, nil))
-			calloutPolicy, err := client.FindResource(netscaler.Policyhttpcallout.Type(), GetNSCompatibleNameByLen(bPolicyName+"_call_Mirror", 31))
-			if err == nil {
-				mirrorPolicyDeleteWithLBvserver(client, confErr, GetNSCompatibleNameByLen(bPolicyName+"_call_Mirror", 31), calloutPolicy["vserver"].(string))
-			}
+			mirrorCalloutsDelete(client, confErr, bPolicyName, 0)
 		}
 	}
 
 	csvserverResponderPolicyBindings, err := client.FindResourceArray(netscaler.Csvserver_responderpolicy_binding.Type(), csBindings.Name)
 	if err == nil {
-
+		stalePolicyNames := make([]string, 0)
 		for _, csvserverResponderPolicyBinding := range csvserverResponderPolicyBindings {
 			if bPolicyName, err = getValueString(csvserverResponderPolicyBinding, "policyname"); err != nil {
 				continue
@@ -552,7 +1065,12 @@ func (csBindings *CSBindingsAPI) deleteState(client *netscaler.NitroClient, conf
 			}
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csBindings.Name, map[string]string{"name": csBindings.Name, "policyname": bPolicyName}, "delete", "", "", ""}, nil, nil))
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
+			stalePolicyNames = append(stalePolicyNames, bPolicyName)
+		}
+		// Variable set by the assignments of a rate limit is named after its first policy, hence deleted after all the policies
+		responderActionsDelete(client, confErr, stalePolicyNames)
+		for _, stalePolicyName := range stalePolicyNames {
+			limitIdentifiersDelete(client, confErr, stalePolicyName, 0)
 		}
 	}
 }
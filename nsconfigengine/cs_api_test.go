@@ -14,8 +14,12 @@ limitations under the License.
 package nsconfigengine
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/citrix/adc-nitro-go/resource/config/lb"
 	"github.com/citrix/citrix-xds-adaptor/tests/env"
 )
 
@@ -193,13 +197,29 @@ func Test_getMatchRule(t *testing.T) {
 		expectedOutput string
 	}{
 		{RouteMatch{}, "true"},
-		{RouteMatch{Domains: []string{"*"}}, "((HTTP.REQ.HOSTNAME.REGEX_MATCH(re/.*/)))"},
-		{RouteMatch{Domains: []string{""}}, "((HTTP.REQ.HOSTNAME.CONTAINS(\"\")))"},
-		{RouteMatch{Domains: []string{"app-c.chaos-testing.svc.cluster.local", "app-c.chaos-testing.svc.cluster.local:8088"}}, "((HTTP.REQ.HOSTNAME.CONTAINS(\"app-c.chaos-testing.svc.cluster.local\") || HTTP.REQ.HOSTNAME.CONTAINS(\"app-c.chaos-testing.svc.cluster.local:8088\")))"},
-		{RouteMatch{Domains: []string{"*"}, Prefix: "/abc"}, "((HTTP.REQ.HOSTNAME.REGEX_MATCH(re/.*/)) && HTTP.REQ.URL.Startswith(\"/abc\"))"},
-		{RouteMatch{Domains: []string{"*"}, Path: "/def/login"}, "((HTTP.REQ.HOSTNAME.REGEX_MATCH(re/.*/)) && HTTP.REQ.URL.EQ(\"/def/login\"))"},
-		{RouteMatch{Domains: []string{"*"}, Regex: "b.*"}, "((HTTP.REQ.HOSTNAME.REGEX_MATCH(re/.*/)) && HTTP.REQ.URL.REGEX_MATCH(re/b.*/))"},
-		{RouteMatch{Domains: []string{"abc.com"}, Prefix: "/", Headers: []MatchHeader{{Name: "x-svc-custid", Exact: "AADS"}, {Name: "hello", Prefix: "world"}, {Name: "x-transaction", Regex: "WDE5F.*"}}}, "((HTTP.REQ.HOSTNAME.CONTAINS(\"abc.com\")) && HTTP.REQ.URL.Startswith(\"/\") && HTTP.REQ.HEADER(\"x-svc-custid\").EQ(\"AADS\") && HTTP.REQ.HEADER(\"hello\").STARTSWITH(\"world\") && HTTP.REQ.HEADER(\"x-transaction\").REGEX_MATCH(re/WDE5F.*/))"},
+		{RouteMatch{Domains: []string{"*"}}, "true"},
+		{RouteMatch{Domains: []string{""}}, "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"\")))"},
+		{RouteMatch{Domains: []string{"app-c.chaos-testing.svc.cluster.local", "App-C.chaos-testing.svc.cluster.local:8088"}}, "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"app-c.chaos-testing.svc.cluster.local\")))"},
+		{RouteMatch{Domains: []string{"*.example.com", "api.*", "10.0.0.1:80"}}, "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).ENDSWITH(\".example.com\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(12)) || (HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).STARTSWITH(\"api.\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(4)) || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"10.0.0.1\")))"},
+		{RouteMatch{Domains: []string{"abc.com", "*"}, Prefix: "/abc"}, "(HTTP.REQ.URL.Startswith(\"/abc\"))"},
+		{RouteMatch{Domains: []string{"*"}, Prefix: "/abc"}, "(HTTP.REQ.URL.Startswith(\"/abc\"))"},
+		{RouteMatch{Domains: []string{"*"}, Path: "/def/login"}, "(HTTP.REQ.URL.EQ(\"/def/login\"))"},
+		{RouteMatch{Domains: []string{"*"}, Regex: "b.*"}, "(HTTP.REQ.URL.REGEX_MATCH(re/b.*/))"},
+		{RouteMatch{Domains: []string{"abc.com"}, Prefix: "/", Headers: []MatchHeader{{Name: "x-svc-custid", Exact: "AADS"}, {Name: "hello", Prefix: "world"}, {Name: "x-transaction", Regex: "WDE5F.*"}}}, "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"abc.com\")) && HTTP.REQ.URL.Startswith(\"/\") && HTTP.REQ.HEADER(\"x-svc-custid\").EQ(\"AADS\") && HTTP.REQ.HEADER(\"hello\").STARTSWITH(\"world\") && HTTP.REQ.HEADER(\"x-transaction\").REGEX_MATCH(re/WDE5F.*/))"},
+		{RouteMatch{Prefix: "/Abc", CaseInsensitive: true}, "(HTTP.REQ.URL.SET_TEXT_MODE(IGNORECASE).Startswith(\"/Abc\"))"},
+		{RouteMatch{Regex: "/api/v[0-9]+"}, "(HTTP.REQ.URL.REGEX_MATCH(re#/api/v[0-9]+#))"},
+		{RouteMatch{Headers: []MatchHeader{{Name: "x-env", Suffix: "prod", IgnoreCase: true}, {Name: "x-user", Contains: "admin", Invert: true}}}, "(HTTP.REQ.HEADER(\"x-env\").SET_TEXT_MODE(IGNORECASE).ENDSWITH(\"prod\") && !(HTTP.REQ.HEADER(\"x-user\").CONTAINS(\"admin\")))"},
+		{RouteMatch{Headers: []MatchHeader{{Name: "x-debug", Present: true}, {Name: "x-skip", Present: true, Invert: true}}}, "(HTTP.REQ.HEADER(\"x-debug\").EXISTS && !(HTTP.REQ.HEADER(\"x-skip\").EXISTS))"},
+		{RouteMatch{Headers: []MatchHeader{{Name: "x-id", Range: &MatchRange{Start: 10, End: 20}}}}, "(HTTP.REQ.HEADER(\"x-id\").TYPECAST_NUM_T(DECIMAL).GE(10) && HTTP.REQ.HEADER(\"x-id\").TYPECAST_NUM_T(DECIMAL).LT(20))"},
+		{RouteMatch{Headers: []MatchHeader{{Name: ":method", Exact: "POST"}, {Name: ":authority", Prefix: "abc.com"}}}, "(HTTP.REQ.METHOD.EQ(\"POST\") && HTTP.REQ.HOSTNAME.STARTSWITH(\"abc.com\"))"},
+		{RouteMatch{Headers: []MatchHeader{{Name: ":scheme", Exact: "https"}}}, "(CLIENT.SSL.IS_SSL)"},
+		{RouteMatch{Headers: []MatchHeader{{Name: ":scheme", Exact: "HTTP", IgnoreCase: true}}}, "(CLIENT.SSL.IS_SSL.NOT)"},
+		{RouteMatch{Headers: []MatchHeader{{Name: ":scheme", Regex: "https?"}}}, "(true)"},
+		{RouteMatch{Headers: []MatchHeader{{Name: ":scheme", Exact: "https", Invert: true}}}, "(!(CLIENT.SSL.IS_SSL))"},
+		{RouteMatch{QueryParameters: []MatchHeader{{Name: "debug", Present: true}, {Name: "user", Exact: "Bob", IgnoreCase: true}}}, "(HTTP.REQ.URL.QUERY.REGEX_MATCH(re/(^|&)debug(=|&|$)/) && HTTP.REQ.URL.QUERY.VALUE(\"user\").SET_TEXT_MODE(IGNORECASE).EQ(\"Bob\"))"},
+		{RouteMatch{Claims: []MatchHeader{{Name: "group", Exact: "admin"}}, jwtVerifiedRule: getJwtVerifiedRule("cs1")}, "((AAA.USER.IS_MEMBER_OF(\"cs1authn\") && " + jwtPayloadExpr + ".XPATH_JSON(xp%/group%).EQ(\"admin\")))"},
+		{RouteMatch{Claims: []MatchHeader{{Name: "group", Exact: "admin", Invert: true}}, jwtVerifiedRule: getJwtVerifiedRule("cs1")}, "((!AAA.USER.IS_MEMBER_OF(\"cs1authn\") || !(" + jwtPayloadExpr + ".XPATH_JSON(xp%/group%).EQ(\"admin\"))))"},
+		{RouteMatch{Claims: []MatchHeader{{Name: "group", Exact: "admin"}}}, "(false)"},
 	}
 	for _, c := range cases {
 		if output := c.input.getMatchRule(); output != c.expectedOutput {
@@ -208,6 +228,130 @@ func Test_getMatchRule(t *testing.T) {
 	}
 }
 
+func Test_PersistencyPolicy_setLbvserver(t *testing.T) {
+	cases := []struct {
+		input          PersistencyPolicy
+		expectedOutput lb.Lbvserver
+	}{
+		{PersistencyPolicy{HeaderName: "x-user"}, lb.Lbvserver{Persistencetype: "RULE", Rule: "HTTP.REQ.HEADER(\"x-user\")"}},
+		{PersistencyPolicy{SourceIP: true}, lb.Lbvserver{Persistencetype: "SOURCEIP"}},
+		{PersistencyPolicy{ConsistentHash: true}, lb.Lbvserver{Lbmethod: "ROUNDROBIN"}},
+		{PersistencyPolicy{HeaderName: ":path", ConsistentHash: true}, lb.Lbvserver{Lbmethod: "URLHASH"}},
+		{PersistencyPolicy{HeaderName: ":authority", ConsistentHash: true}, lb.Lbvserver{Lbmethod: "DOMAINHASH"}},
+		{PersistencyPolicy{HeaderName: "x-user", ConsistentHash: true}, lb.Lbvserver{Lbmethod: "TOKEN", Rule: "HTTP.REQ.HEADER(\"x-user\")"}},
+		{PersistencyPolicy{CookieName: "user", ConsistentHash: true}, lb.Lbvserver{Lbmethod: "TOKEN", Rule: "HTTP.REQ.COOKIE.VALUE(\"user\")"}},
+		{PersistencyPolicy{CookieName: "user", Timeout: 60, ConsistentHash: true}, lb.Lbvserver{Lbmethod: "ROUNDROBIN", Persistencetype: "COOKIEINSERT", Cookiename: "user", Timeout: 60}},
+		{PersistencyPolicy{QueryParameter: "user", ConsistentHash: true}, lb.Lbvserver{Lbmethod: "TOKEN", Rule: "HTTP.REQ.URL.QUERY.VALUE(\"user\")"}},
+		{PersistencyPolicy{SourceIP: true, ConsistentHash: true}, lb.Lbvserver{Lbmethod: "SOURCEIPHASH"}},
+	}
+	for _, c := range cases {
+		lbObj := lb.Lbvserver{}
+		c.input.setLbvserver(&lbObj)
+		if !reflect.DeepEqual(lbObj, c.expectedOutput) {
+			t.Errorf("Expected %+v for %+v, received %+v", c.expectedOutput, c.input, lbObj)
+		}
+	}
+}
+
+func Test_getOrderedBindings(t *testing.T) {
+	csBindings := NewCSBindingsAPI("cs1")
+	csBindings.Bindings = []CSBinding{
+		{Rule: RouteMatch{Domains: []string{"*"}, Prefix: "/"}},
+		{Rule: RouteMatch{Domains: []string{"*.com"}, Prefix: "/"}},
+		{Rule: RouteMatch{Domains: []string{"api.*", "*.example.com", "app.example.com", "app.example.com:80"}, Prefix: "/v1"}},
+		{Rule: RouteMatch{Domains: []string{"api.v2.*"}, Prefix: "/"}},
+		{Rule: RouteMatch{Domains: []string{"web.example.com"}, Prefix: "/"}},
+	}
+	expected := [][]string{
+		{"app.example.com", "app.example.com:80"},
+		{"web.example.com"},
+		{"*.example.com"},
+		{"*.com"},
+		{"api.v2.*"},
+		{"api.*"},
+		{"*"},
+	}
+	// Exact domains are excluded with the patset, and the wildcard domains explicitly
+	wildcardStarts := []int{2, 2, 2, 3, 4, 5, 6}
+	ordered, exactDomains := csBindings.getOrderedBindings()
+	if len(ordered) != len(expected) {
+		t.Fatalf("expected %d bindings but got %d", len(expected), len(ordered))
+	}
+	if !reflect.DeepEqual(exactDomains, []string{"app.example.com", "web.example.com"}) {
+		t.Errorf("incorrect exact domains : got %v", exactDomains)
+	}
+	for i, binding := range ordered {
+		if !reflect.DeepEqual(binding.Rule.Domains, expected[i]) {
+			t.Errorf("incorrect domains for binding %d : expected %v but got %v", i, expected[i], binding.Rule.Domains)
+		}
+		// Bindings exclude the domains of the earlier groups of bindings
+		var excluded []string
+		for _, domains := range expected[2:wildcardStarts[i]] {
+			excluded = append(excluded, domains...)
+		}
+		if len(binding.Rule.excludedDomains) != len(excluded) || (len(excluded) > 0 && !reflect.DeepEqual(binding.Rule.excludedDomains, excluded)) {
+			t.Errorf("incorrect excluded domains for binding %d : expected %v but got %v", i, excluded, binding.Rule.excludedDomains)
+		}
+		if excludedPatset := binding.Rule.excludedPatset; (i < 2 && excludedPatset != "") || (i >= 2 && excludedPatset != "cs1_domains") {
+			t.Errorf("incorrect excluded patset for binding %d : got %s", i, excludedPatset)
+		}
+	}
+	hostExpr := "HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE)"
+	if rule := ordered[3].Rule.getPolicyRuleForDomain(); rule != "((("+hostExpr+".ENDSWITH(\".com\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(4))) && !("+hostExpr+".EQUALS_ANY(\"cs1_domains\") || "+
+		"(("+hostExpr+".ENDSWITH(\".example.com\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(12)))))" {
+		t.Errorf("incorrect domain rule of wildcard binding : got %s", rule)
+	}
+	if rule := ordered[2].Rule.getPolicyRuleForDomain(); rule != "((("+hostExpr+".ENDSWITH(\".example.com\") && HTTP.REQ.HOSTNAME.SERVER.LENGTH.GT(12))) && !"+hostExpr+".EQUALS_ANY(\"cs1_domains\"))" {
+		t.Errorf("incorrect domain rule of wildcard binding excluding exact domains only : got %s", rule)
+	}
+	if rule := ordered[6].Rule.getPolicyRuleForDomain(); !strings.HasPrefix(rule, "!(") {
+		t.Errorf("incorrect domain rule of '*' binding : got %s", rule)
+	}
+}
+
+func Test_getOrderedBindings_manyVirtualHosts(t *testing.T) {
+	csBindings := NewCSBindingsAPI("cs1")
+	// Virtual hosts of a mesh with a few hundred services, each with the short and fully qualified names of the service
+	for i := 0; i < 500; i++ {
+		service := fmt.Sprintf("svc%d", i)
+		csBindings.Bindings = append(csBindings.Bindings, CSBinding{Rule: RouteMatch{Domains: []string{service, service + ":80", service + ".default.svc.cluster.local", fmt.Sprintf("10.0.%d.%d", i/256, i%256)}, Prefix: "/"}})
+	}
+	csBindings.Bindings = append(csBindings.Bindings, CSBinding{Rule: RouteMatch{Domains: []string{"*.example.com"}, Prefix: "/"}}, CSBinding{Rule: RouteMatch{Domains: []string{"*"}, Prefix: "/"}})
+	ordered, exactDomains := csBindings.getOrderedBindings()
+	if len(ordered) != 502 || len(exactDomains) != 1500 {
+		t.Fatalf("expected 502 bindings and 1500 exact domains but got %d and %d", len(ordered), len(exactDomains))
+	}
+	// Rules of the wildcard virtual hosts do not grow with the number of exact domains
+	for _, binding := range ordered[500:] {
+		if rule := binding.Rule.getMatchRule(); len(rule) > 300 {
+			t.Errorf("domain rule of %v is %d characters long : %s", binding.Rule.Domains, len(rule), rule)
+		}
+	}
+}
+
+func Test_getNSRegex(t *testing.T) {
+	cases := []struct {
+		input          string
+		expectedOutput string
+	}{
+		{"b.*", "re/b.*/"},
+		{"^/service/([^/]+)(/.*)$", "re#^/service/([^/]+)(/.*)$#"},
+		{"/a#b", "re~/a#b~"},
+		{"/#~|@%!;:^&=a\\/b", "re/\\/#~|@%!;:^&=a\\/b/"},
+	}
+	for _, c := range cases {
+		if output := getNSRegex(c.input); output != c.expectedOutput {
+			t.Errorf("incorrect output for `%s` : expected `%s` but got `%s`", c.input, c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_getExprString(t *testing.T) {
+	if output := getExprString("/v2/\\\"x\""); output != "\"/v2/\\\\\\\"x\\\"\"" {
+		t.Errorf("incorrect output : got `%s`", output)
+	}
+}
+
 func Test_CSBindingsAPI(t *testing.T) {
 	client := env.GetNitroClient()
 	t.Logf("Test CSBindingsAPI Add")
@@ -235,29 +379,29 @@ func Test_CSBindingsAPI(t *testing.T) {
 	configs := []env.VerifyNitroConfig{
 		{"csaction", "cs4_10", map[string]interface{}{"name": "cs4_10", "targetlbvserver": "v1"}},
 		{"csaction", "cs4_20", map[string]interface{}{"name": "cs4_20", "targetlbvserver": "v2"}},
-		{"cspolicy", "cs4_10", map[string]interface{}{"action": "cs4_10", "policyname": "cs4_10", "rule": "(((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && sys.random.mul(100).lt(80))"}},
-		{"cspolicy", "cs4_20", map[string]interface{}{"action": "cs4_20", "policyname": "cs4_20", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\"))"}},
+		{"cspolicy", "cs4_10", map[string]interface{}{"action": "cs4_10", "policyname": "cs4_10", "rule": "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && sys.random.mul(100).lt(80))"}},
+		{"cspolicy", "cs4_20", map[string]interface{}{"action": "cs4_20", "policyname": "cs4_20", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\"))"}},
 		{"csaction", "cs4_30", map[string]interface{}{"name": "cs4_30", "targetlbvserver": "v1"}},
-		{"cspolicy", "cs4_30", map[string]interface{}{"action": "cs4_30", "policyname": "cs4_30", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"cspolicy", "cs4_30", map[string]interface{}{"action": "cs4_30", "policyname": "cs4_30", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"rewriteaction", "cs4_rw_80", map[string]interface{}{"name": "cs4_rw_80", "search": "text(\"/details\")", "stringbuilderexpr": "\"/about\"", "target": "http.REQ.URL", "type": "replace_all"}},
-		{"rewritepolicy", "cs4_rw_80", map[string]interface{}{"action": "cs4_rw_80", "name": "cs4_rw_80", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\")) && http.req.url.contains(\"/details\") && http.req.url.contains(\"/details/\").not"}},
+		{"rewritepolicy", "cs4_rw_80", map[string]interface{}{"action": "cs4_rw_80", "name": "cs4_rw_80", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\")) && http.req.url.contains(\"/details\") && http.req.url.contains(\"/details/\").not"}},
 		{"rewriteaction", "cs4_rw_90", map[string]interface{}{"name": "cs4_rw_90", "stringbuilderexpr": "\"www.adcdetails.org\"", "target": "HTTP.REQ.HOSTNAME", "type": "replace"}},
-		{"rewritepolicy", "cs4_rw_90", map[string]interface{}{"action": "cs4_rw_90", "name": "cs4_rw_90", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
+		{"rewritepolicy", "cs4_rw_90", map[string]interface{}{"action": "cs4_rw_90", "name": "cs4_rw_90", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
 		{"rewriteaction", "cs4_rw_100", map[string]interface{}{"name": "cs4_rw_100", "stringbuilderexpr": "\"world\"", "target": "hello", "type": "insert_http_header"}},
-		{"rewritepolicy", "cs4_rw_100", map[string]interface{}{"action": "cs4_rw_100", "name": "cs4_rw_100", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
+		{"rewritepolicy", "cs4_rw_100", map[string]interface{}{"action": "cs4_rw_100", "name": "cs4_rw_100", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
 		{"rewriteaction", "cs4_rw_110", map[string]interface{}{"name": "cs4_rw_110", "stringbuilderexpr": "\"go\"", "target": "come", "type": "insert_http_header"}},
-		{"rewritepolicy", "cs4_rw_110", map[string]interface{}{"action": "cs4_rw_110", "name": "cs4_rw_110", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
+		{"rewritepolicy", "cs4_rw_110", map[string]interface{}{"action": "cs4_rw_110", "name": "cs4_rw_110", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
 		{"rewriteaction", "cs4_rw_120", map[string]interface{}{"name": "cs4_rw_120", "stringbuilderexpr": "\"any\"", "target": "time", "type": "insert_http_header"}},
-		{"rewritepolicy", "cs4_rw_120", map[string]interface{}{"action": "cs4_rw_120", "name": "cs4_rw_120", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"rewritepolicy", "cs4_rw_120", map[string]interface{}{"action": "cs4_rw_120", "name": "cs4_rw_120", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"lbvserver", "vanother", map[string]interface{}{"name": "vanother", "persistencetype": "COOKIEINSERT", "cookiename": "abracadabra", "timeout": 15}},
 		{"csaction", "cs4_40", map[string]interface{}{"name": "cs4_40", "targetlbvserver": "vanother"}},
-		{"cspolicy", "cs4_40", map[string]interface{}{"action": "cs4_40", "policyname": "cs4_40", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"cspolicy", "cs4_40", map[string]interface{}{"action": "cs4_40", "policyname": "cs4_40", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"responderaction", "cs4_ra_10", map[string]interface{}{"name": "cs4_ra_10", "target": "\"http://www.another.com/productsall\"", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_10", map[string]interface{}{"action": "cs4_ra_10", "name": "cs4_ra_10", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/products\"))"}},
+		{"responderpolicy", "cs4_ra_10", map[string]interface{}{"action": "cs4_ra_10", "name": "cs4_ra_10", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/products\"))"}},
 		{"responderaction", "cs4_ra_20", map[string]interface{}{"name": "cs4_ra_20", "target": "\"http://www.anotherrandom.com\"+HTTP.REQ.URL", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_20", map[string]interface{}{"action": "cs4_ra_20", "name": "cs4_ra_20", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/random\"))"}},
+		{"responderpolicy", "cs4_ra_20", map[string]interface{}{"action": "cs4_ra_20", "name": "cs4_ra_20", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/random\"))"}},
 		{"responderaction", "cs4_ra_30", map[string]interface{}{"name": "cs4_ra_30", "target": "HTTP.REQ.HOSTNAME + \"/people\"", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_30", map[string]interface{}{"action": "cs4_ra_30", "name": "cs4_ra_30", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/team\"))"}},
+		{"responderpolicy", "cs4_ra_30", map[string]interface{}{"action": "cs4_ra_30", "name": "cs4_ra_30", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/team\"))"}},
 	}
 	err = env.VerifyConfigBlockPresence(client, configs)
 	if err != nil {
@@ -309,29 +453,29 @@ func Test_CSBindingsAPI(t *testing.T) {
 	configs = []env.VerifyNitroConfig{
 		{"csaction", "cs4_10", map[string]interface{}{"name": "cs4_10", "targetlbvserver": "v1"}},
 		{"csaction", "cs4_20", map[string]interface{}{"name": "cs4_20", "targetlbvserver": "v2"}},
-		{"cspolicy", "cs4_10", map[string]interface{}{"action": "cs4_10", "policyname": "cs4_10", "rule": "(((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && sys.random.mul(100).lt(80))"}},
-		{"cspolicy", "cs4_20", map[string]interface{}{"action": "cs4_20", "policyname": "cs4_20", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\"))"}},
+		{"cspolicy", "cs4_10", map[string]interface{}{"action": "cs4_10", "policyname": "cs4_10", "rule": "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && sys.random.mul(100).lt(80))"}},
+		{"cspolicy", "cs4_20", map[string]interface{}{"action": "cs4_20", "policyname": "cs4_20", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\"))"}},
 		{"lbvserver", "v3", map[string]interface{}{"name": "v3", "persistencetype": "RULE", "rule": "HTTP.REQ.HEADER(\"transaction-header\")", "servicetype": "HTTP", "timeout": 2}},
 		{"csaction", "cs4_30", map[string]interface{}{"name": "cs4_30", "targetlbvserver": "v3"}},
-		{"cspolicy", "cs4_30", map[string]interface{}{"action": "cs4_30", "policyname": "cs4_30", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"cspolicy", "cs4_30", map[string]interface{}{"action": "cs4_30", "policyname": "cs4_30", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"rewriteaction", "cs4_rw_80", map[string]interface{}{"name": "cs4_rw_80", "search": "text(\"/details\")", "stringbuilderexpr": "\"/about\"", "target": "http.REQ.URL", "type": "replace_all"}},
-		{"rewritepolicy", "cs4_rw_80", map[string]interface{}{"action": "cs4_rw_80", "name": "cs4_rw_80", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\")) && http.req.url.contains(\"/details\") && http.req.url.contains(\"/details/\").not"}},
+		{"rewritepolicy", "cs4_rw_80", map[string]interface{}{"action": "cs4_rw_80", "name": "cs4_rw_80", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\")) && http.req.url.contains(\"/details\") && http.req.url.contains(\"/details/\").not"}},
 		{"rewriteaction", "cs4_rw_90", map[string]interface{}{"name": "cs4_rw_90", "stringbuilderexpr": "\"www.adcdetails.org\"", "target": "HTTP.REQ.HOSTNAME", "type": "replace"}},
-		{"rewritepolicy", "cs4_rw_90", map[string]interface{}{"action": "cs4_rw_90", "name": "cs4_rw_90", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
+		{"rewritepolicy", "cs4_rw_90", map[string]interface{}{"action": "cs4_rw_90", "name": "cs4_rw_90", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/details\"))"}},
 		{"rewriteaction", "cs4_rw_100", map[string]interface{}{"name": "cs4_rw_100", "stringbuilderexpr": "\"world\"", "target": "hello", "type": "insert_http_header"}},
 		{"rewriteaction", "cs4_rw_110", map[string]interface{}{"name": "cs4_rw_110", "stringbuilderexpr": "\"any\"", "target": "time", "type": "insert_http_header"}},
-		{"rewritepolicy", "cs4_rw_110", map[string]interface{}{"action": "cs4_rw_110", "name": "cs4_rw_110", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"rewritepolicy", "cs4_rw_110", map[string]interface{}{"action": "cs4_rw_110", "name": "cs4_rw_110", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"lbvserver", "vanother", map[string]interface{}{"name": "vanother", "persistencetype": "NONE"}},
 		{"csaction", "cs4_40", map[string]interface{}{"name": "cs4_40", "targetlbvserver": "vanother"}},
-		{"cspolicy", "cs4_40", map[string]interface{}{"action": "cs4_40", "policyname": "cs4_40", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
+		{"cspolicy", "cs4_40", map[string]interface{}{"action": "cs4_40", "policyname": "cs4_40", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/\"))"}},
 		{"responderaction", "cs4_ra_10", map[string]interface{}{"name": "cs4_ra_10", "target": "\"HTTP/1.1 502 Bad Gateway\r\n\r\n\"", "type": "respondwith"}},
-		{"responderpolicy", "cs4_ra_10", map[string]interface{}{"action": "cs4_ra_10", "name": "cs4_ra_10", "rule": "((((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))) && sys.random.mul(100).lt(20))"}},
+		{"responderpolicy", "cs4_ra_10", map[string]interface{}{"action": "cs4_ra_10", "name": "cs4_ra_10", "rule": "((((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.Startswith(\"/\"))) && sys.random.mul(100).lt(20))"}},
 		{"responderaction", "cs4_ra_20", map[string]interface{}{"name": "cs4_ra_20", "target": "\"http://www.another.com/productsall\"", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_20", map[string]interface{}{"action": "cs4_ra_20", "name": "cs4_ra_20", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/products\"))"}},
+		{"responderpolicy", "cs4_ra_20", map[string]interface{}{"action": "cs4_ra_20", "name": "cs4_ra_20", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.Startswith(\"/products\"))"}},
 		{"responderaction", "cs4_ra_30", map[string]interface{}{"name": "cs4_ra_30", "target": "\"http://www.anotherrandom.com\"+HTTP.REQ.URL", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_30", map[string]interface{}{"action": "cs4_ra_30", "name": "cs4_ra_30", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/random\"))"}},
+		{"responderpolicy", "cs4_ra_30", map[string]interface{}{"action": "cs4_ra_30", "name": "cs4_ra_30", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/random\"))"}},
 		{"responderaction", "cs4_ra_40", map[string]interface{}{"name": "cs4_ra_40", "target": "HTTP.REQ.HOSTNAME + \"/people\"", "type": "redirect"}},
-		{"responderpolicy", "cs4_ra_40", map[string]interface{}{"action": "cs4_ra_40", "name": "cs4_ra_40", "rule": "((HTTP.REQ.HOSTNAME.CONTAINS(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/team\"))"}},
+		{"responderpolicy", "cs4_ra_40", map[string]interface{}{"action": "cs4_ra_40", "name": "cs4_ra_40", "rule": "((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.another.in\")) && HTTP.REQ.URL.EQ(\"/team\"))"}},
 	}
 	err = env.VerifyConfigBlockPresence(client, configs)
 	if err != nil {
@@ -422,7 +566,7 @@ func Test_mirror(t *testing.T) {
 	csBindings := NewCSBindingsAPI(csObj.Name)
 	calloutPolicy := NewHTTPCalloutPolicy("lbent2", "bool", "http.req.full_header + http.req.body(10000000)", "", "", "true")
 	csBindings.Bindings = []CSBinding{
-		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicy: &HTTPMirror{Callout: calloutPolicy, Weight: 100}},
+		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicies: []*HTTPMirror{{Callout: calloutPolicy, Weight: 100}}},
 	}
 	err = csBindings.Add(client)
 	if err != nil {
@@ -430,7 +574,7 @@ func Test_mirror(t *testing.T) {
 	}
 	configs := []env.VerifyNitroConfig{
 		{"csaction", "cs5_10", map[string]interface{}{"name": "cs5_10", "targetlbvserver": "v5"}},
-		{"cspolicy", "cs5_10", map[string]interface{}{"action": "cs5_10", "policyname": "cs5_10", "rule": "(((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && (sys.non_blocking_http_callout(cs5_10_call_Mirror)))"}},
+		{"cspolicy", "cs5_10", map[string]interface{}{"action": "cs5_10", "policyname": "cs5_10", "rule": "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && (sys.non_blocking_http_callout(cs5_10_call_Mirror)))"}},
 		{"policyhttpcallout", "cs5_10_call_Mirror", map[string]interface{}{"name": "cs5_10_call_Mirror", "fullreqexpr": "http.req.full_header + http.req.body(10000000)", "vserver": "lbent2", "returntype": "BOOL", "resultexpr": "true"}},
 		{"rewriteaction", "lbent2", map[string]interface{}{"name": "lbent2", "target": "HTTP.REQ.HEADER(\"HOST\")", "stringbuilderexpr": "http.req.header(\"host\").prefix(':', 0).append(\"-shadow:\").append(http.req.header(\"host\").after_str(\":\")).STRIP_END_CHARS(\":\")", "type": "replace"}},
 		{"rewritepolicy", "lbent2", map[string]interface{}{"action": "lbent2", "name": "lbent2", "rule": "true"}},
@@ -449,7 +593,7 @@ func Test_mirror(t *testing.T) {
 	t.Logf("Test CSBindingsAPI Update")
 	csBindings = NewCSBindingsAPI(csObj.Name)
 	csBindings.Bindings = []CSBinding{
-		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicy: nil},
+		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicies: nil},
 	}
 	err = csBindings.Add(client)
 	if err != nil {
@@ -473,7 +617,7 @@ func Test_mirror(t *testing.T) {
 
 	csBindings = NewCSBindingsAPI(csObj.Name)
 	csBindings.Bindings = []CSBinding{
-		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicy: &HTTPMirror{Callout: calloutPolicy, Weight: 100}},
+		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicies: []*HTTPMirror{{Callout: calloutPolicy, Weight: 100}}},
 	}
 	err = csBindings.Add(client)
 	if err != nil {
@@ -481,7 +625,7 @@ func Test_mirror(t *testing.T) {
 	}
 	configs = []env.VerifyNitroConfig{
 		{"csaction", "cs5_10", map[string]interface{}{"name": "cs5_10", "targetlbvserver": "v5"}},
-		{"cspolicy", "cs5_10", map[string]interface{}{"action": "cs5_10", "policyname": "cs5_10", "rule": "(((HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.com\") || HTTP.REQ.HOSTNAME.CONTAINS(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && (sys.non_blocking_http_callout(cs5_10_call_Mirror)))"}},
+		{"cspolicy", "cs5_10", map[string]interface{}{"action": "cs5_10", "policyname": "cs5_10", "rule": "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && (sys.non_blocking_http_callout(cs5_10_call_Mirror)))"}},
 		{"policyhttpcallout", "cs5_10_call_Mirror", map[string]interface{}{"name": "cs5_10_call_Mirror", "fullreqexpr": "http.req.full_header + http.req.body(10000000)", "vserver": "lbent2", "returntype": "BOOL", "resultexpr": "true"}},
 		{"rewriteaction", "lbent2", map[string]interface{}{"name": "lbent2", "target": "HTTP.REQ.HEADER(\"HOST\")", "stringbuilderexpr": "http.req.header(\"host\").prefix(':', 0).append(\"-shadow:\").append(http.req.header(\"host\").after_str(\":\")).STRIP_END_CHARS(\":\")", "type": "replace"}},
 		{"rewritepolicy", "lbent2", map[string]interface{}{"action": "lbent2", "name": "lbent2", "rule": "true"}},
@@ -496,6 +640,30 @@ func Test_mirror(t *testing.T) {
 	if err != nil {
 		t.Errorf("Config verification failed for Add rewrite policy binding lbent2, error %v", err)
 	}
+	t.Logf("Test CSBindingsAPI Update with multiple mirror policies")
+	lbObj3 := NewLBApi("lbent3", "HTTP", "HTTP", "ROUNDROBIN")
+	err = lbObj3.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	calloutPolicy3 := NewHTTPCalloutPolicy("lbent3", "bool", "http.req.full_header + http.req.body(10000000)", "", "", "true")
+	csBindings = NewCSBindingsAPI(csObj.Name)
+	csBindings.Bindings = []CSBinding{
+		{Rule: RouteMatch{Domains: []string{"www.abc.com", "www.abc.in"}, Path: "/login"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v5", LbVserverType: "HTTP"}}}, MirrorPolicies: []*HTTPMirror{{Callout: calloutPolicy, Weight: 100}, {Callout: calloutPolicy3, Weight: 30}}},
+	}
+	err = csBindings.Add(client)
+	if err != nil {
+		t.Errorf("CSBindingsAPI Update for cs5 failed with err %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"cspolicy", "cs5_10", map[string]interface{}{"action": "cs5_10", "policyname": "cs5_10", "rule": "(((HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.com\") || HTTP.REQ.HOSTNAME.SERVER.SET_TEXT_MODE(IGNORECASE).EQ(\"www.abc.in\")) && HTTP.REQ.URL.EQ(\"/login\")) && (sys.non_blocking_http_callout(cs5_10_call_Mirror)) && (sys.random.mul(100).ge(30) || sys.non_blocking_http_callout(cs5_10_call_Mirror1)))"}},
+		{"policyhttpcallout", "cs5_10_call_Mirror1", map[string]interface{}{"name": "cs5_10_call_Mirror1", "fullreqexpr": "http.req.full_header + http.req.body(10000000)", "vserver": "lbent3", "returntype": "BOOL", "resultexpr": "true"}},
+		{"rewritepolicy", "lbent3", map[string]interface{}{"action": "lbent3", "name": "lbent3", "rule": "true"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add/Update cs5, error %v", err)
+	}
 	t.Logf("Test CSBindingsAPI Delete")
 	t.Logf("CSApi delete")
 	err = csObj.Delete(client)
@@ -506,9 +674,11 @@ func Test_mirror(t *testing.T) {
 		{"csaction", "cs5_10", nil},
 		{"cspolicy", "cs5_10", nil},
 		{"policyhttpcallout", "cs5_10_call_Mirror", nil},
+		{"policyhttpcallout", "cs5_10_call_Mirror1", nil},
 		{"rewritepolicy", "lbent2", nil},
 		{"rewriteaction", "lbent2", nil},
 		{"lbvserver", "lbent2", nil},
+		{"lbvserver", "lbent3", nil},
 	}
 	err = env.VerifyConfigBlockAbsence(client, configs)
 	if err != nil {
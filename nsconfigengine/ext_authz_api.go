@@ -0,0 +1,132 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	"github.com/citrix/adc-nitro-go/resource/config/ns"
+	"github.com/citrix/adc-nitro-go/resource/config/policy"
+	"github.com/citrix/adc-nitro-go/resource/config/responder"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+const (
+	// ExtAuthzResultExpr is the result expression of the external authorization callout, i.e. the status line and headers of the authorization response
+	ExtAuthzResultExpr = "HTTP.RES.FULL_HEADER"
+	// External authorization is evaluated after the authorization policy labels, and before the route level responder policies
+	extAuthzCalloutPriority = 3
+	extAuthzDenyPriority    = 4
+	extAuthzErrorPriority   = 5
+	// Rewrite policy label copying the authorization response headers is invoked ahead of the route level rewrite policies
+	extAuthzHeadersInvokePriority = 1
+	extAuthzVariableSize          = 8192
+)
+
+// ExtAuthzSpec specifies the external authorization of the requests of a CS vserver.
+// Callout sends the authorization request to the authorization service, and its result expression is expected to be ExtAuthzResultExpr.
+// Request is denied with the status of a non-2xx authorization response, else UpstreamHeaders of the authorization response are copied to the request.
+// If the authorization service fails or does not respond within Timeout seconds, request is denied with StatusOnError unless FailureModeAllow is set.
+// Timeout is the server timeout of the servicegroup of the Callout's LB vserver, hence the LB vserver needs to be dedicated to the CS vserver
+type ExtAuthzSpec struct {
+	Callout          *HTTPCalloutPolicy
+	UpstreamHeaders  []string
+	Timeout          int
+	FailureModeAllow bool
+	StatusOnError    int
+}
+
+func getExtAuthzNames(csVserverName string) (calloutName, variableName, entityName string) {
+	entityName = csVserverName + "_extauthz"
+	return GetNSCompatibleNameByLen(entityName, 31), GetNSCompatibleNameByLen(entityName+"_res", 31), entityName
+}
+
+// getExtAuthzHeaderExpr returns the expression of the value of the header in the authorization response stored in variable
+func getExtAuthzHeaderExpr(variableName, header string) string {
+	return "$" + variableName + ".SET_TEXT_MODE(IGNORECASE).AFTER_STR(\"\\r\\n" + header + ":\").BEFORE_STR(\"\\r\\n\").STRIP_START_CHARS(\" \")"
+}
+
+// extAuthzResponderAdd adds the responder policy, along with its action, and binds it to the CS vserver
+func extAuthzResponderAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName, policyName, policyRule string, action responder.Responderaction, priority int, gotoPriorityExpression string) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), policyName, action, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), policyName, responder.Responderpolicy{Name: policyName, Rule: policyRule, Action: policyName}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, cs.Csvserverresponderpolicybinding{Name: csVserverName, Policyname: policyName, Priority: priority, Gotopriorityexpression: gotoPriorityExpression}, "add", "", "", ""}, nil, nil))
+}
+
+func extAuthzResponderDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName, policyName string) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": policyName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
+
+// extAuthzHeadersAdd copies the UpstreamHeaders of the authorization response stored in the variable to the request
+func (extAuthzSpec *ExtAuthzSpec) extAuthzHeadersAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName, variableName, labelName string) {
+	headers := make([]requestHeader, 0, len(extAuthzSpec.UpstreamHeaders))
+	for _, header := range extAuthzSpec.UpstreamHeaders {
+		headers = append(headers, requestHeader{name: header, presenceRule: "$" + variableName + ".SET_TEXT_MODE(IGNORECASE).CONTAINS(\"\\r\\n" + header + ":\")", valueExpr: getExtAuthzHeaderExpr(variableName, header)})
+	}
+	headersLabelAdd(client, confErr, csVserverName, labelName, extAuthzHeadersInvokePriority, headers)
+}
+
+func extAuthzDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	calloutName, variableName, entityName := getExtAuthzNames(csVserverName)
+	headersLabelDelete(client, confErr, csVserverName, entityName, authzPolicyStartPriority)
+	extAuthzResponderDelete(client, confErr, csVserverName, entityName+"_err")
+	extAuthzResponderDelete(client, confErr, csVserverName, entityName+"_deny")
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": entityName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), entityName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsassignment.Type(), entityName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsvariable.Type(), variableName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Policyhttpcallout.Type(), calloutName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
+
+// extAuthzAdd adds the HTTP callout to the authorization service. Callout is invoked once per request, by the responder policy
+// assigning its result to a transaction scoped variable, which is then evaluated by the responder policies denying the request and
+// by the rewrite policies copying the authorization response headers
+func (extAuthzSpec *ExtAuthzSpec) extAuthzAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName string) {
+	nsconfLogger.Trace("extAuthzAdd: ExtAuthzSpec addition", "extAuthzSpec", extAuthzSpec)
+	calloutName, variableName, entityName := getExtAuthzNames(csVserverName)
+	callout := extAuthzSpec.Callout
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Policyhttpcallout.Type(), calloutName, policy.Policyhttpcallout{Name: calloutName, Vserver: callout.LbVserverName, Returntype: callout.ReturnType, Resultexpr: callout.ResultExpr, Fullreqexpr: callout.FullReqExpr}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsvariable.Type(), variableName, ns.Nsvariable{Name: variableName, Type: "text(" + fmt.Sprint(extAuthzVariableSize) + ")", Scope: "transaction"}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsassignment.Type(), entityName, ns.Nsassignment{Name: entityName, Variable: "$" + variableName, Set: "SYS.HTTP_CALLOUT(" + calloutName + ")"}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), entityName, responder.Responderpolicy{Name: entityName, Rule: "true", Action: entityName}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csVserverName, cs.Csvserverresponderpolicybinding{Name: csVserverName, Policyname: entityName, Priority: extAuthzCalloutPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+	// Denied request is responded with the status of the authorization response
+	statusExpr := "$" + variableName + ".AFTER_STR(\" \").BEFORE_STR(\"\\r\\n\")"
+	extAuthzResponderAdd(client, confErr, csVserverName, entityName+"_deny", "$"+variableName+".LENGTH.GT(0) && !$"+variableName+".AFTER_STR(\" \").STARTSWITH(\"2\")",
+		responder.Responderaction{Name: entityName + "_deny", Type: "respondwith", Target: "\"HTTP/1.1 \" + " + statusExpr + " + \"\\r\\nContent-Length: 0\\r\\n\\r\\n\""}, extAuthzDenyPriority, "END")
+	if extAuthzSpec.FailureModeAllow {
+		extAuthzResponderDelete(client, confErr, csVserverName, entityName+"_err")
+	} else {
+		statusOnError := extAuthzSpec.StatusOnError
+		if statusOnError == 0 {
+			statusOnError = 403
+		}
+		extAuthzResponderAdd(client, confErr, csVserverName, entityName+"_err", "$"+variableName+".LENGTH.EQ(0)",
+			responder.Responderaction{Name: entityName + "_err", Type: "respondwith", Target: "\"HTTP/1.1 " + fmt.Sprint(statusOnError) + " " + http.StatusText(statusOnError) + "\\r\\nContent-Length: 0\\r\\n\\r\\n\""}, extAuthzErrorPriority, "END")
+	}
+	extAuthzSpec.extAuthzHeadersAdd(client, confErr, csVserverName, variableName, entityName)
+}
+
+func updateVserverExtAuthzSpec(client *netscaler.NitroClient, csVserverName string, extAuthzSpec *ExtAuthzSpec, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverExtAuthzSpec", "extAuthzSpec", extAuthzSpec, "csVserver", csVserverName)
+	if extAuthzSpec == nil || extAuthzSpec.Callout == nil {
+		extAuthzDelete(client, confErr, csVserverName)
+		return
+	}
+	extAuthzSpec.extAuthzAdd(client, confErr, csVserverName)
+}
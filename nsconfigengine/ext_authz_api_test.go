@@ -0,0 +1,92 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_getExtAuthzHeaderExpr(t *testing.T) {
+	expected := "$cs_extauthz_res.SET_TEXT_MODE(IGNORECASE).AFTER_STR(\"\\r\\nx-auth-user:\").BEFORE_STR(\"\\r\\n\").STRIP_START_CHARS(\" \")"
+	if expr := getExtAuthzHeaderExpr("cs_extauthz_res", "x-auth-user"); expr != expected {
+		t.Errorf("Expected %s, received %s", expected, expr)
+	}
+}
+
+func Test_CSApi_extAuthz(t *testing.T) {
+	client := env.GetNitroClient()
+	lbObj := NewLBApi("opa_authz", "HTTP", "HTTP", "ROUNDROBIN")
+	if err := lbObj.Add(client); err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	csObj := NewCSApi("csextauthz", "HTTP", "2.2.1.4", 80)
+	csObj.ExtAuthzSpec = &ExtAuthzSpec{
+		Callout:         NewHTTPCalloutPolicy("opa_authz", "TEXT", "HTTP.REQ.METHOD + \" \" + HTTP.REQ.URL + \" HTTP/1.1\\r\\nHost: \" + HTTP.REQ.HOSTNAME + \"\\r\\nContent-Length: 0\\r\\n\\r\\n\"", "", "", ExtAuthzResultExpr),
+		UpstreamHeaders: []string{"x-auth-user"},
+		Timeout:         2,
+	}
+	t.Logf("Test CSApi Add with external authorization")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"policyhttpcallout", "csextauthz_extauthz", map[string]interface{}{"name": "csextauthz_extauthz", "vserver": "opa_authz", "returntype": "TEXT"}},
+		{"nsvariable", "csextauthz_extauthz_res", map[string]interface{}{"name": "csextauthz_extauthz_res", "scope": "TRANSACTION"}},
+		{"nsassignment", "csextauthz_extauthz", map[string]interface{}{"name": "csextauthz_extauthz", "variable": "$csextauthz_extauthz_res"}},
+		{"responderpolicy", "csextauthz_extauthz", map[string]interface{}{"name": "csextauthz_extauthz", "action": "csextauthz_extauthz"}},
+		{"responderpolicy", "csextauthz_extauthz_deny", map[string]interface{}{"name": "csextauthz_extauthz_deny", "action": "csextauthz_extauthz_deny"}},
+		{"responderaction", "csextauthz_extauthz_err", map[string]interface{}{"name": "csextauthz_extauthz_err", "type": "respondwith"}},
+		{"rewritepolicylabel", "csextauthz_extauthz", map[string]interface{}{"labelname": "csextauthz_extauthz"}},
+		{"rewriteaction", "csextauthz_extauthz_10", map[string]interface{}{"name": "csextauthz_extauthz_10", "type": "replace"}},
+		{"rewriteaction", "csextauthz_extauthz_20", map[string]interface{}{"name": "csextauthz_extauthz_20", "type": "insert_http_header"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csextauthz, error %v", err)
+	}
+	t.Logf("Test CSApi Update with failure mode allow and without upstream headers")
+	csObj.ExtAuthzSpec.FailureModeAllow = true
+	csObj.ExtAuthzSpec.UpstreamHeaders = nil
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"responderpolicy", "csextauthz_extauthz_err", map[string]interface{}{"name": "csextauthz_extauthz_err"}},
+		{"rewritepolicylabel", "csextauthz_extauthz", map[string]interface{}{"labelname": "csextauthz_extauthz"}},
+		{"rewriteaction", "csextauthz_extauthz_10", map[string]interface{}{"name": "csextauthz_extauthz_10"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale external authorization of csextauthz, error %v", err)
+	}
+	t.Logf("Test CSApi Delete with external authorization")
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"policyhttpcallout", "csextauthz_extauthz", map[string]interface{}{"name": "csextauthz_extauthz"}},
+		{"nsvariable", "csextauthz_extauthz_res", map[string]interface{}{"name": "csextauthz_extauthz_res"}},
+		{"responderpolicy", "csextauthz_extauthz_deny", map[string]interface{}{"name": "csextauthz_extauthz_deny"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete csextauthz, error %v", err)
+	}
+	lbObj.Delete(client)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	"github.com/citrix/adc-nitro-go/resource/config/rewrite"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+// headersLabelDelete deletes the rewrite policies bound to the policy label at or after startPriority, along with their rewrite or audit message actions.
+// If startPriority is authzPolicyStartPriority, the label is deleted along with its binding to the CS vserver
+func headersLabelDelete(client *netscaler.NitroClient, confErr *nitroError, csVserverName, labelName string, startPriority int) {
+	var bPolicyName string
+	var priority int
+	labelBindings, err := client.FindResourceArray(netscaler.Rewritepolicylabel_rewritepolicy_binding.Type(), labelName)
+	if err == nil {
+		for _, labelBinding := range labelBindings {
+			if bPolicyName, err = getValueString(labelBinding, "policyname"); err != nil {
+				continue
+			}
+			if priority, err = getValueInt(labelBinding, "priority"); err != nil {
+				continue
+			}
+			if priority < startPriority {
+				continue
+			}
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel_rewritepolicy_binding.Type(), labelName, map[string]string{"labelname": labelName, "policyname": bPolicyName}, "delete", "", "", ""}, nil, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewriteaction.Type(), bPolicyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Auditmessageaction.Type(), bPolicyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		}
+	}
+	if startPriority != authzPolicyStartPriority {
+		return
+	}
+	if _, err = client.FindResource(netscaler.Rewritepolicylabel.Type(), labelName); err != nil {
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_rewritepolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": labelName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), labelName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel.Type(), labelName, nil, "delete", "", "", ""}, nil, nil))
+}
+
+// requestHeader is a header inserted into the request by a rewrite policy label, if presenceRule evaluates to true.
+// If appendValue is set, the value is appended to the header already present in the request, separated by a comma.
+// Header is removed from the request if removeRule evaluates to true
+type requestHeader struct {
+	name         string
+	presenceRule string
+	valueExpr    string
+	appendValue  bool
+	removeRule   string
+}
+
+// headersLabelAdd adds the rewrite policy label setting the headers of the request, and invokes it from the CS vserver at invokePriority.
+// Each header is replaced, or appended to, if present in the request, else inserted
+func headersLabelAdd(client *netscaler.NitroClient, confErr *nitroError, csVserverName, labelName string, invokePriority int, headers []requestHeader) {
+	curPriority := authzPolicyStartPriority
+	if len(headers) > 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel.Type(), labelName, rewrite.Rewritepolicylabel{Labelname: labelName, Transform: "http_req"}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	}
+	type headerAction struct {
+		rule   string
+		action rewrite.Rewriteaction
+	}
+	for _, header := range headers {
+		targetHeader := "HTTP.REQ.HEADER(\"" + header.name + "\")"
+		actions := make([]headerAction, 0, 3)
+		if header.presenceRule != "" {
+			replaceExpr := header.valueExpr
+			if header.appendValue {
+				replaceExpr = targetHeader + " + \",\" + " + header.valueExpr
+			}
+			actions = append(actions, headerAction{header.presenceRule + " && " + targetHeader + ".EXISTS", rewrite.Rewriteaction{Type: "replace", Target: targetHeader, Stringbuilderexpr: replaceExpr}},
+				headerAction{header.presenceRule + " && !" + targetHeader + ".EXISTS", rewrite.Rewriteaction{Type: "insert_http_header", Target: header.name, Stringbuilderexpr: header.valueExpr}})
+		}
+		if header.removeRule != "" {
+			actions = append(actions, headerAction{header.removeRule + " && " + targetHeader + ".EXISTS", rewrite.Rewriteaction{Type: "delete_http_header", Target: header.name}})
+		}
+		for _, rwAction := range actions {
+			entityName := labelName + "_" + fmt.Sprint(curPriority)
+			rwAction.action.Name = entityName
+			// Action update can fail if it is of different type. In this case unbind policy, delete policy, delete action and add action again
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewriteaction.Type(), entityName, rwAction.action, "add", "", "", ""}, nil, []nitroConfig{
+				{netscaler.Rewritepolicylabel_rewritepolicy_binding.Type(), labelName, map[string]string{"labelname": labelName, "policyname": entityName}, "delete", "", "", ""},
+				{netscaler.Rewritepolicy.Type(), entityName, nil, "delete", "", "", ""},
+				{netscaler.Rewriteaction.Type(), entityName, nil, "delete", "", "", ""},
+				{netscaler.Rewriteaction.Type(), entityName, rwAction.action, "add", "", "", ""}}))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), entityName, rewrite.Rewritepolicy{Name: entityName, Rule: rwAction.rule, Action: entityName}, "add", "", "", ""}, nil, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicylabel_rewritepolicy_binding.Type(), labelName, rewrite.Rewritepolicylabelrewritepolicybinding{Labelname: labelName, Policyname: entityName, Priority: curPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+			curPriority = curPriority + 10
+		}
+	}
+	if len(headers) > 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Rewritepolicy.Type(), labelName, rewrite.Rewritepolicy{Name: labelName, Rule: "true", Action: "NOOP"}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_rewritepolicy_binding.Type(), csVserverName, cs.Csvserverrewritepolicybinding{Name: csVserverName, Policyname: labelName, Priority: invokePriority, Gotopriorityexpression: "NEXT", Bindpoint: "REQUEST", Invoke: true, Labeltype: "policylabel", Labelname: labelName}, "add", "", "", ""}, nil, nil))
+	}
+	headersLabelDelete(client, confErr, csVserverName, labelName, curPriority)
+}
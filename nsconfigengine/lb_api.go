@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -30,11 +31,106 @@ import (
 
 // LBMonitor specifies attributes associated with Outlier Detection feature
 type LBMonitor struct {
-	Retries       int    // consecutive[Gateway]Errors of Istio's Outlier Detection (OD)
-	Interval      int    // interval of Istio's OD
-	IntervalUnits string // Units of Interval field.
-	DownTime      int    // baseEjectionTime of Istio's OD
-	DownTimeUnits string // Units of DownTime
+	Type               string   // HTTP-INLINE monitor of the HTTP responses (default), or TCP monitor of the TCP services
+	RespCodes          []string // Response codes of HTTP-INLINE monitor for which the service is UP, default 200
+	Retries            int      // consecutive[5xx|Gateway]Errors of Istio's Outlier Detection (OD)
+	Interval           int      // interval of Istio's OD
+	IntervalUnits      string   // Units of Interval field.
+	DownTime           int      // baseEjectionTime of Istio's OD
+	DownTimeUnits      string   // Units of DownTime
+	MaxEjectionPercent int      // maxEjectionPercent of Istio's OD. LB vserver is marked DOWN when less than (100 - MaxEjectionPercent) percent of services are UP
+}
+
+// deepCopy returns a copy of the monitor spec which shares none of its fields
+func (lbMonitor *LBMonitor) deepCopy() *LBMonitor {
+	monitorCopy := *lbMonitor
+	monitorCopy.RespCodes = append([]string(nil), lbMonitor.RespCodes...)
+	return &monitorCopy
+}
+
+// HealthMonitor specifies an active health check of the services of an LB vserver, mapped to an ADC monitor.
+// Type is one of HTTP, TCP, TCP-ECV and GRPC. HTTPRequest is the request line of the HTTP monitor, e.g. "GET /healthz",
+// and RespCodes are the expected response codes or ranges of codes, e.g. "200-299". Send is the payload of the TCP-ECV monitor, whose response
+// needs to contain any of the Recv payloads.
+// Interval and Timeout are in milliseconds. Service is marked DOWN after UnhealthyThreshold failed probes, and UP after HealthyThreshold successful probes
+type HealthMonitor struct {
+	Type               string
+	HTTPRequest        string
+	Host               string
+	RespCodes          []string
+	Send               string
+	Recv               []string
+	GRPCService        string
+	Interval           int
+	Timeout            int
+	UnhealthyThreshold int
+	HealthyThreshold   int
+}
+
+// CircuitBreaker specifies the limits of the connections and requests to the services of an LB vserver as a whole.
+// Connections beyond the least of MaxConnections and MaxRequests wait in the surge queue of the servicegroup, and those
+// beyond MaxPendingRequests waiting connections spill over, to the backup LB vserver if any, or are dropped
+type CircuitBreaker struct {
+	MaxConnections     int
+	MaxRequests        int
+	MaxPendingRequests int
+}
+
+// getSpilloverThreshold returns the number of client connections of the LB vserver beyond which connections spill over, 0 if there is no limit
+func (circuitBreaker *CircuitBreaker) getSpilloverThreshold() int {
+	limit := circuitBreaker.MaxConnections
+	if circuitBreaker.MaxRequests > 0 && (limit == 0 || circuitBreaker.MaxRequests < limit) {
+		limit = circuitBreaker.MaxRequests
+	}
+	if limit == 0 {
+		return 0
+	}
+	if limit+circuitBreaker.MaxPendingRequests > maxSpilloverThreshold {
+		return maxSpilloverThreshold
+	}
+	return limit + circuitBreaker.MaxPendingRequests
+}
+
+// GetHighPriorityLbName returns the name of the LB vserver of the HIGH priority routes to the LB vserver
+func GetHighPriorityLbName(lbName string) string {
+	return GetNSCompatibleNameByLen(lbName+"_high", 127)
+}
+
+// HTTPProtocolOptions specifies the HTTP protocol towards the services of an LB vserver. HTTP/2 is used with the services
+// which negotiate it, with ALPN for SSL services, if HTTP2 is set, and without negotiation if HTTP2Direct is also set.
+// Window sizes are in bytes, and the defaults of Citrix ADC are used if 0
+type HTTPProtocolOptions struct {
+	HTTP2                   bool
+	HTTP2Direct             bool
+	InitialStreamWindowSize int
+	InitialConnWindowSize   int
+}
+
+// getHTTPProfileName returns the name of the HTTP profile dedicated to the services of the LB vserver
+func getHTTPProfileName(entityName string) string {
+	return GetNSCompatibleNameByLen(entityName+"_httpprofile", 127)
+}
+
+// getNshttpprofile returns the HTTP profile of the protocol options, with maxConcurrentStreams HTTP/2 streams per connection
+func (options *HTTPProtocolOptions) getNshttpprofile(profileName string, maxConcurrentStreams int) ns.Nshttpprofile {
+	profile := ns.Nshttpprofile{Name: profileName, Http2: "DISABLED", Http2direct: "DISABLED", Http2maxconcurrentstreams: maxConcurrentStreams,
+		Http2initialwindowsize: options.InitialStreamWindowSize, Http2initialconnwindowsize: options.InitialConnWindowSize}
+	if options.HTTP2 {
+		profile.Http2 = "ENABLED"
+		if options.HTTP2Direct {
+			profile.Http2direct = "ENABLED"
+		}
+	}
+	if profile.Http2maxconcurrentstreams == 0 {
+		profile.Http2maxconcurrentstreams = defaultHTTP2ConcurrentStreams
+	}
+	if profile.Http2initialwindowsize == 0 {
+		profile.Http2initialwindowsize = defaultHTTP2WindowSize
+	}
+	if profile.Http2initialconnwindowsize == 0 {
+		profile.Http2initialconnwindowsize = defaultHTTP2WindowSize
+	}
+	return profile
 }
 
 // StringMapBinding specifies stringmap and lb-vserver binding
@@ -45,10 +141,14 @@ type StringMapBinding struct {
 }
 
 // LBApi specifies the attributes associated with a load balancng entity on the Citrix-ADC
+// LbMethod of the LB vserver is not updated if empty, as for the clusters balanced by consistent hashing, whose hash based LB method is set by the route.
+// New services of the LB vserver are slowly ramped up to their full share of the load over SlowStartWindow seconds.
+// Traffic fails over to BackupVserver when less than MinActivePercent percent of the services are UP
 type LBApi struct {
 	Name                      string
 	FrontendServiceType       string
 	LbMethod                  string
+	SlowStartWindow           int
 	BackendServiceType        string
 	MaxConnections            int
 	MaxHTTP2ConcurrentStreams int
@@ -56,8 +156,15 @@ type LBApi struct {
 	NetprofileName            string
 	BackendTLS                []SSLSpec
 	LbMonitorObj              *LBMonitor
+	HealthMonitors            []HealthMonitor
+	CircuitBreaker            *CircuitBreaker
+	HighCircuitBreaker        *CircuitBreaker // Of the HIGH priority routes, applied on the LB vserver GetHighPriorityLbName(Name)
+	HTTPProtocolOptions       *HTTPProtocolOptions
+	BackupVserver             string
+	MinActivePercent          int
+	ServerTimeout             int  // Idle timeout, in seconds, of the connections to the services. Default of the ADC if 0
 	AutoScale                 bool // Whether desired state API can be used here or not
-	StringMapBindingObj       *StringMapBinding
+	StringMapBindings         []*StringMapBinding
 }
 
 type timeUnit int
@@ -72,6 +179,17 @@ const (
 	defaultInterval = 5 // in seconds
 	defaultDownTime = 30
 	defaultRetries  = 1
+	// Response timeout of a monitor needs to be less than its interval
+	maxRespTimeout     = 20939
+	defaultRespTimeout = 2 // in seconds
+	// Maximum spillover threshold of CONNECTION spillover method
+	maxSpilloverThreshold = 4294967294
+)
+
+// Defaults of the HTTP/2 settings of Citrix ADC HTTP profile
+const (
+	defaultHTTP2ConcurrentStreams = 100
+	defaultHTTP2WindowSize        = 65535
 )
 
 // This variable is a stop-gap way to disable functionality till LWCPX supports labels infra
@@ -111,6 +229,175 @@ func getLbMonName(entityName string) string {
 	return name
 }
 
+// getHealthMonName returns the name of the index-th monitor of the active health checks of the LB vserver
+func getHealthMonName(entityName string, index int) string {
+	return GetNSCompatibleNameByLen(entityName+"_hcmon"+fmt.Sprint(index), 63)
+}
+
+// getLbmonitor returns the ADC monitor of the health check. gRPC health check is an HTTP monitor with gRPC health checking enabled
+func (monitor *HealthMonitor) getLbmonitor(monName string, secure bool) map[string]interface{} {
+	lbMonitor := map[string]interface{}{"monitorname": monName, "type": monitor.Type, "lrtm": "DISABLED"}
+	if secure {
+		lbMonitor["secure"] = "YES"
+	}
+	timeout := monitor.Timeout
+	if monitor.Interval > 0 && timeout >= monitor.Interval {
+		timeout = monitor.Interval - 1
+	}
+	lbMonitor["interval"], lbMonitor["units3"] = convertTimeUnits(monitor.Interval, "MSEC", maxInterval, defaultInterval)
+	lbMonitor["resptimeout"], lbMonitor["units4"] = convertTimeUnits(timeout, "MSEC", maxRespTimeout, defaultRespTimeout)
+	if monitor.UnhealthyThreshold > 0 {
+		lbMonitor["retries"] = monitor.UnhealthyThreshold
+	}
+	if monitor.HealthyThreshold > 0 {
+		lbMonitor["successretries"] = monitor.HealthyThreshold
+	}
+	switch monitor.Type {
+	case "HTTP":
+		lbMonitor["httprequest"] = monitor.HTTPRequest
+		lbMonitor["respcode"] = monitor.RespCodes
+		if monitor.Host != "" {
+			lbMonitor["customheaders"] = "Host: " + monitor.Host + "\r\n"
+		}
+	case "TCP-ECV":
+		lbMonitor["send"] = monitor.Send
+		if len(monitor.Recv) > 0 {
+			lbMonitor["recv"] = monitor.Recv[0]
+		}
+	case "GRPC":
+		lbMonitor["type"] = "HTTP"
+		lbMonitor["grpchealthcheck"] = "YES"
+		lbMonitor["respcode"] = []string{"200"}
+		if monitor.GRPCService != "" {
+			lbMonitor["grpcservicename"] = monitor.GRPCService
+		}
+		if monitor.Host != "" {
+			lbMonitor["customheaders"] = "Host: " + monitor.Host + "\r\n"
+		}
+	}
+	return lbMonitor
+}
+
+func monitorDelete(client *netscaler.NitroClient, confErr *nitroError, servicegroupName, monName, monType string) {
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_lbmonitor_binding.Type(), servicegroupName, map[string]string{"servicegroupname": servicegroupName, "monitor_name": monName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), monName, map[string]string{"monitorname": monName, "type": monType}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
+
+// httpProfileDelete deletes the HTTP profile dedicated to the servicegroup, if any, after unbinding it from the SSL servicegroup
+func httpProfileDelete(client *netscaler.NitroClient, confErr *nitroError, servicegroupName, serviceType string) {
+	profileName := getHTTPProfileName(servicegroupName)
+	if _, err := client.FindResource(netscaler.Nshttpprofile.Type(), profileName); err != nil {
+		return
+	}
+	if serviceType == "SSL" {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup.Type(), servicegroupName, map[string]interface{}{"servicegroupname": servicegroupName, "httpprofilename": true}, "unset", "", "", ""}, nil, nil))
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nshttpprofile.Type(), profileName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
+
+// getMonitorType returns the type of the monitor, or "" if the monitor does not exist
+func getMonitorType(client *netscaler.NitroClient, monName string) string {
+	lbMonitor, err := client.FindResource(netscaler.Lbmonitor.Type(), monName)
+	if err != nil {
+		return ""
+	}
+	monType, err := getValueString(lbMonitor, "type")
+	if err != nil {
+		return ""
+	}
+	return monType
+}
+
+// healthLbmonitor is an ADC monitor of an active health check, and its weight in the monitor threshold of the servicegroup
+type healthLbmonitor struct {
+	lbMonitor map[string]interface{}
+	weight    int
+}
+
+// getHealthLbmonitors returns the ADC monitors of the active health checks, the weight of the outlier detection monitor and the monitor threshold
+// of the servicegroup. TCP-ECV health check with several Recv payloads is a monitor of weight 1 per payload, and each of the other monitors weighs
+// as much as all of them. Hence a service is UP only if all the other monitors, and any of the payload monitors, are UP.
+// Only the first of such health checks matches any of its payloads, the others match the first payload only
+func (lbObj *LBApi) getHealthLbmonitors(secure bool) ([]healthLbmonitor, int, int) {
+	monitors := make([]healthLbmonitor, 0, len(lbObj.HealthMonitors))
+	payloadMonitors := 0
+	for index := range lbObj.HealthMonitors {
+		monitor := &lbObj.HealthMonitors[index]
+		lbMonitor := monitor.getLbmonitor(getHealthMonName(lbObj.Name, len(monitors)), secure)
+		if monitor.Type != "TCP-ECV" || len(monitor.Recv) <= 1 {
+			monitors = append(monitors, healthLbmonitor{lbMonitor: lbMonitor})
+			continue
+		}
+		if payloadMonitors > 0 {
+			nsconfLogger.Error("getHealthLbmonitors: Only one health check can match any of several payloads, services not returning the first payload are marked DOWN", "lbName", lbObj.Name, "recv", monitor.Recv)
+			monitors = append(monitors, healthLbmonitor{lbMonitor: lbMonitor})
+			continue
+		}
+		payloadMonitors = len(monitor.Recv)
+		for _, recv := range monitor.Recv {
+			payloadMonitor := make(map[string]interface{}, len(lbMonitor))
+			for key, value := range lbMonitor {
+				payloadMonitor[key] = value
+			}
+			payloadMonitor["monitorname"] = getHealthMonName(lbObj.Name, len(monitors))
+			payloadMonitor["recv"] = recv
+			monitors = append(monitors, healthLbmonitor{lbMonitor: payloadMonitor, weight: 1})
+		}
+	}
+	if payloadMonitors == 0 {
+		for index := range monitors {
+			monitors[index].weight = 1
+		}
+		return monitors, 1, 0
+	}
+	otherMonitors := 0
+	if lbObj.LbMonitorObj != nil {
+		otherMonitors++
+	}
+	for index := range monitors {
+		if monitors[index].weight == 0 {
+			monitors[index].weight = payloadMonitors
+			otherMonitors++
+		}
+	}
+	return monitors, payloadMonitors, otherMonitors*payloadMonitors + 1
+}
+
+// monitorBind binds the monitor to the servicegroup with the weight. Monitor bound with another weight is bound again
+func monitorBind(client *netscaler.NitroClient, confErr *nitroError, servicegroupName, monName string, weight int) {
+	monBindings, _ := client.FindResourceArray(netscaler.Servicegroup_lbmonitor_binding.Type(), servicegroupName)
+	for _, monBinding := range monBindings {
+		if boundMonName, _ := getValueString(monBinding, "monitor_name"); boundMonName != monName {
+			continue
+		}
+		if boundWeight, err := getValueInt(monBinding, "monweight"); err == nil && boundWeight != weight {
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_lbmonitor_binding.Type(), servicegroupName, map[string]string{"servicegroupname": servicegroupName, "monitor_name": monName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		}
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_lbmonitor_binding.Type(), servicegroupName, basic.Servicegrouplbmonitorbinding{Servicegroupname: servicegroupName, Monitorname: monName, Monweight: weight}, "add", "", "", ""}, []string{"The monitor is already bound to the service"}, nil))
+}
+
+// healthMonitorsAdd adds the monitors of the active health checks, and binds them to the servicegroup.
+// Monitor whose type has changed is added again, and the monitors of the removed health checks are deleted
+func (lbObj *LBApi) healthMonitorsAdd(client *netscaler.NitroClient, confErr *nitroError, monitors []healthLbmonitor) {
+	for _, monitor := range monitors {
+		monName := monitor.lbMonitor["monitorname"].(string)
+		if monType := getMonitorType(client, monName); monType != "" && monType != monitor.lbMonitor["type"] {
+			monitorDelete(client, confErr, lbObj.Name, monName, monType)
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), monName, monitor.lbMonitor, "add", "", "", ""}, nil, nil))
+		monitorBind(client, confErr, lbObj.Name, monName, monitor.weight)
+	}
+	for index := len(monitors); ; index++ {
+		monName := getHealthMonName(lbObj.Name, index)
+		monType := getMonitorType(client, monName)
+		if monType == "" {
+			break
+		}
+		monitorDelete(client, confErr, lbObj.Name, monName, monType)
+	}
+}
+
 // convertTimeUnits function converts msec to sec or min if the value is more than maxLimit.
 // inUnit should not be minutes (MIN)
 func convertTimeUnits(inTime int, inUnit string, maxLimit int, defaultValue int) (int, string) {
@@ -151,6 +438,28 @@ func NewLBApi(name string, frontendServiceType string, backendServiceType string
 	return lbObj
 }
 
+// getSlowStartParams returns the percentage by which the load of a new service is increased at every interval, and the interval in seconds,
+// so that the service takes its full share of the load after slowStartWindow seconds. As both are integers, the finest ramp whose
+// duration is the closest to the window is chosen
+func getSlowStartParams(slowStartWindow int) (int, int) {
+	percent, interval, minDiff := 100, slowStartWindow, -1
+	for p := 1; p <= 100; p++ {
+		steps := (100 + p - 1) / p
+		i := (slowStartWindow + steps/2) / steps
+		if i < 1 {
+			i = 1
+		}
+		diff := i*steps - slowStartWindow
+		if diff < 0 {
+			diff = -diff
+		}
+		if minDiff < 0 || diff < minDiff {
+			percent, interval, minDiff = p, i, diff
+		}
+	}
+	return percent, interval
+}
+
 func isBuildDesiredStateAPICompatible() bool {
 	nsReleaseNo, nsBuildNo := GetNsReleaseBuild()
 	if nsReleaseNo >= 13.1 || (nsReleaseNo == 13.0 && nsBuildNo >= 45.8) {
@@ -159,16 +468,66 @@ func isBuildDesiredStateAPICompatible() bool {
 	return false
 }
 
+// lbvserverAdd adds/updates the LB vserver, with the spillover of the circuit breaker if any, and unsets the parameters not set in lbInst
+func lbvserverAdd(client *netscaler.NitroClient, confErr *nitroError, lbInst lb.Lbvserver, circuitBreaker *CircuitBreaker) {
+	if circuitBreaker != nil && circuitBreaker.getSpilloverThreshold() > 0 {
+		lbInst.Somethod = "CONNECTION"
+		lbInst.Sothreshold = circuitBreaker.getSpilloverThreshold()
+		lbInst.Sobackupaction = "DROP"
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), lbInst.Name, lbInst, "add", "", "", ""}, nil, []nitroConfig{{netscaler.Lbvserver.Type(), lbInst.Name, nil, "delete", "", "", ""}, {netscaler.Lbvserver.Type(), lbInst.Name, lbInst, "add", "", "", ""}}))
+	lbUnset := map[string]interface{}{"name": lbInst.Name}
+	if lbInst.Newservicerequestunit == "" {
+		lbUnset["newservicerequest"], lbUnset["newservicerequestunit"], lbUnset["newservicerequestincrementinterval"] = true, true, true
+	}
+	if lbInst.Healththreshold == 0 {
+		lbUnset["healththreshold"] = true
+	}
+	if lbInst.Backupvserver == "" {
+		lbUnset["backupvserver"] = true
+	}
+	if lbInst.Somethod == "" {
+		lbUnset["somethod"], lbUnset["sothreshold"], lbUnset["sobackupaction"] = true, true, true
+	}
+	if len(lbUnset) > 1 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), lbInst.Name, lbUnset, "unset", "", "", ""}, nil, nil))
+	}
+}
+
 // Add method adds/updates an LB vserver and associated servicegroup on Citrix-ADC.
 // It also adds httpprofile and http-inline monitor if needed.
 func (lbObj *LBApi) Add(client *netscaler.NitroClient) error {
 	nsconfLogger.Trace("LBApi add", "lbObj", GetLogString(lbObj))
+	if lbObj.BackendServiceType == "SSL" || lbObj.BackendServiceType == "SSL_TCP" {
+		// Services are not added if they can not be verified as specified
+		sni, subjectAltNames := getServerNames(lbObj.BackendTLS)
+		if _, _, err := getServerCommonName(sni, subjectAltNames, true); err != nil {
+			nsconfLogger.Error("LBApi add: LB vserver is not added as the services can not be verified", "lbObj", lbObj.Name, "error", err)
+			return err
+		}
+	}
 	var sg map[string]interface{}
 	confErr := newNitroError()
 	lbInst := lb.Lbvserver{Name: lbObj.Name, Servicetype: lbObj.FrontendServiceType, Lbmethod: lbObj.LbMethod}
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), lbObj.Name, lbInst, "add", "", "", ""}, nil, []nitroConfig{{netscaler.Lbvserver.Type(), lbObj.Name, nil, "delete", "", "", ""}, {netscaler.Lbvserver.Type(), lbObj.Name, lbInst, "add", "", "", ""}}))
+	if lbObj.SlowStartWindow > 0 {
+		lbInst.Newservicerequestunit = "PERCENT"
+		lbInst.Newservicerequest, lbInst.Newservicerequestincrementinterval = getSlowStartParams(lbObj.SlowStartWindow)
+	}
+	if lbObj.LbMonitorObj != nil && lbObj.LbMonitorObj.MaxEjectionPercent > 0 && lbObj.LbMonitorObj.MaxEjectionPercent < 100 {
+		lbInst.Healththreshold = 100 - lbObj.LbMonitorObj.MaxEjectionPercent
+	}
+	if lbObj.BackupVserver != "" {
+		lbInst.Backupvserver = lbObj.BackupVserver
+		if lbObj.MinActivePercent > lbInst.Healththreshold {
+			lbInst.Healththreshold = lbObj.MinActivePercent
+		}
+	}
+	lbvserverAdd(client, confErr, lbInst, lbObj.CircuitBreaker)
 	httpProfileName := "nshttp_default_profile"
-	if lbObj.MaxHTTP2ConcurrentStreams != 0 {
+	if lbObj.HTTPProtocolOptions != nil {
+		httpProfileName = getHTTPProfileName(lbObj.Name)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nshttpprofile.Type(), httpProfileName, lbObj.HTTPProtocolOptions.getNshttpprofile(httpProfileName, lbObj.MaxHTTP2ConcurrentStreams), "add", "", "", ""}, nil, nil))
+	} else if lbObj.MaxHTTP2ConcurrentStreams != 0 {
 		httpProfileName = "nshttp_profile_" + fmt.Sprint(lbObj.MaxHTTP2ConcurrentStreams)
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nshttpprofile.Type(), httpProfileName, ns.Nshttpprofile{Name: httpProfileName, Http2: "ENABLED", Http2maxconcurrentstreams: lbObj.MaxHTTP2ConcurrentStreams}, "add", "", "", ""}, nil, nil))
 	}
@@ -177,38 +536,80 @@ func (lbObj *LBApi) Add(client *netscaler.NitroClient) error {
 	} else {
 		sg = map[string]interface{}{"servicegroupname": lbObj.Name, "servicetype": lbObj.BackendServiceType, "maxclient": lbObj.MaxConnections, "maxreq": lbObj.MaxRequestsPerConnection, "usip": "NO"}
 	}
-	if lbObj.BackendServiceType == "HTTP" {
+	if lbObj.BackendServiceType == "HTTP" || (lbObj.BackendServiceType == "SSL" && lbObj.HTTPProtocolOptions != nil) {
 		sg["httpprofilename"] = httpProfileName
 	}
+	// Surge protection queues the connections beyond the limit of the circuit breakers
+	if lbObj.CircuitBreaker != nil || lbObj.HighCircuitBreaker != nil {
+		sg["sp"] = "OFF"
+		if (lbObj.CircuitBreaker != nil && lbObj.CircuitBreaker.MaxPendingRequests > 0) || (lbObj.HighCircuitBreaker != nil && lbObj.HighCircuitBreaker.MaxPendingRequests > 0) {
+			sg["sp"] = "ON"
+		}
+	}
 	if lbObj.NetprofileName != "" {
 		sg["netprofile"] = lbObj.NetprofileName
 	}
+	if lbObj.ServerTimeout > 0 {
+		sg["svrtimeout"] = lbObj.ServerTimeout
+	}
+	healthMonitors, lbMonWeight, monThreshold := lbObj.getHealthLbmonitors(lbObj.BackendServiceType == "SSL" || lbObj.BackendServiceType == "SSL_TCP")
+	sg["monthreshold"] = monThreshold
 	//TODO copy all servicegroup members before deleting and readding with new type
 	confErr.updateError(doNitro(client, nitroConfig{"servicegroup", lbObj.Name, sg, "add", "", "", ""}, nil, []nitroConfig{{"servicegroup", lbObj.Name, nil, "delete", "", "", ""}, {"servicegroup", lbObj.Name, sg, "add", "", "", ""}}))
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver_servicegroup_binding.Type(), lbObj.Name, lb.Lbvserverservicegroupbinding{Name: lbObj.Name, Servicegroupname: lbObj.Name}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	highPriorityLbName := GetHighPriorityLbName(lbObj.Name)
+	if lbObj.HighCircuitBreaker != nil {
+		lbInst.Name = highPriorityLbName
+		lbvserverAdd(client, confErr, lbInst, lbObj.HighCircuitBreaker)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver_servicegroup_binding.Type(), highPriorityLbName, lb.Lbvserverservicegroupbinding{Name: highPriorityLbName, Servicegroupname: lbObj.Name}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	} else {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), highPriorityLbName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+	if lbObj.HTTPProtocolOptions == nil {
+		httpProfileDelete(client, confErr, lbObj.Name, lbObj.BackendServiceType)
+	}
 	if lbObj.BackendServiceType == "SSL" || lbObj.BackendServiceType == "SSL_TCP" {
 		addSSLServiceGroup(client, lbObj.Name, lbObj.BackendTLS, confErr)
 	}
 	// Creating LB Monitor for outlier detection purpose
 	lbMonName := getLbMonName(lbObj.Name)
 	if lbObj.LbMonitorObj == nil {
-		// Remove HTTP-Inline LB monitor bound to servicegroup if outlier detection field is not passed in cluster resource
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_lbmonitor_binding.Type(), lbObj.Name, map[string]string{"servicegroupname": lbObj.Name, "monitor_name": lbMonName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), lbMonName, map[string]string{"monitorname": lbMonName, "type": "HTTP-INLINE"}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		// Remove LB monitor bound to servicegroup if outlier detection field is not passed in cluster resource
+		if monType := getMonitorType(client, lbMonName); monType != "" {
+			monitorDelete(client, confErr, lbObj.Name, lbMonName, monType)
+		}
 	} else { // Adds lb monitor, and bind it to the servicegroup
-		if lbObj.LbMonitorObj.Retries == 0 {
-			lbObj.LbMonitorObj.Retries = defaultRetries
+		// Monitor spec may be shared by the copies of the LB vserver spec, hence the defaults are set on a copy
+		lbMonitorObj := lbObj.LbMonitorObj.deepCopy()
+		if lbMonitorObj.Type == "" {
+			lbMonitorObj.Type = "HTTP-INLINE"
+		}
+		if monType := getMonitorType(client, lbMonName); monType != "" && monType != lbMonitorObj.Type {
+			monitorDelete(client, confErr, lbObj.Name, lbMonName, monType)
+		}
+		if lbMonitorObj.Retries == 0 {
+			lbMonitorObj.Retries = defaultRetries
 		}
 		// Citrix ADC can have max value of 20940 and 20939 for Interval and Downtime resp. but it can accept various types for duration.
 		// Convert the time to next level of unit in case time-value is more than max-allowed value.
-		lbObj.LbMonitorObj.Interval, lbObj.LbMonitorObj.IntervalUnits = convertTimeUnits(lbObj.LbMonitorObj.Interval, lbObj.LbMonitorObj.IntervalUnits, maxInterval, defaultInterval)
-		lbObj.LbMonitorObj.DownTime, lbObj.LbMonitorObj.DownTimeUnits = convertTimeUnits(lbObj.LbMonitorObj.DownTime, lbObj.LbMonitorObj.DownTimeUnits, maxDownTime, defaultDownTime)
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), lbMonName, lb.Lbmonitor{Monitorname: lbMonName, Type: "HTTP-INLINE", Action: "DOWN", Respcode: []string{"200"}, Httprequest: "HEAD /", Retries: lbObj.LbMonitorObj.Retries, Interval: lbObj.LbMonitorObj.Interval, Units2: lbObj.LbMonitorObj.IntervalUnits, Downtime: lbObj.LbMonitorObj.DownTime, Units3: lbObj.LbMonitorObj.DownTimeUnits}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_lbmonitor_binding.Type(), lbObj.Name, basic.Servicegrouplbmonitorbinding{Servicegroupname: lbObj.Name, Monitorname: lbMonName}, "add", "", "", ""}, []string{"The monitor is already bound to the service"}, nil))
+		lbMonitorObj.Interval, lbMonitorObj.IntervalUnits = convertTimeUnits(lbMonitorObj.Interval, lbMonitorObj.IntervalUnits, maxInterval, defaultInterval)
+		lbMonitorObj.DownTime, lbMonitorObj.DownTimeUnits = convertTimeUnits(lbMonitorObj.DownTime, lbMonitorObj.DownTimeUnits, maxDownTime, defaultDownTime)
+		lbMonitor := lb.Lbmonitor{Monitorname: lbMonName, Type: lbMonitorObj.Type, Retries: lbMonitorObj.Retries, Interval: lbMonitorObj.Interval, Units2: lbMonitorObj.IntervalUnits, Downtime: lbMonitorObj.DownTime, Units3: lbMonitorObj.DownTimeUnits}
+		if lbMonitorObj.Type == "HTTP-INLINE" {
+			lbMonitor.Action = "DOWN"
+			lbMonitor.Httprequest = "HEAD /"
+			lbMonitor.Respcode = lbMonitorObj.RespCodes
+			if len(lbMonitor.Respcode) == 0 {
+				lbMonitor.Respcode = []string{"200"}
+			}
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), lbMonName, lbMonitor, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+		monitorBind(client, confErr, lbObj.Name, lbMonName, lbMonWeight)
 	}
-	// Add stringmap binding
-	if lbObj.StringMapBindingObj != nil {
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policystringmap_pattern_binding.Type(), lbObj.StringMapBindingObj.StringMapName, policy.Policystringmappatternbinding{Name: lbObj.StringMapBindingObj.StringMapName, Key: lbObj.StringMapBindingObj.Key, Value: lbObj.StringMapBindingObj.Value}, "add", "", "", ""}, nil, nil))
+	lbObj.healthMonitorsAdd(client, confErr, healthMonitors)
+	// Add stringmap bindings
+	for _, stringMapBinding := range lbObj.StringMapBindings {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policystringmap_pattern_binding.Type(), stringMapBinding.StringMapName, policy.Policystringmappatternbinding{Name: stringMapBinding.StringMapName, Key: stringMapBinding.Key, Value: stringMapBinding.Value}, "add", "", "", ""}, nil, nil))
 	}
 	return confErr.getError()
 }
@@ -220,6 +621,7 @@ func (lbObj *LBApi) Delete(client *netscaler.NitroClient) error {
 	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), lbObj.Name, nil, "delete", "", "", ""}, nil,
 		[]nitroConfig{{netscaler.Lbvserver.Type(), lbObj.Name, lb.Lbvserver{Name: lbObj.Name, Newname: lbObj.Name + "_stale"}, "rename", "", "", ""},
 			{netscaler.Lbvserver.Type(), lbObj.Name, lb.Lbvserver{Name: lbObj.Name + "_stale"}, "disable", "", "", ""}}))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbvserver.Type(), GetHighPriorityLbName(lbObj.Name), nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 	/* Check if SSL ServiceGroup is present, then remove the cert binding */
 	removeCertBindings(client, confErr, netscaler.Sslservicegroup.Type(), lbObj.Name, "servicegroupname", netscaler.Sslservicegroup_sslcertkey_binding.Type())
 	/* Remove endpoint info for all servicegroup members */
@@ -228,12 +630,23 @@ func (lbObj *LBApi) Delete(client *netscaler.NitroClient) error {
 		nsconfLogger.Debug("In LBApi delete: Error in removing endPoint metadata", "Servicegroup", lbObj.Name, "Error", err)
 	}
 	confErr.updateError(doNitro(client, nitroConfig{resourceType: netscaler.Servicegroup.Type(), resourceName: lbObj.Name, resource: nil, operation: "delete"}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nshttpprofile.Type(), getHTTPProfileName(lbObj.Name), nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
 	// Get rid of HTTP-Inline lbmonitor also if present.
 	lbMonName := getLbMonName(lbObj.Name)
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), lbMonName, map[string]string{"monitorname": lbMonName, "type": "HTTP-INLINE"}, "delete", "", "", ""}, []string{"No such resource"}, nil))
-	// Get key of stringmapbinding
-	if lbObj.StringMapBindingObj != nil {
-		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policystringmap.Type(), lbObj.StringMapBindingObj.StringMapName, nil, "unbind", "pattern", lbObj.StringMapBindingObj.Key, "key"}, nil, nil))
+	if monType := getMonitorType(client, lbMonName); monType != "" {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), lbMonName, map[string]string{"monitorname": lbMonName, "type": monType}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+	for index := 0; ; index++ {
+		monName := getHealthMonName(lbObj.Name, index)
+		monType := getMonitorType(client, monName)
+		if monType == "" {
+			break
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Lbmonitor.Type(), monName, map[string]string{"monitorname": monName, "type": monType}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+	// Get key of stringmapbindings
+	for _, stringMapBinding := range lbObj.StringMapBindings {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Policystringmap.Type(), stringMapBinding.StringMapName, nil, "unbind", "pattern", stringMapBinding.Key, "key"}, nil, nil))
 	}
 	return confErr.getError()
 }
@@ -250,10 +663,11 @@ type Metadata struct {
 // ServiceGroupMember is a way of specifying the ip/domain-name and port of each service endpoint associated with an LB vserver
 // Weight assigned to a servicegroup member indicates the percentage of traffic that should be sent to that service
 type ServiceGroupMember struct {
-	IP     string
-	Domain string
-	Port   int
-	Weight int
+	IP       string
+	Domain   string
+	Port     int
+	Weight   int
+	Draining bool // Draining member is gracefully disabled, so that it receives no new connections while the existing ones complete
 	// Metadata will be common for all IP-endpoints. So let it be part of ServiceGroupAPI
 }
 
@@ -268,6 +682,10 @@ type ServiceGroupAPI struct {
 	IsIPOnlySvcGroup bool
 	// Metadata will be common for all IP-endpoints.
 	Metadata Metadata
+	// Draining members, and the IP members removed from the servicegroup, are gracefully disabled for GracefulDelay seconds.
+	// Removed members are unbound by a later update, once they are out of service. Draining members are excluded if GracefulDelay is 0
+	GracefulDelay    int
+	lingeringMembers bool // Removed members were kept bound by the last Add
 }
 
 // NewServiceGroupAPI returns a new ServiceGroupAPI object
@@ -329,13 +747,97 @@ func (svcGpObj *ServiceGroupAPI) bindAnalyticsProfile(client *netscaler.NitroCli
 func (svcGpObj *ServiceGroupAPI) Add(client *netscaler.NitroClient) error {
 	nsconfLogger.Trace("ServiceGroupAPI add", "svcGpObj", svcGpObj)
 	var err error
+	bindObj, drainMembers, enableMembers := svcGpObj.getGracefulMembers(client)
 	// Check the type of Service Group. whether autoscale
 	if isBuildDesiredStateAPICompatible() && svcGpObj.IsIPOnlySvcGroup == true {
-		err = svcGpObj.useDesiredStateAPI(client)
+		err = bindObj.useDesiredStateAPI(client)
 	} else {
-		err = svcGpObj.useClassicAPI(client)
+		err = bindObj.useClassicAPI(client)
+	}
+	confErr := newNitroError()
+	confErr.updateError(err)
+	for _, member := range drainMembers {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup.Type(), svcGpObj.Name, map[string]interface{}{"servicegroupname": svcGpObj.Name, "servername": member.getServerName(), "port": member.Port, "delay": svcGpObj.GracefulDelay, "graceful": "YES"}, "disable", "", "", ""}, nil, nil))
+	}
+	for _, member := range enableMembers {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup.Type(), svcGpObj.Name, map[string]interface{}{"servicegroupname": svcGpObj.Name, "servername": member.getServerName(), "port": member.Port}, "enable", "", "", ""}, nil, nil))
+	}
+	return confErr.getError()
+}
+
+// HasLingeringMembers returns true if the last Add kept removed members bound until they are out of service.
+// Servicegroup needs to be added again after GracefulDelay seconds to unbind them
+func (svcGpObj *ServiceGroupAPI) HasLingeringMembers() bool {
+	return svcGpObj.lingeringMembers
+}
+
+// getServerName returns the name of the server of the member, i.e. its IP address, or the server entity of its domain
+func (member *ServiceGroupMember) getServerName() string {
+	if member.Domain != "" {
+		return GetNSCompatibleName(member.Domain)
+	}
+	return member.IP
+}
+
+// getGracefulMembers returns the servicegroup with the members to be bound, i.e. the members other than the draining members not bound yet,
+// and the removed IP members which are not out of service yet. It also returns the members to be gracefully disabled, and the disabled members
+// to be enabled again. Draining members are excluded if GracefulDelay is 0. Whether removed members are kept bound is recorded in the servicegroup
+func (svcGpObj *ServiceGroupAPI) getGracefulMembers(client *netscaler.NitroClient) (*ServiceGroupAPI, []ServiceGroupMember, []ServiceGroupMember) {
+	svcGpObj.lingeringMembers = false
+	bindObj := *svcGpObj
+	bindObj.Members = nil
+	var drainMembers, enableMembers []ServiceGroupMember
+	// Servicegroup may not have any members yet
+	svcGpBindings, _ := client.FindResourceArray(netscaler.Servicegroup_servicegroupmember_binding.Type(), svcGpObj.Name)
+	bindings := make(map[string]map[string]interface{})
+	keys := make([]string, 0, len(svcGpBindings))
+	for _, svcGpBinding := range svcGpBindings {
+		servername, _ := getValueString(svcGpBinding, "servername")
+		port, _ := svcGpBinding["port"].(float64)
+		key := servername + ":" + fmt.Sprint(int(port))
+		bindings[key] = svcGpBinding
+		keys = append(keys, key)
+	}
+	for _, member := range svcGpObj.Members {
+		key := member.getServerName() + ":" + fmt.Sprint(member.Port)
+		binding, bound := bindings[key]
+		delete(bindings, key)
+		state, _ := getValueString(binding, "state")
+		if member.Draining {
+			if !bound || svcGpObj.GracefulDelay <= 0 {
+				continue
+			}
+			if state != "DISABLED" {
+				drainMembers = append(drainMembers, member)
+			}
+		} else if state == "DISABLED" {
+			enableMembers = append(enableMembers, member)
+		}
+		bindObj.Members = append(bindObj.Members, member)
+	}
+	if svcGpObj.GracefulDelay <= 0 {
+		return &bindObj, drainMembers, enableMembers
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		binding, ok := bindings[key]
+		if !ok {
+			continue
+		}
+		servername, _ := getValueString(binding, "servername")
+		svrState, _ := getValueString(binding, "svrstate")
+		if net.ParseIP(servername) == nil || svrState == "OUT OF SERVICE" {
+			continue
+		}
+		port, _ := binding["port"].(float64)
+		member := ServiceGroupMember{IP: servername, Port: int(port), Draining: true}
+		bindObj.Members = append(bindObj.Members, member)
+		svcGpObj.lingeringMembers = true
+		if state, _ := getValueString(binding, "state"); state != "DISABLED" {
+			drainMembers = append(drainMembers, member)
+		}
 	}
-	return err
+	return &bindObj, drainMembers, enableMembers
 }
 
 func (svcGpObj *ServiceGroupAPI) useDesiredStateAPI(client *netscaler.NitroClient) error {
@@ -379,9 +881,9 @@ func (svcGpObj *ServiceGroupAPI) useClassicAPI(client *netscaler.NitroClient) er
 		if member.Domain != "" {
 			serverName = GetNSCompatibleName(member.Domain)
 			confErr.updateError(doNitro(client, nitroConfig{netscaler.Server.Type(), serverName, basic.Server{Name: serverName, Domain: member.Domain, State: "ENABLED"}, "add", "", "", ""}, []string{"Invalid value [domain, value differs from existing entity and it cant be updated.]"}, nil))
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_servicegroupmember_binding.Type(), svcGpObj.Name, basic.Servicegroupservicegroupmemberbinding{Servicegroupname: svcGpObj.Name, Servername: serverName, Port: member.Port}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_servicegroupmember_binding.Type(), svcGpObj.Name, basic.Servicegroupservicegroupmemberbinding{Servicegroupname: svcGpObj.Name, Servername: serverName, Port: member.Port, Weight: member.Weight}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
 		} else {
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_servicegroupmember_binding.Type(), svcGpObj.Name, basic.Servicegroupservicegroupmemberbinding{Servicegroupname: svcGpObj.Name, Ip: member.IP, Port: member.Port}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Servicegroup_servicegroupmember_binding.Type(), svcGpObj.Name, basic.Servicegroupservicegroupmemberbinding{Servicegroupname: svcGpObj.Name, Ip: member.IP, Port: member.Port, Weight: member.Weight}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
 			addEndpointMetadata(client, member.IP, svcGpObj.Metadata)
 		}
 	}
@@ -400,15 +902,18 @@ func (svcGpObj *ServiceGroupAPI) useClassicAPI(client *netscaler.NitroClient) er
 						port := int(portF)
 						found := false
 						update := false
-						wt, _ := svcGpBinding["weight"].(int)
+						wt, _ := getValueInt(svcGpBinding, "weight")
+						state, _ := getValueString(svcGpBinding, "state")
 						for _, member := range svcGpObj.Members {
 							if member.Port == port &&
 								(member.IP == servername ||
 									(member.Domain != "" && GetNSCompatibleName(member.Domain) == servername)) {
 								found = true
 								/* if the weight of current desired state of servicegroup member doesn't match with the previous weight assigned, then delete old binding and add the new binding */
-								if wt != member.Weight {
+								// Disabled and draining members are not rebound, as the new binding would be enabled again
+								if member.Weight > 0 && wt != member.Weight && !member.Draining && state != "DISABLED" {
 									update = true
+									wt = member.Weight
 								}
 								break
 							}
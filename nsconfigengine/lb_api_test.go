@@ -14,8 +14,10 @@ limitations under the License.
 package nsconfigengine
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/citrix/adc-nitro-go/resource/config/ns"
 	"github.com/citrix/citrix-xds-adaptor/tests/env"
 )
 
@@ -76,6 +78,107 @@ func Test_convertTimeUnits(t *testing.T) {
 
 }
 
+func Test_getSlowStartParams(t *testing.T) {
+	cases := []struct {
+		window           int
+		expectedPercent  int
+		expectedInterval int
+	}{
+		{60, 5, 3},
+		{5, 20, 1},
+		{3, 34, 1},
+		{15, 7, 1},
+		{150, 2, 3},
+		{1000, 1, 10},
+	}
+	for _, c := range cases {
+		if percent, interval := getSlowStartParams(c.window); percent != c.expectedPercent || interval != c.expectedInterval {
+			t.Errorf("Expected %d percent every %d seconds for window %d, received %d percent every %d seconds", c.expectedPercent, c.expectedInterval, c.window, percent, interval)
+		}
+	}
+}
+
+func Test_CircuitBreaker_getSpilloverThreshold(t *testing.T) {
+	testCases := []struct {
+		input          CircuitBreaker
+		expectedOutput int
+	}{
+		{CircuitBreaker{}, 0},
+		{CircuitBreaker{MaxPendingRequests: 10}, 0},
+		{CircuitBreaker{MaxConnections: 100, MaxRequests: 50, MaxPendingRequests: 10}, 60},
+		{CircuitBreaker{MaxRequests: 200}, 200},
+		{CircuitBreaker{MaxConnections: 4294967290, MaxPendingRequests: 100}, maxSpilloverThreshold},
+	}
+	for _, c := range testCases {
+		output := c.input.getSpilloverThreshold()
+		if output != c.expectedOutput {
+			t.Errorf("FAILED!!! Expected: %d. Received: %d", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_HTTPProtocolOptions_getNshttpprofile(t *testing.T) {
+	testCases := []struct {
+		input          HTTPProtocolOptions
+		expectedOutput ns.Nshttpprofile
+	}{
+		{HTTPProtocolOptions{}, ns.Nshttpprofile{Name: "p1", Http2: "DISABLED", Http2direct: "DISABLED", Http2maxconcurrentstreams: 300, Http2initialwindowsize: 65535, Http2initialconnwindowsize: 65535}},
+		{HTTPProtocolOptions{HTTP2: true, InitialConnWindowSize: 1048576}, ns.Nshttpprofile{Name: "p1", Http2: "ENABLED", Http2direct: "DISABLED", Http2maxconcurrentstreams: 300, Http2initialwindowsize: 65535, Http2initialconnwindowsize: 1048576}},
+		{HTTPProtocolOptions{HTTP2: true, HTTP2Direct: true}, ns.Nshttpprofile{Name: "p1", Http2: "ENABLED", Http2direct: "ENABLED", Http2maxconcurrentstreams: 300, Http2initialwindowsize: 65535, Http2initialconnwindowsize: 65535}},
+	}
+	for _, c := range testCases {
+		output := c.input.getNshttpprofile("p1", 300)
+		if !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("FAILED!!! Expected: %v. Received: %v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_HealthMonitor_getLbmonitor(t *testing.T) {
+	cases := []struct {
+		input          HealthMonitor
+		secure         bool
+		expectedOutput map[string]interface{}
+	}{
+		{HealthMonitor{Type: "HTTP", HTTPRequest: "GET /healthz", Host: "svc.local", RespCodes: []string{"200-299"}, Interval: 10000, Timeout: 500, UnhealthyThreshold: 3, HealthyThreshold: 2}, false,
+			map[string]interface{}{"monitorname": "m1", "type": "HTTP", "lrtm": "DISABLED", "httprequest": "GET /healthz", "customheaders": "Host: svc.local\r\n", "respcode": []string{"200-299"},
+				"interval": 10000, "units3": "MSEC", "resptimeout": 500, "units4": "MSEC", "retries": 3, "successretries": 2}},
+		{HealthMonitor{Type: "TCP-ECV", Send: "PING", Recv: []string{"PONG"}, Interval: 3000, Timeout: 5000}, true,
+			map[string]interface{}{"monitorname": "m1", "type": "TCP-ECV", "lrtm": "DISABLED", "secure": "YES", "send": "PING", "recv": "PONG",
+				"interval": 3000, "units3": "MSEC", "resptimeout": 2999, "units4": "MSEC"}},
+		{HealthMonitor{Type: "GRPC", GRPCService: "grpc.health"}, false,
+			map[string]interface{}{"monitorname": "m1", "type": "HTTP", "lrtm": "DISABLED", "grpchealthcheck": "YES", "grpcservicename": "grpc.health", "respcode": []string{"200"},
+				"interval": defaultInterval, "units3": "SEC", "resptimeout": defaultRespTimeout, "units4": "SEC"}},
+	}
+	for _, c := range cases {
+		if output := c.input.getLbmonitor("m1", c.secure); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %v, received %v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_LBApi_getHealthLbmonitors(t *testing.T) {
+	lbObj := NewLBApi("lbhc", "TCP", "TCP", "ROUNDROBIN")
+	lbObj.HealthMonitors = []HealthMonitor{{Type: "TCP"}, {Type: "TCP-ECV", Send: "PING", Recv: []string{"PONG"}}}
+	monitors, lbMonWeight, monThreshold := lbObj.getHealthLbmonitors(false)
+	if len(monitors) != 2 || monitors[0].weight != 1 || monitors[1].weight != 1 || lbMonWeight != 1 || monThreshold != 0 {
+		t.Errorf("Expected 2 monitors of weight 1 without threshold, received %+v, %d, %d", monitors, lbMonWeight, monThreshold)
+	}
+	lbObj.LbMonitorObj = &LBMonitor{}
+	lbObj.HealthMonitors = []HealthMonitor{{Type: "TCP"}, {Type: "TCP-ECV", Send: "PING", Recv: []string{"PONG", "OK", "READY"}}}
+	monitors, lbMonWeight, monThreshold = lbObj.getHealthLbmonitors(false)
+	expected := []healthLbmonitor{
+		{lbObj.HealthMonitors[0].getLbmonitor("lbhc_hcmon0", false), 3},
+		{map[string]interface{}{"monitorname": "lbhc_hcmon1", "type": "TCP-ECV", "lrtm": "DISABLED", "send": "PING", "recv": "PONG", "interval": defaultInterval, "units3": "SEC", "resptimeout": defaultRespTimeout, "units4": "SEC"}, 1},
+		{map[string]interface{}{"monitorname": "lbhc_hcmon2", "type": "TCP-ECV", "lrtm": "DISABLED", "send": "PING", "recv": "OK", "interval": defaultInterval, "units3": "SEC", "resptimeout": defaultRespTimeout, "units4": "SEC"}, 1},
+		{map[string]interface{}{"monitorname": "lbhc_hcmon3", "type": "TCP-ECV", "lrtm": "DISABLED", "send": "PING", "recv": "READY", "interval": defaultInterval, "units3": "SEC", "resptimeout": defaultRespTimeout, "units4": "SEC"}, 1},
+	}
+	// TCP and outlier detection monitors weigh 3 each, and any of the payload monitors needs to be UP as well
+	if !reflect.DeepEqual(monitors, expected) || lbMonWeight != 3 || monThreshold != 7 {
+		t.Errorf("Expected %+v, 3, 7, received %+v, %d, %d", expected, monitors, lbMonWeight, monThreshold)
+	}
+}
+
 func Test_LBApi_http(t *testing.T) {
 	lbObj := NewLBApi("lbent1", "HTTP", "HTTP", "ROUNDROBIN")
 	lbObj.MaxConnections = 200
@@ -213,6 +316,269 @@ func Test_LBApi_tcp(t *testing.T) {
 	}
 }
 
+func Test_LBApi_healthMonitors(t *testing.T) {
+	lbObj := NewLBApi("lbenthc", "HTTP", "HTTP", "ROUNDROBIN")
+	lbObj.HealthMonitors = []HealthMonitor{
+		{Type: "HTTP", HTTPRequest: "GET /healthz", RespCodes: []string{"200-299"}, Interval: 10000, Timeout: 1000, UnhealthyThreshold: 3, HealthyThreshold: 2},
+		{Type: "TCP", Interval: 5000},
+	}
+	client := env.GetNitroClient()
+	t.Logf("Test LBApi.Add with health monitors")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"lbmonitor", "lbenthc_hcmon0", map[string]interface{}{"monitorname": "lbenthc_hcmon0", "type": "HTTP", "httprequest": "GET /healthz", "retries": 3, "successretries": 2}},
+		{"lbmonitor", "lbenthc_hcmon1", map[string]interface{}{"monitorname": "lbenthc_hcmon1", "type": "TCP"}},
+		{"servicegroup_lbmonitor_binding", "lbenthc", map[string]interface{}{"servicegroupname": "lbenthc", "monitor_name": "lbenthc_hcmon0"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbenthc", err)
+	}
+	t.Logf("Test LBApi update with health monitor type change and removal")
+	lbObj.HealthMonitors = []HealthMonitor{{Type: "TCP-ECV", Send: "PING", Recv: []string{"PONG"}, Interval: 5000}}
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbmonitor", "lbenthc_hcmon0", map[string]interface{}{"monitorname": "lbenthc_hcmon0", "type": "TCP-ECV", "send": "PING", "recv": "PONG"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbenthc", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbmonitor", "lbenthc_hcmon1", map[string]interface{}{"monitorname": "lbenthc_hcmon1", "type": "TCP"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbenthc", err)
+	}
+	t.Logf("Test LBApi delete")
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"servicegroup", "lbenthc", map[string]interface{}{"servicegroupname": "lbenthc", "servicetype": "HTTP"}},
+		{"lbmonitor", "lbenthc_hcmon0", map[string]interface{}{"monitorname": "lbenthc_hcmon0", "type": "TCP-ECV"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete %v, error %v", "lbenthc", err)
+	}
+}
+
+func Test_LBMonitor_deepCopy(t *testing.T) {
+	lbMonitor := &LBMonitor{RespCodes: []string{"100-499"}, Retries: 5}
+	lbMonitorCopy := lbMonitor.deepCopy()
+	lbMonitorCopy.Retries = defaultRetries
+	lbMonitorCopy.RespCodes[0] = "200"
+	if lbMonitor.Retries != 5 || lbMonitor.RespCodes[0] != "100-499" {
+		t.Errorf("Expected monitor spec to be left unchanged by its copy, received %+v", lbMonitor)
+	}
+}
+
+func Test_LBApi_outlierMonitor(t *testing.T) {
+	lbObj := NewLBApi("lbentod", "HTTP", "HTTP", "ROUNDROBIN")
+	lbObj.LbMonitorObj = &LBMonitor{RespCodes: []string{"100-501", "505-599"}, Retries: 4, Interval: 3, IntervalUnits: "SEC"}
+	client := env.GetNitroClient()
+	lbMonitorObj := lbObj.LbMonitorObj.deepCopy()
+	t.Logf("Test LBApi.Add with outlier monitor of gateway failures")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	if !reflect.DeepEqual(lbObj.LbMonitorObj, lbMonitorObj) {
+		t.Errorf("Expected outlier monitor spec %+v to be left unchanged, received %+v", lbMonitorObj, lbObj.LbMonitorObj)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "HTTP-INLINE", "respcode": []interface{}{"100-501", "505-599"}, "retries": 4, "interval": 3}},
+		{"servicegroup_lbmonitor_binding", "lbentod", map[string]interface{}{"servicegroupname": "lbentod", "monitor_name": "lbentod_lbmon"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbentod", err)
+	}
+	t.Logf("Test LBApi update with outlier monitor of 5xx errors")
+	lbObj.LbMonitorObj = &LBMonitor{RespCodes: []string{"100-499"}, Retries: 5}
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "HTTP-INLINE", "respcode": []interface{}{"100-499"}, "retries": 5}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbentod", err)
+	}
+	t.Logf("Test LBApi delete")
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentod", map[string]interface{}{"name": "lbentod"}},
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "HTTP-INLINE"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete %v, error %v", "lbentod", err)
+	}
+}
+
+func Test_LBApi_tcpOutlierMonitor(t *testing.T) {
+	lbObj := NewLBApi("lbentod", "TCP", "TCP", "ROUNDROBIN")
+	lbObj.LbMonitorObj = &LBMonitor{Type: "TCP", Retries: 4, Interval: 3, IntervalUnits: "SEC", MaxEjectionPercent: 40}
+	client := env.GetNitroClient()
+	t.Logf("Test LBApi.Add with TCP outlier monitor")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"lbvserver", "lbentod", map[string]interface{}{"name": "lbentod", "servicetype": "TCP", "healththreshold": 60}},
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "TCP", "retries": 4, "interval": 3}},
+		{"servicegroup_lbmonitor_binding", "lbentod", map[string]interface{}{"servicegroupname": "lbentod", "monitor_name": "lbentod_lbmon"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbentod", err)
+	}
+	t.Logf("Test LBApi update with HTTP outlier monitor")
+	lbObj = NewLBApi("lbentod", "HTTP", "HTTP", "ROUNDROBIN")
+	lbObj.LbMonitorObj = &LBMonitor{RespCodes: []string{"100-499"}, Retries: 5}
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentod", map[string]interface{}{"name": "lbentod", "servicetype": "HTTP"}},
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "HTTP-INLINE", "respcode": []interface{}{"100-499"}, "retries": 5}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbentod", err)
+	}
+	t.Logf("Test LBApi delete")
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentod", map[string]interface{}{"name": "lbentod"}},
+		{"lbmonitor", "lbentod_lbmon", map[string]interface{}{"monitorname": "lbentod_lbmon", "type": "HTTP-INLINE"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete %v, error %v", "lbentod", err)
+	}
+}
+
+func Test_LBApi_circuitBreaker(t *testing.T) {
+	lbObj := NewLBApi("lbentcb", "HTTP", "HTTP", "ROUNDROBIN")
+	lbObj.MaxConnections = 100
+	lbObj.CircuitBreaker = &CircuitBreaker{MaxConnections: 100, MaxRequests: 300, MaxPendingRequests: 20}
+	lbObj.HighCircuitBreaker = &CircuitBreaker{MaxConnections: 10}
+	client := env.GetNitroClient()
+	t.Logf("Test LBApi.Add with circuit breaker")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"lbvserver", "lbentcb", map[string]interface{}{"name": "lbentcb", "somethod": "CONNECTION", "sothreshold": 120, "sobackupaction": "DROP"}},
+		{"servicegroup", "lbentcb", map[string]interface{}{"servicegroupname": "lbentcb", "maxclient": 100, "sp": "ON"}},
+		{"lbvserver", "lbentcb_high", map[string]interface{}{"name": "lbentcb_high", "somethod": "CONNECTION", "sothreshold": 10, "sobackupaction": "DROP"}},
+		{"lbvserver_servicegroup_binding", "lbentcb_high", map[string]interface{}{"name": "lbentcb_high", "servicegroupname": "lbentcb"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbentcb", err)
+	}
+	t.Logf("Test LBApi update without HIGH priority circuit breaker")
+	lbObj.CircuitBreaker = &CircuitBreaker{MaxConnections: 100}
+	lbObj.HighCircuitBreaker = nil
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentcb", map[string]interface{}{"name": "lbentcb", "somethod": "CONNECTION", "sothreshold": 100}},
+		{"servicegroup", "lbentcb", map[string]interface{}{"servicegroupname": "lbentcb", "sp": "OFF"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbentcb", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentcb_high", map[string]interface{}{"name": "lbentcb_high"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbentcb_high", err)
+	}
+	t.Logf("Test LBApi update without circuit breaker")
+	lbObj.CircuitBreaker = nil
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbentcb", map[string]interface{}{"name": "lbentcb", "somethod": "NONE"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbentcb", err)
+	}
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+}
+
+func Test_LBApi_httpProtocolOptions(t *testing.T) {
+	lbObj := NewLBApi("lbenth2", "HTTP", "HTTP", "ROUNDROBIN")
+	lbObj.MaxHTTP2ConcurrentStreams = 200
+	lbObj.HTTPProtocolOptions = &HTTPProtocolOptions{HTTP2: true, HTTP2Direct: true, InitialStreamWindowSize: 1048576}
+	client := env.GetNitroClient()
+	t.Logf("Test LBApi.Add with HTTP/2 to services")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"nshttpprofile", "lbenth2_httpprofile", map[string]interface{}{"name": "lbenth2_httpprofile", "http2": "ENABLED", "http2direct": "ENABLED", "http2maxconcurrentstreams": 200, "http2initialwindowsize": 1048576, "http2initialconnwindowsize": 65535}},
+		{"servicegroup", "lbenth2", map[string]interface{}{"servicegroupname": "lbenth2", "httpprofilename": "lbenth2_httpprofile"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbenth2", err)
+	}
+	t.Logf("Test LBApi update without protocol options")
+	lbObj.HTTPProtocolOptions = nil
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	err = env.VerifyConfigBlockPresence(client, []env.VerifyNitroConfig{{"servicegroup", "lbenth2", map[string]interface{}{"servicegroupname": "lbenth2", "httpprofilename": "nshttp_profile_200"}}})
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbenth2", err)
+	}
+	err = env.VerifyConfigBlockAbsence(client, []env.VerifyNitroConfig{{"nshttpprofile", "lbenth2_httpprofile", map[string]interface{}{"name": "lbenth2_httpprofile"}}})
+	if err != nil {
+		t.Errorf("Config verification failed for Update %v, error %v", "lbenth2", err)
+	}
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+}
+
 func Test_LBApi_http_tls(t *testing.T) {
 	lbObj := NewLBApi("lbent1s", "HTTP", "SSL", "ROUNDROBIN")
 	lbObj.MaxConnections = 200
@@ -269,6 +635,44 @@ func Test_LBApi_http_tls(t *testing.T) {
 	}
 }
 
+func Test_LBApi_http_tls_serverNames(t *testing.T) {
+	lbObj := NewLBApi("lbent2s", "HTTP", "SSL", "ROUNDROBIN")
+	lbObj.BackendTLS = []SSLSpec{{CertFilename: "certssvc1_svc1", PrivateKeyFilename: "certssvc1_svc1_key", RootCertFilename: "certssvc1_rootCA", SNI: "svc1.citrixrootdummy1.com", SubjectAltNames: []string{"svc1.citrixrootdummy1.com"}}}
+	client := env.GetNitroClient()
+	UploadCert(client, "../tests/certs/certssvc1/svc1.citrixrootdummy1.com.crt", "certssvc1_svc1", "../tests/certs/certssvc1/svc1.citrixrootdummy1.com.key", "certssvc1_svc1_key")
+	UploadCert(client, "../tests/certs/certssvc1/rootCA.crt", "certssvc1_rootCA", "", "")
+	t.Logf("Test LBApi.Add with SNI and subject alternative name")
+	err := lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"sslservicegroup", "lbent2s", map[string]interface{}{"serverauth": "ENABLED", "servicegroupname": "lbent2s", "snienable": "ENABLED", "commonname": "svc1.citrixrootdummy1.com"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add %v, error %v", "lbent2s", err)
+	}
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+	t.Logf("Test LBApi.Add with several subject alternative names")
+	lbObj.BackendTLS[0].SubjectAltNames = []string{"svc1.citrixrootdummy1.com", "svc2.citrixrootdummy1.com"}
+	err = lbObj.Add(client)
+	if err == nil {
+		t.Errorf("LBApi add expected to fail with several subject alternative names")
+	}
+	configs = []env.VerifyNitroConfig{
+		{"lbvserver", "lbent2s", map[string]interface{}{"name": "lbent2s"}},
+		{"servicegroup", "lbent2s", map[string]interface{}{"servicegroupname": "lbent2s"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for refused Add %v, error %v", "lbent2s", err)
+	}
+}
+
 func Test_LBApi_tcp_to_http(t *testing.T) {
 	lbObj := NewLBApi("lb1", "TCP", "TCP", "ROUNDROBIN")
 	t.Logf("Adding LB of type TCP")
@@ -312,9 +716,68 @@ func Test_ServiceGroupAPI_ip(t *testing.T) {
 	if err != nil {
 		t.Errorf("Config verification for update failed with error %v", err)
 	}
+	t.Logf("Test weight update of the members")
+	svcGpObj.Members = []ServiceGroupMember{{IP: "1.1.1.2", Port: 80, Weight: 20}, {IP: "3.3.3.3", Port: 80, Weight: 5}, {IP: "2.2.2.2", Port: 9090}}
+	err = svcGpObj.Add(client)
+	if err != nil {
+		t.Errorf("ServiceGroup members weight update failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "servicegroup", "svcgp1", "servicegroupmember", []map[string]interface{}{{"ip": "3.3.3.3", "port": 80, "weight": 5}, {"ip": "2.2.2.2", "port": 9090, "weight": 1}, {"ip": "1.1.1.2", "port": 80, "weight": 20}})
+	if err != nil {
+		t.Errorf("Config verification for weight update failed with error %v", err)
+	}
 	client.DeleteResource("servicegroup", "svcgp1")
 }
 
+func Test_ServiceGroupAPI_graceful(t *testing.T) {
+	client := env.GetNitroClient()
+	client.AddResource("servicegroup", "svcgp4", map[string]interface{}{"servicegroupname": "svcgp4", "servicetype": "HTTP"})
+	svcGpObj := NewServiceGroupAPI("svcgp4")
+	svcGpObj.IsIPOnlySvcGroup = false
+	svcGpObj.GracefulDelay = 30
+	svcGpObj.Members = []ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 2}, {IP: "1.1.1.2", Port: 80}, {IP: "1.1.1.3", Port: 80, Draining: true}}
+	err := svcGpObj.Add(client)
+	if err != nil {
+		t.Errorf("ServiceGroup members add failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "servicegroup", "svcgp4", "servicegroupmember", []map[string]interface{}{{"ip": "1.1.1.1", "port": 80}, {"ip": "1.1.1.2", "port": 80}})
+	if err != nil {
+		t.Errorf("Config verification for add failed with error %v", err)
+	}
+	t.Logf("Test graceful disable of draining and removed members")
+	svcGpObj.Members = []ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 2, Draining: true}}
+	err = svcGpObj.Add(client)
+	if err != nil {
+		t.Errorf("ServiceGroup members update failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "servicegroup", "svcgp4", "servicegroupmember", []map[string]interface{}{{"ip": "1.1.1.1", "port": 80, "state": "DISABLED"}, {"ip": "1.1.1.2", "port": 80, "state": "DISABLED"}})
+	if err != nil {
+		t.Errorf("Config verification for graceful disable failed with error %v", err)
+	}
+	t.Logf("Test weight update of draining members does not rebind them")
+	svcGpObj.Members = []ServiceGroupMember{{IP: "1.1.1.1", Port: 80, Weight: 8, Draining: true}}
+	err = svcGpObj.Add(client)
+	if err != nil {
+		t.Errorf("ServiceGroup members update failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "servicegroup", "svcgp4", "servicegroupmember", []map[string]interface{}{{"ip": "1.1.1.1", "port": 80, "state": "DISABLED", "weight": 2}, {"ip": "1.1.1.2", "port": 80, "state": "DISABLED"}})
+	if err != nil {
+		t.Errorf("Config verification for graceful disable failed with error %v", err)
+	}
+	t.Logf("Test enable of members no longer draining")
+	svcGpObj.GracefulDelay = 0
+	svcGpObj.Members = []ServiceGroupMember{{IP: "1.1.1.1", Port: 80}}
+	err = svcGpObj.Add(client)
+	if err != nil {
+		t.Errorf("ServiceGroup members update failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "servicegroup", "svcgp4", "servicegroupmember", []map[string]interface{}{{"ip": "1.1.1.1", "port": 80}})
+	if err != nil {
+		t.Errorf("Config verification for enable failed with error %v", err)
+	}
+	client.DeleteResource("servicegroup", "svcgp4")
+}
+
 func Test_ServiceGroupAPI_domain(t *testing.T) {
 	client := env.GetNitroClient()
 	client.AddResource("servicegroup", "svcgp2", map[string]interface{}{"servicegroupname": "svcgp2", "servicetype": "HTTP"})
@@ -0,0 +1,295 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	"github.com/citrix/adc-nitro-go/resource/config/ns"
+	"github.com/citrix/adc-nitro-go/resource/config/responder"
+	"github.com/citrix/adc-nitro-go/resource/config/stream"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+const (
+	defaultRateLimitStatus = http.StatusTooManyRequests
+	minLimitTimeslice      = 10
+)
+
+// TokenBucket specifies the number of requests permitted in every fill interval
+type TokenBucket struct {
+	MaxTokens     int
+	TokensPerFill int
+	FillInterval  int // milliseconds
+}
+
+// RateLimitMatch specifies the request attributes to be matched by a rate limit descriptor. All the specified attributes need to match
+type RateLimitMatch struct {
+	Headers  []MatchHeader
+	ClientIP string
+}
+
+// RateLimitDescriptor specifies the token bucket applied to the requests matching any of Matches
+// Selector specifies the ADC expressions whose every distinct value is limited separately, e.g. CLIENT.IP.SRC for a limit per client
+type RateLimitDescriptor struct {
+	Matches     []RateLimitMatch
+	TokenBucket TokenBucket
+	Selector    []string
+}
+
+// RateLimit specifies the local rate limiting of the requests of a route.
+// A request is limited by the token bucket of the first descriptor it matches, and by TokenBucket if it matches none.
+// If AllDescriptors is set, a request is limited by every descriptor it matches.
+// Limit identifiers of a Shared rate limit are named after the CS vserver and hence shared by all the routes of the CS vserver,
+// otherwise they are owned by the route.
+// EnabledPercent is the percentage of requests subjected to rate limiting, and EnforcedPercent is the percentage of limited requests which are responded with StatusCode
+type RateLimit struct {
+	TokenBucket     *TokenBucket
+	Descriptors     []RateLimitDescriptor
+	StatusCode      int
+	PerConnection   bool
+	Shared          bool
+	EnabledPercent  int
+	EnforcedPercent int
+	AllDescriptors  bool
+}
+
+// getTimeslice returns the fill interval in multiples of 10 milliseconds as required by the limit identifier
+func (bucket *TokenBucket) getTimeslice() int {
+	if bucket.FillInterval <= minLimitTimeslice {
+		return minLimitTimeslice
+	}
+	return ((bucket.FillInterval + minLimitTimeslice - 1) / minLimitTimeslice) * minLimitTimeslice
+}
+
+func (bucket *TokenBucket) getLimitIdentifier(name, selectorName string) ns.Nslimitidentifier {
+	limitIdentifier := ns.Nslimitidentifier{Limitidentifier: name, Mode: "REQUEST_RATE", Threshold: bucket.TokensPerFill, Timeslice: bucket.getTimeslice(), Limittype: "SMOOTH", Selectorname: selectorName}
+	if bucket.MaxTokens > bucket.TokensPerFill {
+		limitIdentifier.Limittype = "BURSTY"
+	}
+	return limitIdentifier
+}
+
+func (match *RateLimitMatch) getMatchRule() string {
+	rules := make([]string, 0)
+	for _, header := range match.Headers {
+		if headerRule := header.getHeaderMatchRule(); headerRule != "" {
+			rules = append(rules, headerRule)
+		}
+	}
+	if match.ClientIP != "" {
+		if ip := net.ParseIP(match.ClientIP); ip != nil && ip.To4() == nil {
+			rules = append(rules, "CLIENT.IPV6.SRC.EQ("+match.ClientIP+")")
+		} else {
+			rules = append(rules, "CLIENT.IP.SRC.EQ("+match.ClientIP+")")
+		}
+	}
+	if len(rules) == 0 {
+		return "true"
+	}
+	return "(" + strings.Join(rules, " && ") + ")"
+}
+
+func (descriptor *RateLimitDescriptor) getMatchRule() string {
+	rules := make([]string, 0)
+	for _, match := range descriptor.Matches {
+		rules = append(rules, match.getMatchRule())
+	}
+	return "(" + strings.Join(rules, " || ") + ")"
+}
+
+// getLimitIdentifierName returns the name of the limit identifier of the index'th token bucket. Index 0 is the default token bucket and rest are of the descriptors
+func getLimitIdentifierName(prefix string, index int) string {
+	return GetNSCompatibleNameByLen(prefix+"_rl"+fmt.Sprint(index), 31)
+}
+
+// getGlobalLimitPrefix returns the prefix of the limit identifiers of the global rate limits of a CS vserver
+func getGlobalLimitPrefix(csVserverName string) string {
+	return csVserverName + "_g"
+}
+
+func getLimitSelectorName(prefix string) string {
+	return GetNSCompatibleNameByLen(prefix+"_rl", 31)
+}
+
+// getLimitRules returns the expressions which are true when the request exceeds each of the limits, and the number of limit identifiers they refer.
+// Limit identifiers are named after prefix
+func (rateLimit *RateLimit) getLimitRules(prefix string) ([]string, int) {
+	rules := make([]string, 0)
+	matched := make([]string, 0)
+	for i, descriptor := range rateLimit.Descriptors {
+		// Descriptor which no request of the route can match is retained only to keep the limit identifier names of the rest stable
+		if len(descriptor.Matches) == 0 {
+			continue
+		}
+		rule := descriptor.getMatchRule()
+		if len(matched) > 0 && !rateLimit.AllDescriptors {
+			rule = rule + " && !(" + strings.Join(matched, " || ") + ")"
+		}
+		rules = append(rules, "("+rule+" && SYS.CHECK_LIMIT(\""+getLimitIdentifierName(prefix, i+1)+"\"))")
+		matched = append(matched, descriptor.getMatchRule())
+	}
+	if rateLimit.TokenBucket != nil {
+		if len(matched) > 0 {
+			rules = append(rules, "(!("+strings.Join(matched, " || ")+") && SYS.CHECK_LIMIT(\""+getLimitIdentifierName(prefix, 0)+"\"))")
+		} else {
+			rules = append(rules, "SYS.CHECK_LIMIT(\""+getLimitIdentifierName(prefix, 0)+"\")")
+		}
+	}
+	if len(rules) == 0 {
+		return rules, 0
+	}
+	return rules, len(rateLimit.Descriptors) + 1
+}
+
+func (rateLimit *RateLimit) getEnabledRule(rule string) string {
+	if rateLimit.EnabledPercent < 100 {
+		rule = "SYS.RANDOM.MUL(100).LT(" + fmt.Sprint(rateLimit.EnabledPercent) + ") && " + rule
+	}
+	return rule
+}
+
+func (rateLimit *RateLimit) getEnforcedRule(rule string) string {
+	if rateLimit.EnforcedPercent < 100 {
+		rule = rule + " && SYS.RANDOM.MUL(100).LT(" + fmt.Sprint(rateLimit.EnforcedPercent) + ")"
+	}
+	return rule
+}
+
+// getLimitRule returns the expression which is true when the request exceeds the rate limit, and the number of limit identifiers it refers.
+// Limit identifiers are named after prefix
+func (rateLimit *RateLimit) getLimitRule(prefix string) (string, int) {
+	rules, limitCount := rateLimit.getLimitRules(prefix)
+	if len(rules) == 0 {
+		return "", 0
+	}
+	return rateLimit.getEnforcedRule(rateLimit.getEnabledRule("(" + strings.Join(rules, " || ") + ")")), limitCount
+}
+
+// limitIdentifiersAdd adds the limit identifiers of the default token bucket and of the descriptors, and the stream selector for per connection rate limiting
+func (rateLimit *RateLimit) limitIdentifiersAdd(client *netscaler.NitroClient, confErr *nitroError, prefix string) {
+	selectorName := ""
+	if rateLimit.PerConnection {
+		selectorName = getLimitSelectorName(prefix)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Streamselector.Type(), selectorName, stream.Streamselector{Name: selectorName, Rule: []string{"CLIENT.IP.SRC", "CLIENT.TCP.SRCPORT"}}, "add", "", "", ""}, nil, nil))
+	}
+	if rateLimit.TokenBucket != nil {
+		limitIdentifier := rateLimit.TokenBucket.getLimitIdentifier(getLimitIdentifierName(prefix, 0), selectorName)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nslimitidentifier.Type(), limitIdentifier.Limitidentifier, limitIdentifier, "add", "", "", ""}, nil, nil))
+	}
+	for i, descriptor := range rateLimit.Descriptors {
+		limitIdentifierName := getLimitIdentifierName(prefix, i+1)
+		descriptorSelectorName := selectorName
+		if len(descriptor.Selector) > 0 {
+			// Stream selector of the descriptor is named same as its limit identifier
+			descriptorSelectorName = limitIdentifierName
+			selectorRule := descriptor.Selector
+			if rateLimit.PerConnection {
+				selectorRule = append([]string{"CLIENT.IP.SRC", "CLIENT.TCP.SRCPORT"}, descriptor.Selector...)
+			}
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Streamselector.Type(), descriptorSelectorName, stream.Streamselector{Name: descriptorSelectorName, Rule: selectorRule}, "add", "", "", ""}, nil, nil))
+		}
+		limitIdentifier := descriptor.TokenBucket.getLimitIdentifier(limitIdentifierName, descriptorSelectorName)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nslimitidentifier.Type(), limitIdentifier.Limitidentifier, limitIdentifier, "add", "", "", ""}, nil, nil))
+	}
+}
+
+// limitIdentifiersDelete deletes the limit identifiers named after prefix starting from startIndex, along with their stream selectors.
+// Stream selector for per connection rate limiting is deleted along with the limit identifier of the default token bucket
+func limitIdentifiersDelete(client *netscaler.NitroClient, confErr *nitroError, prefix string, startIndex int) {
+	for index := startIndex; ; index++ {
+		limitIdentifierName := getLimitIdentifierName(prefix, index)
+		if _, err := client.FindResource(netscaler.Nslimitidentifier.Type(), limitIdentifierName); err != nil {
+			if index != 0 {
+				break
+			}
+			continue
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nslimitidentifier.Type(), limitIdentifierName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Streamselector.Type(), limitIdentifierName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+	if startIndex == 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Streamselector.Type(), getLimitSelectorName(prefix), nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+}
+
+// getLimitedVariableName returns the name of the transaction variable which is set for the requests exceeding any limit of the rate limit
+func getLimitedVariableName(prefix string) string {
+	return GetNSCompatibleNameByLen(prefix+"_rlv", 31)
+}
+
+// rateLimitPolicyAdd adds the limit identifiers and the responder policy responding with the rate limit's status code to the requests of the route exceeding the limit
+// Limit identifiers of a shared rate limit are named after sharedPrefix. Returns the number of limit identifiers shared by the routes of the CS vserver.
+// If a request is limited by every descriptor it matches, each limit is checked by a policy of its own, so that the request is counted by all the limits
+// even after exceeding one of them. These policies set a transaction variable, and the request is responded by the last policy if the variable is set
+func (csBindings *CSBindingsAPI) rateLimitPolicyAdd(client *netscaler.NitroClient, confErr *nitroError, policyRule string, rateLimit *RateLimit, sharedPrefix string) int {
+	prefix := csBindings.Name + "_ra_" + fmt.Sprint(csBindings.curResPriority)
+	if rateLimit.Shared {
+		prefix = sharedPrefix
+	}
+	limitRules, limitCount := rateLimit.getLimitRules(prefix)
+	if len(limitRules) == 0 {
+		return 0
+	}
+	rateLimit.limitIdentifiersAdd(client, confErr, prefix)
+	statusCode := rateLimit.StatusCode
+	if statusCode == 0 {
+		statusCode = defaultRateLimitStatus
+	}
+	responseTarget := "\"HTTP/1.1 " + fmt.Sprint(statusCode) + " " + http.StatusText(statusCode) + "\r\n\r\n\""
+	if rateLimit.AllDescriptors && len(limitRules) > 1 {
+		variableName := getLimitedVariableName(csBindings.Name + "_ra_" + fmt.Sprint(csBindings.curResPriority))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsvariable.Type(), variableName, ns.Nsvariable{Name: variableName, Type: "ulong", Scope: "transaction"}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+		for _, limitRule := range limitRules {
+			csBindings.responderAssignmentPolicyAdd(client, confErr, rateLimit.getEnabledRule("("+policyRule+") && "+limitRule), variableName)
+		}
+		csBindings.responderPolicyAdd(client, confErr, rateLimit.getEnforcedRule("$"+variableName+".EQ(1)"), "respondwith", responseTarget, 0)
+	} else {
+		limitRule, _ := rateLimit.getLimitRule(prefix)
+		csBindings.responderPolicyAdd(client, confErr, "("+policyRule+") && "+limitRule, "respondwith", responseTarget, 0)
+	}
+	if rateLimit.Shared {
+		return limitCount
+	}
+	limitIdentifiersDelete(client, confErr, prefix, limitCount)
+	return 0
+}
+
+// responderAssignmentPolicyAdd adds the responder policy setting the variable to 1 for the requests matching policyRule.
+// Policy is bound with GOTO NEXT so that the requests are evaluated against the following policies as well
+func (csBindings *CSBindingsAPI) responderAssignmentPolicyAdd(client *netscaler.NitroClient, confErr *nitroError, policyRule string, variableName string) {
+	responderEntityName := csBindings.Name + "_ra_" + fmt.Sprint(csBindings.curResPriority)
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsassignment.Type(), responderEntityName, ns.Nsassignment{Name: responderEntityName, Variable: "$" + variableName, Set: "1"}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderpolicy.Type(), responderEntityName, responder.Responderpolicy{Name: responderEntityName, Rule: policyRule, Action: responderEntityName}, "add", "", "", ""}, nil, nil))
+	// Responder action of the policy, if it earlier responded to the requests, is no longer used
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), responderEntityName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_responderpolicy_binding.Type(), csBindings.Name, cs.Csvserverresponderpolicybinding{Name: csBindings.Name, Policyname: responderEntityName, Priority: csBindings.curResPriority, Gotopriorityexpression: "NEXT"}, "add", "", "", ""}, nil, nil))
+	csBindings.curResPriority = csBindings.curResPriority + 10
+}
+
+// responderActionsDelete deletes the responder actions or the assignments used by the responder policies, and the variables set by the assignments
+// of the rate limits named after the policies. Variables are deleted after all the assignments, since they are named only after the first policy of a rate limit
+func responderActionsDelete(client *netscaler.NitroClient, confErr *nitroError, policyNames []string) {
+	for _, policyName := range policyNames {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Responderaction.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsassignment.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+	for _, policyName := range policyNames {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Nsvariable.Type(), getLimitedVariableName(policyName), nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+	}
+}
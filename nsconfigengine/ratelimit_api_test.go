@@ -0,0 +1,156 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_getTimeslice(t *testing.T) {
+	cases := []struct {
+		fillInterval int
+		timeslice    int
+	}{
+		{0, 10},
+		{5, 10},
+		{10, 10},
+		{25, 30},
+		{1000, 1000},
+	}
+	for _, c := range cases {
+		bucket := TokenBucket{FillInterval: c.fillInterval}
+		if timeslice := bucket.getTimeslice(); timeslice != c.timeslice {
+			t.Errorf("getTimeslice for %d: expected %d, received %d", c.fillInterval, c.timeslice, timeslice)
+		}
+	}
+}
+
+func Test_getLimitIdentifier(t *testing.T) {
+	bucket := TokenBucket{MaxTokens: 10, TokensPerFill: 5, FillInterval: 1000}
+	limitIdentifier := bucket.getLimitIdentifier("cs1_rl0", "cs1_rl")
+	if limitIdentifier.Threshold != 5 || limitIdentifier.Timeslice != 1000 || limitIdentifier.Limittype != "BURSTY" || limitIdentifier.Mode != "REQUEST_RATE" || limitIdentifier.Selectorname != "cs1_rl" {
+		t.Errorf("Unexpected limit identifier %v", limitIdentifier)
+	}
+	bucket.MaxTokens = 5
+	if limitIdentifier = bucket.getLimitIdentifier("cs1_rl0", ""); limitIdentifier.Limittype != "SMOOTH" {
+		t.Errorf("Expected SMOOTH limit type, received %s", limitIdentifier.Limittype)
+	}
+}
+
+func Test_getLimitRule(t *testing.T) {
+	cases := []struct {
+		name       string
+		rateLimit  RateLimit
+		rule       string
+		limitCount int
+	}{
+		{"token bucket", RateLimit{TokenBucket: &TokenBucket{MaxTokens: 1, TokensPerFill: 1, FillInterval: 1000}, EnabledPercent: 100, EnforcedPercent: 100}, "(SYS.CHECK_LIMIT(\"cs1_rl0\"))", 1},
+		{"partially enabled and enforced", RateLimit{TokenBucket: &TokenBucket{MaxTokens: 1, TokensPerFill: 1, FillInterval: 1000}, EnabledPercent: 50, EnforcedPercent: 10},
+			"SYS.RANDOM.MUL(100).LT(50) && (SYS.CHECK_LIMIT(\"cs1_rl0\")) && SYS.RANDOM.MUL(100).LT(10)", 1},
+		{"descriptors", RateLimit{TokenBucket: &TokenBucket{MaxTokens: 1, TokensPerFill: 1, FillInterval: 1000}, EnabledPercent: 100, EnforcedPercent: 100, Descriptors: []RateLimitDescriptor{
+			{Matches: []RateLimitMatch{{Headers: []MatchHeader{{Name: "x-user", Exact: "foo"}}}}},
+			{},
+			{Matches: []RateLimitMatch{{ClientIP: "10.1.1.1"}, {ClientIP: "2001:db8::1"}}}}},
+			"((((HTTP.REQ.HEADER(\"x-user\").EQ(\"foo\"))) && SYS.CHECK_LIMIT(\"cs1_rl1\")) || " +
+				"(((CLIENT.IP.SRC.EQ(10.1.1.1)) || (CLIENT.IPV6.SRC.EQ(2001:db8::1))) && !(((HTTP.REQ.HEADER(\"x-user\").EQ(\"foo\")))) && SYS.CHECK_LIMIT(\"cs1_rl3\")) || " +
+				"(!(((HTTP.REQ.HEADER(\"x-user\").EQ(\"foo\"))) || ((CLIENT.IP.SRC.EQ(10.1.1.1)) || (CLIENT.IPV6.SRC.EQ(2001:db8::1)))) && SYS.CHECK_LIMIT(\"cs1_rl0\")))", 4},
+		{"all descriptors", RateLimit{EnabledPercent: 100, EnforcedPercent: 100, AllDescriptors: true, Descriptors: []RateLimitDescriptor{
+			{Matches: []RateLimitMatch{{}}, Selector: []string{"CLIENT.IP.SRC"}},
+			{Matches: []RateLimitMatch{{Headers: []MatchHeader{{Name: "x-user", Present: true}}}}, Selector: []string{"HTTP.REQ.HEADER(\"x-user\")"}}}},
+			"(((true) && SYS.CHECK_LIMIT(\"cs1_rl1\")) || (((HTTP.REQ.HEADER(\"x-user\").EXISTS)) && SYS.CHECK_LIMIT(\"cs1_rl2\")))", 3},
+		{"no limits", RateLimit{EnabledPercent: 100, EnforcedPercent: 100, Descriptors: []RateLimitDescriptor{{}}}, "", 0},
+	}
+	for _, c := range cases {
+		rule, limitCount := c.rateLimit.getLimitRule("cs1")
+		if rule != c.rule || limitCount != c.limitCount {
+			t.Errorf("%s: expected (%s, %d), received (%s, %d)", c.name, c.rule, c.limitCount, rule, limitCount)
+		}
+	}
+}
+
+func Test_getLimitRules(t *testing.T) {
+	rateLimit := RateLimit{EnabledPercent: 100, EnforcedPercent: 100, AllDescriptors: true, TokenBucket: &TokenBucket{MaxTokens: 1, TokensPerFill: 1, FillInterval: 1000}, Descriptors: []RateLimitDescriptor{
+		{Matches: []RateLimitMatch{{}}, Selector: []string{"CLIENT.IP.SRC"}},
+		{Matches: []RateLimitMatch{{Headers: []MatchHeader{{Name: "x-user", Present: true}}}}, Selector: []string{"HTTP.REQ.HEADER(\"x-user\")"}}}}
+	expectedRules := []string{
+		"((true) && SYS.CHECK_LIMIT(\"cs1_rl1\"))",
+		"(((HTTP.REQ.HEADER(\"x-user\").EXISTS)) && SYS.CHECK_LIMIT(\"cs1_rl2\"))",
+		"(!((true) || ((HTTP.REQ.HEADER(\"x-user\").EXISTS))) && SYS.CHECK_LIMIT(\"cs1_rl0\"))",
+	}
+	rules, limitCount := rateLimit.getLimitRules("cs1")
+	if !reflect.DeepEqual(rules, expectedRules) || limitCount != 3 {
+		t.Errorf("Expected (%v, 3), received (%v, %d)", expectedRules, rules, limitCount)
+	}
+}
+
+func Test_CSBindingsAPI_rateLimit(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("csrl", "HTTP", "*", 80)
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi Add failed with err %v", err)
+	}
+	csBindings := NewCSBindingsAPI(csObj.Name)
+	csBindings.Bindings = []CSBinding{
+		{Rule: RouteMatch{Domains: []string{"*"}, Prefix: "/limited"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v1", LbVserverType: "HTTP", Weight: 100}}},
+			RateLimit: &RateLimit{TokenBucket: &TokenBucket{MaxTokens: 10, TokensPerFill: 5, FillInterval: 1000}, StatusCode: 503, PerConnection: true, EnabledPercent: 100, EnforcedPercent: 100}},
+		{Rule: RouteMatch{Domains: []string{"*"}, Prefix: "/"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v1", LbVserverType: "HTTP", Weight: 100}}},
+			RateLimit: &RateLimit{TokenBucket: &TokenBucket{MaxTokens: 100, TokensPerFill: 100, FillInterval: 60000}, Shared: true, EnabledPercent: 100, EnforcedPercent: 100}},
+	}
+	t.Logf("Test CSBindingsAPI Add with rate limits")
+	err = csBindings.Add(client)
+	if err != nil {
+		t.Errorf("CSBindingsAPI Add for csrl failed with err %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"streamselector", "csrl_ra_10_rl", map[string]interface{}{"name": "csrl_ra_10_rl"}},
+		{"nslimitidentifier", "csrl_ra_10_rl0", map[string]interface{}{"limitidentifier": "csrl_ra_10_rl0", "threshold": 5, "timeslice": 1000, "limittype": "BURSTY", "selectorname": "csrl_ra_10_rl"}},
+		{"responderaction", "csrl_ra_10", map[string]interface{}{"name": "csrl_ra_10", "type": "respondwith", "target": "\"HTTP/1.1 503 Service Unavailable\r\n\r\n\""}},
+		{"responderpolicy", "csrl_ra_10", map[string]interface{}{"name": "csrl_ra_10", "action": "csrl_ra_10", "rule": "((HTTP.REQ.URL.Startswith(\"/limited\"))) && (SYS.CHECK_LIMIT(\"csrl_ra_10_rl0\"))"}},
+		{"nslimitidentifier", "csrl_rl0", map[string]interface{}{"limitidentifier": "csrl_rl0", "threshold": 100, "timeslice": 60000, "limittype": "SMOOTH"}},
+		{"responderaction", "csrl_ra_20", map[string]interface{}{"name": "csrl_ra_20", "type": "respondwith", "target": "\"HTTP/1.1 429 Too Many Requests\r\n\r\n\""}},
+		{"responderpolicy", "csrl_ra_20", map[string]interface{}{"name": "csrl_ra_20", "action": "csrl_ra_20", "rule": "((HTTP.REQ.URL.Startswith(\"/\"))) && (SYS.CHECK_LIMIT(\"csrl_rl0\"))"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csrl, error %v", err)
+	}
+	t.Logf("Test CSBindingsAPI Add with rate limits removed")
+	csBindings = NewCSBindingsAPI(csObj.Name)
+	csBindings.Bindings = []CSBinding{
+		{Rule: RouteMatch{Domains: []string{"*"}, Prefix: "/"}, CsPolicy: CsPolicy{Canary: []Canary{{LbVserverName: "v1", LbVserverType: "HTTP", Weight: 100}}}},
+	}
+	err = csBindings.Add(client)
+	if err != nil {
+		t.Errorf("CSBindingsAPI Add for csrl failed with err %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"streamselector", "csrl_ra_10_rl", map[string]interface{}{"name": "csrl_ra_10_rl"}},
+		{"nslimitidentifier", "csrl_ra_10_rl0", map[string]interface{}{"limitidentifier": "csrl_ra_10_rl0"}},
+		{"responderpolicy", "csrl_ra_10", map[string]interface{}{"name": "csrl_ra_10"}},
+		{"nslimitidentifier", "csrl_rl0", map[string]interface{}{"limitidentifier": "csrl_rl0"}},
+		{"responderpolicy", "csrl_ra_20", map[string]interface{}{"name": "csrl_ra_20"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale rate limits of csrl, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi Delete for csrl failed with err %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/citrix/adc-nitro-go/resource/config/ssl"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+const (
+	// Frontend SSL sessions are reused for 120 seconds by default
+	defaultSSLSessionTimeout = 120
+	// DEFAULT cipher group is bound to a frontend SSL profile by default
+	defaultSSLCipher = "DEFAULT"
+)
+
+// tlsVersions lists the TLS versions in increasing order
+var tlsVersions = []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"}
+
+// nsCipherNames maps the OpenSSL names of the cipher suites to their Citrix ADC names. All the cipher suites of Envoy are mapped,
+// other than the PSK cipher suites which are not supported by Citrix ADC
+var nsCipherNames = map[string]string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256": "TLS1.2-ECDHE-ECDSA-AES128-GCM-SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384": "TLS1.2-ECDHE-ECDSA-AES256-GCM-SHA384",
+	"ECDHE-ECDSA-CHACHA20-POLY1305": "TLS1.2-ECDHE-ECDSA-CHACHA20-POLY1305",
+	"ECDHE-RSA-AES128-GCM-SHA256":   "TLS1.2-ECDHE-RSA-AES128-GCM-SHA256",
+	"ECDHE-RSA-AES256-GCM-SHA384":   "TLS1.2-ECDHE-RSA-AES256-GCM-SHA384",
+	"ECDHE-RSA-CHACHA20-POLY1305":   "TLS1.2-ECDHE-RSA-CHACHA20-POLY1305",
+	"ECDHE-ECDSA-AES128-SHA":        "TLS1-ECDHE-ECDSA-AES128-SHA",
+	"ECDHE-ECDSA-AES256-SHA":        "TLS1-ECDHE-ECDSA-AES256-SHA",
+	"ECDHE-RSA-AES128-SHA":          "TLS1-ECDHE-RSA-AES128-SHA",
+	"ECDHE-RSA-AES256-SHA":          "TLS1-ECDHE-RSA-AES256-SHA",
+	"AES128-GCM-SHA256":             "TLS1.2-AES128-GCM-SHA256",
+	"AES256-GCM-SHA384":             "TLS1.2-AES256-GCM-SHA384",
+	"AES128-SHA":                    "TLS1-AES-128-CBC-SHA",
+	"AES256-SHA":                    "TLS1-AES-256-CBC-SHA",
+	"DES-CBC3-SHA":                  "SSL3-DES-CBC3-SHA",
+}
+
+// nsTLS13CipherNames are the Citrix ADC names of the TLSv1.3 cipher suites
+var nsTLS13CipherNames = []string{"TLS1.3-AES128-GCM-SHA256", "TLS1.3-AES256-GCM-SHA384", "TLS1.3-CHACHA20-POLY1305-SHA256"}
+
+// nsECCCurveNames maps the OpenSSL names of the ECDH curves to their Citrix ADC names
+var nsECCCurveNames = map[string]string{
+	"P-224":  "P_224",
+	"P-256":  "P_256",
+	"P-384":  "P_384",
+	"P-521":  "P_521",
+	"X25519": "X_25519",
+}
+
+// defaultECCCurves are the ECDH curves bound to a frontend SSL profile by default
+var defaultECCCurves = []string{"P_256", "P_384", "P_224", "P_521"}
+
+// SSLProfileSpec specifies the TLS parameters of the client connections of an SSL vserver, applied with a frontend SSL profile dedicated to the vserver.
+// MinVersion and MaxVersion are TLS versions as in tlsVersions, and the range is not limited on the side left empty.
+// Ciphers and ECCCurves are in order of preference, with OpenSSL names, and the defaults of Citrix ADC are used if empty.
+// Unsupported Ciphers are not allowed, and the SSL profile is not applied if none of Ciphers is supported.
+// As TLSv1.3 cipher suites are not configurable in OpenSSL cipher lists, all of them are allowed along with Ciphers.
+// ALPNProtocols are the protocols offered in ALPN by SSL_TCP vservers, and SessionTimeout is in seconds
+type SSLProfileSpec struct {
+	MinVersion     string
+	MaxVersion     string
+	Ciphers        []string
+	ECCCurves      []string
+	ALPNProtocols  []string
+	SessionTickets bool
+	SessionTimeout int
+}
+
+func getSSLProfileName(vserverName string) string {
+	return GetNSCompatibleNameByLen(vserverName+"_sslprofile", 127)
+}
+
+// isTLSVersionEnabled returns "ENABLED" if the version is within the range of versions of the SSL profile, else "DISABLED"
+func (sslProfile *SSLProfileSpec) isTLSVersionEnabled(index int) string {
+	for i, version := range tlsVersions {
+		if (version == sslProfile.MinVersion && index < i) || (version == sslProfile.MaxVersion && index > i) {
+			return "DISABLED"
+		}
+	}
+	return "ENABLED"
+}
+
+// getALPNProtocol returns the most preferred application protocol which Citrix ADC can negotiate with ALPN
+func (sslProfile *SSLProfileSpec) getALPNProtocol() string {
+	alpnProtocol := "NONE"
+	for _, protocol := range sslProfile.ALPNProtocols {
+		if protocol == "h2" {
+			return "HTTP2"
+		}
+		if protocol == "http/1.1" {
+			alpnProtocol = "HTTP1.1"
+		}
+	}
+	return alpnProtocol
+}
+
+// getSslprofile returns the frontend SSL profile of the spec. SNI, client authentication and OCSP stapling of the vserver, in vserverParams,
+// are set on the profile, as these can not be set on a vserver with an SSL profile
+func (sslProfile *SSLProfileSpec) getSslprofile(profileName string, vserverParams ssl.Sslprofile) ssl.Sslprofile {
+	profile := ssl.Sslprofile{Name: profileName, Sslprofiletype: "FrontEnd", Ssl3: "DISABLED", Tls1: sslProfile.isTLSVersionEnabled(0), Tls11: sslProfile.isTLSVersionEnabled(1),
+		Tls12: sslProfile.isTLSVersionEnabled(2), Tls13: sslProfile.isTLSVersionEnabled(3), Sessreuse: "ENABLED", Sesstimeout: sslProfile.SessionTimeout,
+		Sessionticket: "DISABLED", Alpnprotocol: sslProfile.getALPNProtocol(), Snienable: vserverParams.Snienable, Clientauth: vserverParams.Clientauth, Ocspstapling: vserverParams.Ocspstapling}
+	if profile.Sesstimeout == 0 {
+		profile.Sesstimeout = defaultSSLSessionTimeout
+	}
+	if sslProfile.SessionTickets {
+		profile.Sessionticket = "ENABLED"
+	}
+	return profile
+}
+
+// UnsupportedCiphers returns the cipher suites of the SSL profile which are not supported by Citrix ADC
+func (sslProfile *SSLProfileSpec) UnsupportedCiphers() []string {
+	var unsupportedCiphers []string
+	for _, cipher := range sslProfile.Ciphers {
+		if _, ok := nsCipherNames[cipher]; !ok {
+			unsupportedCiphers = append(unsupportedCiphers, cipher)
+		}
+	}
+	return unsupportedCiphers
+}
+
+// getNSCiphers returns the Citrix ADC names of the cipher suites, skipping the ones not supported. DEFAULT cipher group is used only if
+// no cipher suite is specified, and error is returned if none of them is supported, as the client connections would not be limited to them
+func (sslProfile *SSLProfileSpec) getNSCiphers() ([]string, error) {
+	if len(sslProfile.Ciphers) == 0 {
+		return []string{defaultSSLCipher}, nil
+	}
+	var nsCiphers []string
+	for _, cipher := range sslProfile.Ciphers {
+		if nsCipher, ok := nsCipherNames[cipher]; ok {
+			nsCiphers = append(nsCiphers, nsCipher)
+		} else {
+			nsconfLogger.Warn("getNSCiphers: Cipher suite is not supported", "cipher", cipher)
+		}
+	}
+	if len(nsCiphers) == 0 {
+		return nil, fmt.Errorf("none of the cipher suites %v is supported", sslProfile.Ciphers)
+	}
+	if sslProfile.isTLSVersionEnabled(3) == "ENABLED" {
+		nsCiphers = append(nsCiphers, nsTLS13CipherNames...)
+	}
+	return nsCiphers, nil
+}
+
+// getNSECCCurves returns the Citrix ADC names of the ECDH curves, skipping the ones not supported
+func (sslProfile *SSLProfileSpec) getNSECCCurves() []string {
+	var nsCurves []string
+	for _, curve := range sslProfile.ECCCurves {
+		if nsCurve, ok := nsECCCurveNames[curve]; ok {
+			nsCurves = append(nsCurves, nsCurve)
+		} else {
+			nsconfLogger.Warn("getNSECCCurves: ECDH curve is not supported", "curve", curve)
+		}
+	}
+	if len(nsCurves) == 0 {
+		return defaultECCCurves
+	}
+	return nsCurves
+}
+
+// sslProfileBindingsUpdate binds the values to the SSL profile in order of priority, after unbinding the existing values if they differ
+func sslProfileBindingsUpdate(client *netscaler.NitroClient, confErr *nitroError, profileName, bindingType, key, boundKey string, values []string) {
+	var boundValues []string
+	bindings, err := client.FindResourceArray(bindingType, profileName)
+	if err == nil {
+		for _, binding := range bindings {
+			if value, err := getValueString(binding, boundKey); err == nil {
+				boundValues = append(boundValues, value)
+			}
+		}
+	}
+	if reflect.DeepEqual(boundValues, values) {
+		return
+	}
+	for _, value := range boundValues {
+		confErr.updateError(doNitro(client, nitroConfig{bindingType, profileName, map[string]string{"name": profileName, key: value}, "delete", "", "", ""}, nil, nil))
+	}
+	for index, value := range values {
+		confErr.updateError(doNitro(client, nitroConfig{bindingType, profileName, map[string]interface{}{"name": profileName, key: value, "cipherpriority": index + 1}, "add", "", "", ""}, nil, nil))
+	}
+}
+
+// sslProfileAdd adds the SSL profile of the vserver, along with its cipher and ECDH curve bindings, and sets it on the vserver.
+// Profile is not applied if none of its cipher suites is supported
+func (sslProfile *SSLProfileSpec) sslProfileAdd(client *netscaler.NitroClient, confErr *nitroError, vserverName string, vserverParams ssl.Sslprofile) {
+	profileName := getSSLProfileName(vserverName)
+	nsCiphers, err := sslProfile.getNSCiphers()
+	if err != nil {
+		confErr.updateError(fmt.Errorf("SSL profile %s is not applied: %v", profileName, err))
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslprofile.Type(), profileName, sslProfile.getSslprofile(profileName, vserverParams), "add", "", "", ""}, nil, nil))
+	sslProfileBindingsUpdate(client, confErr, profileName, netscaler.Sslprofile_sslcipher_binding.Type(), "ciphername", "cipheraliasname", nsCiphers)
+	sslProfileBindingsUpdate(client, confErr, profileName, netscaler.Sslprofile_ecccurve_binding.Type(), "ecccurvename", "ecccurvename", sslProfile.getNSECCCurves())
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver.Type(), vserverName, ssl.Sslvserver{Vservername: vserverName, Sslprofile: profileName}, "set", "", "", ""}, nil, nil))
+}
+
+// sslProfileDelete removes the SSL profile dedicated to the vserver, if any
+func sslProfileDelete(client *netscaler.NitroClient, confErr *nitroError, vserverName string) {
+	profileName := getSSLProfileName(vserverName)
+	if _, err := client.FindResource(netscaler.Sslprofile.Type(), profileName); err != nil {
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver.Type(), vserverName, map[string]interface{}{"vservername": vserverName, "sslprofile": true}, "unset", "", "", ""}, []string{"No such resource"}, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslprofile.Type(), profileName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/adc-nitro-go/resource/config/ssl"
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_SSLProfileSpec_getSslprofile(t *testing.T) {
+	testCases := []struct {
+		input          SSLProfileSpec
+		expectedOutput ssl.Sslprofile
+	}{
+		{SSLProfileSpec{MinVersion: "TLSv1.2", MaxVersion: "TLSv1.3", SessionTickets: true},
+			ssl.Sslprofile{Name: "p1", Sslprofiletype: "FrontEnd", Ssl3: "DISABLED", Tls1: "DISABLED", Tls11: "DISABLED", Tls12: "ENABLED", Tls13: "ENABLED", Sessreuse: "ENABLED", Sesstimeout: 120, Sessionticket: "ENABLED", Alpnprotocol: "NONE", Snienable: "ENABLED", Clientauth: "DISABLED", Ocspstapling: "DISABLED"}},
+		{SSLProfileSpec{MinVersion: "TLSv1.1", MaxVersion: "TLSv1.2", ALPNProtocols: []string{"http/1.1"}, SessionTimeout: 300},
+			ssl.Sslprofile{Name: "p1", Sslprofiletype: "FrontEnd", Ssl3: "DISABLED", Tls1: "DISABLED", Tls11: "ENABLED", Tls12: "ENABLED", Tls13: "DISABLED", Sessreuse: "ENABLED", Sesstimeout: 300, Sessionticket: "DISABLED", Alpnprotocol: "HTTP1.1", Snienable: "ENABLED", Clientauth: "DISABLED", Ocspstapling: "DISABLED"}},
+		{SSLProfileSpec{ALPNProtocols: []string{"http/1.1", "h2"}},
+			ssl.Sslprofile{Name: "p1", Sslprofiletype: "FrontEnd", Ssl3: "DISABLED", Tls1: "ENABLED", Tls11: "ENABLED", Tls12: "ENABLED", Tls13: "ENABLED", Sessreuse: "ENABLED", Sesstimeout: 120, Sessionticket: "DISABLED", Alpnprotocol: "HTTP2", Snienable: "ENABLED", Clientauth: "DISABLED", Ocspstapling: "DISABLED"}},
+	}
+	for _, c := range testCases {
+		output := c.input.getSslprofile("p1", ssl.Sslprofile{Snienable: "ENABLED", Clientauth: "DISABLED", Ocspstapling: "DISABLED"})
+		if !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("FAILED!!! Expected: %+v. Received: %+v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_SSLProfileSpec_getNSCiphers(t *testing.T) {
+	testCases := []struct {
+		input               SSLProfileSpec
+		expectedCiphers     []string
+		expectedECCCurves   []string
+		expectedUnsupported []string
+		expectedErr         bool
+	}{
+		{SSLProfileSpec{}, []string{"DEFAULT"}, []string{"P_256", "P_384", "P_224", "P_521"}, nil, false},
+		{SSLProfileSpec{MaxVersion: "TLSv1.2", Ciphers: []string{"ECDHE-RSA-AES256-GCM-SHA384", "ECDHE-PSK-AES128-CBC-SHA", "AES128-SHA"}, ECCCurves: []string{"X25519", "P-256"}},
+			[]string{"TLS1.2-ECDHE-RSA-AES256-GCM-SHA384", "TLS1-AES-128-CBC-SHA"}, []string{"X_25519", "P_256"}, []string{"ECDHE-PSK-AES128-CBC-SHA"}, false},
+		{SSLProfileSpec{Ciphers: []string{"ECDHE-ECDSA-AES128-GCM-SHA256"}, ECCCurves: []string{"P-192"}},
+			[]string{"TLS1.2-ECDHE-ECDSA-AES128-GCM-SHA256", "TLS1.3-AES128-GCM-SHA256", "TLS1.3-AES256-GCM-SHA384", "TLS1.3-CHACHA20-POLY1305-SHA256"}, []string{"P_256", "P_384", "P_224", "P_521"}, nil, false},
+		// Neither DEFAULT cipher group nor TLSv1.3 cipher suites are allowed, if none of the cipher suites is supported
+		{SSLProfileSpec{Ciphers: []string{"PSK-AES128-CBC-SHA", "ECDHE-PSK-CHACHA20-POLY1305"}},
+			nil, []string{"P_256", "P_384", "P_224", "P_521"}, []string{"PSK-AES128-CBC-SHA", "ECDHE-PSK-CHACHA20-POLY1305"}, true},
+	}
+	for _, c := range testCases {
+		ciphers, err := c.input.getNSCiphers()
+		if !reflect.DeepEqual(ciphers, c.expectedCiphers) || (err != nil) != c.expectedErr {
+			t.Errorf("FAILED!!! Expected: %v/%v. Received: %v/%v", c.expectedCiphers, c.expectedErr, ciphers, err)
+		}
+		if unsupported := c.input.UnsupportedCiphers(); !reflect.DeepEqual(unsupported, c.expectedUnsupported) {
+			t.Errorf("FAILED!!! Expected unsupported ciphers: %v. Received: %v", c.expectedUnsupported, unsupported)
+		}
+		curves := c.input.getNSECCCurves()
+		if !reflect.DeepEqual(curves, c.expectedECCCurves) {
+			t.Errorf("FAILED!!! Expected: %v. Received: %v", c.expectedECCCurves, curves)
+		}
+	}
+}
+
+func Test_CSApi_sslProfile(t *testing.T) {
+	csObj := NewCSApi("cs2p", "SSL", "2.2.1.1", 9443)
+	csObj.FrontendTLS = []SSLSpec{{CertFilename: "certssvc2_svc2", PrivateKeyFilename: "certssvc2_svc2_key"}}
+	csObj.FrontendTLSClientAuth = true
+	csObj.SSLProfile = &SSLProfileSpec{MinVersion: "TLSv1.2", MaxVersion: "TLSv1.2", Ciphers: []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES256-GCM-SHA384"}, SessionTickets: true}
+	client := env.GetNitroClient()
+	t.Logf("Test CSApi Add with SSL profile")
+	UploadCert(client, "../tests/certs/certssvc2/svc2.citrixrootdummy2.com.crt", "certssvc2_svc2", "../tests/certs/certssvc2/svc2.citrixrootdummy2.com.key", "certssvc2_svc2_key")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"sslprofile", "cs2p_sslprofile", map[string]interface{}{"name": "cs2p_sslprofile", "tls1": "DISABLED", "tls11": "DISABLED", "tls12": "ENABLED", "tls13": "DISABLED", "sessionticket": "ENABLED", "clientauth": "ENABLED"}},
+		{"sslvserver", "cs2p", map[string]interface{}{"vservername": "cs2p", "sslprofile": "cs2p_sslprofile"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add cs2p, error %v", err)
+	}
+	err = env.VerifyBindings(client, "sslprofile", "cs2p_sslprofile", "sslcipher", []map[string]interface{}{{"cipheraliasname": "TLS1.2-ECDHE-RSA-AES128-GCM-SHA256", "cipherpriority": 1}, {"cipheraliasname": "TLS1.2-ECDHE-RSA-AES256-GCM-SHA384", "cipherpriority": 2}})
+	if err != nil {
+		t.Errorf("Config verification failed for Add binding cs2p, error %v", err)
+	}
+	t.Logf("Test CSApi update without SSL profile")
+	csObj.SSLProfile = nil
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	err = env.VerifyConfigBlockAbsence(client, []env.VerifyNitroConfig{{"sslprofile", "cs2p_sslprofile", nil}})
+	if err != nil {
+		t.Errorf("Config verification failed for Update cs2p, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+}
@@ -32,7 +32,10 @@ const (
 	encodedSSLCertPath = "%2fnsconfig%2fssl"
 )
 
-// SSLSpec specifies the SSL certificates associated with a vserver/service on Citrix-ADC
+// SSLSpec specifies the SSL certificates associated with a vserver/service on Citrix-ADC.
+// SSL servicegroups send SNI in TLS handshake, and expect one of SubjectAltNames in the certificate of the server if its CA is set.
+// Peer certificates are checked for revocation against the CRL of the CA, uploaded as CRLFilename or provided inline as CRL,
+// and, if the OCSP responder of the CA at OCSPResponderURL can be reached, against its response
 type SSLSpec struct {
 	SNICert            bool
 	CertFilename       string
@@ -41,6 +44,11 @@ type SSLSpec struct {
 	Cert               string
 	PrivateKey         string
 	RootCert           string
+	SNI                string
+	SubjectAltNames    []string
+	CRLFilename        string
+	CRL                string
+	OCSPResponderURL   string
 }
 
 //SSLVserverBinding specifies the SSL Vservername and SNI details needed for cetkey binding to ssl vserver during cert rotation
@@ -308,6 +316,180 @@ func (sslObj *SSLSpec) addInlineCert(client *netscaler.NitroClient, confErr *nit
 	return entityCertName, rootCertName
 }
 
+// GetCRLFileName returns the name of the CRL file on Citrix ADC, derived from the content of the CRL
+func GetCRLFileName(crl string) string {
+	return GetNSCompatibleNameHash(crl, 55)
+}
+
+// getCRLName returns the name of the CRL of the CA certificate from the CRL file
+func getCRLName(caCertName, crlFileName string) string {
+	return GetNSCompatibleNameHash(caCertName+crlFileName, 31)
+}
+
+// getOCSPResponderName returns the name of the OCSP responder at the URL
+func getOCSPResponderName(url string) string {
+	return GetNSCompatibleNameHash(url, 31)
+}
+
+// addCRL adds the CRL of the CA certificate from the CRL file, unless it is already added from the same file. The file is uploaded
+// with the content crl if it is set. CRLs of the CA certificate from other files are deleted
+func addCRL(client *netscaler.NitroClient, confErr *nitroError, caCertName, crlFileName string, crl []byte) {
+	crlName := getCRLName(caCertName, crlFileName)
+	if _, err := client.FindResource(netscaler.Sslcrl.Type(), crlName); err != nil {
+		if crl != nil {
+			confErr.updateError(UploadCertData(client, crl, crlFileName, nil, ""))
+		}
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslcrl.Type(), crlName, ssl.Sslcrl{Crlname: crlName, Crlpath: sslCertPath + crlFileName, Cacert: caCertName, Inform: "PEM"}, "add", "", "", ""}, nil, nil))
+	}
+	deleteCRLs(client, confErr, caCertName, crlName)
+}
+
+// deleteCRLs deletes the CRLs of the CA certificate other than keepCRLName, and their files unless other CRLs are added from them
+func deleteCRLs(client *netscaler.NitroClient, confErr *nitroError, caCertName, keepCRLName string) {
+	crls, err := client.FindAllResources(netscaler.Sslcrl.Type())
+	if err != nil {
+		return
+	}
+	crlPaths := make(map[string]bool)
+	staleCRLs := make(map[string]string)
+	for _, crl := range crls {
+		crlName, _ := getValueString(crl, "crlname")
+		crlCACertName, _ := getValueString(crl, "cacert")
+		crlPath, _ := getValueString(crl, "crlpath")
+		if crlCACertName == caCertName && crlName != keepCRLName {
+			staleCRLs[crlName] = crlPath
+		} else {
+			crlPaths[crlPath] = true
+		}
+	}
+	for crlName, crlPath := range staleCRLs {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslcrl.Type(), crlName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		if !crlPaths[crlPath] && strings.HasPrefix(crlPath, sslCertPath) {
+			DeleteCert(client, strings.TrimPrefix(crlPath, sslCertPath))
+		}
+	}
+}
+
+// getRevocationChecks returns whether any SSL vserver or servicegroup checks the revocation of the peer certificates issued by the CA
+// certificate against its CRLs, and against its OCSP responders
+func getRevocationChecks(client *netscaler.NitroClient, caCertName string) (bool, bool) {
+	var crlChecked, ocspChecked bool
+	checkBindings := func(bindingType, entityName string) {
+		bindings, err := client.FindResourceArray(bindingType, entityName)
+		if err != nil {
+			return
+		}
+		for _, binding := range bindings {
+			if certKey, _ := getValueString(binding, "certkeyname"); certKey == caCertName {
+				crlCheck, _ := getValueString(binding, "crlcheck")
+				ocspCheck, _ := getValueString(binding, "ocspcheck")
+				crlChecked = crlChecked || crlCheck != ""
+				ocspChecked = ocspChecked || ocspCheck != ""
+			}
+		}
+	}
+	if vservers, err := client.FindResourceArray(netscaler.Sslcertkey_sslvserver_binding.Type(), caCertName); err == nil {
+		for _, vserver := range vservers {
+			if vserverName, err := getValueString(vserver, "servername"); err == nil {
+				checkBindings(netscaler.Sslvserver_sslcertkey_binding.Type(), vserverName)
+			}
+		}
+	}
+	if services, err := client.FindResourceArray(netscaler.Sslcertkey_service_binding.Type(), caCertName); err == nil {
+		for _, service := range services {
+			if serviceGroupName, err := getValueString(service, "servicegroupname"); err == nil {
+				checkBindings(netscaler.Sslservicegroup_sslcertkey_binding.Type(), serviceGroupName)
+			}
+		}
+	}
+	return crlChecked, ocspChecked
+}
+
+// deleteRevocationChecks deletes the CRLs, and unbinds the OCSP responders, of the CA certificate if no SSL vserver or servicegroup checks
+// them any more. OCSP responders are deleted unless bound to other CA certificates
+func deleteRevocationChecks(client *netscaler.NitroClient, confErr *nitroError, caCertName string) {
+	crlChecked, ocspChecked := getRevocationChecks(client, caCertName)
+	if !crlChecked {
+		deleteCRLs(client, confErr, caCertName, "")
+	}
+	if ocspChecked {
+		return
+	}
+	responders, err := client.FindResourceArray(netscaler.Sslcertkey_sslocspresponder_binding.Type(), caCertName)
+	if err != nil {
+		return
+	}
+	for _, responder := range responders {
+		if responderName, err := getValueString(responder, "ocspresponder"); err == nil {
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslcertkey_sslocspresponder_binding.Type(), caCertName, map[string]string{"certkey": caCertName, "ocspresponder": responderName}, "delete", "", "", ""}, nil, nil))
+			client.DeleteResource(netscaler.Sslocspresponder.Type(), responderName)
+		}
+	}
+}
+
+// addRevocationCheck adds the CRL and the OCSP responder of the CA certificate of the spec, and returns the CRL and OCSP checks of its binding
+// to the entity. Existing binding is removed if its checks differ, to be added again with the checks. Checks no longer set on any binding of
+// the CA certificate are deleted
+func (sslObj *SSLSpec) addRevocationCheck(client *netscaler.NitroClient, confErr *nitroError, caCertName, entityName, bindingType, resourceName string) (string, string) {
+	var crlCheck, ocspCheck string
+	crlFileName := sslObj.CRLFilename
+	var crl []byte
+	if sslObj.CRL != "" {
+		crl = []byte(sslObj.CRL)
+		crlFileName = GetCRLFileName(sslObj.CRL)
+	}
+	if crlFileName != "" {
+		addCRL(client, confErr, caCertName, crlFileName, crl)
+		crlCheck = "Mandatory"
+	}
+	if sslObj.OCSPResponderURL != "" {
+		responderName := getOCSPResponderName(sslObj.OCSPResponderURL)
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslocspresponder.Type(), responderName, ssl.Sslocspresponder{Name: responderName, Url: sslObj.OCSPResponderURL, Cache: "ENABLED"}, "add", "", "", ""}, nil, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslcertkey_sslocspresponder_binding.Type(), caCertName, ssl.Sslcertkeysslocspresponderbinding{Certkey: caCertName, Ocspresponder: responderName, Priority: 1}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+		// Peer certificates are not rejected if the OCSP responder can not be reached
+		ocspCheck = "Optional"
+	}
+	bindings, err := client.FindResourceArray(bindingType, entityName)
+	if err != nil {
+		return crlCheck, ocspCheck
+	}
+	for _, binding := range bindings {
+		if certKey, _ := getValueString(binding, "certkeyname"); certKey != caCertName {
+			continue
+		}
+		boundCRLCheck, _ := getValueString(binding, "crlcheck")
+		boundOCSPCheck, _ := getValueString(binding, "ocspcheck")
+		if boundCRLCheck != crlCheck || boundOCSPCheck != ocspCheck {
+			confErr.updateError(doNitro(client, nitroConfig{bindingType, entityName, map[string]string{resourceName: entityName, "certkeyname": caCertName, "ca": "true"}, "delete", "", "", ""}, nil, nil))
+			if (boundCRLCheck != "" && crlCheck == "") || (boundOCSPCheck != "" && ocspCheck == "") {
+				deleteRevocationChecks(client, confErr, caCertName)
+			}
+		}
+	}
+	return crlCheck, ocspCheck
+}
+
+// UpdateCRL updates the CRLs added from the CRL file oldCRLFileName to be added from newCRLFileName, and deletes the old file
+func UpdateCRL(client *netscaler.NitroClient, oldCRLFileName, newCRLFileName string) {
+	confErr := newNitroError()
+	crls, err := client.FindAllResources(netscaler.Sslcrl.Type())
+	if err != nil {
+		return
+	}
+	for _, crl := range crls {
+		crlPath, _ := getValueString(crl, "crlpath")
+		caCertName, _ := getValueString(crl, "cacert")
+		if crlPath == sslCertPath+oldCRLFileName && caCertName != "" {
+			addCRL(client, confErr, caCertName, newCRLFileName, nil)
+		}
+	}
+	if err = confErr.getError(); err != nil {
+		nsconfLogger.Error("UpdateCRL: Failed to update CRLs", "crlFile", newCRLFileName, "error", err)
+		return
+	}
+	DeleteCert(client, oldCRLFileName)
+}
+
 // CertInfo structure holds info for certFile
 type CertInfo struct {
 	certName string
@@ -322,6 +504,9 @@ func deleteStaleCert(client *netscaler.NitroClient, confErr *nitroError, entityN
 			if certKey, err := getValueString(certBinding, "certkeyname"); err == nil {
 				if _, ok := cert[certKey]; !ok {
 					confErr.updateError(doNitro(client, nitroConfig{entityType, entityName, map[string]string{resourceName: entityName, "certkeyname": certKey, "ca": strconv.FormatBool(cert[certKey].isCA)}, "delete", "", "", ""}, nil, nil))
+					if caVal, ok := certBinding["ca"]; ok && caVal == true {
+						deleteRevocationChecks(client, confErr, certKey)
+					}
 					DeleteCertKey(client, certKey)
 				}
 			}
@@ -329,6 +514,42 @@ func deleteStaleCert(client *netscaler.NitroClient, confErr *nitroError, entityN
 	}
 }
 
+// getServerNames returns the SNI, and the subject alternative names expected in the certificate of the server, of the first SSL specs setting them
+func getServerNames(sslObjs []SSLSpec) (string, []string) {
+	var sni string
+	var subjectAltNames []string
+	for _, sslObj := range sslObjs {
+		if sni == "" {
+			sni = sslObj.SNI
+		}
+		if len(subjectAltNames) == 0 {
+			subjectAltNames = sslObj.SubjectAltNames
+		}
+	}
+	return sni, subjectAltNames
+}
+
+// getServerCommonName returns the server name sent in SNI, and the common name of the SSL servicegroup. Citrix ADC verifies the DNS names
+// of the certificate of the server against the common name, and sends it in SNI if enabled. Hence if the server is verified, the common
+// name is the subject alternative name if any, else SNI, and SNI is not sent if it is not the subject alternative name. Error is returned
+// if there are several subject alternative names, as the server can not be verified against any of them
+func getServerCommonName(sni string, subjectAltNames []string, serverAuth bool) (string, string, error) {
+	var subjectAltName string
+	for _, name := range subjectAltNames {
+		if subjectAltName != "" && name != subjectAltName {
+			return "", "", fmt.Errorf("Server can not be verified against any of several subject alternative names %v", subjectAltNames)
+		}
+		subjectAltName = name
+	}
+	if !serverAuth || subjectAltName == "" || subjectAltName == sni {
+		return sni, sni, nil
+	}
+	if sni != "" {
+		nsconfLogger.Warn("getServerCommonName: SNI is not the subject alternative name verified. SNI is not sent", "sni", sni, "subjectAltName", subjectAltName)
+	}
+	return "", subjectAltName, nil
+}
+
 func addSSLServiceGroup(client *netscaler.NitroClient, serviceGroupName string, sslObjs []SSLSpec, confErr *nitroError) {
 	serverAuth := "DISABLED"
 	certPresent := make(map[string]CertInfo)
@@ -355,15 +576,32 @@ func addSSLServiceGroup(client *netscaler.NitroClient, serviceGroupName string,
 		}
 		if rootCertName != "" {
 			serverAuth = "ENABLED"
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslservicegroup_sslcertkey_binding.Type(), serviceGroupName, ssl.Sslservicegroupsslcertkeybinding{Servicegroupname: serviceGroupName, Certkeyname: rootCertName, Ca: true}, "add", "", "", ""}, nil, nil))
+			crlCheck, ocspCheck := sslObj.addRevocationCheck(client, confErr, rootCertName, serviceGroupName, netscaler.Sslservicegroup_sslcertkey_binding.Type(), "servicegroupname")
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslservicegroup_sslcertkey_binding.Type(), serviceGroupName, ssl.Sslservicegroupsslcertkeybinding{Servicegroupname: serviceGroupName, Certkeyname: rootCertName, Ca: true, Crlcheck: crlCheck, Ocspcheck: ocspCheck}, "add", "", "", ""}, nil, nil))
 			certPresent[rootCertName] = CertInfo{certName: rootCertName, isCA: true}
 		}
 	}
 	deleteStaleCert(client, confErr, serviceGroupName, netscaler.Sslservicegroup_sslcertkey_binding.Type(), "servicegroupname", certPresent)
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslservicegroup.Type(), serviceGroupName, ssl.Sslservicegroup{Servicegroupname: serviceGroupName, Serverauth: serverAuth}, "add", "", "", ""}, nil, nil))
+	sslServiceGroup := ssl.Sslservicegroup{Servicegroupname: serviceGroupName, Serverauth: serverAuth, Snienable: "DISABLED"}
+	sni, subjectAltNames := getServerNames(sslObjs)
+	sni, commonName, err := getServerCommonName(sni, subjectAltNames, serverAuth == "ENABLED")
+	if err != nil {
+		confErr.updateError(err)
+		return
+	}
+	sslServiceGroup.Commonname = commonName
+	if sni != "" {
+		sslServiceGroup.Snienable = "ENABLED"
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslservicegroup.Type(), serviceGroupName, sslServiceGroup, "add", "", "", ""}, nil, nil))
+	if sslServiceGroup.Commonname == "" {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslservicegroup.Type(), serviceGroupName, map[string]interface{}{"servicegroupname": serviceGroupName, "commonname": true}, "unset", "", "", ""}, nil, nil))
+	}
 }
 
-func addSSLVserver(client *netscaler.NitroClient, vserverName string, sslObjs []SSLSpec, SSLClientAuth bool, confErr *nitroError) {
+// addSSLVserver binds the certificates to the SSL vserver, and applies the SSL profile of the vserver if sslProfile is set.
+// OCSP responses of the certificates of the vserver are stapled in TLS handshake if ocspStapling is set
+func addSSLVserver(client *netscaler.NitroClient, vserverName string, sslObjs []SSLSpec, SSLClientAuth, ocspStapling bool, sslProfile *SSLProfileSpec, confErr *nitroError) {
 	sniEnable := "DISABLED"
 	certPresent := make(map[string]CertInfo)
 	var entityCertName, rootCertName string
@@ -391,7 +629,8 @@ func addSSLVserver(client *netscaler.NitroClient, vserverName string, sslObjs []
 			certPresent[entityCertName] = CertInfo{certName: entityCertName, isCA: false}
 		}
 		if rootCertName != "" {
-			confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver_sslcertkey_binding.Type(), vserverName, ssl.Sslvserversslcertkeybinding{Vservername: vserverName, Certkeyname: rootCertName, Ca: true}, "add", "", "", ""}, nil, nil))
+			crlCheck, ocspCheck := sslObj.addRevocationCheck(client, confErr, rootCertName, vserverName, netscaler.Sslvserver_sslcertkey_binding.Type(), "vservername")
+			confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver_sslcertkey_binding.Type(), vserverName, ssl.Sslvserversslcertkeybinding{Vservername: vserverName, Certkeyname: rootCertName, Ca: true, Crlcheck: crlCheck, Ocspcheck: ocspCheck}, "add", "", "", ""}, nil, nil))
 			certPresent[rootCertName] = CertInfo{certName: rootCertName, isCA: true}
 		}
 	}
@@ -399,9 +638,17 @@ func addSSLVserver(client *netscaler.NitroClient, vserverName string, sslObjs []
 	if SSLClientAuth == true {
 		sslClientAuthVal = "ENABLED"
 	}
+	ocspStaplingVal := "DISABLED"
+	if ocspStapling {
+		ocspStaplingVal = "ENABLED"
+	}
 	deleteStaleCert(client, confErr, vserverName, netscaler.Sslvserver_sslcertkey_binding.Type(), "vservername", certPresent)
-	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver.Type(), vserverName, ssl.Sslvserver{Vservername: vserverName, Snienable: sniEnable, Clientauth: sslClientAuthVal}, "set", "", "", ""}, nil, nil))
-
+	if sslProfile != nil {
+		sslProfile.sslProfileAdd(client, confErr, vserverName, ssl.Sslprofile{Snienable: sniEnable, Clientauth: sslClientAuthVal, Ocspstapling: ocspStaplingVal})
+		return
+	}
+	sslProfileDelete(client, confErr, vserverName)
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver.Type(), vserverName, ssl.Sslvserver{Vservername: vserverName, Snienable: sniEnable, Clientauth: sslClientAuthVal, Ocspstapling: ocspStaplingVal}, "set", "", "", ""}, nil, nil))
 }
 
 func sslFileTransfer(client *netscaler.NitroClient, fileName, fileContents string) error {
@@ -513,6 +760,10 @@ func addSSLForwardSpec(client *netscaler.NitroClient, vserverName string, forwar
 		if priority <= len(forwardObjs) {
 			continue
 		}
+		// Policies bound at the other bind points are not for SSL forwarding
+		if bindType, err := getValueString(binding, "type"); err == nil && bindType != "CLIENTHELLO_REQ" {
+			continue
+		}
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslvserver_sslpolicy_binding.Type(), vserverName, map[string]string{"vservername": vserverName, "policyname": bPolicyName, "type": "CLIENTHELLO_REQ"}, "delete", "", "", ""}, nil, nil))
 		confErr.updateError(doNitro(client, nitroConfig{netscaler.Sslpolicy.Type(), bPolicyName, nil, "delete", "", "", ""}, nil, nil))
 	}
@@ -536,7 +787,7 @@ func deleteCertBindings(client *netscaler.NitroClient, confErr *nitroError, enti
 		if certKey, err := getValueString(certBinding, "certkeyname"); err == nil {
 			if caVal, ok := certBinding["ca"]; ok && caVal == true {
 				confErr.updateError(doNitro(client, nitroConfig{bindingType, entityName, map[string]string{resourceName: entityName, "certkeyname": certKey, "ca": "true"}, "delete", "", "", ""}, nil, nil))
-
+				deleteRevocationChecks(client, confErr, certKey)
 			} else {
 				confErr.updateError(doNitro(client, nitroConfig{bindingType, entityName, map[string]string{resourceName: entityName, "certkeyname": certKey}, "delete", "", "", ""}, nil, nil))
 			}
@@ -40,6 +40,32 @@ func Test_GetSslCertkeyName(t *testing.T) {
 	}
 }
 
+func Test_getServerCommonName(t *testing.T) {
+	testCases := []struct {
+		sni                string
+		subjectAltNames    []string
+		serverAuth         bool
+		expectedSNI        string
+		expectedCommonName string
+		expectedErr        bool
+	}{
+		{"", nil, true, "", "", false},
+		{"svc1.example.com", nil, false, "svc1.example.com", "svc1.example.com", false},
+		{"svc1.example.com", []string{"svc2.example.com"}, false, "svc1.example.com", "svc1.example.com", false},
+		{"svc1.example.com", nil, true, "svc1.example.com", "svc1.example.com", false},
+		{"svc1.example.com", []string{"svc1.example.com", "svc1.example.com"}, true, "svc1.example.com", "svc1.example.com", false},
+		{"svc1.example.com", []string{"svc2.example.com", "svc1.example.com"}, true, "", "", true},
+		{"svc1.example.com", []string{"svc2.example.com"}, true, "", "svc2.example.com", false},
+		{"", []string{"svc2.example.com"}, true, "", "svc2.example.com", false},
+	}
+	for _, c := range testCases {
+		sni, commonName, err := getServerCommonName(c.sni, c.subjectAltNames, c.serverAuth)
+		if sni != c.expectedSNI || commonName != c.expectedCommonName || (err != nil) != c.expectedErr {
+			t.Errorf("FAILED!!! Expected: %s/%s/%v. Received: %s/%s/%v", c.expectedSNI, c.expectedCommonName, c.expectedErr, sni, commonName, err)
+		}
+	}
+}
+
 func Test_certOperations(t *testing.T) {
 	client := env.GetNitroClient()
 	t.Logf("Test UploadCert")
@@ -238,3 +264,90 @@ func Test_UpdateRootCABindings(t *testing.T) {
 		t.Errorf("LBApi delete failed with %v", err)
 	}
 }
+
+func Test_SSLSpec_revocationCheck(t *testing.T) {
+	client := env.GetNitroClient()
+	UploadCert(client, "../tests/certs/certssvc1/rootCA.crt", "certssvc1_rootCA", "", "")
+	crlData, _, err := env.GetCertKeyData("../tests/certs/certssvc1/rootCA.crl", "")
+	if err != nil {
+		t.Errorf("Failed reading CRL- %v", err)
+	}
+	crlFileName := GetCRLFileName(string(crlData))
+	UploadCertData(client, crlData, crlFileName, nil, "")
+	lbObj := NewLBApi("lbent1s", "HTTP", "SSL", "ROUNDROBIN")
+	lbObj.BackendTLS = []SSLSpec{{RootCertFilename: "certssvc1_rootCA", CRLFilename: crlFileName, OCSPResponderURL: "http://ocsp.citrixrootdummy1.com"}}
+	t.Logf("Test LBApi.Add with CRL and OCSP responder")
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	csObj := NewCSApi("cs2", "SSL", "2.2.1.1", 8443)
+	csObj.AllowACL = false
+	csObj.OCSPStapling = true
+	csObj.FrontendTLS = []SSLSpec{{RootCertFilename: "certssvc1_rootCA", CRL: string(crlData)}}
+	t.Logf("Test CSApi.Add with inline CRL and OCSP stapling")
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	crlName := getCRLName("certssvc1_rootCA", crlFileName)
+	responderName := getOCSPResponderName("http://ocsp.citrixrootdummy1.com")
+	configs := []env.VerifyNitroConfig{
+		{"sslcrl", crlName, map[string]interface{}{"crlname": crlName, "cacert": "certssvc1_rootCA"}},
+		{"sslocspresponder", responderName, map[string]interface{}{"name": responderName, "url": "http://ocsp.citrixrootdummy1.com", "cache": "ENABLED"}},
+		{"sslvserver", "cs2", map[string]interface{}{"vservername": "cs2", "ocspstapling": "ENABLED"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add, error %v", err)
+	}
+	err = env.VerifyBindings(client, "sslcertkey", "certssvc1_rootCA", "sslocspresponder", []map[string]interface{}{{"certkey": "certssvc1_rootCA", "ocspresponder": responderName}})
+	if err != nil {
+		t.Errorf("Config verification failed for OCSP responder binding, error %v", err)
+	}
+	err = env.VerifyBindings(client, "sslservicegroup", "lbent1s", "sslcertkey", []map[string]interface{}{{"ca": true, "certkeyname": "certssvc1_rootCA", "servicegroupname": "lbent1s", "crlcheck": "Mandatory", "ocspcheck": "Optional"}})
+	if err != nil {
+		t.Errorf("Config verification failed for Add binding %v, error %v", "lbent1s", err)
+	}
+	t.Logf("Test UpdateCRL")
+	UploadCertData(client, crlData, "certssvc1_rootCA_crl_new", nil, "")
+	UpdateCRL(client, crlFileName, "certssvc1_rootCA_crl_new")
+	newCRLName := getCRLName("certssvc1_rootCA", "certssvc1_rootCA_crl_new")
+	configs = []env.VerifyNitroConfig{
+		{"sslcrl", newCRLName, map[string]interface{}{"crlname": newCRLName, "crlpath": "/nsconfig/ssl/certssvc1_rootCA_crl_new"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for UpdateCRL, error %v", err)
+	}
+	err = env.VerifyNotPresent(client, env.VerifyNitroConfig{"sslcrl", crlName, map[string]interface{}{}})
+	if err != nil {
+		t.Errorf("Config verification failed for UpdateCRL, error %v", err)
+	}
+	t.Logf("Test LBApi.Add without OCSP responder")
+	lbObj.BackendTLS = []SSLSpec{{RootCertFilename: "certssvc1_rootCA", CRLFilename: "certssvc1_rootCA_crl_new"}}
+	err = lbObj.Add(client)
+	if err != nil {
+		t.Errorf("LBApi add failed with %v", err)
+	}
+	err = env.VerifyBindings(client, "sslservicegroup", "lbent1s", "sslcertkey", []map[string]interface{}{{"ca": true, "certkeyname": "certssvc1_rootCA", "servicegroupname": "lbent1s", "crlcheck": "Mandatory"}})
+	if err != nil {
+		t.Errorf("Config verification failed for Add binding %v, error %v", "lbent1s", err)
+	}
+	err = env.VerifyNotPresent(client, env.VerifyNitroConfig{"sslocspresponder", responderName, map[string]interface{}{}})
+	if err != nil {
+		t.Errorf("Config verification failed for OCSP responder removal, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	err = lbObj.Delete(client)
+	if err != nil {
+		t.Errorf("LBApi delete failed with %v", err)
+	}
+	err = env.VerifyNotPresent(client, env.VerifyNitroConfig{"sslcrl", newCRLName, map[string]interface{}{}})
+	if err != nil {
+		t.Errorf("Config verification failed for CRL removal, error %v", err)
+	}
+}
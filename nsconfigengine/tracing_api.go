@@ -0,0 +1,104 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/citrix/adc-nitro-go/resource/config/appflow"
+	"github.com/citrix/adc-nitro-go/resource/config/cs"
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+const (
+	// AppFlow collector of the log proxy, to which the AppFlow action of the sampled requests exports the records
+	logProxyCollectorName = "logproxy_lstreamd"
+	// AppFlow policy sampling the requests exported by the analytics profiles is the only one bound to the CS vserver
+	tracingPolicyPriority = 1
+)
+
+// tracingHeaderParams maps the request headers which can be logged in the AppFlow records, to the appflow parameters logging them
+var tracingHeaderParams = map[string]string{
+	"authorization":   "httpauthorization",
+	"via":             "httpvia",
+	"x-forwarded-for": "httpxforwardedfor",
+}
+
+// alwaysLoggedTracingHeaders are the request headers which are logged in the AppFlow records irrespective of the tracing
+var alwaysLoggedTracingHeaders = map[string]bool{"cookie": true, "referer": true}
+
+// TracingSpec specifies the distributed tracing of the requests, whose spans are exported in AppFlow records to the log proxy.
+// SamplingRate is the percentage of the requests traced. RequestHeaders are the headers logged in the records for the custom tags of
+// the spans, in addition to the URL, method, host, user agent, content type, cookie and referer of the request which are always logged
+type TracingSpec struct {
+	SamplingRate   int
+	RequestHeaders []string
+}
+
+func getTracingPolicyName(csVserverName string) string {
+	return csVserverName + "_tracing"
+}
+
+// IsTracingHeader returns true if the request header can be logged in the AppFlow records
+func IsTracingHeader(header string) bool {
+	_, ok := tracingHeaderParams[strings.ToLower(header)]
+	return ok || alwaysLoggedTracingHeaders[strings.ToLower(header)]
+}
+
+// getAppflowParams returns the appflow parameters of the tracing. Headers not in RequestHeaders are not logged. Requests of the vservers
+// are sampled by their AppFlow policies, hence all the requests exported by the analytics profiles are traced unless SamplingRate is 0
+func (tracingSpec *TracingSpec) getAppflowParams() map[string]interface{} {
+	params := map[string]interface{}{"distributedtracing": "ENABLED", "disttracingsamplingrate": 100}
+	if tracingSpec.SamplingRate == 0 {
+		params = map[string]interface{}{"distributedtracing": "DISABLED"}
+	}
+	for _, param := range tracingHeaderParams {
+		params[param] = "DISABLED"
+	}
+	for _, header := range tracingSpec.RequestHeaders {
+		if param, ok := tracingHeaderParams[strings.ToLower(header)]; ok {
+			params[param] = "ENABLED"
+		}
+	}
+	return params
+}
+
+// Update enables the distributed tracing on the Citrix-ADC, and sets the request headers logged in the AppFlow records.
+// Tracing is disabled if SamplingRate is 0
+func (tracingSpec *TracingSpec) Update(client *netscaler.NitroClient) error {
+	nsconfLogger.Trace("TracingSpec update", "tracingSpec", tracingSpec)
+	confErr := newNitroError()
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Appflowparam.Type(), "", tracingSpec.getAppflowParams(), "set", "", "", ""}, nil, nil))
+	return confErr.getError()
+}
+
+// updateVserverAnalyticsSampling adds the AppFlow policy exporting samplingRate percentage of the requests of the CS vserver by the analytics
+// profiles, or deletes it if samplingRate is 0
+func updateVserverAnalyticsSampling(client *netscaler.NitroClient, csVserverName string, analyticsProfileNames []string, samplingRate int, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverAnalyticsSampling", "samplingRate", samplingRate, "csVserver", csVserverName)
+	policyName := getTracingPolicyName(csVserverName)
+	if samplingRate == 0 || len(analyticsProfileNames) == 0 {
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_appflowpolicy_binding.Type(), csVserverName, map[string]string{"name": csVserverName, "policyname": policyName}, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Appflowpolicy.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		confErr.updateError(doNitro(client, nitroConfig{netscaler.Appflowaction.Type(), policyName, nil, "delete", "", "", ""}, []string{"No such resource"}, nil))
+		return
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Appflowaction.Type(), policyName, appflow.Appflowaction{Name: policyName, Collectors: []string{logProxyCollectorName}}, "add", "", "", ""}, nil, nil))
+	for _, profileName := range analyticsProfileNames {
+		confErr.updateError(doNitro(client, nitroConfig{"appflowaction_analyticsprofile_binding", policyName, appflow.Appflowactionanalyticsprofilebinding{Name: policyName, Analyticsprofile: profileName}, "add", "", "", ""}, []string{"Resource already exists"}, nil))
+	}
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Appflowpolicy.Type(), policyName, appflow.Appflowpolicy{Name: policyName, Rule: "SYS.RANDOM.MUL(100).LT(" + fmt.Sprint(samplingRate) + ")", Action: policyName}, "add", "", "", ""}, nil, nil))
+	confErr.updateError(doNitro(client, nitroConfig{netscaler.Csvserver_appflowpolicy_binding.Type(), csVserverName, cs.Csvserverappflowpolicybinding{Name: csVserverName, Policyname: policyName, Priority: tracingPolicyPriority, Gotopriorityexpression: "END"}, "add", "", "", ""}, nil, nil))
+}
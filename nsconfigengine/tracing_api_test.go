@@ -0,0 +1,88 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_TracingSpec_getAppflowParams(t *testing.T) {
+	cases := []struct {
+		input          TracingSpec
+		expectedOutput map[string]interface{}
+	}{
+		{TracingSpec{SamplingRate: 100}, map[string]interface{}{"distributedtracing": "ENABLED", "disttracingsamplingrate": 100, "httpauthorization": "DISABLED",
+			"httpvia": "DISABLED", "httpxforwardedfor": "DISABLED"}},
+		{TracingSpec{SamplingRate: 1, RequestHeaders: []string{"Referer", "x-forwarded-for", "x-request-id"}}, map[string]interface{}{"distributedtracing": "ENABLED",
+			"disttracingsamplingrate": 100, "httpauthorization": "DISABLED", "httpvia": "DISABLED", "httpxforwardedfor": "ENABLED"}},
+		{TracingSpec{}, map[string]interface{}{"distributedtracing": "DISABLED", "httpauthorization": "DISABLED", "httpvia": "DISABLED", "httpxforwardedfor": "DISABLED"}},
+	}
+	for _, c := range cases {
+		if output := c.input.getAppflowParams(); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %v, received %v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_TracingSpec_Update(t *testing.T) {
+	client := env.GetNitroClient()
+	tracingSpec := &TracingSpec{SamplingRate: 10, RequestHeaders: []string{"via"}}
+	t.Logf("Test TracingSpec Update")
+	if err := tracingSpec.Update(client); err != nil {
+		t.Errorf("TracingSpec update failed with %v", err)
+	}
+	appflowParams, err := client.FindResource("appflowparam", "")
+	if err != nil {
+		t.Errorf("Could not find appflowparam: %v", err)
+	} else if appflowParams["httpvia"] != "ENABLED" || appflowParams["httpauthorization"] != "DISABLED" {
+		t.Errorf("Unexpected appflowparam %v", appflowParams)
+	}
+}
+
+func Test_CSApi_analyticsSampling(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("cstracing", "HTTP", "2.2.1.8", 80)
+	csObj.AnalyticsProfileNames = []string{"ns_analytics_default_http_profile"}
+	csObj.AnalyticsSamplingRate = 10
+	t.Logf("Test CSApi Add with sampled analytics profiles")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"appflowaction", "cstracing_tracing", map[string]interface{}{"name": "cstracing_tracing"}},
+		{"appflowpolicy", "cstracing_tracing", map[string]interface{}{"name": "cstracing_tracing", "rule": "SYS.RANDOM.MUL(100).LT(10)", "action": "cstracing_tracing"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add cstracing, error %v", err)
+	}
+	t.Logf("Test CSApi Update with all the requests exported")
+	csObj.AnalyticsSamplingRate = 0
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale sampling of cstracing, error %v", err)
+	}
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+}
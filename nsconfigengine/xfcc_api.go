@@ -0,0 +1,86 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"strings"
+
+	netscaler "github.com/citrix/adc-nitro-go/service"
+)
+
+const (
+	// Rewrite policy label setting the x-forwarded-client-cert header is invoked after those copying the authorization response and JWT claim headers
+	xfccInvokePriority = 3
+	xfccHeader         = "x-forwarded-client-cert"
+	// clientCertPresentRule is true if the client presented a certificate in the TLS handshake
+	clientCertPresentRule = "CLIENT.SSL.CLIENT_CERT.EXISTS"
+	// clientCertHashExpr is the SHA256 digest of the DER encoded client certificate, decoded from its PEM encoding
+	clientCertHashExpr = "CLIENT.SSL.CLIENT_CERT.TO_PEM.AFTER_STR(\"-----BEGIN CERTIFICATE-----\").BEFORE_STR(\"-----END CERTIFICATE-----\").REGEX_REPLACE(re/\\s/, \"\", ALL).B64DECODE.SHA256"
+	// clientCertSubjectExpr is the Subject of the client certificate, with the double quotes in it escaped to be set as a quoted XFCC value
+	clientCertSubjectExpr = "CLIENT.SSL.CLIENT_CERT.SUBJECT.REGEX_REPLACE(re/\"/, \"\\\\\\\"\", ALL)"
+)
+
+// ForwardClientCertSpec specifies the handling of the x-forwarded-client-cert (XFCC) header in the requests of a CS vserver.
+// Mode is one of SANITIZE, FORWARD_ONLY, APPEND_FORWARD, SANITIZE_SET and ALWAYS_FORWARD_ONLY, as in Envoy's forward_client_cert_details.
+// Except in ALWAYS_FORWARD_ONLY mode, the header is removed from the requests of clients which did not present a certificate.
+// Details of the client certificate set by APPEND_FORWARD and SANITIZE_SET modes are the Hash of the certificate, along with its
+// quoted Subject and URI subject alternative name if set
+type ForwardClientCertSpec struct {
+	Mode    string
+	Subject bool
+	URI     bool
+}
+
+func getXFCCLabelName(csVserverName string) string {
+	return csVserverName + "_xfcc"
+}
+
+// getDetailsExpr returns the expression of the details of the client certificate, in the format of the elements of the XFCC header
+func (xfccSpec *ForwardClientCertSpec) getDetailsExpr() string {
+	details := []string{"\"Hash=\" + " + clientCertHashExpr}
+	if xfccSpec.Subject {
+		details = append(details, "\";Subject=\\\"\" + "+clientCertSubjectExpr+" + \"\\\"\"")
+	}
+	if xfccSpec.URI {
+		details = append(details, "\";URI=\" + "+ClientCertURISANExpr)
+	}
+	return strings.Join(details, " + ")
+}
+
+// getXFCCHeaders returns the XFCC header to be set by the rewrite policy label, if the header is to be modified in the mode
+func (xfccSpec *ForwardClientCertSpec) getXFCCHeaders() []requestHeader {
+	switch xfccSpec.Mode {
+	case "ALWAYS_FORWARD_ONLY":
+		return nil
+	case "FORWARD_ONLY":
+		return []requestHeader{{name: xfccHeader, removeRule: "!" + clientCertPresentRule}}
+	case "APPEND_FORWARD":
+		return []requestHeader{{name: xfccHeader, presenceRule: clientCertPresentRule, valueExpr: xfccSpec.getDetailsExpr(), appendValue: true, removeRule: "!" + clientCertPresentRule}}
+	case "SANITIZE_SET":
+		return []requestHeader{{name: xfccHeader, presenceRule: clientCertPresentRule, valueExpr: xfccSpec.getDetailsExpr(), removeRule: "!" + clientCertPresentRule}}
+	}
+	return []requestHeader{{name: xfccHeader, removeRule: "true"}}
+}
+
+// updateVserverForwardClientCertSpec adds the rewrite policy label setting the XFCC header of the requests of the CS vserver, or deletes it if xfccSpec is nil
+func updateVserverForwardClientCertSpec(client *netscaler.NitroClient, csVserverName string, xfccSpec *ForwardClientCertSpec, confErr *nitroError) {
+	nsconfLogger.Trace("updateVserverForwardClientCertSpec", "xfccSpec", xfccSpec, "csVserver", csVserverName)
+	labelName := getXFCCLabelName(csVserverName)
+	if xfccSpec == nil {
+		headersLabelDelete(client, confErr, csVserverName, labelName, authzPolicyStartPriority)
+		return
+	}
+	// Label is deleted if the mode does not modify the header
+	headersLabelAdd(client, confErr, csVserverName, labelName, xfccInvokePriority, xfccSpec.getXFCCHeaders())
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 Citrix Systems, Inc
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nsconfigengine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/citrix/citrix-xds-adaptor/tests/env"
+)
+
+func Test_ForwardClientCertSpec_getXFCCHeaders(t *testing.T) {
+	hashExpr := "\"Hash=\" + CLIENT.SSL.CLIENT_CERT.TO_PEM.AFTER_STR(\"-----BEGIN CERTIFICATE-----\").BEFORE_STR(\"-----END CERTIFICATE-----\").REGEX_REPLACE(re/\\s/, \"\", ALL).B64DECODE.SHA256"
+	detailsExpr := hashExpr + " + \";Subject=\\\"\" + CLIENT.SSL.CLIENT_CERT.SUBJECT.REGEX_REPLACE(re/\"/, \"\\\\\\\"\", ALL) + \"\\\"\"" +
+		" + \";URI=\" + CLIENT.SSL.CLIENT_CERT.SUBJECT_ALT_NAME.REGEX_SELECT(re/URI:[^,]+/).AFTER_STR(\"URI:\")"
+	cases := []struct {
+		input          ForwardClientCertSpec
+		expectedOutput []requestHeader
+	}{
+		{ForwardClientCertSpec{}, []requestHeader{{name: "x-forwarded-client-cert", removeRule: "true"}}},
+		{ForwardClientCertSpec{Mode: "SANITIZE", Subject: true}, []requestHeader{{name: "x-forwarded-client-cert", removeRule: "true"}}},
+		{ForwardClientCertSpec{Mode: "ALWAYS_FORWARD_ONLY"}, nil},
+		{ForwardClientCertSpec{Mode: "FORWARD_ONLY"}, []requestHeader{{name: "x-forwarded-client-cert", removeRule: "!CLIENT.SSL.CLIENT_CERT.EXISTS"}}},
+		{ForwardClientCertSpec{Mode: "APPEND_FORWARD", Subject: true, URI: true}, []requestHeader{{name: "x-forwarded-client-cert", presenceRule: "CLIENT.SSL.CLIENT_CERT.EXISTS",
+			valueExpr: detailsExpr, appendValue: true, removeRule: "!CLIENT.SSL.CLIENT_CERT.EXISTS"}}},
+		{ForwardClientCertSpec{Mode: "SANITIZE_SET"}, []requestHeader{{name: "x-forwarded-client-cert", presenceRule: "CLIENT.SSL.CLIENT_CERT.EXISTS",
+			valueExpr: hashExpr, removeRule: "!CLIENT.SSL.CLIENT_CERT.EXISTS"}}},
+	}
+	for _, c := range cases {
+		if output := c.input.getXFCCHeaders(); !reflect.DeepEqual(output, c.expectedOutput) {
+			t.Errorf("Expected %+v, received %+v", c.expectedOutput, output)
+		}
+	}
+}
+
+func Test_CSApi_forwardClientCert(t *testing.T) {
+	client := env.GetNitroClient()
+	csObj := NewCSApi("csxfcc", "HTTP", "2.2.1.5", 80)
+	csObj.ForwardClientCert = &ForwardClientCertSpec{Mode: "APPEND_FORWARD", Subject: true, URI: true}
+	t.Logf("Test CSApi Add with XFCC append forward mode")
+	err := csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs := []env.VerifyNitroConfig{
+		{"rewritepolicylabel", "csxfcc_xfcc", map[string]interface{}{"labelname": "csxfcc_xfcc"}},
+		{"rewriteaction", "csxfcc_xfcc_10", map[string]interface{}{"name": "csxfcc_xfcc_10", "type": "replace"}},
+		{"rewriteaction", "csxfcc_xfcc_20", map[string]interface{}{"name": "csxfcc_xfcc_20", "type": "insert_http_header"}},
+		{"rewriteaction", "csxfcc_xfcc_30", map[string]interface{}{"name": "csxfcc_xfcc_30", "type": "delete_http_header"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Add csxfcc, error %v", err)
+	}
+	t.Logf("Test CSApi Update with XFCC sanitize mode")
+	csObj.ForwardClientCert.Mode = "SANITIZE"
+	err = csObj.Add(client)
+	if err != nil {
+		t.Errorf("CSApi add failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"rewriteaction", "csxfcc_xfcc_10", map[string]interface{}{"name": "csxfcc_xfcc_10", "type": "delete_http_header"}},
+	}
+	err = env.VerifyConfigBlockPresence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Update csxfcc, error %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"rewriteaction", "csxfcc_xfcc_20", map[string]interface{}{"name": "csxfcc_xfcc_20"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for stale XFCC policies of csxfcc, error %v", err)
+	}
+	t.Logf("Test CSApi Delete with XFCC")
+	err = csObj.Delete(client)
+	if err != nil {
+		t.Errorf("CSApi delete failed with %v", err)
+	}
+	configs = []env.VerifyNitroConfig{
+		{"rewritepolicylabel", "csxfcc_xfcc", map[string]interface{}{"labelname": "csxfcc_xfcc"}},
+		{"rewriteaction", "csxfcc_xfcc_10", map[string]interface{}{"name": "csxfcc_xfcc_10"}},
+	}
+	err = env.VerifyConfigBlockAbsence(client, configs)
+	if err != nil {
+		t.Errorf("Config verification failed for Delete csxfcc, error %v", err)
+	}
+}
@@ -21,7 +21,11 @@ openssl genrsa -out tests/certs/certssvc1/svc1.citrixrootdummy1.com.key 2048
 openssl req -new -sha256 -key tests/certs/certssvc1/svc1.citrixrootdummy1.com.key -subj "/C=AU/ST=Some-State/O=Internet Widgits Pty Ltd/CN=svc1.citrixrootdummy1.com" -out tests/certs/certssvc1/svc1.citrixrootdummy1.com.csr
 openssl x509 -req -in tests/certs/certssvc1/svc1.citrixrootdummy1.com.csr -CA tests/certs/certssvc1/rootCA.crt -CAkey tests/certs/certssvc1/rootCA.key -CAcreateserial -out tests/certs/certssvc1/svc1.citrixrootdummy1.com.crt -sha256
 
-rm -f tests/certs/certssvc1/svc1.citrixrootdummy1.com.csr tests/certs/certssvc1/rootCA.srl tests/certs/certssvc1/rootCA.key tests/certs/certssvc1/rootCA.csr
+touch tests/certs/certssvc1/index.txt
+printf "[ca]\ndefault_ca=crlca\n[crlca]\ndatabase=tests/certs/certssvc1/index.txt\ndefault_md=sha256\ndefault_crl_days=365\n" > tests/certs/certssvc1/crl.cnf
+openssl ca -gencrl -config tests/certs/certssvc1/crl.cnf -cert tests/certs/certssvc1/rootCA.crt -keyfile tests/certs/certssvc1/rootCA.key -out tests/certs/certssvc1/rootCA.crl
+
+rm -f tests/certs/certssvc1/svc1.citrixrootdummy1.com.csr tests/certs/certssvc1/rootCA.srl tests/certs/certssvc1/rootCA.key tests/certs/certssvc1/rootCA.csr tests/certs/certssvc1/index.txt* tests/certs/certssvc1/crl.cnf
 
 openssl genrsa -out tests/certs/certssvc1/new_rootCA.key 4096
 openssl req -new -key tests/certs/certssvc1/new_rootCA.key -out tests/certs/certssvc1/new_rootCA.csr -subj "/C=AU/ST=Some-State/O=Internet Widgits Pty Ltd/CN=citrixrootdummy1.com"